@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"io"
+	"os"
 
 	"github.com/nmramorov/gowatcher/internal/log"
 	"github.com/nmramorov/gowatcher/internal/server"
@@ -10,9 +12,73 @@ import (
 func main() {
 	ctx := context.Background()
 
+	// server migrate [up | down [N] | status] [флаги сервера]
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		action, steps, flags, err := server.ParseMigrateArgs(os.Args[2:])
+		if err == nil {
+			os.Args = append(os.Args[:1], flags...)
+			err = server.Migrate(ctx, action, steps, os.Stdout)
+		}
+		if err != nil {
+			log.ErrorLog.Printf("migration failed: %e", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	// server export|import [ndjson|csv] [-history] [-from T] [-to T] [-file PATH] [флаги сервера]
+	if len(os.Args) > 1 && (os.Args[1] == "export" || os.Args[1] == "import") {
+		if err := transferMetrics(ctx, os.Args[1], os.Args[2:]); err != nil {
+			log.ErrorLog.Printf("%s failed: %e", os.Args[1], err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	server := server.Server{}
 	err := server.Run(ctx)
 	if err != nil {
 		log.ErrorLog.Printf("internal error launching server: %e", err)
 	}
 }
+
+// Функция, выполняющая команду export или import. Выгрузка пишется в stdout и читается из stdin,
+// если не задан файл -file. Информационные сообщения выводятся в stderr, чтобы не смешиваться с выгрузкой.
+func transferMetrics(ctx context.Context, command string, args []string) (err error) {
+	opts, flags, err := server.ParseTransferArgs(args)
+	if err != nil {
+		return err
+	}
+	os.Args = append(os.Args[:1], flags...)
+	log.InfoLog.SetOutput(os.Stderr)
+	if command == "export" {
+		var out io.Writer = os.Stdout
+		if opts.File != "" {
+			file, err := os.Create(opts.File)
+			if err != nil {
+				return err
+			}
+			defer func() {
+				if closeErr := file.Close(); err == nil {
+					err = closeErr
+				}
+			}()
+			out = file
+		}
+		return server.Export(ctx, opts, out)
+	}
+	var in io.Reader = os.Stdin
+	if opts.File != "" {
+		file, err := os.Open(opts.File)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			if closeErr := file.Close(); closeErr != nil {
+				log.ErrorLog.Printf("error closing %s: %e", opts.File, closeErr)
+			}
+		}()
+		in = file
+	}
+	return server.Import(ctx, opts, in, os.Stdout)
+}
@@ -6,89 +6,88 @@ import (
 	"crypto/hmac"
 	"encoding/hex"
 	"encoding/json"
+	stdErrors "errors"
 	"html/template"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
 	_ "net/http/pprof" //nolint:gosec
 
 	middleware "github.com/nmramorov/gowatcher/internal/api/middlewares"
-	val "github.com/nmramorov/gowatcher/internal/api/validators"
 	col "github.com/nmramorov/gowatcher/internal/collector"
 	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
-	"github.com/nmramorov/gowatcher/internal/db"
 	"github.com/nmramorov/gowatcher/internal/errors"
 	"github.com/nmramorov/gowatcher/internal/hashgen"
 	"github.com/nmramorov/gowatcher/internal/log"
 	sec "github.com/nmramorov/gowatcher/internal/security"
+	"github.com/nmramorov/gowatcher/internal/storage"
 )
 
 var (
-	GAUGE   = "gauge"
-	COUNTER = "counter"
+	GAUGE     = "gauge"
+	COUNTER   = "counter"
+	HISTOGRAM = "histogram"
+	SUMMARY   = "summary"
+	SET       = "set"
+
+	// Заголовок ответа /value/, которым помечается давно не обновлявшаяся серия.
+	StaleHeader = "X-Metric-Stale"
+
+	// Интервал истории по умолчанию и шаги, из которых выбирается шаг по умолчанию:
+	// наименьший, при котором число точек не превышает допустимое.
+	DefaultHistoryRange = time.Hour
+	HistorySteps        = []time.Duration{time.Minute, time.Hour, 24 * time.Hour}
 )
 
 // Базовый тип Handler, отвечающий за обработку запросов.
+// Все чтения и записи метрик проходят через Storage, коллектор служит реестром описаний метрик.
 type Handler struct {
 	*chi.Mux
 	Collector      *col.Collector
+	Storage        storage.Storage
 	Secretkey      string
 	privateKeyPath string
 	TrustedSubnet  string
-	Cursor         *db.Cursor
+	otlp           *otlpCumulative
+	influx         sync.Mutex
 }
 
-// Конструктор для объектов типа Handler.
-func NewHandler(key, privateKeyPath, trustedSubnet string, newCursor *db.Cursor) *Handler {
+// Конструктор для объектов типа Handler. Хранилище должно работать поверх того же коллектора.
+func NewHandler(key, privateKeyPath, trustedSubnet string, collector *col.Collector, store storage.Storage) *Handler {
 	h := &Handler{
 		Mux:            chi.NewMux(),
-		Collector:      col.NewCollector(),
+		Collector:      collector,
+		Storage:        store,
 		Secretkey:      key,
-		Cursor:         newCursor,
-		privateKeyPath: privateKeyPath,
-		TrustedSubnet:  trustedSubnet,
-	}
-	h.Use(middleware.GzipHandle)
-	h.Use(h.DecodeMessage)
-	h.Use(h.ValidateIP)
-	h.Get("/", h.ListMetricsHTML)
-	h.Get("/ping", h.HandlePing)
-	h.Get("/value/{type}/{name}", h.GetMetricByTypeAndName)
-	h.Post("/update/{type}/{name}/{value}", h.UpdateMetric)
-	h.Post("/update/", h.UpdateMetricsJSON)
-	h.Post("/value/", h.GetMetricByJSON)
-	h.Post("/updates/", h.UpdateJSONBatch)
-
-	return h
-}
-
-// Конструктор Handler, который инициализируется с записанными ранее данными Metrics.
-func NewHandlerFromSavedData(saved *m.Metrics, secretkey, privateKeyPath, trustedSubnet string,
-	cursor *db.Cursor,
-) *Handler {
-	h := &Handler{
-		Mux:            chi.NewMux(),
-		Collector:      col.NewCollectorFromSavedFile(saved),
-		Secretkey:      secretkey,
-		Cursor:         cursor,
 		privateKeyPath: privateKeyPath,
 		TrustedSubnet:  trustedSubnet,
+		otlp:           newOTLPCumulative(),
 	}
 	h.Use(middleware.GzipHandle)
 	h.Use(h.DecodeMessage)
 	h.Use(h.ValidateIP)
 	h.Get("/", h.ListMetricsHTML)
 	h.Get("/ping", h.HandlePing)
+	h.Get("/metrics", h.PrometheusMetrics)
 	h.Get("/value/{type}/{name}", h.GetMetricByTypeAndName)
+	h.Get("/history/{type}/{name}", h.GetHistory)
 	h.Post("/update/{type}/{name}/{value}", h.UpdateMetric)
 	h.Post("/update/", h.UpdateMetricsJSON)
 	h.Post("/value/", h.GetMetricByJSON)
 	h.Post("/updates/", h.UpdateJSONBatch)
+	h.Post("/write", h.WriteInflux)
+	h.Post("/v1/metrics", h.ReceiveOTLP)
+	h.Get("/metadata/", h.ListMetadata)
+	h.Get("/metadata/{name}", h.GetMetadata)
+	h.Post("/metadata/", h.DeclareMetadata)
 
 	return h
 }
@@ -164,6 +163,18 @@ func (h *Handler) CheckHash(metricData *m.JSONMetrics) error {
 		hash = generator.GenerateHash(metricData.MType, metricData.ID, *metricData.Value)
 	case COUNTER:
 		hash = generator.GenerateHash(metricData.MType, metricData.ID, *metricData.Delta)
+	case HISTOGRAM:
+		if metricData.Histogram != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Histogram.String())
+		}
+	case SUMMARY:
+		if metricData.Summary != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Summary.String())
+		}
+	case SET:
+		if metricData.Set != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Set.String())
+		}
 	}
 	d, _ := hex.DecodeString(hash)
 	if hmac.Equal(d, []byte(metricData.Hash)) {
@@ -181,6 +192,18 @@ func (h *Handler) getHash(metricData *m.JSONMetrics) string {
 		hash = generator.GenerateHash(metricData.MType, metricData.ID, *metricData.Value)
 	case COUNTER:
 		hash = generator.GenerateHash(metricData.MType, metricData.ID, *metricData.Delta)
+	case HISTOGRAM:
+		if metricData.Histogram != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Histogram.String())
+		}
+	case SUMMARY:
+		if metricData.Summary != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Summary.String())
+		}
+	case SET:
+		if metricData.Set != nil {
+			hash = generator.GenerateHash(metricData.MType, metricData.ID, metricData.Set.String())
+		}
 	}
 	return hash
 }
@@ -199,15 +222,11 @@ func (h *Handler) UpdateMetricsJSON(rw http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	updatedData, err := h.Collector.UpdateMetricFromJSON(&metricData)
+	updatedData, err := h.Storage.Update(r.Context(), &metricData)
 	if err != nil {
 		log.ErrorLog.Printf("Error occurred during metric update from json: %e", err)
-	}
-	if h.Cursor.IsValid {
-		err = h.Cursor.Add(r.Context(), updatedData)
-		if err != nil {
-			log.ErrorLog.Println("could not add data to db...")
-		}
+		http.Error(rw, err.Error(), UpdateErrorStatus(err))
+		return
 	}
 
 	updatedData.Hash = h.getHash(updatedData)
@@ -232,19 +251,13 @@ func (h *Handler) GetMetricByJSON(rw http.ResponseWriter, r *http.Request) {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
-	var metric *m.JSONMetrics
-	var err error
-	if h.Cursor.IsValid {
-		metric, err = h.Cursor.Get(r.Context(), &metricData)
-		if err != nil {
-			log.ErrorLog.Println("could not get data from db...")
-		}
+	metric, err := h.Storage.Get(r.Context(), &metricData)
+	if stdErrors.Is(err, errors.ErrorRateWindow) {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
 	}
-	if metric == nil {
-		metric, err = h.Collector.GetMetricJSON(&metricData)
-		if err != nil {
-			log.ErrorLog.Printf("Error occurred during metric getting from json: %e", err)
-		}
+	if err != nil {
+		log.ErrorLog.Printf("Error occurred during metric getting from json: %e", err)
 	}
 	var hash string
 	if h.Secretkey != "" {
@@ -264,30 +277,221 @@ func (h *Handler) GetMetricByJSON(rw http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// Deprecated: метод был создан для первых инкрементов, в настоящее время не используется.
+// Функция, разбирающая условия на метки из параметров запроса вида label=host:a.
+func ParseLabelMatchers(values []string) (map[string]string, error) {
+	if len(values) == 0 {
+		return nil, nil
+	}
+	matchers := make(map[string]string, len(values))
+	for _, value := range values {
+		name, labelValue, found := strings.Cut(value, ":")
+		if !found || name == "" {
+			return nil, errors.ErrorLabelMatcher
+		}
+		matchers[name] = labelValue
+	}
+	return matchers, nil
+}
+
+// Функция, разбирающая запрошенные уровни квантилей из параметров запроса вида quantile=0.99.
+func ParseQuantiles(values []string) ([]float64, error) {
+	quantiles := make([]float64, 0, len(values))
+	for _, value := range values {
+		q, err := strconv.ParseFloat(value, 64)
+		if err != nil || q < 0 || q > 1 {
+			return nil, errors.ErrorQuantile
+		}
+		quantiles = append(quantiles, q)
+	}
+	return quantiles, nil
+}
+
+// Функция, формирующая текстовый ответ со значениями квантилей скетча.
+// Единственный запрошенный квантиль возвращается числом, несколько — строками "уровень значение".
+func formatQuantiles(summary *m.Summary, levels []float64) string {
+	quantiles := summary.Quantiles(levels)
+	if len(levels) == 1 {
+		return strconv.FormatFloat(quantiles[0].Value, 'f', -1, 64)
+	}
+	lines := make([]string, 0, len(quantiles))
+	for _, q := range quantiles {
+		lines = append(lines, strconv.FormatFloat(q.Quantile, 'f', -1, 64)+" "+strconv.FormatFloat(q.Value, 'f', -1, 64))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Функция, формирующая текстовый ответ /value/ для найденной серии.
+// Для counter с параметром rate или increase возвращается прирост за окно, для summary — квантили,
+// для set — оценка числа уникальных элементов.
+func formatValue(metric *m.JSONMetrics, query url.Values, levels []float64) (string, error) {
+	switch metric.MType {
+	case GAUGE:
+		return strconv.FormatFloat(*metric.Value, 'f', -1, 64), nil
+	case COUNTER:
+		if query.Has("rate") {
+			if metric.Rate == nil {
+				return "", errors.ErrorRateWindow
+			}
+			return strconv.FormatFloat(*metric.Rate, 'f', -1, 64), nil
+		}
+		if query.Has("increase") {
+			if metric.Increase == nil {
+				return "", errors.ErrorRateWindow
+			}
+			return strconv.FormatFloat(*metric.Increase, 'f', -1, 64), nil
+		}
+		return strconv.FormatInt(*metric.Delta, 10), nil
+	case HISTOGRAM:
+		return metric.Histogram.String(), nil
+	case SUMMARY:
+		return formatQuantiles(metric.Summary, levels), nil
+	case SET:
+		return strconv.FormatUint(*metric.Estimate, 10), nil
+	}
+	return "", errors.ErrorWrongStringConvertion
+}
+
+// Метод, возвращающий значение серии текстом по запросам вида /value/{type}/{name}?label=host:a.
 func (h *Handler) GetMetricByTypeAndName(rw http.ResponseWriter, r *http.Request) {
-	metricType := chi.URLParam(r, "type")
-	metricName := chi.URLParam(r, "name")
-	isValid := val.ValidateMetric(metricType, metricName, h.Collector)
-	if isValid {
-		metric, err := h.Collector.GetMetric(metricName)
-		if err != nil {
-			http.Error(rw, "Metric not found", http.StatusNotFound)
+	query := r.URL.Query()
+	matchers, err := ParseLabelMatchers(query["label"])
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	requested := &m.JSONMetrics{
+		ID:     chi.URLParam(r, "name"),
+		MType:  chi.URLParam(r, "type"),
+		Labels: matchers,
+	}
+	var levels []float64
+	switch requested.MType {
+	case SUMMARY:
+		if levels, err = ParseQuantiles(query["quantile"]); err != nil {
+			http.Error(rw, err.Error(), http.StatusBadRequest)
 			return
 		}
-		payload, err := h.Collector.String(metric)
-		if err != nil {
-			http.Error(rw, "Decoding error", http.StatusInternalServerError)
-			return
+		for _, level := range levels {
+			requested.Quantiles = append(requested.Quantiles, m.Quantile{Quantile: level})
+		}
+	case COUNTER:
+		if query.Has("rate") {
+			requested.Window = query.Get("rate")
+		} else if query.Has("increase") {
+			requested.Window = query.Get("increase")
 		}
+		if query.Has("rate") || query.Has("increase") {
+			if _, err = col.ParseRateWindow(requested.Window); err != nil {
+				http.Error(rw, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	metric, err := h.Storage.Get(r.Context(), requested)
+	if stdErrors.Is(err, errors.ErrorRateWindow) {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(rw, "Metric not found", http.StatusNotFound)
+		return
+	}
+	payload, err := formatValue(metric, query, levels)
+	if stdErrors.Is(err, errors.ErrorRateWindow) {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(rw, "Decoding error", http.StatusInternalServerError)
+		return
+	}
+	if metric.Stale {
+		rw.Header().Set(StaleHeader, "true")
+	}
+	_, err = rw.Write([]byte(payload))
+	if err != nil {
+		log.ErrorLog.Printf("error writing data to get metrics by type and name request: %e", err)
+	}
+}
 
-		_, err = rw.Write([]byte(payload))
-		if err != nil {
-			log.ErrorLog.Printf("error writing data to get metrics by type and name request: %e", err)
+// Функция, разбирающая момент времени из параметра запроса: миллисекунды Unix или RFC3339.
+// Пустое значение заменяется значением по умолчанию.
+func ParseHistoryTime(value string, fallback time.Time) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+	parsed, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.ErrorHistoryRange
+	}
+	return parsed, nil
+}
+
+// Функция, разбирающая параметры from, to и step запроса истории.
+// По умолчанию возвращается последний час, шаг выбирается по длине интервала.
+func ParseHistoryRange(query url.Values, now time.Time) (time.Time, time.Time, time.Duration, error) {
+	to, err := ParseHistoryTime(query.Get("to"), now)
+	if err != nil {
+		return to, to, 0, err
+	}
+	from, err := ParseHistoryTime(query.Get("from"), to.Add(-DefaultHistoryRange))
+	if err != nil {
+		return from, to, 0, err
+	}
+	var step time.Duration
+	if query.Has("step") {
+		if step, err = time.ParseDuration(query.Get("step")); err != nil {
+			return from, to, 0, errors.ErrorHistoryRange
 		}
 	} else {
-		http.Error(rw, "Metric not found", http.StatusNotFound)
+		for _, step = range HistorySteps {
+			if to.Sub(from)/step <= m.MaxHistoryPoints {
+				break
+			}
+		}
+	}
+	return from, to, step, m.ValidateHistoryRange(from, to, step)
+}
+
+// Метод, возвращающий историю серии gauge или counter по запросам вида
+// /history/{type}/{name}?from=&to=&step=1m&label=host:a. Точки выровнены по шагу
+// и содержат среднее, минимум, максимум и последнее значение интервала.
+func (h *Handler) GetHistory(rw http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	requested := &m.JSONMetrics{ID: chi.URLParam(r, "name"), MType: chi.URLParam(r, "type")}
+	if requested.MType != GAUGE && requested.MType != COUNTER {
+		http.Error(rw, "History is supported for gauge and counter only", http.StatusBadRequest)
+		return
+	}
+	var err error
+	if requested.Labels, err = ParseLabelMatchers(query["label"]); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	from, to, step, err := ParseHistoryRange(query, time.Now())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reader, ok := h.Storage.(storage.HistoryReader)
+	if !ok {
+		http.Error(rw, errors.ErrorHistoryUnavailable.Error(), http.StatusNotImplemented)
+		return
+	}
+	points, err := reader.History(r.Context(), requested, from, to, step)
+	if stdErrors.Is(err, errors.ErrorHistoryUnavailable) {
+		http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		log.ErrorLog.Printf("could not read history of %s: %e", requested.ID, err)
+		http.Error(rw, "History error", http.StatusInternalServerError)
+		return
 	}
+	h.writeJSON(rw, points)
 }
 
 // Deprecated: метод был создан для первых инкрементов, в настоящее время не используется.
@@ -310,6 +514,7 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	metricType, metricName, metricValue := args[2], args[3], args[4]
+	newMetric := &m.JSONMetrics{ID: metricName, MType: metricType}
 	switch metricType {
 	case "gauge":
 		newMetricValue, err := strconv.ParseFloat(metricValue, 64)
@@ -317,7 +522,7 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Wrong Gauge value", http.StatusBadRequest)
 			return
 		}
-		h.Collector.Metrics.GaugeMetrics[metricName] = m.Gauge(newMetricValue)
+		newMetric.Value = &newMetricValue
 
 	case "counter":
 		newMetricValue, err := strconv.ParseInt(metricValue, 10, 64)
@@ -325,12 +530,15 @@ func (h *Handler) UpdateMetric(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Wrong Counter value", http.StatusBadRequest)
 			return
 		}
-		newValue := h.Collector.Metrics.CounterMetrics[metricName] + m.Counter(newMetricValue)
-		h.Collector.Metrics.CounterMetrics[metricName] = newValue
+		newMetric.Delta = &newMetricValue
 	default:
 		http.Error(w, "Wrong metric type", http.StatusNotImplemented)
 		return
 	}
+	if _, err := h.Storage.Update(r.Context(), newMetric); err != nil {
+		http.Error(w, err.Error(), UpdateErrorStatus(err))
+		return
+	}
 	_, err := w.Write([]byte(`{"status":"ok"}`))
 	if err != nil {
 		log.ErrorLog.Printf("error writing data to non-JSON update request: %e", err)
@@ -342,36 +550,42 @@ func (h *Handler) ListMetricsHTML(w http.ResponseWriter, r *http.Request) {
 	t := template.Must(template.New("").Parse(`
 	<strong>Gauge Metrics:</strong>\n {{range $key, $val := .GaugeMetrics}} {{$key}} = {{$val}}\n {{end}}
 	<strong>Counter Metrics:</strong>\n {{range $key, $val := .CounterMetrics}} {{$key}} = {{$val}}\n {{end}}
+	<strong>Metadata:</strong>\n {{range $key, $val := .Metadata}} {{$key}} ({{$val.MType}}{{if $val.Unit}}, {{$val.Unit}}{{end}}){{if $val.Help}}: {{$val.Help}}{{end}}{{if $val.Owner}} [{{$val.Owner}}]{{end}}\n {{end}}
 	`))
+	snapshot, err := h.Storage.Snapshot(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/html")
-	err := t.Execute(w, h.Collector.Metrics)
+	err = t.Execute(w, snapshot)
 	if err != nil {
 		log.ErrorLog.Printf("error getting HTML list of metrics: %e", err)
 	}
 }
 
-// Вспомогательный метод для получения метрик из коллектора.
-func (h *Handler) GetCurrentMetrics() *m.Metrics {
-	return h.Collector.Metrics
+// Вспомогательный метод для получения снимка метрик из хранилища.
+func (h *Handler) GetCurrentMetrics(ctx context.Context) (*m.Metrics, error) {
+	return h.Storage.Snapshot(ctx)
 }
 
-// Метод для проверки соединения с БД.
+// Метод, удаляющий серии, не обновлявшиеся дольше срока устаревания, вместе с состоянием их потоков OTLP.
+// Потоки серий, удалённых хранилищем раньше, например при записи снимка, тоже забываются.
+func (h *Handler) EvictStale(now time.Time) []string {
+	evicted := h.Collector.EvictStale(now)
+	h.otlp.forget(h.Collector.HasSeries)
+	return evicted
+}
+
+// Метод для проверки доступности хранилища.
 func (h *Handler) HandlePing(w http.ResponseWriter, r *http.Request) {
-	err := h.Cursor.Ping(r.Context())
+	err := h.Storage.Ping(r.Context())
 	if err != nil {
 		http.Error(w, "error with db", http.StatusInternalServerError)
 		return
 	}
 }
 
-// Метод, инициализирующий БД.
-func (h *Handler) InitDB(parent context.Context) error {
-	ctx, cancel := context.WithTimeout(parent, db.DBDefaultTimeout)
-	defer cancel()
-
-	return h.Cursor.InitDB(ctx)
-}
-
 // Метод, позволяющий обновить несколько метрик за раз.
 func (h *Handler) UpdateJSONBatch(rw http.ResponseWriter, r *http.Request) {
 	var metricsBatch []*m.JSONMetrics
@@ -379,18 +593,11 @@ func (h *Handler) UpdateJSONBatch(rw http.ResponseWriter, r *http.Request) {
 		http.Error(rw, err.Error(), http.StatusBadRequest)
 		return
 	}
-	err := h.Collector.UpdateBatch(metricsBatch)
+	_, err := h.Storage.UpdateBatch(r.Context(), metricsBatch)
 	if err != nil {
-		http.Error(rw, err.Error(), http.StatusBadRequest)
+		http.Error(rw, err.Error(), UpdateErrorStatus(err))
 		return
 	}
-	if h.Cursor.IsValid {
-		err = h.Cursor.AddBatchV2(r.Context(), metricsBatch)
-		if err != nil {
-			http.Error(rw, err.Error(), http.StatusInternalServerError)
-			return
-		}
-	}
 	buf := bytes.NewBuffer([]byte{})
 	encoder := json.NewEncoder(buf)
 	err = encoder.Encode(metricsBatch)
@@ -405,3 +612,56 @@ func (h *Handler) UpdateJSONBatch(rw http.ResponseWriter, r *http.Request) {
 		return
 	}
 }
+
+// Функция, выбирающая HTTP-статус для ошибки обновления метрики.
+// Конфликт с зарегистрированным типом или более новым наблюдением отличается от некорректного запроса.
+func UpdateErrorStatus(err error) int {
+	if stdErrors.Is(err, errors.ErrorTypeConflict) || stdErrors.Is(err, errors.ErrorLateSample) {
+		return http.StatusConflict
+	}
+	return http.StatusBadRequest
+}
+
+// Метод, регистрирующий описание метрики: тип, единицы измерения, пояснение и владельца.
+func (h *Handler) DeclareMetadata(rw http.ResponseWriter, r *http.Request) {
+	meta := m.Metadata{}
+	if err := json.NewDecoder(r.Body).Decode(&meta); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	stored, err := h.Storage.DeclareMetadata(r.Context(), &meta)
+	if err != nil {
+		log.ErrorLog.Printf("could not declare metadata for %s: %e", meta.Name, err)
+		http.Error(rw, err.Error(), UpdateErrorStatus(err))
+		return
+	}
+	h.writeJSON(rw, stored)
+}
+
+// Метод, возвращающий описание метрики по имени.
+func (h *Handler) GetMetadata(rw http.ResponseWriter, r *http.Request) {
+	meta, ok := h.Collector.GetMetadata(chi.URLParam(r, "name"))
+	if !ok {
+		http.Error(rw, "Metric not found", http.StatusNotFound)
+		return
+	}
+	h.writeJSON(rw, meta)
+}
+
+// Метод, возвращающий все зарегистрированные описания метрик.
+func (h *Handler) ListMetadata(rw http.ResponseWriter, r *http.Request) {
+	h.writeJSON(rw, h.Collector.ListMetadata())
+}
+
+// Вспомогательный метод, записывающий ответ в формате JSON.
+func (h *Handler) writeJSON(rw http.ResponseWriter, data interface{}) {
+	buf := bytes.NewBuffer([]byte{})
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	if _, err := rw.Write(buf.Bytes()); err != nil {
+		log.ErrorLog.Printf("error writing json response: %e", err)
+	}
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -9,13 +10,21 @@ import (
 	"net/http"
 	"net/http/httptest"
 	_ "net/http/pprof"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/nmramorov/gowatcher/internal/collector"
 	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
 	"github.com/nmramorov/gowatcher/internal/db"
+	otlp "github.com/nmramorov/gowatcher/internal/proto/otlp"
+	"github.com/nmramorov/gowatcher/internal/storage"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
 )
 
 func testRequest(t *testing.T, ts *httptest.Server, method, path string) (int, string) {
@@ -33,6 +42,27 @@ func testRequest(t *testing.T, ts *httptest.Server, method, path string) (int, s
 	return resp.StatusCode, string(respBody)
 }
 
+// Обработчик поверх хранилища в БД с заданным курсором; недоступная БД заменяется памятью.
+func handlerWithCursor(key, privateKeyPath, trustedSubnet string, cursor *db.Cursor) *Handler {
+	c := collector.NewCollector()
+	return NewHandler(key, privateKeyPath, trustedSubnet, c, storage.NewDatabase(c, cursor))
+}
+
+func testRequestWithHeaders(t *testing.T, ts *httptest.Server, method, path string) (http.Header, string) {
+	req, err := http.NewRequest(method, ts.URL+path, nil)
+	require.NoError(t, err)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+
+	respBody, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+
+	defer resp.Body.Close()
+
+	return resp.Header, string(respBody)
+}
+
 func testRequestJSON(t *testing.T, ts *httptest.Server, method, path string, payload interface{}) (int, []byte) {
 	buf := bytes.NewBuffer([]byte{})
 	encoder := json.NewEncoder(buf)
@@ -178,7 +208,7 @@ func TestPOSTMetricsHandlerNoJson(t *testing.T) {
 	}
 	ctx := context.Background()
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -273,7 +303,7 @@ func TestGETMetricsHandler(t *testing.T) {
 	}
 	ctx := context.Background()
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -293,7 +323,7 @@ func TestHTML(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 	metricsHandler.Collector.UpdateMetrics()
 
 	ts := httptest.NewServer(metricsHandler)
@@ -361,7 +391,7 @@ func TestPOSTMetricsHandlerJson(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -524,7 +554,7 @@ func TestPOSTValueMetricsHandlerJson(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("some key", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("some key", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -565,7 +595,7 @@ func TestPing(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("fdsfds", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("fdsfds", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -581,14 +611,21 @@ func TestPing(t *testing.T) {
 	}
 }
 
-func TestNewHandlerFromSavedData(t *testing.T) {
-	ctx := context.Background()
-	col := collector.NewCollector()
-	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	assert.NotPanics(t, func() {
-		NewHandlerFromSavedData(col.GetMetrics(),
-			"sss", "", "", MOCKCURSOR)
-	})
+func TestMemoryStorageHandler(t *testing.T) {
+	c := collector.NewCollector()
+	metricsHandler := NewHandler("sss", "", "", c, storage.NewMemory(c))
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	statusCode, _ := testRequest(t, ts, "GET", "/ping")
+	assert.Equal(t, 200, statusCode)
+	statusCode, _ = testRequest(t, ts, "POST", "/update/gauge/Temperature/36.6")
+	assert.Equal(t, 200, statusCode)
+	statusCode, body := testRequest(t, ts, "GET", "/value/gauge/Temperature")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "36.6", body)
 }
 
 func TestPOSTMetricsHandlerJsonBatch(t *testing.T) {
@@ -633,7 +670,7 @@ func TestPOSTMetricsHandlerJsonBatch(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -691,7 +728,7 @@ func TestPOSTUpdateJsonBatch(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
 
 	ts := httptest.NewServer(metricsHandler)
 
@@ -727,7 +764,7 @@ func TestDecodeMsg(t *testing.T) {
 			want: want{
 				code: 400,
 			},
-			handler: NewHandler("dfd", "./key.pem", "", MOCKCURSOR),
+			handler: handlerWithCursor("dfd", "./key.pem", "", MOCKCURSOR),
 			args: &m.JSONMetrics{
 				ID:    "GaugeMetric",
 				MType: "gauge",
@@ -736,7 +773,7 @@ func TestDecodeMsg(t *testing.T) {
 		},
 		{
 			name:    "Negative test Counter 1",
-			handler: NewHandler("dsfdsf", "./key.pem", "", MOCKCURSOR),
+			handler: handlerWithCursor("dsfdsf", "./key.pem", "", MOCKCURSOR),
 			want: want{
 				code: 400,
 			},
@@ -748,7 +785,7 @@ func TestDecodeMsg(t *testing.T) {
 		},
 		{
 			name:    "Positive test Counter 1",
-			handler: NewHandler("dfdsfsdf", "", "", MOCKCURSOR),
+			handler: handlerWithCursor("dfdsfsdf", "", "", MOCKCURSOR),
 			want: want{
 				code: 200,
 			},
@@ -760,7 +797,7 @@ func TestDecodeMsg(t *testing.T) {
 		},
 		{
 			name:    "Negative test Counter 2",
-			handler: NewHandler("dsfsdf", "./.", "", MOCKCURSOR),
+			handler: handlerWithCursor("dsfsdf", "./.", "", MOCKCURSOR),
 			want: want{
 				code: 400,
 			},
@@ -772,7 +809,7 @@ func TestDecodeMsg(t *testing.T) {
 		},
 		{
 			name:    "Negative test Counter 3",
-			handler: NewHandler("sdfdsfds", "./key.pem", "", MOCKCURSOR),
+			handler: handlerWithCursor("sdfdsfds", "./key.pem", "", MOCKCURSOR),
 			want: want{
 				code: 400,
 			},
@@ -801,10 +838,10 @@ func TestHandler_ValidateIP(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandlerWithoutSubnet := NewHandler("", "", "", MOCKCURSOR)
-	metricsHandlerWithWrongCIDR := NewHandler("", "", "sdfdsf", MOCKCURSOR)
-	metricsHandlerWithProperSubnet := NewHandler("", "", "192.168.1.0/24", MOCKCURSOR)
-	metricsHandlerWithWrongSubnet := NewHandler("", "", "192.168.0.1/24", MOCKCURSOR)
+	metricsHandlerWithoutSubnet := handlerWithCursor("", "", "", MOCKCURSOR)
+	metricsHandlerWithWrongCIDR := handlerWithCursor("", "", "sdfdsf", MOCKCURSOR)
+	metricsHandlerWithProperSubnet := handlerWithCursor("", "", "192.168.1.0/24", MOCKCURSOR)
+	metricsHandlerWithWrongSubnet := handlerWithCursor("", "", "192.168.0.1/24", MOCKCURSOR)
 
 	type want struct {
 		code int
@@ -868,7 +905,7 @@ func TestCheckHash(t *testing.T) {
 	value := float64(0.0)
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("very secret key", "", "", MOCKCURSOR)
+	metricsHandler := handlerWithCursor("very secret key", "", "", MOCKCURSOR)
 	err := metricsHandler.CheckHash(&m.JSONMetrics{
 		ID:    "MyMetric",
 		MType: "counter",
@@ -883,19 +920,576 @@ func TestCheckHash(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func TestInitDB(t *testing.T) {
+func TestGetCurrentMetrics(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("very secret key", "", "", MOCKCURSOR)
-	err := metricsHandler.InitDB(ctx)
-	require.Error(t, err)
+	metricsHandler := handlerWithCursor("very secret key", "", "", MOCKCURSOR)
+	snapshot, err := metricsHandler.GetCurrentMetrics(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, snapshot.CounterMetrics, "PollCount")
 }
 
-func TestGetCurrentMetrics(t *testing.T) {
+func TestPOSTHistogramHandlerJSON(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	histogram := m.NewHistogram([]float64{0.1, 1})
+	histogram.Observe(0.5)
+	payload := m.JSONMetrics{ID: "RequestLatency", MType: "histogram", Histogram: histogram}
+
+	statusCode, body := testRequestJSON(t, ts, "POST", "/update/", payload)
+	assert.Equal(t, 200, statusCode)
+	result := m.JSONMetrics{}
+	require.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, []uint64{0, 1, 0}, result.Histogram.Counts)
+
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/updates/", []m.JSONMetrics{payload})
+	assert.Equal(t, 200, statusCode)
+
+	statusCode, body = testRequestJSON(t, ts, "POST", "/value/", m.JSONMetrics{ID: "RequestLatency", MType: "histogram"})
+	assert.Equal(t, 200, statusCode)
+	require.NoError(t, json.Unmarshal(body, &result))
+	assert.Equal(t, uint64(2), result.Histogram.Count)
+
+	payload.Histogram = m.NewHistogram([]float64{5})
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", payload)
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestGETMetricWithLabels(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	value := 12.5
+	payload := m.JSONMetrics{ID: "Temperature", MType: "gauge", Value: &value, Labels: map[string]string{"room": "a"}}
+	statusCode, _ := testRequestJSON(t, ts, "POST", "/update/", payload)
+	assert.Equal(t, 200, statusCode)
+
+	statusCode, body := testRequest(t, ts, "GET", "/value/gauge/Temperature?label=room:a")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "12.5", body)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/gauge/Temperature?label=room:b")
+	assert.Equal(t, 404, statusCode)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/gauge/Temperature?label=room")
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestSummaryHandler(t *testing.T) {
 	ctx := context.Background()
 
 	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
-	metricsHandler := NewHandler("very secret key", "", "", MOCKCURSOR)
-	require.NotPanics(t, func() { metricsHandler.GetCurrentMetrics() })
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	payload := m.JSONMetrics{ID: "RequestLatency", MType: "summary", Samples: []float64{10, 20, 30, 40}}
+	statusCode, data := testRequestJSON(t, ts, "POST", "/update/", payload)
+	assert.Equal(t, 200, statusCode)
+	result := m.JSONMetrics{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, uint64(4), result.Summary.Count)
+	assert.Len(t, result.Quantiles, len(m.DefaultQuantiles))
+
+	statusCode, body := testRequest(t, ts, "GET", "/value/summary/RequestLatency?quantile=1")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "40", body)
+
+	statusCode, body = testRequest(t, ts, "GET", "/value/summary/RequestLatency?quantile=0&quantile=1")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "0 10\n1 40", body)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/summary/RequestLatency?quantile=2")
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestMetadataHandlers(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	meta := m.Metadata{Name: "RequestLatency", MType: "summary", Unit: "ms", Help: "Request latency", Owner: "api"}
+	statusCode, data := testRequestJSON(t, ts, "POST", "/metadata/", meta)
+	assert.Equal(t, 200, statusCode)
+	result := m.Metadata{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, meta, result)
+
+	statusCode, data = testRequestJSON(t, ts, "GET", "/metadata/RequestLatency", nil)
+	assert.Equal(t, 200, statusCode)
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, meta, result)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/metadata/Unknown")
+	assert.Equal(t, 404, statusCode)
+
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/metadata/", m.Metadata{Name: "RequestLatency", MType: "gauge"})
+	assert.Equal(t, 409, statusCode)
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/metadata/", m.Metadata{MType: "gauge"})
+	assert.Equal(t, 400, statusCode)
+
+	value := 3.0
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", m.JSONMetrics{ID: "RequestLatency", MType: "gauge", Value: &value})
+	assert.Equal(t, 409, statusCode)
+	statusCode, _ = testRequest(t, ts, "POST", "/update/gauge/PollCount/1")
+	assert.Equal(t, 409, statusCode)
+
+	statusCode, data = testRequestJSON(t, ts, "GET", "/metadata/", nil)
+	assert.Equal(t, 200, statusCode)
+	list := []m.Metadata{}
+	require.NoError(t, json.Unmarshal(data, &list))
+	assert.Contains(t, list, meta)
+
+	statusCode, body := testRequest(t, ts, "GET", "/")
+	assert.Equal(t, 200, statusCode)
+	assert.Contains(t, body, "RequestLatency (summary, ms): Request latency [api]")
+}
+
+func TestSetHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	payload := m.JSONMetrics{ID: "UniqueUsers", MType: "set", Members: []string{"alice", "bob"}}
+	statusCode, data := testRequestJSON(t, ts, "POST", "/updates/", []m.JSONMetrics{payload})
+	assert.Equal(t, 200, statusCode)
+	require.NotEmpty(t, data)
+
+	payload.Members = []string{"bob", "carol"}
+	statusCode, data = testRequestJSON(t, ts, "POST", "/update/", payload)
+	assert.Equal(t, 200, statusCode)
+	result := m.JSONMetrics{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, uint64(3), *result.Estimate)
+
+	statusCode, body := testRequest(t, ts, "GET", "/value/set/UniqueUsers")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "3", body)
+}
+
+func TestStaleMetricHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+	metricsHandler.Collector.Staleness = collector.Staleness{StaleAfter: time.Minute}
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	statusCode, _ := testRequest(t, ts, "POST", "/update/gauge/Temperature/36.6")
+	assert.Equal(t, 200, statusCode)
+
+	resp, body := testRequestWithHeaders(t, ts, "GET", "/value/gauge/Temperature")
+	assert.Equal(t, "36.6", body)
+	assert.Empty(t, resp.Get(StaleHeader))
+
+	metricsHandler.Collector.Metrics.UpdatedAt["Temperature"] = time.Now().Add(-time.Hour).UnixMilli()
+	resp, _ = testRequestWithHeaders(t, ts, "GET", "/value/gauge/Temperature")
+	assert.Equal(t, "true", resp.Get(StaleHeader))
+
+	statusCode, data := testRequestJSON(t, ts, "POST", "/value/", m.JSONMetrics{ID: "Temperature", MType: "gauge"})
+	assert.Equal(t, 200, statusCode)
+	result := m.JSONMetrics{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.True(t, result.Stale)
+}
+
+func TestCounterRateHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		delta := int64(30)
+		sampleTime := now.Add(time.Duration(i-2) * 30 * time.Second).UnixMilli()
+		payload := m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &sampleTime}
+		statusCode, _ := testRequestJSON(t, ts, "POST", "/update/", payload)
+		assert.Equal(t, 200, statusCode)
+	}
+
+	statusCode, body := testRequest(t, ts, "GET", "/value/counter/Requests?increase=5m")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "60", body)
+
+	statusCode, body = testRequest(t, ts, "GET", "/value/counter/Requests?rate=5m")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "1", body)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/counter/Requests?rate=forever")
+	assert.Equal(t, 400, statusCode)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/counter/Requests?rate")
+	assert.Equal(t, 400, statusCode)
+
+	statusCode, _ = testRequest(t, ts, "GET", "/value/counter/Requests?increase=")
+	assert.Equal(t, 400, statusCode)
+
+	statusCode, data := testRequestJSON(t, ts, "POST", "/value/", m.JSONMetrics{ID: "Requests", MType: "counter", Window: "5m"})
+	assert.Equal(t, 200, statusCode)
+	result := m.JSONMetrics{}
+	require.NoError(t, json.Unmarshal(data, &result))
+	assert.Equal(t, int64(90), *result.Delta)
+	assert.Equal(t, 1.0, *result.Rate)
+}
+
+func TestHistoryHandler(t *testing.T) {
+	ctx := context.Background()
+	c := collector.NewCollector()
+	store, err := storage.OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), c)
+	require.NoError(t, err)
+	defer store.Close(ctx)
+	metricsHandler := NewHandler("", "", "", c, store)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	start := time.Now().Truncate(time.Minute).Add(-time.Minute)
+	for i, value := range []float64{1, 3, 8} {
+		value := value
+		sampleTime := start.Add(time.Duration(i) * 30 * time.Second).UnixMilli()
+		payload := m.JSONMetrics{ID: "Load", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"},
+			Timestamp: &sampleTime}
+		statusCode, _ := testRequestJSON(t, ts, "POST", "/update/", payload)
+		assert.Equal(t, 200, statusCode)
+	}
+
+	path := fmt.Sprintf("/history/gauge/Load?label=host:a&from=%d&to=%s&step=1m",
+		start.UnixMilli(), start.Add(2*time.Minute).Format(time.RFC3339))
+	statusCode, body := testRequest(t, ts, "GET", path)
+	require.Equal(t, 200, statusCode)
+	points := []m.Point{}
+	require.NoError(t, json.Unmarshal([]byte(body), &points))
+	require.Len(t, points, 2)
+	assert.Equal(t, m.Point{Timestamp: start.UnixMilli(), Avg: 2, Min: 1, Max: 3, Last: 3, Count: 2}, points[0])
+	assert.Equal(t, 8.0, points[1].Avg)
+
+	for _, path := range []string{
+		"/history/summary/Load",
+		"/history/gauge/Load?step=0s",
+		"/history/gauge/Load?from=later",
+		"/history/gauge/Load?step=1ms",
+		"/history/gauge/Load?label=host",
+	} {
+		statusCode, _ = testRequest(t, ts, "GET", path)
+		assert.Equal(t, 400, statusCode, path)
+	}
+
+	memory := NewHandler("", "", "", c, storage.NewMemory(c))
+	memoryServer := httptest.NewServer(memory)
+	defer memoryServer.Close()
+	statusCode, _ = testRequest(t, memoryServer, "GET", "/history/gauge/Load")
+	assert.Equal(t, 501, statusCode)
+}
+
+func TestParseHistoryRange(t *testing.T) {
+	now := time.Now()
+	from, to, step, err := ParseHistoryRange(url.Values{}, now)
+	require.NoError(t, err)
+	assert.Equal(t, now, to)
+	assert.Equal(t, now.Add(-time.Hour), from)
+	assert.Equal(t, time.Minute, step)
+
+	query := url.Values{"from": {strconv.FormatInt(now.Add(-30*24*time.Hour).UnixMilli(), 10)}}
+	_, _, step, err = ParseHistoryRange(query, now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, step)
+}
+
+func TestPrometheusHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	meta := m.Metadata{Name: "Temperature", MType: "gauge", Unit: "celsius", Help: "Room \"temperature\""}
+	statusCode, _ := testRequestJSON(t, ts, "POST", "/metadata/", meta)
+	assert.Equal(t, 200, statusCode)
+	value := 21.5
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", m.JSONMetrics{
+		ID: "Temperature", MType: "gauge", Value: &value, Labels: map[string]string{"room": "a\"1", "host": "h"},
+	})
+	assert.Equal(t, 200, statusCode)
+	histogram := m.NewHistogram([]float64{1, 10})
+	for _, sample := range []float64{0.5, 3, 100} {
+		histogram.Observe(sample)
+	}
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", m.JSONMetrics{ID: "Latency", MType: "histogram", Histogram: histogram})
+	assert.Equal(t, 200, statusCode)
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", m.JSONMetrics{
+		ID: "Users.unique", MType: "set", Members: []string{"alice", "bob"},
+	})
+	assert.Equal(t, 200, statusCode)
+	// метка le гистограммы и метки, совпавшие после очистки имени, переименовываются
+	statusCode, _ = testRequestJSON(t, ts, "POST", "/update/", m.JSONMetrics{
+		ID: "Wait", MType: "histogram", Histogram: m.NewHistogram([]float64{1}),
+		Labels: map[string]string{"le": "user", "a.b": "dot", "a_b": "plain", "a-b": "dash"},
+	})
+	assert.Equal(t, 200, statusCode)
+
+	resp, body := testRequestWithHeaders(t, ts, "GET", "/metrics")
+	assert.Equal(t, PrometheusContentType, resp.Get("Content-Type"))
+	assert.Contains(t, body, "# HELP Temperature Room \"temperature\" (celsius)\n# TYPE Temperature gauge\n"+
+		"Temperature{host=\"h\",room=\"a\\\"1\"} 21.5\n")
+	assert.Contains(t, body, "# TYPE PollCount counter\nPollCount 0\n")
+	assert.Contains(t, body, "# TYPE Latency histogram\n"+
+		"Latency_bucket{le=\"1\"} 1\nLatency_bucket{le=\"10\"} 2\nLatency_bucket{le=\"+Inf\"} 3\n"+
+		"Latency_sum 103.5\nLatency_count 3\n")
+	assert.Contains(t, body, "# TYPE Wait histogram\n"+
+		"Wait_bucket{a_b=\"plain\",exported_a_b=\"dash\",exported_exported_a_b=\"dot\",exported_le=\"user\",le=\"1\"} 0\n")
+	assert.Contains(t, body, "Wait_sum{a_b=\"plain\",exported_a_b=\"dash\",exported_exported_a_b=\"dot\",exported_le=\"user\"} 0\n")
+	assert.Contains(t, body, "# HELP Users_unique Users.unique\n# TYPE Users_unique gauge\nUsers_unique 2\n")
+
+	// одно имя не может принадлежать двум семействам: совпадающие после очистки имена получают суффикс типа
+	var out bytes.Buffer
+	require.NoError(t, WritePrometheus(&out, &m.Metrics{
+		GaugeMetrics:   map[string]m.Gauge{"Dup": 1.5, "a.b": 2, "a_b": 3},
+		CounterMetrics: map[string]m.Counter{"Dup": 3},
+	}))
+	assert.Equal(t, "# HELP Dup Dup\n# TYPE Dup counter\nDup 3\n"+
+		"# HELP Dup_gauge Dup\n# TYPE Dup_gauge gauge\nDup_gauge 1.5\n"+
+		"# HELP a_b a_b\n# TYPE a_b gauge\na_b 3\n"+
+		"# HELP a_b_gauge a.b\n# TYPE a_b_gauge gauge\na_b_gauge 2\n", out.String())
+}
+
+func TestInfluxWriteHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	_, err := gz.Write([]byte("requests,path=/api count=5i\nrequests,path=/api count=7i,latency=0.25\n"))
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	req, err := http.NewRequest("POST", ts.URL+"/write?db=telegraf", &body)
+	require.NoError(t, err)
+	req.Header.Set("Content-Encoding", "gzip")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	statusCode, text := testRequest(t, ts, "GET", "/value/counter/requests_count?label=path:/api")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "7", text)
+	statusCode, text = testRequest(t, ts, "GET", "/value/gauge/requests_latency")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "0.25", text)
+
+	// целые поля Telegraf — накопленные итоги: повторная строка не увеличивает counter
+	write := func(line string) {
+		resp, err := http.Post(ts.URL+"/write", "text/plain", strings.NewReader(line))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	}
+	write("net,iface=eth0 bytes_recv=1000i")
+	write("net,iface=eth0 bytes_recv=1000i")
+	statusCode, text = testRequest(t, ts, "GET", "/value/counter/net_bytes_recv?label=iface:eth0")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "1000", text)
+	write("net,iface=eth0 bytes_recv=1500i")
+	statusCode, text = testRequest(t, ts, "GET", "/value/counter/net_bytes_recv?label=iface:eth0")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "1500", text)
+
+	// итог новой серии без меток не сравнивается с серией, метки которой лишь содержат её метки
+	write("disk,host=a reads=100i")
+	write("disk reads=50i")
+	statusCode, text = testRequest(t, ts, "GET", "/value/counter/disk_reads")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "50", text)
+	statusCode, text = testRequest(t, ts, "GET", "/value/counter/disk_reads?label=host:a")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "100", text)
+
+	statusCode, _ = testRequest(t, ts, "POST", "/write?precision=h")
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestOTLPHandler(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	post := func(contentType string, body []byte) (int, []byte) {
+		req, err := http.NewRequest("POST", ts.URL+"/v1/metrics", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		data, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, data
+	}
+	export := func(total string) string {
+		return `{"resourceMetrics":[{"resource":{"attributes":[{"key":"service.name","value":{"stringValue":"api"}}]},
+			"scopeMetrics":[{"scope":{"name":"otel"},"metrics":[
+				{"name":"http.requests","sum":{"aggregationTemporality":2,"isMonotonic":true,
+					"dataPoints":[{"asInt":"` + total + `","timeUnixNano":"1700000000000000000",
+						"attributes":[{"key":"code","value":{"intValue":"200"}}]}]}},
+				{"name":"cpu.load","gauge":{"dataPoints":[{"asDouble":0.75}]}},
+				{"name":"http.latency","histogram":{"aggregationTemporality":1,"dataPoints":[
+					{"count":"3","sum":7.5,"bucketCounts":["1","2","0"],"explicitBounds":[1,5]},
+					{"count":"1","bucketCounts":["1","0"],"explicitBounds":[1,5]}]}},
+				{"name":"broken","gauge":{"dataPoints":[{}]}}]}]}]}`
+	}
+
+	statusCode, data := post("application/json", []byte(export("10")))
+	assert.Equal(t, 200, statusCode)
+	assert.JSONEq(t, `{"partialSuccess":{"rejectedDataPoints":"2",
+		"errorMessage":"data points without value or with wrong histogram buckets"}}`, string(data))
+	statusCode, _ = post("application/json", []byte(export("15")))
+	assert.Equal(t, 200, statusCode)
+
+	statusCode, body := testRequest(t, ts, "GET", "/value/counter/http.requests?label=service.name:api&label=code:200")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "15", body)
+	statusCode, body = testRequest(t, ts, "GET", "/value/gauge/cpu.load?label=service.name:api")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "0.75", body)
+	found, err := metricsHandler.Storage.Get(ctx, &m.JSONMetrics{ID: "http.latency", MType: "histogram"})
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2, 4, 0}, found.Histogram.Counts)
+
+	value := &otlp.NumberDataPoint{Value: &otlp.NumberDataPoint_AsDouble{AsDouble: 1.5}}
+	request := &otlp.ExportMetricsServiceRequest{ResourceMetrics: []*otlp.ResourceMetrics{{
+		ScopeMetrics: []*otlp.ScopeMetrics{{Metrics: []*otlp.Metric{{
+			Name: "queue.depth", Data: &otlp.Metric_Gauge{Gauge: &otlp.Gauge{DataPoints: []*otlp.NumberDataPoint{value}}},
+		}}}},
+	}}}
+	payload, err := proto.Marshal(request)
+	require.NoError(t, err)
+	statusCode, data = post("application/x-protobuf", payload)
+	assert.Equal(t, 200, statusCode)
+	assert.Empty(t, data)
+	statusCode, body = testRequest(t, ts, "GET", "/value/gauge/queue.depth")
+	assert.Equal(t, 200, statusCode)
+	assert.Equal(t, "1.5", body)
+
+	statusCode, _ = post("text/plain", payload)
+	assert.Equal(t, http.StatusUnsupportedMediaType, statusCode)
+	statusCode, _ = post("application/x-protobuf", []byte("garbage"))
+	assert.Equal(t, 400, statusCode)
+}
+
+func TestOTLPCumulativeStreams(t *testing.T) {
+	ctx := context.Background()
+
+	MOCKCURSOR, _ := db.NewCursor(ctx, "", "pgx")
+	metricsHandler := handlerWithCursor("", "", "", MOCKCURSOR)
+
+	ts := httptest.NewServer(metricsHandler)
+
+	defer ts.Close()
+
+	started := uint64(time.Now().UnixNano())
+	send := func(name string, start uint64, total int64) {
+		point := &otlp.NumberDataPoint{StartTimeUnixNano: start, Value: &otlp.NumberDataPoint_AsInt{AsInt: total}}
+		request := &otlp.ExportMetricsServiceRequest{ResourceMetrics: []*otlp.ResourceMetrics{{
+			ScopeMetrics: []*otlp.ScopeMetrics{{Metrics: []*otlp.Metric{{Name: name, Data: &otlp.Metric_Sum{Sum: &otlp.Sum{
+				AggregationTemporality: otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+				IsMonotonic:            true,
+				DataPoints:             []*otlp.NumberDataPoint{point},
+			}}}}}},
+		}}}
+		payload, err := proto.Marshal(request)
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", ts.URL+"/v1/metrics", bytes.NewReader(payload))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", OTLPProtobufContentType)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, 200, resp.StatusCode)
+	}
+	value := func(name string) string {
+		_, body := testRequest(t, ts, "GET", "/value/counter/"+name)
+		return body
+	}
+
+	send("requests", started+1, 100)
+	send("requests", started+1, 150)
+	assert.Equal(t, "150", value("requests"))
+	// источник перезапустился: новое время начала, накопление с нуля
+	send("requests", started+2, 20)
+	assert.Equal(t, "170", value("requests"))
+	send("requests", started+2, 30)
+	assert.Equal(t, "180", value("requests"))
+	// запоздавшие точки текущего и прежнего потоков не учитываются
+	send("requests", started+2, 25)
+	send("requests", started+1, 160)
+	assert.Equal(t, "180", value("requests"))
+
+	// поток, начатый до запуска сервера, без серии в хранилище учитывается целиком
+	send("jobs", 1, 500)
+	assert.Equal(t, "500", value("jobs"))
+	send("jobs", 1, 510)
+	assert.Equal(t, "510", value("jobs"))
+
+	// после перезапуска сервера точкой отсчёта служит итог серии в хранилище
+	restored := int64(400)
+	_, err := metricsHandler.Storage.Update(ctx, &m.JSONMetrics{ID: "tasks", MType: "counter", Delta: &restored})
+	require.NoError(t, err)
+	send("tasks", 1, 450)
+	assert.Equal(t, "450", value("tasks"))
+	send("tasks", 1, 460)
+	assert.Equal(t, "460", value("tasks"))
+
+	// потоки удалённых серий забываются вместе с сериями
+	metricsHandler.Collector.Staleness.EvictAfter = time.Minute
+	metricsHandler.EvictStale(time.Now().Add(time.Hour))
+	assert.Empty(t, metricsHandler.otlp.streams)
+	send("tasks", started+3, 5)
+	assert.Equal(t, "5", value("tasks"))
 }
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/influx"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Метод, принимающий метрики в формате InfluxDB line protocol по запросам вида /write?precision=s,
+// чтобы Telegraf и клиенты InfluxDB могли писать в сервер без доработок. Пакет с ошибкой
+// в любой строке отклоняется целиком, успешная запись отвечает 204, как InfluxDB.
+// Целые поля задают итог counter: повторная запись того же значения его не увеличивает.
+func (h *Handler) WriteInflux(rw http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	batch, err := influx.ParseLines(body, r.URL.Query().Get("precision"))
+	if err != nil {
+		log.ErrorLog.Printf("could not parse line protocol: %e", err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = h.storeInflux(r.Context(), batch); err != nil {
+		http.Error(rw, err.Error(), UpdateErrorStatus(err))
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// Метод, записывающий разобранный пакет. Итоги counter переводятся в приращения относительно
+// сохранённого значения серии с теми же метками или предыдущей строки пакета; уменьшение итога
+// уменьшает counter.
+// Запросы обрабатываются по одному, чтобы приращения считались от актуального значения.
+func (h *Handler) storeInflux(ctx context.Context, batch []*m.JSONMetrics) error {
+	h.influx.Lock()
+	defer h.influx.Unlock()
+	totals := make(map[string]int64)
+	points := make([]*m.JSONMetrics, 0, len(batch))
+	for _, point := range batch {
+		if point.MType != COUNTER {
+			points = append(points, point)
+			continue
+		}
+		key, total := point.Key(), *point.Delta
+		current, ok := totals[key]
+		if !ok {
+			stored, err := h.Storage.GetSeries(ctx, &m.JSONMetrics{ID: point.ID, MType: point.MType, Labels: point.Labels})
+			if err == nil && stored.Delta != nil {
+				current = *stored.Delta
+			}
+		}
+		totals[key] = total
+		if delta := total - current; delta != 0 {
+			point.Delta = &delta
+			points = append(points, point)
+		}
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	_, err := h.Storage.UpdateBatch(ctx, points)
+	return err
+}
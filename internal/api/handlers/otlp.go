@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+	otlp "github.com/nmramorov/gowatcher/internal/proto/otlp"
+	"github.com/nmramorov/gowatcher/internal/storage"
+)
+
+// Типы содержимого OTLP/HTTP.
+const (
+	OTLPProtobufContentType = "application/x-protobuf"
+	OTLPJSONContentType     = "application/json"
+)
+
+// Метод, принимающий метрики OpenTelemetry по OTLP/HTTP: JSON или protobuf, если этого требует
+// Content-Type. Точки Gauge становятся gauge, монотонные Sum — counter, немонотонные Sum — gauge,
+// Histogram — histogram. Атрибуты ресурса и точки становятся метками, атрибуты точки важнее.
+// Накопительные Sum и Histogram переводятся в приращения относительно предыдущей точки того же потока.
+// Тело уже распаковано и расшифровано middleware GzipHandle и DecodeMessage.
+func (h *Handler) ReceiveOTLP(rw http.ResponseWriter, r *http.Request) {
+	contentType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (contentType != OTLPProtobufContentType && contentType != OTLPJSONContentType) {
+		http.Error(rw, "unsupported content type, expected application/json or application/x-protobuf",
+			http.StatusUnsupportedMediaType)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request := &otlp.ExportMetricsServiceRequest{}
+	if contentType == OTLPProtobufContentType {
+		err = proto.Unmarshal(body, request)
+	} else {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(body, request)
+	}
+	if err != nil {
+		log.ErrorLog.Printf("could not decode OTLP request: %e", err)
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rejected, err := h.storeOTLP(r.Context(), request)
+	if err != nil {
+		http.Error(rw, err.Error(), UpdateErrorStatus(err))
+		return
+	}
+	response := &otlp.ExportMetricsServiceResponse{}
+	if rejected > 0 {
+		response.PartialSuccess = &otlp.ExportMetricsPartialSuccess{
+			RejectedDataPoints: rejected,
+			ErrorMessage:       "data points without value or with wrong histogram buckets",
+		}
+	}
+	var data []byte
+	if contentType == OTLPProtobufContentType {
+		data, err = proto.Marshal(response)
+	} else {
+		data, err = protojson.Marshal(response)
+	}
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", contentType)
+	if _, err = rw.Write(data); err != nil {
+		log.ErrorLog.Printf("error writing OTLP response: %e", err)
+	}
+}
+
+// Метод, преобразующий запрос OTLP и записывающий его в хранилище. Возвращает число отклонённых точек.
+// Запросы обрабатываются по одному, чтобы приращения одного потока не учитывались дважды.
+func (h *Handler) storeOTLP(ctx context.Context, request *otlp.ExportMetricsServiceRequest) (int64, error) {
+	h.otlp.mu.Lock()
+	defer h.otlp.mu.Unlock()
+	converter := &otlpConverter{
+		ctx: ctx, store: h.Storage, state: h.otlp,
+		pending: make(map[string]*otlpStream), totals: make(map[string]*m.JSONMetrics),
+	}
+	batch := converter.convert(request)
+	if len(batch) > 0 {
+		if _, err := h.Storage.UpdateBatch(ctx, batch); err != nil {
+			return 0, err
+		}
+	}
+	converter.commit()
+	return converter.rejected, nil
+}
+
+// Последние накопительные значения потоков OTLP, общие для всех запросов. Поток — это серия вместе
+// со временем начала накопления start_time_unix_nano, которое источник меняет при перезапуске.
+// Приращения считаются относительно предыдущего значения того же потока, а не накопленного итога серии,
+// куда могут писать и другие источники. Состояние хранится только в памяти: после перезапуска сервера
+// точкой отсчёта потока служит итог серии в хранилище. Потоки удалённых серий забываются, см. forget.
+type otlpCumulative struct {
+	mu      sync.Mutex
+	started uint64
+	streams map[string]*otlpStream
+}
+
+// Последнее накопительное значение потока.
+type otlpStream struct {
+	start     uint64
+	total     int64
+	histogram *m.Histogram
+}
+
+func newOTLPCumulative() *otlpCumulative {
+	return &otlpCumulative{started: uint64(time.Now().UnixNano()), streams: make(map[string]*otlpStream)}
+}
+
+// Способы учёта накопительной точки.
+const (
+	otlpStale    = iota // точка старше уже учтённой: пропускается
+	otlpBaseline        // первая точка потока, начатого до запуска сервера: приращение от итога серии
+	otlpFull            // накопление началось заново: всё значение является приращением
+	otlpSince           // приращение относительно предыдущего значения потока
+)
+
+// Преобразователь запроса OTLP в пакет наблюдений. Новые значения потоков копятся в pending
+// и переносятся в общее состояние только после успешной записи пакета.
+type otlpConverter struct {
+	ctx      context.Context
+	store    storage.Storage
+	state    *otlpCumulative
+	pending  map[string]*otlpStream
+	totals   map[string]*m.JSONMetrics
+	rejected int64
+}
+
+// Метод, переносящий значения потоков, учтённые в записанном пакете, в общее состояние.
+func (c *otlpConverter) commit() {
+	for key, stream := range c.pending {
+		c.state.streams[key] = stream
+	}
+}
+
+// Метод, возвращающий последнее значение потока: встреченное в запросе или сохранённое ранее.
+func (c *otlpConverter) stream(key string) *otlpStream {
+	if stream, ok := c.pending[key]; ok {
+		return stream
+	}
+	return c.state.streams[key]
+}
+
+// Метод, выбирающий способ учёта точки потока key со временем начала start. Поток, начатый до запуска
+// сервера, мог быть уже учтён до перезапуска, поэтому его первая точка сравнивается с итогом серии.
+// Уменьшение при том же известном времени начала означает запоздавшую точку, при неизвестном — перезапуск.
+func (c *otlpConverter) resolve(key string, start uint64, decreased func(previous *otlpStream) bool) (*otlpStream, int) {
+	previous := c.stream(key)
+	switch {
+	case previous == nil:
+		if start != 0 && start < c.state.started {
+			return nil, otlpBaseline
+		}
+		return nil, otlpFull
+	case start != previous.start:
+		if start != 0 && start < previous.start {
+			return previous, otlpStale
+		}
+		return previous, otlpFull
+	case decreased(previous):
+		if start != 0 {
+			return previous, otlpStale
+		}
+		return previous, otlpFull
+	}
+	return previous, otlpSince
+}
+
+func (c *otlpConverter) convert(request *otlp.ExportMetricsServiceRequest) []*m.JSONMetrics {
+	batch := make([]*m.JSONMetrics, 0)
+	for _, resourceMetrics := range request.GetResourceMetrics() {
+		resource := resourceMetrics.GetResource().GetAttributes()
+		for _, scopeMetrics := range resourceMetrics.GetScopeMetrics() {
+			for _, metric := range scopeMetrics.GetMetrics() {
+				batch = append(batch, c.convertMetric(metric, resource)...)
+			}
+		}
+	}
+	return batch
+}
+
+func (c *otlpConverter) convertMetric(metric *otlp.Metric, resource []*otlp.KeyValue) []*m.JSONMetrics {
+	batch := make([]*m.JSONMetrics, 0)
+	add := func(point *m.JSONMetrics, ok bool) {
+		if !ok {
+			c.rejected++
+			return
+		}
+		if point != nil {
+			batch = append(batch, point)
+		}
+	}
+	switch {
+	case metric.GetGauge() != nil:
+		for _, dp := range metric.GetGauge().GetDataPoints() {
+			add(c.gauge(metric.GetName(), dp, resource, false))
+		}
+	case metric.GetSum() != nil:
+		sum := metric.GetSum()
+		cumulative := sum.GetAggregationTemporality() == otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, dp := range sum.GetDataPoints() {
+			if sum.GetIsMonotonic() {
+				add(c.counter(metric.GetName(), dp, resource, cumulative))
+			} else {
+				add(c.gauge(metric.GetName(), dp, resource, !cumulative))
+			}
+		}
+	case metric.GetHistogram() != nil:
+		histogram := metric.GetHistogram()
+		cumulative := histogram.GetAggregationTemporality() == otlp.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE
+		for _, dp := range histogram.GetDataPoints() {
+			add(c.histogram(metric.GetName(), dp, resource, cumulative))
+		}
+	default:
+		log.InfoLog.Printf("skipping OTLP metric %s of unsupported type", metric.GetName())
+	}
+	return batch
+}
+
+// Функция, возвращающая значение точки числом; false, если значение не задано.
+func otlpNumber(dp *otlp.NumberDataPoint) (float64, bool) {
+	switch value := dp.GetValue().(type) {
+	case *otlp.NumberDataPoint_AsDouble:
+		return value.AsDouble, true
+	case *otlp.NumberDataPoint_AsInt:
+		return float64(value.AsInt), true
+	}
+	return 0, false
+}
+
+// Функция, создающая наблюдение с метками ресурса и точки и временем точки.
+func otlpPoint(name, mtype string, resource, attributes []*otlp.KeyValue, timeUnixNano uint64) *m.JSONMetrics {
+	point := &m.JSONMetrics{ID: name, MType: mtype}
+	for _, attrs := range [][]*otlp.KeyValue{resource, attributes} {
+		for _, attr := range attrs {
+			value, ok := otlpAttribute(attr.GetValue())
+			if !ok {
+				continue
+			}
+			if point.Labels == nil {
+				point.Labels = make(map[string]string)
+			}
+			point.Labels[attr.GetKey()] = value
+		}
+	}
+	if timeUnixNano > 0 {
+		timestamp := int64(timeUnixNano / uint64(1000000))
+		point.Timestamp = &timestamp
+	}
+	return point
+}
+
+// Функция, приводящая скалярное значение атрибута к строке. Массивы и вложенные списки пропускаются.
+func otlpAttribute(value *otlp.AnyValue) (string, bool) {
+	switch v := value.GetValue().(type) {
+	case *otlp.AnyValue_StringValue:
+		return v.StringValue, true
+	case *otlp.AnyValue_BoolValue:
+		return strconv.FormatBool(v.BoolValue), true
+	case *otlp.AnyValue_IntValue:
+		return strconv.FormatInt(v.IntValue, 10), true
+	case *otlp.AnyValue_DoubleValue:
+		return strconv.FormatFloat(v.DoubleValue, 'f', -1, 64), true
+	}
+	return "", false
+}
+
+// Метод, возвращающий сохранённое значение серии: встреченное ранее в запросе или из хранилища.
+func (c *otlpConverter) current(point *m.JSONMetrics) *m.JSONMetrics {
+	key := point.MType + "\x00" + point.Key()
+	if stored, ok := c.totals[key]; ok {
+		return stored
+	}
+	return c.stored(point)
+}
+
+// Метод, возвращающий значение серии с точно такими же метками из хранилища; nil, если серии нет.
+func (c *otlpConverter) stored(point *m.JSONMetrics) *m.JSONMetrics {
+	stored, err := c.store.GetSeries(c.ctx, &m.JSONMetrics{ID: point.ID, MType: point.MType, Labels: point.Labels})
+	if err != nil {
+		return nil
+	}
+	return stored
+}
+
+func (c *otlpConverter) remember(point, total *m.JSONMetrics) {
+	c.totals[point.MType+"\x00"+point.Key()] = total
+}
+
+// Метод, преобразующий точку в gauge. Для приращений немонотонной Sum значение добавляется к текущему.
+func (c *otlpConverter) gauge(
+	name string, dp *otlp.NumberDataPoint, resource []*otlp.KeyValue, delta bool,
+) (*m.JSONMetrics, bool) {
+	value, ok := otlpNumber(dp)
+	if !ok {
+		return nil, false
+	}
+	point := otlpPoint(name, GAUGE, resource, dp.GetAttributes(), dp.GetTimeUnixNano())
+	if delta {
+		if stored := c.current(point); stored != nil && stored.Value != nil {
+			value += *stored.Value
+		}
+	}
+	point.Value = &value
+	c.remember(point, point)
+	return point, true
+}
+
+// Метод, преобразующий точку монотонной Sum в приращение counter. Для накопительной Sum приращение
+// считается относительно предыдущего значения того же потока.
+func (c *otlpConverter) counter(
+	name string, dp *otlp.NumberDataPoint, resource []*otlp.KeyValue, cumulative bool,
+) (*m.JSONMetrics, bool) {
+	value, ok := otlpNumber(dp)
+	if !ok {
+		return nil, false
+	}
+	point := otlpPoint(name, COUNTER, resource, dp.GetAttributes(), dp.GetTimeUnixNano())
+	delta := int64(math.Round(value))
+	if cumulative {
+		key, total := point.MType+"\x00"+point.Key(), delta
+		previous, mode := c.resolve(key, dp.GetStartTimeUnixNano(), func(previous *otlpStream) bool {
+			return total < previous.total
+		})
+		switch mode {
+		case otlpStale:
+			return nil, true
+		case otlpBaseline:
+			if stored := c.stored(point); stored != nil && stored.Delta != nil {
+				delta -= *stored.Delta
+				if delta < 0 {
+					delta = 0
+				}
+			}
+		case otlpSince:
+			delta -= previous.total
+		}
+		c.pending[key] = &otlpStream{start: dp.GetStartTimeUnixNano(), total: total}
+	}
+	if delta == 0 {
+		return nil, true
+	}
+	point.Delta = &delta
+	return point, true
+}
+
+// Метод, преобразующий точку Histogram. Точка без корзин становится гистограммой из одной корзины.
+// Для накопительной Histogram приращение считается относительно предыдущего значения того же потока.
+func (c *otlpConverter) histogram(
+	name string, dp *otlp.HistogramDataPoint, resource []*otlp.KeyValue, cumulative bool,
+) (*m.JSONMetrics, bool) {
+	histogram := &m.Histogram{
+		Bounds: dp.GetExplicitBounds(), Counts: dp.GetBucketCounts(), Count: dp.GetCount(), Sum: dp.GetSum(),
+	}
+	if len(histogram.Counts) == 0 {
+		histogram.Bounds, histogram.Counts = []float64{}, []uint64{dp.GetCount()}
+	}
+	if histogram.Validate() != nil {
+		return nil, false
+	}
+	point := otlpPoint(name, HISTOGRAM, resource, dp.GetAttributes(), dp.GetTimeUnixNano())
+	point.Histogram = histogram
+	if cumulative {
+		key := point.MType + "\x00" + point.Key()
+		var increase *m.Histogram
+		_, mode := c.resolve(key, dp.GetStartTimeUnixNano(), func(previous *otlpStream) bool {
+			var ok bool
+			increase, ok = histogram.Since(previous.histogram)
+			return !ok
+		})
+		switch mode {
+		case otlpStale:
+			return nil, true
+		case otlpBaseline:
+			if stored := c.stored(point); stored != nil && stored.Histogram != nil {
+				point.Histogram, _ = histogram.Since(stored.Histogram)
+			}
+		case otlpSince:
+			point.Histogram = increase
+		}
+		c.pending[key] = &otlpStream{start: dp.GetStartTimeUnixNano(), histogram: histogram}
+	}
+	if point.Histogram == nil || point.Histogram.Count == 0 {
+		return nil, true
+	}
+	return point, true
+}
+
+// Метод, забывающий потоки, серии которых больше нет в хранилище, например после удаления устаревших серий.
+func (s *otlpCumulative) forget(exists func(key string) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for stream := range s.streams {
+		_, key, _ := strings.Cut(stream, "\x00")
+		if !exists(key) {
+			delete(s.streams, stream)
+		}
+	}
+}
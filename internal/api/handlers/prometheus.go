@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+	"github.com/nmramorov/gowatcher/internal/storage"
+)
+
+// Тип содержимого текстового формата Prometheus.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Метод, отдающий все серии в текстовом формате Prometheus для сбора по /metrics.
+func (h *Handler) PrometheusMetrics(rw http.ResponseWriter, r *http.Request) {
+	snapshot, err := h.Storage.Snapshot(r.Context())
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", PrometheusContentType)
+	if err = WritePrometheus(rw, snapshot); err != nil {
+		log.ErrorLog.Printf("error writing prometheus metrics: %e", err)
+	}
+}
+
+// Функция, записывающая снимок метрик в текстовом формате Prometheus. Серии группируются в семейства
+// по имени и типу, перед семейством выводятся строки HELP (описание из метаданных) и TYPE. Histogram
+// выводится корзинами с границей le, summary — квантилями DefaultQuantiles, set — оценкой числа
+// элементов как gauge.
+func WritePrometheus(out io.Writer, snapshot *m.Metrics) error {
+	w := bufio.NewWriter(out)
+	for _, family := range prometheusFamilies(storage.ListSnapshot(snapshot)) {
+		writePrometheusHeader(w, family, snapshot.Metadata[family.id])
+		for _, metric := range family.series {
+			writePrometheusSeries(w, family.name, metric)
+		}
+	}
+	return w.Flush()
+}
+
+// Семейство серий Prometheus: серии одной метрики под общими строками HELP и TYPE.
+type prometheusFamily struct {
+	name   string
+	id     string
+	mtype  string
+	series []*m.JSONMetrics
+}
+
+// Функция, группирующая серии в семейства и назначающая им имена Prometheus, упорядоченные по имени.
+// Имя должно принадлежать одному семейству, иначе Prometheus отклонит весь ответ. Оно достаётся
+// метрике, которой не пришлось менять имя, а при равенстве — первой по имени и типу; остальные получают
+// суффикс с типом, а если занят и он — пропускаются. Имена серий _bucket, _sum и _count histogram
+// и summary тоже считаются занятыми.
+func prometheusFamilies(list []*m.JSONMetrics) []*prometheusFamily {
+	byMetric := make(map[string]*prometheusFamily)
+	families := make([]*prometheusFamily, 0)
+	for _, metric := range list {
+		key := metric.MType + "\x00" + metric.ID
+		family, ok := byMetric[key]
+		if !ok {
+			family = &prometheusFamily{id: metric.ID, mtype: prometheusType(metric.MType)}
+			byMetric[key] = family
+			families = append(families, family)
+		}
+		family.series = append(family.series, metric)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		iValid, jValid := prometheusName(families[i].id) == families[i].id, prometheusName(families[j].id) == families[j].id
+		if iValid != jValid {
+			return iValid
+		}
+		if families[i].id != families[j].id {
+			return families[i].id < families[j].id
+		}
+		return families[i].series[0].MType < families[j].series[0].MType
+	})
+	taken := make(map[string]bool)
+	named := make([]*prometheusFamily, 0, len(families))
+	for _, family := range families {
+		name := prometheusName(family.id)
+		if taken[name] {
+			name += "_" + family.series[0].MType
+		}
+		if taken[name] {
+			log.ErrorLog.Printf("skipping %s %s in prometheus output: name %s is already taken",
+				family.series[0].MType, family.id, name)
+			continue
+		}
+		taken[name] = true
+		if family.mtype == HISTOGRAM || family.mtype == SUMMARY {
+			taken[name+"_bucket"], taken[name+"_sum"], taken[name+"_count"] = true, true, true
+		}
+		family.name = name
+		named = append(named, family)
+	}
+	sort.Slice(named, func(i, j int) bool {
+		return named[i].name < named[j].name
+	})
+	return named
+}
+
+// Функция, возвращающая тип Prometheus для типа метрики: set выводится как gauge.
+func prometheusType(mtype string) string {
+	if mtype == SET {
+		return GAUGE
+	}
+	return mtype
+}
+
+func writePrometheusHeader(w *bufio.Writer, family *prometheusFamily, meta *m.Metadata) {
+	help := family.id
+	if meta != nil && meta.Help != "" {
+		help = meta.Help
+	}
+	if meta != nil && meta.Unit != "" {
+		help += " (" + meta.Unit + ")"
+	}
+	w.WriteString("# HELP " + family.name + " " + escapeHelp(help) + "\n")
+	w.WriteString("# TYPE " + family.name + " " + family.mtype + "\n")
+}
+
+func writePrometheusSeries(w *bufio.Writer, name string, metric *m.JSONMetrics) {
+	labels := prometheusLabelPairs(metric.Labels, reservedLabel(metric.MType))
+	sample := func(suffix string, value float64, extra ...string) {
+		w.WriteString(name + suffix + prometheusLabels(labels, extra...) + " " + formatPrometheusValue(value) + "\n")
+	}
+	switch {
+	case metric.MType == GAUGE && metric.Value != nil:
+		sample("", *metric.Value)
+	case metric.MType == COUNTER && metric.Delta != nil:
+		sample("", float64(*metric.Delta))
+	case metric.MType == HISTOGRAM && metric.Histogram != nil:
+		var cumulative uint64
+		for i, bound := range metric.Histogram.Bounds {
+			cumulative += metric.Histogram.Counts[i]
+			sample("_bucket", float64(cumulative), "le", formatPrometheusValue(bound))
+		}
+		sample("_bucket", float64(metric.Histogram.Count), "le", "+Inf")
+		sample("_sum", metric.Histogram.Sum)
+		sample("_count", float64(metric.Histogram.Count))
+	case metric.MType == SUMMARY && metric.Summary != nil:
+		for _, q := range metric.Summary.Quantiles(m.DefaultQuantiles) {
+			sample("", q.Value, "quantile", formatPrometheusValue(q.Quantile))
+		}
+		sample("_sum", metric.Summary.Sum)
+		sample("_count", float64(metric.Summary.Count))
+	case metric.MType == SET && metric.Estimate != nil:
+		sample("", float64(*metric.Estimate))
+	}
+}
+
+// Функция, приводящая имя метрики к допустимому в Prometheus: недопустимые символы заменяются на _.
+func prometheusName(id string) string {
+	return sanitizePrometheus(id, true)
+}
+
+func sanitizePrometheus(name string, colon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(colon && r == ':') || (i > 0 && r >= '0' && r <= '9')
+		if !valid {
+			r = '_'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// Функция, возвращающая метку, которую Prometheus формирует сам для типа метрики:
+// le у корзин гистограммы и quantile у квантилей summary.
+func reservedLabel(mtype string) string {
+	switch mtype {
+	case HISTOGRAM:
+		return "le"
+	case SUMMARY:
+		return "quantile"
+	}
+	return ""
+}
+
+// Функция, приводящая метки серии к допустимым в Prometheus и возвращающая пары имя="значение",
+// упорядоченные по имени. Имена, не требующие очистки, сохраняются. Метка с именем reserved и метки,
+// имена которых после замены недопустимых символов совпали с уже занятыми, получают префикс exported_,
+// как при сборе Prometheus; очищаемые имена занимаются в порядке исходных имён.
+func prometheusLabelPairs(labels map[string]string, reserved string) []string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	taken := map[string]bool{reserved: reserved != ""}
+	exported := make(map[string]string, len(labels))
+	for _, name := range names {
+		if sanitizePrometheus(name, false) == name && !taken[name] {
+			exported[name], taken[name] = name, true
+		}
+	}
+	for _, name := range names {
+		if _, ok := exported[name]; ok {
+			continue
+		}
+		target := sanitizePrometheus(name, false)
+		for taken[target] {
+			target = "exported_" + target
+		}
+		exported[name], taken[target] = target, true
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return exported[names[i]] < exported[names[j]]
+	})
+	pairs := make([]string, 0, len(names))
+	for _, name := range names {
+		pairs = append(pairs, exported[name]+`="`+escapeLabelValue(labels[name])+`"`)
+	}
+	return pairs
+}
+
+// Функция, формирующая набор меток серии в фигурных скобках из подготовленных пар.
+// Дополнительные метки le или quantile передаются парами имя, значение и выводятся последними.
+func prometheusLabels(pairs []string, extra ...string) string {
+	if len(pairs) == 0 && len(extra) == 0 {
+		return ""
+	}
+	all := make([]string, 0, len(pairs)+len(extra)/2)
+	all = append(all, pairs...)
+	for i := 0; i+1 < len(extra); i += 2 {
+		all = append(all, extra[i]+`="`+extra[i+1]+`"`)
+	}
+	return "{" + strings.Join(all, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatPrometheusValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
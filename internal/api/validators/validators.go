@@ -10,6 +10,12 @@ func validateMetricType(metricType string) bool {
 		return true
 	case "counter":
 		return true
+	case "histogram":
+		return true
+	case "summary":
+		return true
+	case "set":
+		return true
 	default:
 		return false
 	}
@@ -26,8 +26,11 @@ import (
 )
 
 var (
-	COUNTER = "counter"
-	GAUGE   = "gauge"
+	COUNTER   = "counter"
+	GAUGE     = "gauge"
+	HISTOGRAM = "histogram"
+	SUMMARY   = "summary"
+	SET       = "set"
 )
 
 func CreateRequests(endpoint string, mtrcs *m.Metrics) []*http.Request {
@@ -53,28 +56,69 @@ func CreateRequests(endpoint string, mtrcs *m.Metrics) []*http.Request {
 	return requests
 }
 
-func createBatch(src *m.Metrics) []*m.JSONMetrics {
-	batchCap := len(src.CounterMetrics) + len(src.GaugeMetrics)
+func createBatch(src *m.Metrics, labels map[string]string) []*m.JSONMetrics {
+	batchCap := len(src.CounterMetrics) + len(src.GaugeMetrics) + len(src.HistogramMetrics) +
+		len(src.SummaryMetrics) + len(src.SetMetrics)
 	batch := make([]*m.JSONMetrics, 0, batchCap)
 	for k, v := range src.GaugeMetrics {
 		v := v
 		batch = append(batch, &m.JSONMetrics{
-			ID:    k,
-			MType: GAUGE,
-			Value: (*float64)(&v),
+			ID:        k,
+			MType:     GAUGE,
+			Value:     (*float64)(&v),
+			Labels:    labels,
+			Timestamp: sampleTimestamp(src, k),
 		})
 	}
 	for k, v := range src.CounterMetrics {
 		v := v
 		batch = append(batch, &m.JSONMetrics{
-			ID:    k,
-			MType: COUNTER,
-			Delta: (*int64)(&v),
+			ID:        k,
+			MType:     COUNTER,
+			Delta:     (*int64)(&v),
+			Labels:    labels,
+			Timestamp: sampleTimestamp(src, k),
+		})
+	}
+	for k, v := range src.HistogramMetrics {
+		batch = append(batch, &m.JSONMetrics{
+			ID:        k,
+			MType:     HISTOGRAM,
+			Histogram: v.Copy(),
+			Labels:    labels,
+			Timestamp: sampleTimestamp(src, k),
+		})
+	}
+	for k, v := range src.SummaryMetrics {
+		batch = append(batch, &m.JSONMetrics{
+			ID:        k,
+			MType:     SUMMARY,
+			Summary:   v.Copy(),
+			Labels:    labels,
+			Timestamp: sampleTimestamp(src, k),
+		})
+	}
+	for k, v := range src.SetMetrics {
+		batch = append(batch, &m.JSONMetrics{
+			ID:        k,
+			MType:     SET,
+			Set:       v.Copy(),
+			Labels:    labels,
+			Timestamp: sampleTimestamp(src, k),
 		})
 	}
 	return batch
 }
 
+// Функция, возвращающая время последнего сбора метрики, если оно известно.
+func sampleTimestamp(src *m.Metrics, key string) *int64 {
+	ts, ok := src.Timestamps[key]
+	if !ok {
+		return nil
+	}
+	return &ts
+}
+
 func encodeBatch(batch []*m.JSONMetrics, certPath string) *bytes.Buffer {
 	body := bytes.NewBuffer([]byte{})
 	encoder := json.NewEncoder(body)
@@ -95,8 +139,8 @@ func encodeBatch(batch []*m.JSONMetrics, certPath string) *bytes.Buffer {
 	return buf
 }
 
-func createRequestsBatch(endpoint, path, certPath string, src *m.Metrics) *http.Request {
-	batch := createBatch(src)
+func createRequestsBatch(endpoint, path, certPath string, src *m.Metrics, labels map[string]string) *http.Request {
+	batch := createBatch(src, labels)
 	body := encodeBatch(batch, certPath)
 	req, err := http.NewRequest(http.MethodPost, endpoint+path, body)
 	if err != nil {
@@ -107,7 +151,9 @@ func createRequestsBatch(endpoint, path, certPath string, src *m.Metrics) *http.
 	return req
 }
 
-func createBody(metricType, path, key, secretkey, certPath string, value interface{}) *bytes.Buffer {
+func createBody(metricType, path, key, secretkey, certPath string, value interface{},
+	labels map[string]string,
+) *bytes.Buffer {
 	var hash string
 	if secretkey != "" {
 		generator := hashgen.NewHashGenerator(secretkey)
@@ -133,6 +179,7 @@ func createBody(metricType, path, key, secretkey, certPath string, value interfa
 		toEncode.Hash = hash
 	}
 	toEncode.ID = key
+	toEncode.Labels = labels
 	if path == "/value/" {
 		toEncode.Delta = nil
 		toEncode.Value = nil
@@ -151,10 +198,12 @@ func createBody(metricType, path, key, secretkey, certPath string, value interfa
 	return buf
 }
 
-func createGaugeRequests(endpoint, path, key, certPath string, gaugeMetrics map[string]m.Gauge) []*http.Request {
+func createGaugeRequests(endpoint, path, key, certPath string, gaugeMetrics map[string]m.Gauge,
+	labels map[string]string,
+) []*http.Request {
 	requests := make([]*http.Request, 0)
 	for k, v := range gaugeMetrics {
-		body := createBody(GAUGE, path, k, key, certPath, v)
+		body := createBody(GAUGE, path, k, key, certPath, v, labels)
 
 		req, err := http.NewRequest(http.MethodPost, endpoint+path, body)
 		if err != nil {
@@ -167,10 +216,12 @@ func createGaugeRequests(endpoint, path, key, certPath string, gaugeMetrics map[
 	return requests
 }
 
-func createCounterRequests(endpoint, path, key, certPath string, counterMetrics map[string]m.Counter) []*http.Request {
+func createCounterRequests(endpoint, path, key, certPath string, counterMetrics map[string]m.Counter,
+	labels map[string]string,
+) []*http.Request {
 	requests := make([]*http.Request, 0)
 	for k, v := range counterMetrics {
-		body := createBody(COUNTER, path, k, key, certPath, v)
+		body := createBody(COUNTER, path, k, key, certPath, v, labels)
 		req, err := http.NewRequest(http.MethodPost, endpoint+path, body)
 		if err != nil {
 			log.ErrorLog.Printf("Could not do POST request for counter with params: %s %d", k, v)
@@ -182,19 +233,23 @@ func createCounterRequests(endpoint, path, key, certPath string, counterMetrics
 	return requests
 }
 
-func generateMetricsRequests(endpoint, path, key, certPath string, src *m.Metrics) []*http.Request {
-	gaugeRequests := createGaugeRequests(endpoint, path, key, certPath, src.GaugeMetrics)
-	counterRequests := createCounterRequests(endpoint, path, key, certPath, src.CounterMetrics)
+func generateMetricsRequests(endpoint, path, key, certPath string, src *m.Metrics,
+	labels map[string]string,
+) []*http.Request {
+	gaugeRequests := createGaugeRequests(endpoint, path, key, certPath, src.GaugeMetrics, labels)
+	counterRequests := createCounterRequests(endpoint, path, key, certPath, src.CounterMetrics, labels)
 	return append(gaugeRequests, counterRequests...)
 }
 
-func PushMetrics(client *http.Client, endpoint string, mtrcs *m.Metrics, key, certPath string) {
+func PushMetrics(client *http.Client, endpoint string, mtrcs *m.Metrics, key, certPath string,
+	labels map[string]string,
+) {
 	defer func() {
 		if p := recover(); p != nil {
 			log.ErrorLog.Println(p)
 		}
 	}()
-	requests := generateMetricsRequests(endpoint, "/update/", key, certPath, mtrcs)
+	requests := generateMetricsRequests(endpoint, "/update/", key, certPath, mtrcs, labels)
 	for _, request := range requests {
 		resp, err := client.Do(request)
 		if err != nil {
@@ -207,13 +262,13 @@ func PushMetrics(client *http.Client, endpoint string, mtrcs *m.Metrics, key, ce
 	}
 }
 
-func PushMetricsBatch(client *http.Client, endpoint, certPath string, mtrcs *m.Metrics) {
+func PushMetricsBatch(client *http.Client, endpoint, certPath string, mtrcs *m.Metrics, labels map[string]string) {
 	defer func() {
 		if p := recover(); p != nil {
 			log.ErrorLog.Println(p)
 		}
 	}()
-	request := createRequestsBatch(endpoint, "/updates/", certPath, mtrcs)
+	request := createRequestsBatch(endpoint, "/updates/", certPath, mtrcs, labels)
 	resp, err := client.Do(request)
 	if err != nil {
 		log.ErrorLog.Println(err)
@@ -224,13 +279,15 @@ func PushMetricsBatch(client *http.Client, endpoint, certPath string, mtrcs *m.M
 	}
 }
 
-func GetMetricsValues(client *http.Client, endpoint, key, certPath string, mtrcs *m.Metrics) {
+func GetMetricsValues(client *http.Client, endpoint, key, certPath string, mtrcs *m.Metrics,
+	labels map[string]string,
+) {
 	defer func() {
 		if p := recover(); p != nil {
 			log.ErrorLog.Println(p)
 		}
 	}()
-	requests := generateMetricsRequests(endpoint, "/value/", key, certPath, mtrcs)
+	requests := generateMetricsRequests(endpoint, "/value/", key, certPath, mtrcs, labels)
 	for _, request := range requests {
 		resp, err := client.Do(request)
 		if err != nil {
@@ -280,6 +337,9 @@ func RunConcurrently(ctx context.Context, stateSignal chan struct{}, config *con
 	jobCh := make(chan *Job, config.RateLimit)
 	var wg sync.WaitGroup
 	collector := col.NewCollector()
+	if len(config.Buckets) > 0 {
+		collector.Buckets = config.Buckets
+	}
 	wg.Add(1)
 	go func() {
 		RunTickers(ctx, stateSignal, config, jobCh)
@@ -298,13 +358,15 @@ func RunConcurrently(ctx context.Context, stateSignal chan struct{}, config *con
 	wg.Wait()
 }
 
-func PushMetricsGRPC(ctx context.Context, col *col.Collector, client pb.MetricsClient) {
+func PushMetricsGRPC(ctx context.Context, col *col.Collector, client pb.MetricsClient, labels map[string]string) {
 	for k, v := range col.Metrics.CounterMetrics {
 		resp, err := client.AddMetric(ctx, &pb.AddMetricRequest{
 			Metric: &pb.Metric{
-				Id:    k,
-				Mtype: "counter",
-				Delta: int64(v),
+				Id:        k,
+				Mtype:     "counter",
+				Delta:     int64(v),
+				Labels:    labels,
+				Timestamp: col.Metrics.Timestamps[k],
 			},
 		})
 		if err != nil {
@@ -315,11 +377,81 @@ func PushMetricsGRPC(ctx context.Context, col *col.Collector, client pb.MetricsC
 		}
 	}
 	for k, v := range col.Metrics.GaugeMetrics {
+		resp, err := client.AddMetric(ctx, &pb.AddMetricRequest{
+			Metric: &pb.Metric{
+				Id:        k,
+				Mtype:     "gauge",
+				Value:     float64(v),
+				Labels:    labels,
+				Timestamp: col.Metrics.Timestamps[k],
+			},
+		})
+		if err != nil {
+			log.ErrorLog.Printf("GRPC. Error pushing metric %s: %e", k, err)
+		}
+		if resp != nil && resp.Error != "" {
+			log.ErrorLog.Printf("GRPC resp error: %s", resp.Error)
+		}
+	}
+	for k, v := range col.Metrics.HistogramMetrics {
 		resp, err := client.AddMetric(ctx, &pb.AddMetricRequest{
 			Metric: &pb.Metric{
 				Id:    k,
-				Mtype: "counter",
-				Value: float64(v),
+				Mtype: HISTOGRAM,
+				Histogram: &pb.Histogram{
+					Bounds: v.Bounds,
+					Counts: v.Counts,
+					Count:  v.Count,
+					Sum:    v.Sum,
+				},
+				Labels:    labels,
+				Timestamp: col.Metrics.Timestamps[k],
+			},
+		})
+		if err != nil {
+			log.ErrorLog.Printf("GRPC. Error pushing metric %s: %e", k, err)
+		}
+		if resp != nil && resp.Error != "" {
+			log.ErrorLog.Printf("GRPC resp error: %s", resp.Error)
+		}
+	}
+	for k, v := range col.Metrics.SummaryMetrics {
+		resp, err := client.AddMetric(ctx, &pb.AddMetricRequest{
+			Metric: &pb.Metric{
+				Id:    k,
+				Mtype: SUMMARY,
+				Summary: &pb.Summary{
+					RelativeAccuracy: v.RelativeAccuracy,
+					Positive:         v.Positive,
+					Negative:         v.Negative,
+					Zero:             v.Zero,
+					Count:            v.Count,
+					Sum:              v.Sum,
+					Min:              v.Min,
+					Max:              v.Max,
+				},
+				Labels:    labels,
+				Timestamp: col.Metrics.Timestamps[k],
+			},
+		})
+		if err != nil {
+			log.ErrorLog.Printf("GRPC. Error pushing metric %s: %e", k, err)
+		}
+		if resp != nil && resp.Error != "" {
+			log.ErrorLog.Printf("GRPC resp error: %s", resp.Error)
+		}
+	}
+	for k, v := range col.Metrics.SetMetrics {
+		resp, err := client.AddMetric(ctx, &pb.AddMetricRequest{
+			Metric: &pb.Metric{
+				Id:    k,
+				Mtype: SET,
+				Set: &pb.Set{
+					Precision: uint32(v.Precision),
+					Registers: v.Registers,
+				},
+				Labels:    labels,
+				Timestamp: col.Metrics.Timestamps[k],
 			},
 		})
 		if err != nil {
@@ -331,13 +463,14 @@ func PushMetricsGRPC(ctx context.Context, col *col.Collector, client pb.MetricsC
 	}
 }
 
-func GetMetricsGRPC(ctx context.Context, metrics *m.Metrics, client pb.MetricsClient) {
+func GetMetricsGRPC(ctx context.Context, metrics *m.Metrics, client pb.MetricsClient, labels map[string]string) {
 	for k := range metrics.CounterMetrics {
 		resp, err := client.GetMetric(
 			ctx, &pb.GetMetricRequest{
 				Metric: &pb.Metric{
-					Id:    k,
-					Mtype: "counter",
+					Id:     k,
+					Mtype:  "counter",
+					Labels: labels,
 				},
 			},
 		)
@@ -355,8 +488,9 @@ func GetMetricsGRPC(ctx context.Context, metrics *m.Metrics, client pb.MetricsCl
 		resp, err := client.GetMetric(
 			ctx, &pb.GetMetricRequest{
 				Metric: &pb.Metric{
-					Id:    k,
-					Mtype: "gauge",
+					Id:     k,
+					Mtype:  "gauge",
+					Labels: labels,
 				},
 			},
 		)
@@ -390,21 +524,28 @@ func RunJob(ctx context.Context, job *Job, collector *col.Collector, client *htt
 			collector.UpdateExtraMetrics()
 			log.InfoLog.Println("Extra metrics have been updated concurrently")
 		case "push":
+			start := time.Now()
 			if agentConfig.GRPC {
 				PushMetricsGRPC(
-					jobCtx, collector, grpcClient,
+					jobCtx, collector, grpcClient, agentConfig.Labels,
 				)
 				log.InfoLog.Println("Metrics have been pushed via GRPC")
-				GetMetricsGRPC(jobCtx, collector.GetMetrics(), grpcClient)
+				GetMetricsGRPC(jobCtx, collector.GetMetrics(), grpcClient, agentConfig.Labels)
 				log.InfoLog.Println("Metrics have been received via GRPC")
 			} else {
-				PushMetrics(client, endpoint, collector.GetMetrics(), agentConfig.Key, agentConfig.PublicKeyPath)
+				PushMetrics(client, endpoint, collector.GetMetrics(), agentConfig.Key, agentConfig.PublicKeyPath,
+					agentConfig.Labels)
 				log.InfoLog.Println("Metrics have been pushed")
-				PushMetricsBatch(client, endpoint, agentConfig.PublicKeyPath, collector.GetMetrics())
+				PushMetricsBatch(client, endpoint, agentConfig.PublicKeyPath, collector.GetMetrics(), agentConfig.Labels)
 				log.InfoLog.Println("Batch metrics were pushed")
-				GetMetricsValues(client, endpoint, agentConfig.Key, agentConfig.PublicKeyPath, collector.GetMetrics())
+				GetMetricsValues(client, endpoint, agentConfig.Key, agentConfig.PublicKeyPath, collector.GetMetrics(),
+					agentConfig.Labels)
 				log.InfoLog.Println("Metrics update has been received")
 			}
+			// гистограммы и скетчи отправляются как приращения, поэтому после отправки обнуляются
+			collector.ResetDistributions()
+			collector.ObserveHistogram("PushDuration", time.Since(start).Seconds())
+			collector.ObserveSummary("PushDurationQuantiles", time.Since(start).Seconds())
 		}
 	}
 }
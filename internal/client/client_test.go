@@ -23,7 +23,7 @@ func TestPushMetrics(t *testing.T) {
 	endpoint := "http://127.0.0.1:8080"
 
 	client := &http.Client{}
-	assert.NotPanics(t, func() { PushMetrics(client, endpoint, collector.GetMetrics(), "", "") })
+	assert.NotPanics(t, func() { PushMetrics(client, endpoint, collector.GetMetrics(), "", "", nil) })
 }
 
 func TestCreateRequests(t *testing.T) {
@@ -37,7 +37,7 @@ func TestPushMetricsBatch(t *testing.T) {
 	endpoint := "http://127.0.0.1:8080"
 
 	client := &http.Client{}
-	assert.NotPanics(t, func() { PushMetricsBatch(client, endpoint, "", collector.GetMetrics()) })
+	assert.NotPanics(t, func() { PushMetricsBatch(client, endpoint, "", collector.GetMetrics(), nil) })
 }
 
 func TestGetMetricsValues(t *testing.T) {
@@ -45,7 +45,7 @@ func TestGetMetricsValues(t *testing.T) {
 	endpoint := "http://127.0.0.1:8080"
 
 	client := &http.Client{}
-	assert.NotPanics(t, func() { GetMetricsValues(client, endpoint, "gauge", "", collector.GetMetrics()) })
+	assert.NotPanics(t, func() { GetMetricsValues(client, endpoint, "gauge", "", collector.GetMetrics(), nil) })
 }
 
 func TestClientRun(t *testing.T) {
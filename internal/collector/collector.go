@@ -1,6 +1,8 @@
 package collector
 
 import (
+	stdErrors "errors"
+	"fmt"
 	"reflect"
 	"runtime"
 	"strconv"
@@ -17,26 +19,42 @@ import (
 
 type Collector struct {
 	m.Collector
-	Metrics *m.Metrics
-	Updates int
-	mu      sync.Mutex
+	Metrics    *m.Metrics
+	Updates    int
+	Buckets    []float64
+	OutOfOrder OutOfOrderPolicy
+	Staleness  Staleness
+	mu         sync.Mutex
+	// Накопленные значения counter для расчёта rate и increase.
+	counterHistory map[string][]counterSample
 }
 
 func NewCollector() *Collector {
 	var memstats runtime.MemStats
 	runtime.ReadMemStats(&memstats)
 
-	return &Collector{
-		Metrics: m.NewMetrics(),
-		Updates: 0,
+	col := &Collector{
+		Metrics:    m.NewMetrics(),
+		Updates:    0,
+		Buckets:    m.DefaultBuckets,
+		OutOfOrder: OutOfOrderPolicy{Mode: OutOfOrderAccept},
 	}
+	col.registerStoredSeries()
+	col.markStoredSeries(time.Now())
+	return col
 }
 
 func NewCollectorFromSavedFile(saved *m.Metrics) *Collector {
-	return &Collector{
-		Metrics: saved,
-		Updates: 0,
+	saved.EnsureInitialized()
+	col := &Collector{
+		Metrics:    saved,
+		Updates:    0,
+		Buckets:    m.DefaultBuckets,
+		OutOfOrder: OutOfOrderPolicy{Mode: OutOfOrderAccept},
 	}
+	col.registerStoredSeries()
+	col.markStoredSeries(time.Now())
+	return col
 }
 
 func (col *Collector) UpdateMetrics() {
@@ -46,27 +64,183 @@ func (col *Collector) UpdateMetrics() {
 	runtime.ReadMemStats(&newstats)
 
 	col.Updates++
+	previous := col.Metrics
 	col.Metrics = m.UpdateMetrics(&newstats, col.Updates)
+	col.Metrics.HistogramMetrics, col.Metrics.SummaryMetrics = previous.HistogramMetrics, previous.SummaryMetrics
+	col.Metrics.SetMetrics = previous.SetMetrics
+	col.Metrics.Metadata, col.Metrics.Timestamps = previous.Metadata, previous.Timestamps
+	col.Metrics.UpdatedAt = previous.UpdatedAt
+	now := time.Now()
+	for key := range col.Metrics.GaugeMetrics {
+		col.touchSeries(key, now)
+	}
+	for key := range col.Metrics.CounterMetrics {
+		col.touchSeries(key, now)
+	}
+}
+
+// Метод, добавляющий наблюдение в гистограмму с границами корзин коллектора.
+func (col *Collector) ObserveHistogram(name string, value float64) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	histogram, ok := col.Metrics.HistogramMetrics[name]
+	if !ok {
+		histogram = m.NewHistogram(col.Buckets)
+		col.Metrics.HistogramMetrics[name] = histogram
+	}
+	histogram.Observe(value)
+	col.touchSeries(name, time.Now())
+}
+
+// Метод, добавляющий наблюдение в скетч квантилей.
+func (col *Collector) ObserveSummary(name string, value float64) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	summary, ok := col.Metrics.SummaryMetrics[name]
+	if !ok {
+		summary = m.NewSummary(m.DefaultRelativeAccuracy)
+		col.Metrics.SummaryMetrics[name] = summary
+	}
+	summary.Observe(value)
+	col.touchSeries(name, time.Now())
+}
+
+// Метод, добавляющий элемент в скетч уникальных значений.
+func (col *Collector) ObserveSet(name, member string) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	set, ok := col.Metrics.SetMetrics[name]
+	if !ok {
+		set = m.NewSet(m.DefaultSetPrecision)
+		col.Metrics.SetMetrics[name] = set
+	}
+	set.Add(member)
+	col.touchSeries(name, time.Now())
+}
+
+// Метод, обнуляющий гистограммы и скетчи после их отправки на сервер.
+func (col *Collector) ResetDistributions() {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	for _, histogram := range col.Metrics.HistogramMetrics {
+		histogram.Reset()
+	}
+	for _, summary := range col.Metrics.SummaryMetrics {
+		summary.Reset()
+	}
+	for _, set := range col.Metrics.SetMetrics {
+		set.Reset()
+	}
 }
 
 func (col *Collector) GetMetrics() *m.Metrics {
 	return col.Metrics
 }
 
+// Метод, возвращающий копию всех серий, которую можно читать и сохранять без блокировки коллектора.
+func (col *Collector) Snapshot() *m.Metrics {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	snapshot := &m.Metrics{}
+	snapshot.EnsureInitialized()
+	for key, value := range col.Metrics.GaugeMetrics {
+		snapshot.GaugeMetrics[key] = value
+	}
+	for key, value := range col.Metrics.CounterMetrics {
+		snapshot.CounterMetrics[key] = value
+	}
+	for key, value := range col.Metrics.HistogramMetrics {
+		snapshot.HistogramMetrics[key] = value.Copy()
+	}
+	for key, value := range col.Metrics.SummaryMetrics {
+		snapshot.SummaryMetrics[key] = value.Copy()
+	}
+	for key, value := range col.Metrics.SetMetrics {
+		snapshot.SetMetrics[key] = value.Copy()
+	}
+	for key, value := range col.Metrics.Metadata {
+		meta := *value
+		snapshot.Metadata[key] = &meta
+	}
+	for key, value := range col.Metrics.Timestamps {
+		snapshot.Timestamps[key] = value
+	}
+	for key, value := range col.Metrics.UpdatedAt {
+		snapshot.UpdatedAt[key] = value
+	}
+	return snapshot
+}
+
+// Метод, заменяющий все серии коллектора сохранёнными ранее, например при восстановлении из файла.
+func (col *Collector) Restore(saved *m.Metrics) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	saved.EnsureInitialized()
+	col.Metrics = saved
+	col.counterHistory = nil
+	col.registerStoredSeries()
+	col.markStoredSeries(time.Now())
+}
+
 func (col *Collector) GetMetric(name string) (interface{}, error) {
-	for k, v := range col.Metrics.CounterMetrics {
-		if k == name {
-			return v, nil
-		}
+	return col.GetMetricWithLabels(name, nil)
+}
+
+// Метод, возвращающий значение серии с заданным именем, метки которой удовлетворяют matchers.
+func (col *Collector) GetMetricWithLabels(name string, matchers map[string]string) (interface{}, error) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if key, ok := findSeries(col.Metrics.CounterMetrics, name, matchers); ok {
+		return col.Metrics.CounterMetrics[key], nil
 	}
-	for k, v := range col.Metrics.GaugeMetrics {
-		if k == name {
-			return v, nil
-		}
+	if key, ok := findSeries(col.Metrics.GaugeMetrics, name, matchers); ok {
+		return col.Metrics.GaugeMetrics[key], nil
+	}
+	if key, ok := findSeries(col.Metrics.HistogramMetrics, name, matchers); ok {
+		return col.Metrics.HistogramMetrics[key], nil
+	}
+	if key, ok := findSeries(col.Metrics.SummaryMetrics, name, matchers); ok {
+		return col.Metrics.SummaryMetrics[key], nil
+	}
+	if key, ok := findSeries(col.Metrics.SetMetrics, name, matchers); ok {
+		return col.Metrics.SetMetrics[key], nil
 	}
 	return 1, errors.ErrorMetricNotFound
 }
 
+// Функция, находящая ключ серии по имени метрики и условиям на метки. Из подходящих серий выбирается
+// серия с самым коротким каноническим представлением меток (LabelsJSON), при равной длине — первая
+// по байтам; точное совпадение всегда короче остальных. Так же выбирают запросы Select диалектов БД.
+func findSeries[T any](series map[string]T, name string, matchers map[string]string) (string, bool) {
+	key := m.SeriesKey(name, matchers)
+	if _, ok := series[key]; ok {
+		return key, true
+	}
+	found, foundLabels := key, ""
+	for k := range series {
+		id, labels := m.ParseSeriesKey(k)
+		if id != name || !m.MatchLabels(labels, matchers) {
+			continue
+		}
+		encoded := m.LabelsJSON(labels)
+		if foundLabels == "" || len(encoded) < len(foundLabels) ||
+			(len(encoded) == len(foundLabels) && encoded < foundLabels) {
+			found, foundLabels = k, encoded
+		}
+	}
+	return found, foundLabels != ""
+}
+
+// Функция, находящая ключ серии точно по меткам запроса или, если exact не задан, по условиям на метки.
+func lookupSeries[T any](exact bool, series map[string]T, name string, labels map[string]string) (string, bool) {
+	if !exact {
+		return findSeries(series, name, labels)
+	}
+	key := m.SeriesKey(name, labels)
+	_, ok := series[key]
+	return key, ok
+}
+
 func (col *Collector) String(value interface{}) (string, error) {
 	val := reflect.ValueOf(value)
 	switch val.Kind() {
@@ -75,6 +249,9 @@ func (col *Collector) String(value interface{}) (string, error) {
 	case reflect.Int64:
 		return strconv.FormatInt(val.Int(), 10), nil
 	default:
+		if stringer, ok := value.(fmt.Stringer); ok {
+			return stringer.String(), nil
+		}
 		return "", errors.ErrorWrongStringConvertion
 	}
 }
@@ -83,51 +260,242 @@ func (col *Collector) UpdateMetricFromJSON(newMetric *m.JSONMetrics) (*m.JSONMet
 	col.mu.Lock()
 	defer col.mu.Unlock()
 	result := m.JSONMetrics{}
+	key := newMetric.Key()
+	if err := col.checkType(newMetric.ID, newMetric.MType); err != nil {
+		return &result, err
+	}
+	sampleTime := newMetric.SampleTime(time.Now())
+	late, err := col.checkSampleTime(key, sampleTime)
+	if err != nil {
+		return &result, err
+	}
+	// Итог накопительной метрики после запоздавшего наблюдения уже включает более новые,
+	// поэтому он относится ко времени последнего наблюдения серии, а не запоздавшего.
+	valueTimestamp := newMetric.Timestamp
+	if late && newMetric.MType != "gauge" {
+		last := col.Metrics.Timestamps[key]
+		valueTimestamp = &last
+	}
 	switch newMetric.MType {
 	case "gauge":
-		col.Metrics.GaugeMetrics[newMetric.ID] = m.Gauge(*newMetric.Value)
-		val := col.Metrics.GaugeMetrics[newMetric.ID]
-		result.Value = (*float64)(&val)
+		if newMetric.Value == nil {
+			return &result, errors.ErrorMetricValue
+		}
+		// запоздавшее значение попадает в историю, но не заменяет более новое текущее
+		val := *newMetric.Value
+		if !late {
+			col.Metrics.GaugeMetrics[key] = m.Gauge(val)
+		}
+		result.Value = &val
 	case "counter":
-		col.Metrics.CounterMetrics[newMetric.ID] += m.Counter(*newMetric.Delta)
-		delta := col.Metrics.CounterMetrics[newMetric.ID]
+		if newMetric.Delta == nil {
+			return &result, errors.ErrorMetricValue
+		}
+		col.Metrics.CounterMetrics[key] += m.Counter(*newMetric.Delta)
+		delta := col.Metrics.CounterMetrics[key]
+		col.recordCounter(key, delta, sampleTime)
 		result.Delta = (*int64)(&delta)
+	case "histogram":
+		if newMetric.Histogram == nil {
+			return &result, errors.ErrorMetricValue
+		}
+		if err := newMetric.Histogram.Validate(); err != nil {
+			return &result, err
+		}
+		stored, ok := col.Metrics.HistogramMetrics[key]
+		if !ok {
+			stored = m.NewHistogram(newMetric.Histogram.Bounds)
+			col.Metrics.HistogramMetrics[key] = stored
+		}
+		if err := stored.Merge(newMetric.Histogram); err != nil {
+			return &result, err
+		}
+		result.Histogram = stored.Copy()
+	case "summary":
+		stored, err := col.updateSummary(key, newMetric)
+		if err != nil {
+			return &result, err
+		}
+		result.Summary = stored.Copy()
+		result.Quantiles = stored.Quantiles(nil)
+	case "set":
+		stored, err := col.updateSet(key, newMetric)
+		if err != nil {
+			return &result, err
+		}
+		estimate := stored.Estimate()
+		result.Set = stored.Copy()
+		result.Estimate = &estimate
 	default:
 		return &result, errors.ErrorMetricNotFound
 	}
+	col.registerType(newMetric.ID, newMetric.MType)
+	col.touchSeries(key, sampleTime)
+	col.markUpdated(key, time.Now())
 	result.MType = newMetric.MType
 	result.ID = newMetric.ID
+	result.Labels = newMetric.Labels
+	result.Timestamp = valueTimestamp
 	return &result, nil
 }
 
+// Метод, возвращающий метрику в формате JSON. Метки запроса используются как условия отбора серии.
 func (col *Collector) GetMetricJSON(requestedMetric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	return col.getMetric(requestedMetric, false)
+}
+
+// Метод, возвращающий серию, набор меток которой в точности совпадает с метками запроса. Нужен
+// приёмникам, пересчитывающим присланные итоги в приращения: серия с другими метками не подходит.
+func (col *Collector) GetSeries(requestedMetric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	return col.getMetric(requestedMetric, true)
+}
+
+func (col *Collector) getMetric(requestedMetric *m.JSONMetrics, exact bool) (*m.JSONMetrics, error) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
 	result := m.JSONMetrics{}
+	var key string
 	switch requestedMetric.MType {
+	// Для отсутствующих gauge и counter вместе с ошибкой возвращается нулевое значение,
+	// которое отдаёт JSON API.
 	case "gauge":
-		res := col.Metrics.GaugeMetrics[requestedMetric.ID]
+		var ok bool
+		key, ok = lookupSeries(exact, col.Metrics.GaugeMetrics, requestedMetric.ID, requestedMetric.Labels)
+		res := col.Metrics.GaugeMetrics[key]
 		result.Value = (*float64)(&res)
-
+		if !ok {
+			result.ID, result.MType, result.Labels = requestedMetric.ID, requestedMetric.MType, requestedMetric.Labels
+			return &result, errors.ErrorMetricNotFound
+		}
 	case "counter":
-		res := col.Metrics.CounterMetrics[requestedMetric.ID]
+		var ok bool
+		key, ok = lookupSeries(exact, col.Metrics.CounterMetrics, requestedMetric.ID, requestedMetric.Labels)
+		res := col.Metrics.CounterMetrics[key]
 		result.Delta = (*int64)(&res)
+		if !ok {
+			result.ID, result.MType, result.Labels = requestedMetric.ID, requestedMetric.MType, requestedMetric.Labels
+			return &result, errors.ErrorMetricNotFound
+		}
+		if requestedMetric.Window != "" {
+			window, err := ParseRateWindow(requestedMetric.Window)
+			if err != nil {
+				return requestedMetric, err
+			}
+			increase, rate := counterIncrease(col.counterHistory[key], window, time.Now())
+			result.Window = requestedMetric.Window
+			result.Increase = &increase
+			result.Rate = &rate
+		}
+	case "histogram":
+		var ok bool
+		key, ok = lookupSeries(exact, col.Metrics.HistogramMetrics, requestedMetric.ID, requestedMetric.Labels)
+		if !ok {
+			return requestedMetric, errors.ErrorMetricNotFound
+		}
+		result.Histogram = col.Metrics.HistogramMetrics[key].Copy()
+	case "summary":
+		var ok bool
+		key, ok = lookupSeries(exact, col.Metrics.SummaryMetrics, requestedMetric.ID, requestedMetric.Labels)
+		if !ok {
+			return requestedMetric, errors.ErrorMetricNotFound
+		}
+		levels := make([]float64, 0, len(requestedMetric.Quantiles))
+		for _, q := range requestedMetric.Quantiles {
+			levels = append(levels, q.Quantile)
+		}
+		result.Summary = col.Metrics.SummaryMetrics[key].Copy()
+		result.Quantiles = result.Summary.Quantiles(levels)
+	case "set":
+		var ok bool
+		key, ok = lookupSeries(exact, col.Metrics.SetMetrics, requestedMetric.ID, requestedMetric.Labels)
+		if !ok {
+			return requestedMetric, errors.ErrorMetricNotFound
+		}
+		result.Set = col.Metrics.SetMetrics[key].Copy()
+		estimate := result.Set.Estimate()
+		result.Estimate = &estimate
 	default:
 		return requestedMetric, errors.ErrorMetricNotFound
 	}
 	result.MType = requestedMetric.MType
-	result.ID = requestedMetric.ID
+	result.ID, result.Labels = m.ParseSeriesKey(key)
+	result.Stale = col.isStale(key, time.Now())
 
 	return &result, nil
 }
 
-func (col *Collector) UpdateBatch(metrics []*m.JSONMetrics) error {
+// Метод, объединяющий присланный скетч и сырые наблюдения с хранимым скетчем серии.
+func (col *Collector) updateSummary(key string, newMetric *m.JSONMetrics) (*m.Summary, error) {
+	if newMetric.Summary == nil && len(newMetric.Samples) == 0 {
+		return nil, errors.ErrorMetricValue
+	}
+	accuracy := m.DefaultRelativeAccuracy
+	if newMetric.Summary != nil {
+		if err := newMetric.Summary.Validate(); err != nil {
+			return nil, err
+		}
+		accuracy = newMetric.Summary.RelativeAccuracy
+	}
+	stored, ok := col.Metrics.SummaryMetrics[key]
+	if !ok {
+		stored = m.NewSummary(accuracy)
+	}
+	if newMetric.Summary != nil {
+		if err := stored.Merge(newMetric.Summary); err != nil {
+			return nil, err
+		}
+	}
+	for _, sample := range newMetric.Samples {
+		stored.Observe(sample)
+	}
+	col.Metrics.SummaryMetrics[key] = stored
+	return stored, nil
+}
+
+// Метод, объединяющий присланный скетч и элементы множества с хранимым скетчем серии.
+func (col *Collector) updateSet(key string, newMetric *m.JSONMetrics) (*m.Set, error) {
+	if newMetric.Set == nil && len(newMetric.Members) == 0 {
+		return nil, errors.ErrorMetricValue
+	}
+	precision := m.DefaultSetPrecision
+	if newMetric.Set != nil {
+		if err := newMetric.Set.Validate(); err != nil {
+			return nil, err
+		}
+		precision = newMetric.Set.Precision
+	}
+	stored, ok := col.Metrics.SetMetrics[key]
+	if !ok {
+		stored = m.NewSet(precision)
+	}
+	if newMetric.Set != nil {
+		if err := stored.Merge(newMetric.Set); err != nil {
+			return nil, err
+		}
+	}
+	for _, member := range newMetric.Members {
+		stored.Add(member)
+	}
+	col.Metrics.SetMetrics[key] = stored
+	return stored, nil
+}
+
+// Метод, обновляющий метрики пакетом. Возвращает итоговые значения принятых серий:
+// запоздавшие наблюдения, отброшенные политикой, пропускаются и не прерывают обработку пакета.
+func (col *Collector) UpdateBatch(metrics []*m.JSONMetrics) ([]*m.JSONMetrics, error) {
+	accepted := make([]*m.JSONMetrics, 0, len(metrics))
 	for _, metric := range metrics {
-		_, err := col.UpdateMetricFromJSON(metric)
+		updated, err := col.UpdateMetricFromJSON(metric)
+		if stdErrors.Is(err, errors.ErrorLateSample) {
+			continue
+		}
 		if err != nil {
 			log.ErrorLog.Printf("could not update metric as batch part: %e", err)
-			return err
+			return accepted, err
 		}
+		accepted = append(accepted, updated)
 	}
-	return nil
+	return accepted, nil
 }
 
 func (col *Collector) UpdateExtraMetrics() {
@@ -138,4 +506,8 @@ func (col *Collector) UpdateExtraMetrics() {
 	col.Metrics.GaugeMetrics["TotalMemory"] = m.Gauge(v.Total)
 	col.Metrics.GaugeMetrics["FreeMemory"] = m.Gauge(v.Free)
 	col.Metrics.GaugeMetrics["CPUutilization1"] = m.Gauge(utilization[0])
+	now := time.Now()
+	for _, key := range []string{"TotalMemory", "FreeMemory", "CPUutilization1"} {
+		col.touchSeries(key, now)
+	}
 }
@@ -158,3 +158,117 @@ func TestCollectorUpdateExtraMetrics(t *testing.T) {
 	assert.GreaterOrEqual(t, c.GetMetrics().GaugeMetrics["FreeMemory"], metrics.Gauge(0.0))
 	assert.GreaterOrEqual(t, c.GetMetrics().GaugeMetrics["CPUutilization1"], metrics.Gauge(0.0))
 }
+
+func TestUpdateHistogramFromJSON(t *testing.T) {
+	c := NewCollector()
+	incoming := metrics.NewHistogram([]float64{1, 5})
+	incoming.Observe(2)
+	res, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "histogram", Histogram: incoming})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), res.Histogram.Count)
+
+	res, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "histogram", Histogram: incoming})
+	assert.NoError(t, err)
+	assert.Equal(t, []uint64{0, 2, 0}, res.Histogram.Counts)
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{
+		ID: "Latency", MType: "histogram", Histogram: metrics.NewHistogram([]float64{2}),
+	})
+	assert.Equal(t, errors.ErrorHistogramBounds, err)
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "histogram"})
+	assert.Equal(t, errors.ErrorMetricValue, err)
+
+	res, err = c.GetMetricJSON(&metrics.JSONMetrics{ID: "Latency", MType: "histogram"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), res.Histogram.Count)
+}
+
+func TestObserveHistogram(t *testing.T) {
+	c := NewCollector()
+	c.ObserveHistogram("PushDuration", 0.2)
+	c.UpdateMetrics()
+	assert.Equal(t, uint64(1), c.Metrics.HistogramMetrics["PushDuration"].Count)
+	c.ResetDistributions()
+	assert.Equal(t, uint64(0), c.Metrics.HistogramMetrics["PushDuration"].Count)
+}
+
+func TestLabeledSeries(t *testing.T) {
+	c := NewCollector()
+	first, second := 1.5, 2.5
+	_, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{
+		ID: "Alloc", MType: "gauge", Value: &first, Labels: map[string]string{"host": "a", "env": "prod"},
+	})
+	assert.NoError(t, err)
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{
+		ID: "Alloc", MType: "gauge", Value: &second, Labels: map[string]string{"host": "b", "env": "prod"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.Gauge(first), c.Metrics.GaugeMetrics[`Alloc{env="prod",host="a"}`])
+	assert.Equal(t, metrics.Gauge(second), c.Metrics.GaugeMetrics[`Alloc{env="prod",host="b"}`])
+
+	res, err := c.GetMetricJSON(&metrics.JSONMetrics{ID: "Alloc", MType: "gauge", Labels: map[string]string{"host": "b"}})
+	assert.NoError(t, err)
+	assert.Equal(t, second, *res.Value)
+	assert.Equal(t, map[string]string{"host": "b", "env": "prod"}, res.Labels)
+
+	value, err := c.GetMetricWithLabels("Alloc", map[string]string{"host": "a"})
+	assert.NoError(t, err)
+	assert.Equal(t, metrics.Gauge(first), value)
+
+	_, err = c.GetMetricWithLabels("Alloc", map[string]string{"host": "c"})
+	assert.Equal(t, errors.ErrorMetricNotFound, err)
+}
+
+func TestUpdateSummaryFromJSON(t *testing.T) {
+	c := NewCollector()
+	res, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "summary", Samples: []float64{1, 2, 3}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), res.Summary.Count)
+
+	partial := metrics.NewSummary(metrics.DefaultRelativeAccuracy)
+	partial.Observe(4)
+	res, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "summary", Summary: partial})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(4), res.Summary.Count)
+	assert.Equal(t, float64(4), res.Summary.Max)
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Latency", MType: "summary"})
+	assert.Equal(t, errors.ErrorMetricValue, err)
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{
+		ID: "Latency", MType: "summary", Summary: metrics.NewSummary(0.1),
+	})
+	assert.Equal(t, errors.ErrorSummaryAccuracy, err)
+
+	res, err = c.GetMetricJSON(&metrics.JSONMetrics{
+		ID: "Latency", MType: "summary", Quantiles: []metrics.Quantile{{Quantile: 1}},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []metrics.Quantile{{Quantile: 1, Value: 4}}, res.Quantiles)
+}
+
+func TestUpdateSetFromJSON(t *testing.T) {
+	c := NewCollector()
+	res, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Visitors", MType: "set", Members: []string{"a", "b", "a"}})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(2), *res.Estimate)
+
+	partial := metrics.NewSet(metrics.DefaultSetPrecision)
+	partial.Add("c")
+	partial.Add("a")
+	res, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Visitors", MType: "set", Set: partial})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(3), *res.Estimate)
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Visitors", MType: "set", Set: metrics.NewSet(8)})
+	assert.Equal(t, errors.ErrorSetPrecision, err)
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Visitors", MType: "set"})
+	assert.Equal(t, errors.ErrorMetricValue, err)
+
+	c.ObserveSet("LocalVisitors", "x")
+	res, err = c.GetMetricJSON(&metrics.JSONMetrics{ID: "LocalVisitors", MType: "set"})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(1), *res.Estimate)
+	c.ResetDistributions()
+	assert.Equal(t, uint64(0), c.Metrics.SetMetrics["LocalVisitors"].Estimate())
+}
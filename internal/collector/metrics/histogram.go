@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Границы корзин гистограммы по умолчанию.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram хранит распределение наблюдений по корзинам с заданными верхними границами.
+// Counts содержит len(Bounds)+1 значений: последняя корзина соответствует +Inf.
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+	Count  uint64    `json:"count"`
+	Sum    float64   `json:"sum"`
+}
+
+// Конструктор гистограммы с заданными границами корзин.
+func NewHistogram(bounds []float64) *Histogram {
+	sorted := make([]float64, len(bounds))
+	copy(sorted, bounds)
+	sort.Float64s(sorted)
+	return &Histogram{
+		Bounds: sorted,
+		Counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Метод, добавляющий наблюдение в соответствующую корзину.
+func (h *Histogram) Observe(value float64) {
+	idx := sort.SearchFloat64s(h.Bounds, value)
+	h.Counts[idx]++
+	h.Count++
+	h.Sum += value
+}
+
+// Метод, объединяющий две гистограммы с одинаковыми границами корзин.
+func (h *Histogram) Merge(other *Histogram) error {
+	if !h.sameBounds(other) {
+		return errors.ErrorHistogramBounds
+	}
+	for i, c := range other.Counts {
+		h.Counts[i] += c
+	}
+	h.Count += other.Count
+	h.Sum += other.Sum
+	return nil
+}
+
+// Метод, возвращающий прирост накопительной гистограммы h относительно предыдущего значения previous.
+// Если границы различаются или какой-то счётчик уменьшился, накопление началось заново
+// и возвращается false.
+func (h *Histogram) Since(previous *Histogram) (*Histogram, bool) {
+	if !h.sameBounds(previous) || h.Count < previous.Count {
+		return nil, false
+	}
+	result := h.Copy()
+	for i, c := range previous.Counts {
+		if result.Counts[i] < c {
+			return nil, false
+		}
+		result.Counts[i] -= c
+	}
+	result.Count -= previous.Count
+	result.Sum -= previous.Sum
+	return result, true
+}
+
+// Метод, проверяющий корректность гистограммы, полученной извне.
+func (h *Histogram) Validate() error {
+	if len(h.Counts) != len(h.Bounds)+1 || !sort.Float64sAreSorted(h.Bounds) {
+		return errors.ErrorHistogramBounds
+	}
+	return nil
+}
+
+// Метод, возвращающий независимую копию гистограммы.
+func (h *Histogram) Copy() *Histogram {
+	result := &Histogram{
+		Bounds: make([]float64, len(h.Bounds)),
+		Counts: make([]uint64, len(h.Counts)),
+		Count:  h.Count,
+		Sum:    h.Sum,
+	}
+	copy(result.Bounds, h.Bounds)
+	copy(result.Counts, h.Counts)
+	return result
+}
+
+// Метод, обнуляющий накопленные наблюдения с сохранением границ.
+func (h *Histogram) Reset() {
+	for i := range h.Counts {
+		h.Counts[i] = 0
+	}
+	h.Count = 0
+	h.Sum = 0
+}
+
+// Строковая репрезентация гистограммы в формате JSON.
+func (h *Histogram) String() string {
+	data, _ := json.Marshal(h)
+	return string(data)
+}
+
+func (h *Histogram) sameBounds(other *Histogram) bool {
+	if len(h.Bounds) != len(other.Bounds) || len(h.Counts) != len(other.Counts) {
+		return false
+	}
+	for i, b := range h.Bounds {
+		if b != other.Bounds[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,70 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestHistogramObserve(t *testing.T) {
+	h := NewHistogram([]float64{5, 1})
+	assert.Equal(t, []float64{1, 5}, h.Bounds)
+	h.Observe(0.5)
+	h.Observe(1)
+	h.Observe(3)
+	h.Observe(100)
+	assert.Equal(t, []uint64{2, 1, 1}, h.Counts)
+	assert.Equal(t, uint64(4), h.Count)
+	assert.InDelta(t, 104.5, h.Sum, 0.0001)
+}
+
+func TestHistogramMerge(t *testing.T) {
+	h := NewHistogram([]float64{1, 5})
+	h.Observe(3)
+	other := NewHistogram([]float64{1, 5})
+	other.Observe(0.1)
+	other.Observe(3)
+	require.NoError(t, h.Merge(other))
+	assert.Equal(t, []uint64{1, 2, 0}, h.Counts)
+	assert.Equal(t, uint64(3), h.Count)
+
+	wrong := NewHistogram([]float64{1, 10})
+	assert.Equal(t, errors.ErrorHistogramBounds, h.Merge(wrong))
+}
+
+func TestHistogramCopyAndReset(t *testing.T) {
+	h := NewHistogram(DefaultBuckets)
+	h.Observe(0.3)
+	c := h.Copy()
+	h.Reset()
+	assert.Equal(t, uint64(0), h.Count)
+	assert.Equal(t, uint64(1), c.Count)
+	assert.Len(t, h.Counts, len(DefaultBuckets)+1)
+}
+
+func TestHistogramValidate(t *testing.T) {
+	assert.NoError(t, NewHistogram([]float64{1, 2}).Validate())
+	assert.Error(t, (&Histogram{Bounds: []float64{1, 2}, Counts: []uint64{1}}).Validate())
+	assert.Error(t, (&Histogram{Bounds: []float64{2, 1}, Counts: []uint64{0, 0, 0}}).Validate())
+}
+
+func TestHistogramSince(t *testing.T) {
+	previous := NewHistogram([]float64{1, 5})
+	previous.Observe(3)
+	current := previous.Copy()
+	current.Observe(0.5)
+	current.Observe(3)
+	delta, ok := current.Since(previous)
+	require.True(t, ok)
+	assert.Equal(t, []uint64{1, 1, 0}, delta.Counts)
+	assert.Equal(t, uint64(2), delta.Count)
+	assert.InDelta(t, 3.5, delta.Sum, 0.0001)
+
+	_, ok = previous.Since(current)
+	assert.False(t, ok)
+	_, ok = current.Since(NewHistogram([]float64{1, 10}))
+	assert.False(t, ok)
+}
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"sort"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Максимальное число точек в ответе на запрос истории.
+const MaxHistoryPoints = 11000
+
+// Сохранённое значение серии в момент времени.
+type Sample struct {
+	Time  time.Time
+	Value float64
+}
+
+// Точка истории: агрегаты значений, попавших в интервал [Timestamp, Timestamp+step).
+type Point struct {
+	Timestamp int64   `json:"timestamp"` // начало интервала, миллисекунды Unix
+	Avg       float64 `json:"avg"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+	Last      float64 `json:"last"`
+	Count     uint64  `json:"count"` // число значений в интервале
+}
+
+// Агрегат свёрнутой истории: точка истории с разрешением Step в миллисекундах.
+type Rollup struct {
+	Step int64 `json:"step"`
+	Point
+}
+
+// Агрегат свёрнутой истории серии: имя, тип и метки задаёт Series.
+type SeriesRollup struct {
+	Series *JSONMetrics
+	Rollup
+}
+
+// Функция, прореживающая упорядоченные по времени значения до точек с шагом step.
+// Границы интервалов кратны step от начала эпохи, поэтому точки разных запросов совпадают.
+// Интервалы без значений пропускаются.
+func Downsample(samples []Sample, step time.Duration) []Point {
+	points := make([]Point, 0)
+	var sum float64
+	for _, sample := range samples {
+		start := sample.Time.Truncate(step).UnixMilli()
+		if len(points) == 0 || points[len(points)-1].Timestamp != start {
+			if len(points) > 0 {
+				last := &points[len(points)-1]
+				last.Avg = sum / float64(last.Count)
+			}
+			points = append(points, Point{Timestamp: start, Min: sample.Value, Max: sample.Value})
+			sum = 0
+		}
+		point := &points[len(points)-1]
+		sum += sample.Value
+		point.Count++
+		point.Last = sample.Value
+		if sample.Value < point.Min {
+			point.Min = sample.Value
+		}
+		if sample.Value > point.Max {
+			point.Max = sample.Value
+		}
+	}
+	if len(points) > 0 {
+		last := &points[len(points)-1]
+		last.Avg = sum / float64(last.Count)
+	}
+	return points
+}
+
+// Функция, объединяющая точки в точки с шагом step, не меньшим исходного.
+// Среднее взвешивается числом значений, последним считается значение более поздней точки.
+func Resample(points []Point, step time.Duration) []Point {
+	sorted := append([]Point(nil), points...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Timestamp < sorted[j].Timestamp
+	})
+	resampled := make([]Point, 0, len(sorted))
+	for _, point := range sorted {
+		if point.Count == 0 {
+			continue
+		}
+		start := time.UnixMilli(point.Timestamp).Truncate(step).UnixMilli()
+		if len(resampled) == 0 || resampled[len(resampled)-1].Timestamp != start {
+			point.Timestamp = start
+			resampled = append(resampled, point)
+			continue
+		}
+		last := &resampled[len(resampled)-1]
+		count := last.Count + point.Count
+		last.Avg = (last.Avg*float64(last.Count) + point.Avg*float64(point.Count)) / float64(count)
+		last.Count = count
+		last.Last = point.Last
+		if point.Min < last.Min {
+			last.Min = point.Min
+		}
+		if point.Max > last.Max {
+			last.Max = point.Max
+		}
+	}
+	return resampled
+}
+
+// Функция, проверяющая интервал запроса истории: from < to, step > 0 и не более MaxHistoryPoints точек.
+func ValidateHistoryRange(from, to time.Time, step time.Duration) error {
+	if step <= 0 || !from.Before(to) || to.Sub(from)/step > MaxHistoryPoints {
+		return errors.ErrorHistoryRange
+	}
+	return nil
+}
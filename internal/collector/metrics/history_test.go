@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestDownsample(t *testing.T) {
+	start := time.UnixMilli(0).Add(10 * time.Minute)
+	samples := []Sample{
+		{Time: start.Add(5 * time.Second), Value: 4},
+		{Time: start.Add(20 * time.Second), Value: 2},
+		{Time: start.Add(50 * time.Second), Value: 6},
+		{Time: start.Add(3*time.Minute + time.Second), Value: 1},
+	}
+
+	points := Downsample(samples, time.Minute)
+	assert.Equal(t, []Point{
+		{Timestamp: start.UnixMilli(), Avg: 4, Min: 2, Max: 6, Last: 6, Count: 3},
+		{Timestamp: start.Add(3 * time.Minute).UnixMilli(), Avg: 1, Min: 1, Max: 1, Last: 1, Count: 1},
+	}, points)
+	assert.Empty(t, Downsample(nil, time.Minute))
+}
+
+func TestValidateHistoryRange(t *testing.T) {
+	now := time.Now()
+	assert.NoError(t, ValidateHistoryRange(now.Add(-time.Hour), now, time.Minute))
+	assert.Equal(t, errors.ErrorHistoryRange, ValidateHistoryRange(now, now.Add(-time.Hour), time.Minute))
+	assert.Equal(t, errors.ErrorHistoryRange, ValidateHistoryRange(now.Add(-time.Hour), now, 0))
+	assert.Equal(t, errors.ErrorHistoryRange, ValidateHistoryRange(now.Add(-24*time.Hour), now, time.Second))
+}
+
+func TestResample(t *testing.T) {
+	start := time.UnixMilli(0).Add(time.Hour)
+	points := []Point{
+		{Timestamp: start.Add(time.Minute).UnixMilli(), Avg: 6, Min: 5, Max: 7, Last: 7, Count: 2},
+		{Timestamp: start.UnixMilli(), Avg: 2, Min: 1, Max: 3, Last: 3, Count: 2},
+		{Timestamp: start.Add(time.Hour).UnixMilli(), Avg: 9, Min: 9, Max: 9, Last: 9, Count: 1},
+	}
+
+	assert.Equal(t, []Point{
+		{Timestamp: start.UnixMilli(), Avg: 4, Min: 1, Max: 7, Last: 7, Count: 4},
+		{Timestamp: start.Add(time.Hour).UnixMilli(), Avg: 9, Min: 9, Max: 9, Last: 9, Count: 1},
+	}, Resample(points, time.Hour))
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Функция, формирующая ключ хранения серии из имени метрики и отсортированного набора меток.
+// Для метрики без меток ключ совпадает с её именем, например Alloc{env="prod",host="a"}.
+func SeriesKey(id string, labels map[string]string) string {
+	if len(labels) == 0 {
+		return id
+	}
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(id)
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteByte('=')
+		b.WriteString(strconv.Quote(labels[name]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// Функция, разбирающая ключ серии обратно на имя метрики и набор меток.
+func ParseSeriesKey(key string) (string, map[string]string) {
+	start := strings.IndexByte(key, '{')
+	if start < 0 || !strings.HasSuffix(key, "}") {
+		return key, nil
+	}
+	id := key[:start]
+	rest := key[start+1 : len(key)-1]
+	labels := map[string]string{}
+	for rest != "" {
+		eq := strings.IndexByte(rest, '=')
+		if eq < 0 {
+			return key, nil
+		}
+		name := rest[:eq]
+		quoted, err := strconv.QuotedPrefix(rest[eq+1:])
+		if err != nil {
+			return key, nil
+		}
+		value, err := strconv.Unquote(quoted)
+		if err != nil {
+			return key, nil
+		}
+		labels[name] = value
+		rest = strings.TrimPrefix(rest[eq+1+len(quoted):], ",")
+	}
+	return id, labels
+}
+
+// Функция, проверяющая, что набор меток удовлетворяет всем переданным условиям на равенство.
+func MatchLabels(labels, matchers map[string]string) bool {
+	for name, value := range matchers {
+		if labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// Функция, возвращающая каноническое JSON-представление меток для хранения в БД.
+func LabelsJSON(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "{}"
+	}
+	// encoding/json сортирует ключи словаря, поэтому представление однозначно
+	data, _ := json.Marshal(labels)
+	return string(data)
+}
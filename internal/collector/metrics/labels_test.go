@@ -0,0 +1,39 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeriesKey(t *testing.T) {
+	assert.Equal(t, "Alloc", SeriesKey("Alloc", nil))
+	key := SeriesKey("Alloc", map[string]string{"host": "a", "env": "prod"})
+	assert.Equal(t, `Alloc{env="prod",host="a"}`, key)
+
+	id, labels := ParseSeriesKey(key)
+	assert.Equal(t, "Alloc", id)
+	assert.Equal(t, map[string]string{"host": "a", "env": "prod"}, labels)
+
+	tricky := map[string]string{"path": `/a,b="c"`}
+	id, labels = ParseSeriesKey(SeriesKey("Requests", tricky))
+	assert.Equal(t, "Requests", id)
+	assert.Equal(t, tricky, labels)
+
+	id, labels = ParseSeriesKey("PollCount")
+	assert.Equal(t, "PollCount", id)
+	assert.Nil(t, labels)
+}
+
+func TestMatchLabels(t *testing.T) {
+	labels := map[string]string{"host": "a", "env": "prod"}
+	assert.True(t, MatchLabels(labels, nil))
+	assert.True(t, MatchLabels(labels, map[string]string{"host": "a"}))
+	assert.False(t, MatchLabels(labels, map[string]string{"host": "b"}))
+	assert.False(t, MatchLabels(nil, map[string]string{"host": "a"}))
+}
+
+func TestLabelsJSON(t *testing.T) {
+	assert.Equal(t, "{}", LabelsJSON(nil))
+	assert.Equal(t, `{"env":"prod","host":"a"}`, LabelsJSON(map[string]string{"host": "a", "env": "prod"}))
+}
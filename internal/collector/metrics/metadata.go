@@ -0,0 +1,10 @@
+package metrics
+
+// Описание метрики в реестре: тип, единицы измерения, пояснение и ответственный.
+type Metadata struct {
+	Name  string `json:"id"`              // имя метрики
+	MType string `json:"type"`            // зарегистрированный тип метрики
+	Unit  string `json:"unit,omitempty"`  // единицы измерения
+	Help  string `json:"help,omitempty"`  // текстовое описание
+	Owner string `json:"owner,omitempty"` // команда или сервис, отвечающие за метрику
+}
@@ -3,6 +3,7 @@ package metrics
 import (
 	"math/rand"
 	"runtime"
+	"time"
 )
 
 type (
@@ -11,16 +12,48 @@ type (
 )
 
 type Metrics struct {
-	GaugeMetrics   map[string]Gauge
-	CounterMetrics map[string]Counter
+	GaugeMetrics     map[string]Gauge
+	CounterMetrics   map[string]Counter
+	HistogramMetrics map[string]*Histogram
+	SummaryMetrics   map[string]*Summary
+	SetMetrics       map[string]*Set
+	Metadata         map[string]*Metadata
+	Timestamps       map[string]int64
+	UpdatedAt        map[string]int64
 }
 
 type JSONMetrics struct {
-	ID    string   `json:"id" db:"_id"`                // имя метрики
-	MType string   `json:"type" db:"mtype"`            // параметр, принимающий значение gauge или counter
-	Delta *int64   `json:"delta,omitempty" db:"delta"` // значение метрики в случае передачи counter
-	Value *float64 `json:"value,omitempty" db:"value"` // значение метрики в случае передачи gauge
-	Hash  string   `json:"hash,omitempty"`             // значение хеш-функции
+	ID        string            `json:"id" db:"_id"`                // имя метрики
+	MType     string            `json:"type" db:"mtype"`            // тип метрики: gauge, counter, histogram, summary или set
+	Delta     *int64            `json:"delta,omitempty" db:"delta"` // значение метрики в случае передачи counter
+	Value     *float64          `json:"value,omitempty" db:"value"` // значение метрики в случае передачи gauge
+	Histogram *Histogram        `json:"histogram,omitempty"`        // значение метрики в случае передачи histogram
+	Summary   *Summary          `json:"summary,omitempty"`          // частичный скетч в случае передачи summary
+	Samples   []float64         `json:"samples,omitempty"`          // сырые наблюдения в случае передачи summary
+	Quantiles []Quantile        `json:"quantiles,omitempty"`        // запрошенные и рассчитанные квантили summary
+	Set       *Set              `json:"set,omitempty"`              // частичный скетч в случае передачи set
+	Members   []string          `json:"members,omitempty"`          // элементы множества в случае передачи set
+	Estimate  *uint64           `json:"estimate,omitempty"`         // оценка числа уникальных элементов set
+	Window    string            `json:"window,omitempty"`           // окно расчёта rate и increase для counter, например 5m
+	Rate      *float64          `json:"rate,omitempty"`             // прирост counter в секунду за окно
+	Increase  *float64          `json:"increase,omitempty"`         // прирост counter за окно
+	Stale     bool              `json:"stale,omitempty"`            // серия давно не обновлялась
+	Labels    map[string]string `json:"labels,omitempty"`           // набор меток серии
+	Timestamp *int64            `json:"timestamp,omitempty"`        // время наблюдения, миллисекунды Unix
+	Hash      string            `json:"hash,omitempty"`             // значение хеш-функции
+}
+
+// Метод, возвращающий ключ хранения серии с учётом меток.
+func (metric *JSONMetrics) Key() string {
+	return SeriesKey(metric.ID, metric.Labels)
+}
+
+// Метод, возвращающий время наблюдения. Если клиент его не передал, используется время получения now.
+func (metric *JSONMetrics) SampleTime(now time.Time) time.Time {
+	if metric.Timestamp == nil {
+		return now
+	}
+	return time.UnixMilli(*metric.Timestamp)
 }
 
 // Интерфейс, используемый для работы с метриками: обновление, чтение и строковая репрезентация.
@@ -67,6 +100,12 @@ func UpdateMetrics(m *runtime.MemStats, counter int) *Metrics {
 		CounterMetrics: map[string]Counter{
 			"PollCount": Counter(counter),
 		},
+		HistogramMetrics: map[string]*Histogram{},
+		SummaryMetrics:   map[string]*Summary{},
+		SetMetrics:       map[string]*Set{},
+		Metadata:         map[string]*Metadata{},
+		Timestamps:       map[string]int64{},
+		UpdatedAt:        map[string]int64{},
 	}
 }
 
@@ -109,6 +148,40 @@ func NewMetrics() *Metrics {
 		CounterMetrics: map[string]Counter{
 			"PollCount": Counter(0),
 		},
+		HistogramMetrics: map[string]*Histogram{},
+		SummaryMetrics:   map[string]*Summary{},
+		SetMetrics:       map[string]*Set{},
+		Metadata:         map[string]*Metadata{},
+		Timestamps:       map[string]int64{},
+		UpdatedAt:        map[string]int64{},
+	}
+}
+
+// Метод, инициализирующий отсутствующие словари метрик, например после чтения старого файла.
+func (mtrcs *Metrics) EnsureInitialized() {
+	if mtrcs.GaugeMetrics == nil {
+		mtrcs.GaugeMetrics = map[string]Gauge{}
+	}
+	if mtrcs.CounterMetrics == nil {
+		mtrcs.CounterMetrics = map[string]Counter{}
+	}
+	if mtrcs.HistogramMetrics == nil {
+		mtrcs.HistogramMetrics = map[string]*Histogram{}
+	}
+	if mtrcs.SummaryMetrics == nil {
+		mtrcs.SummaryMetrics = map[string]*Summary{}
+	}
+	if mtrcs.SetMetrics == nil {
+		mtrcs.SetMetrics = map[string]*Set{}
+	}
+	if mtrcs.Metadata == nil {
+		mtrcs.Metadata = map[string]*Metadata{}
+	}
+	if mtrcs.Timestamps == nil {
+		mtrcs.Timestamps = map[string]int64{}
+	}
+	if mtrcs.UpdatedAt == nil {
+		mtrcs.UpdatedAt = map[string]int64{}
 	}
 }
 
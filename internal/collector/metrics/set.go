@@ -0,0 +1,121 @@
+package metrics
+
+import (
+	"encoding/json"
+	"hash/fnv"
+	"math"
+	"math/bits"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Точность HyperLogLog по умолчанию: 2^12 регистров, стандартная ошибка около 1.6%.
+const DefaultSetPrecision uint8 = 12
+
+// Допустимый диапазон точности скетча.
+const (
+	minSetPrecision uint8 = 4
+	maxSetPrecision uint8 = 18
+)
+
+// Set — объединяемый скетч HyperLogLog для оценки числа уникальных элементов.
+// Каждый регистр хранит максимальную позицию первой единицы среди хешей попавших в него элементов,
+// поэтому объединение скетчей сводится к поэлементному максимуму регистров.
+type Set struct {
+	Precision uint8  `json:"precision"`
+	Registers []byte `json:"registers"`
+}
+
+// Конструктор скетча с заданной точностью.
+func NewSet(precision uint8) *Set {
+	if precision < minSetPrecision || precision > maxSetPrecision {
+		precision = DefaultSetPrecision
+	}
+	return &Set{
+		Precision: precision,
+		Registers: make([]byte, 1<<precision),
+	}
+}
+
+// Функция хеширования элемента: FNV-1a с финальным перемешиванием murmur3,
+// чтобы у агентов и сервера получались одинаковые и равномерно распределённые хеши.
+func hashMember(member string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(member))
+	h := hasher.Sum64()
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+// Метод, добавляющий элемент в скетч.
+func (s *Set) Add(member string) {
+	h := hashMember(member)
+	idx := h >> (64 - s.Precision)
+	rank := byte(bits.LeadingZeros64(h<<s.Precision|1<<(s.Precision-1)) + 1)
+	if rank > s.Registers[idx] {
+		s.Registers[idx] = rank
+	}
+}
+
+// Метод, объединяющий скетч с другим скетчем той же точности.
+func (s *Set) Merge(other *Set) error {
+	if s.Precision != other.Precision {
+		return errors.ErrorSetPrecision
+	}
+	for idx, rank := range other.Registers {
+		if rank > s.Registers[idx] {
+			s.Registers[idx] = rank
+		}
+	}
+	return nil
+}
+
+// Метод, проверяющий корректность скетча, полученного извне.
+func (s *Set) Validate() error {
+	if s.Precision < minSetPrecision || s.Precision > maxSetPrecision || len(s.Registers) != 1<<s.Precision {
+		return errors.ErrorSetPrecision
+	}
+	return nil
+}
+
+// Метод, возвращающий оценку числа уникальных элементов.
+// Для малых значений используется линейный подсчёт по пустым регистрам.
+func (s *Set) Estimate() uint64 {
+	m := float64(len(s.Registers))
+	var sum float64
+	zeros := 0
+	for _, rank := range s.Registers {
+		sum += math.Ldexp(1, -int(rank))
+		if rank == 0 {
+			zeros++
+		}
+	}
+	estimate := 0.7213 / (1 + 1.079/m) * m * m / sum
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(estimate))
+}
+
+// Метод, возвращающий независимую копию скетча.
+func (s *Set) Copy() *Set {
+	registers := make([]byte, len(s.Registers))
+	copy(registers, s.Registers)
+	return &Set{Precision: s.Precision, Registers: registers}
+}
+
+// Метод, обнуляющий скетч после отправки на сервер.
+func (s *Set) Reset() {
+	for idx := range s.Registers {
+		s.Registers[idx] = 0
+	}
+}
+
+func (s *Set) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
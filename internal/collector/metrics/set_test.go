@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestSetEstimate(t *testing.T) {
+	s := NewSet(DefaultSetPrecision)
+	assert.Equal(t, uint64(0), s.Estimate())
+	for i := 0; i < 10; i++ {
+		s.Add("user-1")
+	}
+	assert.Equal(t, uint64(1), s.Estimate())
+
+	for _, n := range []int{100, 10000, 100000} {
+		s := NewSet(DefaultSetPrecision)
+		for i := 0; i < n; i++ {
+			s.Add(fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+		}
+		assert.InEpsilon(t, n, s.Estimate(), 0.05)
+	}
+}
+
+func TestSetMerge(t *testing.T) {
+	s := NewSet(DefaultSetPrecision)
+	other := NewSet(DefaultSetPrecision)
+	for i := 0; i < 1000; i++ {
+		s.Add(fmt.Sprintf("session-%d", i))
+		other.Add(fmt.Sprintf("session-%d", i+500))
+	}
+	require.NoError(t, s.Merge(other))
+	assert.InEpsilon(t, 1500, s.Estimate(), 0.05)
+	assert.Equal(t, errors.ErrorSetPrecision, s.Merge(NewSet(10)))
+}
+
+func TestSetJSONRoundTrip(t *testing.T) {
+	s := NewSet(DefaultSetPrecision)
+	s.Add("a")
+	s.Add("b")
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	restored := &Set{}
+	require.NoError(t, json.Unmarshal(data, restored))
+	require.NoError(t, restored.Validate())
+	assert.Equal(t, uint64(2), restored.Estimate())
+	assert.Error(t, (&Set{Precision: 12, Registers: []byte{1}}).Validate())
+
+	c := s.Copy()
+	s.Reset()
+	assert.Equal(t, uint64(0), s.Estimate())
+	assert.Equal(t, uint64(2), c.Estimate())
+}
@@ -0,0 +1,205 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Относительная точность квантилей по умолчанию.
+const DefaultRelativeAccuracy = 0.01
+
+// Квантили, возвращаемые по умолчанию, если в запросе они не указаны.
+var DefaultQuantiles = []float64{0.5, 0.9, 0.99}
+
+// Quantile — значение квантиля, рассчитанное по скетчу.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// Summary — объединяемый скетч DDSketch для потокового расчёта квантилей.
+// Наблюдения раскладываются по логарифмическим корзинам, поэтому любой квантиль
+// оценивается с относительной погрешностью не хуже RelativeAccuracy без хранения самих значений.
+type Summary struct {
+	RelativeAccuracy float64          `json:"relative_accuracy"`
+	Positive         map[int32]uint64 `json:"positive"`
+	Negative         map[int32]uint64 `json:"negative"`
+	Zero             uint64           `json:"zero"`
+	Count            uint64           `json:"count"`
+	Sum              float64          `json:"sum"`
+	Min              float64          `json:"min"`
+	Max              float64          `json:"max"`
+}
+
+// Конструктор скетча с заданной относительной точностью.
+func NewSummary(relativeAccuracy float64) *Summary {
+	if relativeAccuracy <= 0 || relativeAccuracy >= 1 {
+		relativeAccuracy = DefaultRelativeAccuracy
+	}
+	return &Summary{
+		RelativeAccuracy: relativeAccuracy,
+		Positive:         map[int32]uint64{},
+		Negative:         map[int32]uint64{},
+	}
+}
+
+func (s *Summary) gamma() float64 {
+	return (1 + s.RelativeAccuracy) / (1 - s.RelativeAccuracy)
+}
+
+func (s *Summary) index(value float64) int32 {
+	return int32(math.Ceil(math.Log(value) / math.Log(s.gamma())))
+}
+
+// Представительное значение корзины с относительной погрешностью не более RelativeAccuracy.
+func (s *Summary) bucketValue(index int32) float64 {
+	gamma := s.gamma()
+	return 2 * math.Pow(gamma, float64(index)) / (gamma + 1)
+}
+
+// Метод, добавляющий наблюдение в скетч.
+func (s *Summary) Observe(value float64) {
+	switch {
+	case value > 0:
+		s.Positive[s.index(value)]++
+	case value < 0:
+		s.Negative[s.index(-value)]++
+	default:
+		s.Zero++
+	}
+	if s.Count == 0 || value < s.Min {
+		s.Min = value
+	}
+	if s.Count == 0 || value > s.Max {
+		s.Max = value
+	}
+	s.Count++
+	s.Sum += value
+}
+
+// Метод, объединяющий скетч с другим скетчем той же точности.
+func (s *Summary) Merge(other *Summary) error {
+	if s.RelativeAccuracy != other.RelativeAccuracy {
+		return errors.ErrorSummaryAccuracy
+	}
+	if other.Count == 0 {
+		return nil
+	}
+	for idx, c := range other.Positive {
+		s.Positive[idx] += c
+	}
+	for idx, c := range other.Negative {
+		s.Negative[idx] += c
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Zero += other.Zero
+	s.Count += other.Count
+	s.Sum += other.Sum
+	return nil
+}
+
+// Метод, проверяющий корректность скетча, полученного извне.
+func (s *Summary) Validate() error {
+	if s.RelativeAccuracy <= 0 || s.RelativeAccuracy >= 1 {
+		return errors.ErrorSummaryAccuracy
+	}
+	if s.Positive == nil {
+		s.Positive = map[int32]uint64{}
+	}
+	if s.Negative == nil {
+		s.Negative = map[int32]uint64{}
+	}
+	return nil
+}
+
+// Метод, возвращающий оценку квантиля q из диапазона [0, 1].
+func (s *Summary) Quantile(q float64) float64 {
+	if s.Count == 0 {
+		return 0
+	}
+	if q <= 0 {
+		return s.Min
+	}
+	if q >= 1 {
+		return s.Max
+	}
+	rank := uint64(q * float64(s.Count-1))
+	var seen uint64
+	// отрицательные значения идут от наибольших по модулю к наименьшим
+	negative := sortedIndexes(s.Negative)
+	for i := len(negative) - 1; i >= 0; i-- {
+		seen += s.Negative[negative[i]]
+		if seen > rank {
+			return s.clamp(-s.bucketValue(negative[i]))
+		}
+	}
+	seen += s.Zero
+	if seen > rank {
+		return 0
+	}
+	for _, idx := range sortedIndexes(s.Positive) {
+		seen += s.Positive[idx]
+		if seen > rank {
+			return s.clamp(s.bucketValue(idx))
+		}
+	}
+	return s.Max
+}
+
+// Метод, рассчитывающий набор квантилей.
+func (s *Summary) Quantiles(qs []float64) []Quantile {
+	if len(qs) == 0 {
+		qs = DefaultQuantiles
+	}
+	result := make([]Quantile, 0, len(qs))
+	for _, q := range qs {
+		result = append(result, Quantile{Quantile: q, Value: s.Quantile(q)})
+	}
+	return result
+}
+
+func (s *Summary) clamp(value float64) float64 {
+	return math.Max(s.Min, math.Min(s.Max, value))
+}
+
+// Метод, возвращающий независимую копию скетча.
+func (s *Summary) Copy() *Summary {
+	result := *s
+	result.Positive = make(map[int32]uint64, len(s.Positive))
+	for idx, c := range s.Positive {
+		result.Positive[idx] = c
+	}
+	result.Negative = make(map[int32]uint64, len(s.Negative))
+	for idx, c := range s.Negative {
+		result.Negative[idx] = c
+	}
+	return &result
+}
+
+// Метод, обнуляющий скетч с сохранением точности.
+func (s *Summary) Reset() {
+	*s = *NewSummary(s.RelativeAccuracy)
+}
+
+// Строковая репрезентация скетча в формате JSON.
+func (s *Summary) String() string {
+	data, _ := json.Marshal(s)
+	return string(data)
+}
+
+func sortedIndexes(buckets map[int32]uint64) []int32 {
+	indexes := make([]int32, 0, len(buckets))
+	for idx := range buckets {
+		indexes = append(indexes, idx)
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i] < indexes[j] })
+	return indexes
+}
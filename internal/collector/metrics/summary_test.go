@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestSummaryQuantiles(t *testing.T) {
+	s := NewSummary(DefaultRelativeAccuracy)
+	for i := 1; i <= 1000; i++ {
+		s.Observe(float64(i))
+	}
+	assert.Equal(t, uint64(1000), s.Count)
+	for _, q := range []float64{0.5, 0.9, 0.99} {
+		expected := q * 999
+		assert.InDelta(t, expected, s.Quantile(q), expected*2*DefaultRelativeAccuracy)
+	}
+	assert.Equal(t, float64(1), s.Quantile(0))
+	assert.Equal(t, float64(1000), s.Quantile(1))
+	assert.Len(t, s.Quantiles(nil), len(DefaultQuantiles))
+}
+
+func TestSummaryNegativeAndZero(t *testing.T) {
+	s := NewSummary(DefaultRelativeAccuracy)
+	s.Observe(-10)
+	s.Observe(0)
+	s.Observe(10)
+	s.Observe(10)
+	assert.InDelta(t, -10, s.Quantile(0.1), 0.2)
+	assert.Equal(t, float64(0), s.Quantile(0.4))
+	assert.InDelta(t, 10, s.Quantile(0.9), 0.2)
+	assert.False(t, math.IsNaN(NewSummary(DefaultRelativeAccuracy).Quantile(0.5)))
+}
+
+func TestSummaryMerge(t *testing.T) {
+	s := NewSummary(DefaultRelativeAccuracy)
+	other := NewSummary(DefaultRelativeAccuracy)
+	for i := 1; i <= 50; i++ {
+		s.Observe(float64(i))
+		other.Observe(float64(i + 50))
+	}
+	require.NoError(t, s.Merge(other))
+	assert.Equal(t, uint64(100), s.Count)
+	assert.Equal(t, float64(1), s.Min)
+	assert.Equal(t, float64(100), s.Max)
+	assert.InDelta(t, 50, s.Quantile(0.5), 1)
+
+	assert.Equal(t, errors.ErrorSummaryAccuracy, s.Merge(NewSummary(0.05)))
+}
+
+func TestSummaryJSONRoundTrip(t *testing.T) {
+	s := NewSummary(DefaultRelativeAccuracy)
+	s.Observe(0.25)
+	s.Observe(4)
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	restored := &Summary{}
+	require.NoError(t, json.Unmarshal(data, restored))
+	require.NoError(t, restored.Validate())
+	assert.Equal(t, s.Quantiles(nil), restored.Quantiles(nil))
+
+	c := s.Copy()
+	s.Reset()
+	assert.Equal(t, uint64(0), s.Count)
+	assert.Equal(t, uint64(2), c.Count)
+}
@@ -0,0 +1,62 @@
+package collector
+
+import (
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Режимы обработки запоздавших наблюдений.
+const (
+	OutOfOrderAccept = "accept" // принимать любые запоздавшие наблюдения
+	OutOfOrderDrop   = "drop"   // отбрасывать запоздавшие наблюдения
+	OutOfOrderWindow = "window" // принимать запоздавшие наблюдения не старше окна
+)
+
+// Политика обработки наблюдений, время которых меньше времени последнего наблюдения серии.
+// Принятое запоздавшее значение gauge не перезаписывает более новое текущее значение.
+type OutOfOrderPolicy struct {
+	Mode   string
+	Window time.Duration
+}
+
+// Функция, проверяющая режим политики. Пустой режим соответствует OutOfOrderAccept.
+func NewOutOfOrderPolicy(mode string, window time.Duration) (OutOfOrderPolicy, error) {
+	switch mode {
+	case "":
+		mode = OutOfOrderAccept
+	case OutOfOrderAccept, OutOfOrderDrop, OutOfOrderWindow:
+	default:
+		return OutOfOrderPolicy{Mode: OutOfOrderAccept}, errors.ErrorOutOfOrderPolicy
+	}
+	return OutOfOrderPolicy{Mode: mode, Window: window}, nil
+}
+
+// Метод, определяющий, является ли наблюдение серии key запоздавшим и допускает ли его политика.
+// Вызывается под мьютексом коллектора.
+func (col *Collector) checkSampleTime(key string, sampleTime time.Time) (bool, error) {
+	last, ok := col.Metrics.Timestamps[key]
+	if !ok || sampleTime.UnixMilli() >= last {
+		return false, nil
+	}
+	lag := time.UnixMilli(last).Sub(sampleTime)
+	switch col.OutOfOrder.Mode {
+	case OutOfOrderDrop:
+	case OutOfOrderWindow:
+		if lag <= col.OutOfOrder.Window {
+			return true, nil
+		}
+	default:
+		return true, nil
+	}
+	log.InfoLog.Printf("dropped sample of %s that is %s older than the stored one", key, lag)
+	return true, errors.ErrorLateSample
+}
+
+// Метод, запоминающий время последнего наблюдения серии. Вызывается под мьютексом коллектора.
+func (col *Collector) touchSeries(key string, sampleTime time.Time) {
+	if ms := sampleTime.UnixMilli(); ms > col.Metrics.Timestamps[key] {
+		col.Metrics.Timestamps[key] = ms
+	}
+}
@@ -0,0 +1,88 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func gaugeAt(value float64, ts time.Time) *metrics.JSONMetrics {
+	ms := ts.UnixMilli()
+	return &metrics.JSONMetrics{ID: "Temperature", MType: "gauge", Value: &value, Timestamp: &ms}
+}
+
+func TestNewOutOfOrderPolicy(t *testing.T) {
+	policy, err := NewOutOfOrderPolicy("", 0)
+	require.NoError(t, err)
+	assert.Equal(t, OutOfOrderAccept, policy.Mode)
+
+	policy, err = NewOutOfOrderPolicy(OutOfOrderWindow, time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, policy.Window)
+
+	_, err = NewOutOfOrderPolicy("newest", 0)
+	assert.Equal(t, errors.ErrorOutOfOrderPolicy, err)
+}
+
+func TestLateGaugeAccepted(t *testing.T) {
+	c := NewCollector()
+	now := time.Now()
+	_, err := c.UpdateMetricFromJSON(gaugeAt(20, now))
+	require.NoError(t, err)
+
+	res, err := c.UpdateMetricFromJSON(gaugeAt(10, now.Add(-time.Hour)))
+	require.NoError(t, err)
+	assert.Equal(t, 10.0, *res.Value)
+	assert.Equal(t, metrics.Gauge(20), c.Metrics.GaugeMetrics["Temperature"])
+	assert.Equal(t, now.UnixMilli(), c.Metrics.Timestamps["Temperature"])
+}
+
+func TestLateSampleDropped(t *testing.T) {
+	c := NewCollector()
+	c.OutOfOrder = OutOfOrderPolicy{Mode: OutOfOrderDrop}
+	now := time.Now()
+	_, err := c.UpdateMetricFromJSON(gaugeAt(20, now))
+	require.NoError(t, err)
+	_, err = c.UpdateMetricFromJSON(gaugeAt(10, now.Add(-time.Second)))
+	assert.Equal(t, errors.ErrorLateSample, err)
+
+	accepted, err := c.UpdateBatch([]*metrics.JSONMetrics{gaugeAt(10, now.Add(-time.Second)), gaugeAt(30, now)})
+	require.NoError(t, err)
+	assert.Len(t, accepted, 1)
+	assert.Equal(t, metrics.Gauge(30), c.Metrics.GaugeMetrics["Temperature"])
+}
+
+func TestLateSampleWindow(t *testing.T) {
+	c := NewCollector()
+	c.OutOfOrder = OutOfOrderPolicy{Mode: OutOfOrderWindow, Window: time.Minute}
+	now := time.Now()
+	_, err := c.UpdateMetricFromJSON(gaugeAt(20, now))
+	require.NoError(t, err)
+	_, err = c.UpdateMetricFromJSON(gaugeAt(15, now.Add(-30*time.Second)))
+	assert.NoError(t, err)
+	_, err = c.UpdateMetricFromJSON(gaugeAt(10, now.Add(-2*time.Minute)))
+	assert.Equal(t, errors.ErrorLateSample, err)
+	assert.Equal(t, metrics.Gauge(20), c.Metrics.GaugeMetrics["Temperature"])
+}
+
+func TestLateCounterKeepsLatestTime(t *testing.T) {
+	c := NewCollector()
+	now := time.Now()
+	at := func(delta int64, sampleTime time.Time) *metrics.JSONMetrics {
+		ms := sampleTime.UnixMilli()
+		return &metrics.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &ms}
+	}
+	_, err := c.UpdateMetricFromJSON(at(5, now))
+	require.NoError(t, err)
+
+	// итог после запоздавшего приращения включает более новые наблюдения
+	res, err := c.UpdateMetricFromJSON(at(2, now.Add(-time.Minute)))
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *res.Delta)
+	assert.Equal(t, now.UnixMilli(), *res.Timestamp)
+}
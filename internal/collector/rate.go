@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"time"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Максимальное окно расчёта rate и increase: более старые значения counter не хранятся.
+var MaxRateWindow = time.Hour
+
+// Ограничение числа хранимых значений одного counter на случай очень частых обновлений.
+const maxCounterSamples = 4096
+
+// Накопленное значение counter на момент наблюдения.
+type counterSample struct {
+	At    time.Time
+	Value m.Counter
+}
+
+// Метод, запоминающий накопленное значение counter. Вызывается под мьютексом коллектора.
+// Время не убывает: запоздавшее наблюдение записывается временем последнего значения.
+func (col *Collector) recordCounter(key string, value m.Counter, at time.Time) {
+	if col.counterHistory == nil {
+		col.counterHistory = make(map[string][]counterSample)
+	}
+	samples := col.counterHistory[key]
+	if len(samples) > 0 && at.Before(samples[len(samples)-1].At) {
+		at = samples[len(samples)-1].At
+	}
+	samples = append(samples, counterSample{At: at, Value: value})
+	// Самое старое значение внутри горизонта остаётся точкой отсчёта для окна максимальной длины.
+	horizon := at.Add(-MaxRateWindow)
+	for len(samples) > 1 && !samples[1].At.After(horizon) {
+		samples = samples[1:]
+	}
+	if len(samples) > maxCounterSamples {
+		samples = samples[len(samples)-maxCounterSamples:]
+	}
+	col.counterHistory[key] = samples
+}
+
+// Функция, разбирающая окно расчёта rate и increase, например 30s или 5m.
+func ParseRateWindow(value string) (time.Duration, error) {
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 || window > MaxRateWindow {
+		return 0, errors.ErrorRateWindow
+	}
+	return window, nil
+}
+
+// Функция, рассчитывающая прирост counter и прирост в секунду по значениям, попавшим в окно.
+// Точкой отсчёта служит последнее значение не позже начала окна, если оно есть.
+// Уменьшение значения считается перезапуском: прирост после него равен новому значению.
+func counterIncrease(samples []counterSample, window time.Duration, now time.Time) (float64, float64) {
+	start := now.Add(-window)
+	first := 0
+	for i, sample := range samples {
+		if sample.At.After(start) {
+			break
+		}
+		first = i
+	}
+	points := make([]counterSample, 0, len(samples)-first)
+	for _, sample := range samples[first:] {
+		if sample.At.After(now) {
+			break
+		}
+		points = append(points, sample)
+	}
+	if len(points) < 2 {
+		return 0, 0
+	}
+	var increase float64
+	for i := 1; i < len(points); i++ {
+		delta := points[i].Value - points[i-1].Value
+		if delta < 0 {
+			delta = points[i].Value
+		}
+		increase += float64(delta)
+	}
+	span := points[len(points)-1].At.Sub(points[0].At).Seconds()
+	if span <= 0 {
+		return increase, 0
+	}
+	return increase, increase / span
+}
+
+// Метод, возвращающий прирост counter и прирост в секунду за окно window до момента now.
+func (col *Collector) CounterRate(
+	name string, matchers map[string]string, window time.Duration, now time.Time,
+) (float64, float64, error) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	key, ok := findSeries(col.Metrics.CounterMetrics, name, matchers)
+	if !ok {
+		return 0, 0, errors.ErrorMetricNotFound
+	}
+	increase, rate := counterIncrease(col.counterHistory[key], window, now)
+	return increase, rate, nil
+}
@@ -0,0 +1,61 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func counterAt(delta int64, ts time.Time) *metrics.JSONMetrics {
+	ms := ts.UnixMilli()
+	return &metrics.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &ms}
+}
+
+func TestCounterIncreaseWithReset(t *testing.T) {
+	now := time.Now()
+	samples := []counterSample{
+		{At: now.Add(-90 * time.Second), Value: 10},
+		{At: now.Add(-60 * time.Second), Value: 40},
+		{At: now.Add(-30 * time.Second), Value: 5},
+		{At: now, Value: 25},
+	}
+	increase, rate := counterIncrease(samples, time.Minute, now)
+	assert.Equal(t, 25.0, increase)
+	assert.InDelta(t, 25.0/60, rate, 1e-9)
+
+	increase, _ = counterIncrease(samples, 10*time.Minute, now)
+	assert.Equal(t, 55.0, increase)
+
+	increase, rate = counterIncrease(samples[:1], time.Minute, now)
+	assert.Zero(t, increase)
+	assert.Zero(t, rate)
+}
+
+func TestCounterRate(t *testing.T) {
+	c := NewCollector()
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		_, err := c.UpdateMetricFromJSON(counterAt(10, now.Add(time.Duration(i-4)*10*time.Second)))
+		require.NoError(t, err)
+	}
+	increase, rate, err := c.CounterRate("Requests", nil, 20*time.Second, now)
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, increase)
+	assert.InDelta(t, 1.0, rate, 1e-9)
+
+	res, err := c.GetMetricJSON(&metrics.JSONMetrics{ID: "Requests", MType: "counter", Window: "1m"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(50), *res.Delta)
+	assert.NotNil(t, res.Rate)
+	assert.Equal(t, 40.0, *res.Increase)
+
+	_, _, err = c.CounterRate("Unknown", nil, time.Minute, now)
+	assert.Equal(t, errors.ErrorMetricNotFound, err)
+	_, err = ParseRateWindow("2h")
+	assert.Equal(t, errors.ErrorRateWindow, err)
+}
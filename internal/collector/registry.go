@@ -0,0 +1,115 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Типы метрик, которые может хранить коллектор.
+var metricTypes = map[string]bool{
+	"gauge":     true,
+	"counter":   true,
+	"histogram": true,
+	"summary":   true,
+	"set":       true,
+}
+
+// Метод, регистрирующий описание метрики или дополняющий уже существующее.
+// Описание с типом, отличным от зарегистрированного, отклоняется.
+func (col *Collector) DeclareMetadata(meta *m.Metadata) (*m.Metadata, error) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	if meta.Name == "" || !metricTypes[meta.MType] {
+		return nil, errors.ErrorMetadata
+	}
+	if err := col.checkType(meta.Name, meta.MType); err != nil {
+		return nil, err
+	}
+	stored, ok := col.Metrics.Metadata[meta.Name]
+	if !ok {
+		stored = &m.Metadata{Name: meta.Name, MType: meta.MType}
+		col.Metrics.Metadata[meta.Name] = stored
+	}
+	if meta.Unit != "" {
+		stored.Unit = meta.Unit
+	}
+	if meta.Help != "" {
+		stored.Help = meta.Help
+	}
+	if meta.Owner != "" {
+		stored.Owner = meta.Owner
+	}
+	result := *stored
+	return &result, nil
+}
+
+// Метод, возвращающий описание метрики по имени.
+func (col *Collector) GetMetadata(name string) (*m.Metadata, bool) {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	stored, ok := col.Metrics.Metadata[name]
+	if !ok {
+		return nil, false
+	}
+	result := *stored
+	return &result, true
+}
+
+// Метод, возвращающий все зарегистрированные описания, упорядоченные по имени.
+func (col *Collector) ListMetadata() []m.Metadata {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	result := make([]m.Metadata, 0, len(col.Metrics.Metadata))
+	for _, meta := range col.Metrics.Metadata {
+		result = append(result, *meta)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result
+}
+
+// Метод, проверяющий, что тип обновления совпадает с зарегистрированным типом метрики.
+// Вызывается под мьютексом коллектора.
+func (col *Collector) checkType(name, mtype string) error {
+	stored, ok := col.Metrics.Metadata[name]
+	if !ok || stored.MType == mtype {
+		return nil
+	}
+	log.ErrorLog.Printf("rejected %s update of %s: registered as %s", mtype, name, stored.MType)
+	return fmt.Errorf("%w: %s is registered as %s, got %s", errors.ErrorTypeConflict, name, stored.MType, mtype)
+}
+
+// Метод, регистрирующий тип метрики при первом успешном обновлении.
+// Вызывается под мьютексом коллектора.
+func (col *Collector) registerType(name, mtype string) {
+	if _, ok := col.Metrics.Metadata[name]; !ok {
+		col.Metrics.Metadata[name] = &m.Metadata{Name: name, MType: mtype}
+	}
+}
+
+// Метод, заполняющий реестр типами уже хранящихся серий, например после чтения старого файла.
+func (col *Collector) registerStoredSeries() {
+	for key := range col.Metrics.GaugeMetrics {
+		name, _ := m.ParseSeriesKey(key)
+		col.registerType(name, "gauge")
+	}
+	for key := range col.Metrics.CounterMetrics {
+		name, _ := m.ParseSeriesKey(key)
+		col.registerType(name, "counter")
+	}
+	for key := range col.Metrics.HistogramMetrics {
+		name, _ := m.ParseSeriesKey(key)
+		col.registerType(name, "histogram")
+	}
+	for key := range col.Metrics.SummaryMetrics {
+		name, _ := m.ParseSeriesKey(key)
+		col.registerType(name, "summary")
+	}
+	for key := range col.Metrics.SetMetrics {
+		name, _ := m.ParseSeriesKey(key)
+		col.registerType(name, "set")
+	}
+}
@@ -0,0 +1,67 @@
+package collector
+
+import (
+	stdErrors "errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestDeclareMetadata(t *testing.T) {
+	c := NewCollector()
+	meta, err := c.DeclareMetadata(&metrics.Metadata{Name: "RequestLatency", MType: "histogram", Unit: "seconds"})
+	require.NoError(t, err)
+	assert.Equal(t, "seconds", meta.Unit)
+
+	meta, err = c.DeclareMetadata(&metrics.Metadata{Name: "RequestLatency", MType: "histogram", Help: "HTTP latency"})
+	require.NoError(t, err)
+	assert.Equal(t, metrics.Metadata{Name: "RequestLatency", MType: "histogram", Unit: "seconds", Help: "HTTP latency"}, *meta)
+
+	_, err = c.DeclareMetadata(&metrics.Metadata{Name: "RequestLatency", MType: "gauge"})
+	assert.True(t, stdErrors.Is(err, errors.ErrorTypeConflict))
+	_, err = c.DeclareMetadata(&metrics.Metadata{Name: "Broken", MType: "sample"})
+	assert.Equal(t, errors.ErrorMetadata, err)
+
+	stored, ok := c.GetMetadata("RequestLatency")
+	assert.True(t, ok)
+	assert.Equal(t, "HTTP latency", stored.Help)
+	_, ok = c.GetMetadata("Unknown")
+	assert.False(t, ok)
+}
+
+func TestTypeConflict(t *testing.T) {
+	c := NewCollector()
+	value := 1.5
+	_, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "PollCount", MType: "gauge", Value: &value})
+	assert.True(t, stdErrors.Is(err, errors.ErrorTypeConflict))
+	assert.Contains(t, err.Error(), "PollCount is registered as counter")
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Fresh", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	delta := int64(1)
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Fresh", MType: "counter", Delta: &delta})
+	assert.True(t, stdErrors.Is(err, errors.ErrorTypeConflict))
+
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Failed", MType: "histogram"})
+	assert.Equal(t, errors.ErrorMetricValue, err)
+	_, ok := c.GetMetadata("Failed")
+	assert.False(t, ok)
+}
+
+func TestRegistryFromSavedFile(t *testing.T) {
+	saved := &metrics.Metrics{
+		GaugeMetrics: map[string]metrics.Gauge{`Alloc{host="a"}`: 1},
+		Metadata: map[string]*metrics.Metadata{
+			"Requests": {Name: "Requests", MType: "counter", Unit: "requests"},
+		},
+	}
+	c := NewCollectorFromSavedFile(saved)
+	list := c.ListMetadata()
+	require.Len(t, list, 2)
+	assert.Equal(t, metrics.Metadata{Name: "Alloc", MType: "gauge"}, list[0])
+	assert.Equal(t, "requests", list[1].Unit)
+}
@@ -0,0 +1,102 @@
+package collector
+
+import (
+	"time"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Настройки устаревания серий: серия без обновлений дольше StaleAfter помечается устаревшей,
+// дольше EvictAfter — удаляется. Нулевое значение отключает соответствующую проверку.
+type Staleness struct {
+	StaleAfter time.Duration
+	EvictAfter time.Duration
+}
+
+// Метод, запоминающий время последнего обновления серии. Вызывается под мьютексом коллектора.
+func (col *Collector) markUpdated(key string, now time.Time) {
+	col.Metrics.UpdatedAt[key] = now.UnixMilli()
+}
+
+// Метод, проставляющий время обновления сериям, у которых его нет, например после чтения старого файла.
+func (col *Collector) markStoredSeries(now time.Time) {
+	keys := make([]string, 0)
+	for key := range col.Metrics.GaugeMetrics {
+		keys = append(keys, key)
+	}
+	for key := range col.Metrics.CounterMetrics {
+		keys = append(keys, key)
+	}
+	for key := range col.Metrics.HistogramMetrics {
+		keys = append(keys, key)
+	}
+	for key := range col.Metrics.SummaryMetrics {
+		keys = append(keys, key)
+	}
+	for key := range col.Metrics.SetMetrics {
+		keys = append(keys, key)
+	}
+	for _, key := range keys {
+		if _, ok := col.Metrics.UpdatedAt[key]; !ok {
+			col.markUpdated(key, now)
+		}
+	}
+}
+
+// Метод, проверяющий, устарела ли серия. Вызывается под мьютексом коллектора.
+func (col *Collector) isStale(key string, now time.Time) bool {
+	updated, ok := col.Metrics.UpdatedAt[key]
+	if col.Staleness.StaleAfter <= 0 || !ok {
+		return false
+	}
+	return now.Sub(time.UnixMilli(updated)) > col.Staleness.StaleAfter
+}
+
+// Метод, проверяющий, устарела ли серия с заданным именем и условиями на метки.
+func (col *Collector) IsStale(name string, matchers map[string]string) bool {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	key, ok := findSeries(col.Metrics.UpdatedAt, name, matchers)
+	return ok && col.isStale(key, time.Now())
+}
+
+// Метод, проверяющий, есть ли в коллекторе серия с ключом key.
+func (col *Collector) HasSeries(key string) bool {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	_, ok := col.Metrics.UpdatedAt[key]
+	return ok
+}
+
+// Метод, удаляющий серии, которые не обновлялись дольше EvictAfter, и возвращающий их ключи.
+func (col *Collector) EvictStale(now time.Time) []string {
+	col.mu.Lock()
+	defer col.mu.Unlock()
+	evicted := make([]string, 0)
+	if col.Staleness.EvictAfter <= 0 {
+		return evicted
+	}
+	for key, updated := range col.Metrics.UpdatedAt {
+		lastUpdate := time.UnixMilli(updated)
+		if now.Sub(lastUpdate) <= col.Staleness.EvictAfter {
+			continue
+		}
+		deleteSeries(col.Metrics, key)
+		delete(col.counterHistory, key)
+		evicted = append(evicted, key)
+		log.InfoLog.Printf("evicted stale series %s, last updated at %s", key, lastUpdate.Format(time.RFC3339))
+	}
+	return evicted
+}
+
+// Функция, удаляющая серию из всех словарей метрик.
+func deleteSeries(mtrcs *m.Metrics, key string) {
+	delete(mtrcs.GaugeMetrics, key)
+	delete(mtrcs.CounterMetrics, key)
+	delete(mtrcs.HistogramMetrics, key)
+	delete(mtrcs.SummaryMetrics, key)
+	delete(mtrcs.SetMetrics, key)
+	delete(mtrcs.Timestamps, key)
+	delete(mtrcs.UpdatedAt, key)
+}
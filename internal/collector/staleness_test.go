@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+func TestStaleSeriesMarked(t *testing.T) {
+	c := NewCollector()
+	c.Staleness = Staleness{StaleAfter: time.Minute}
+	value := 36.6
+	_, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Temperature", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+
+	res, err := c.GetMetricJSON(&metrics.JSONMetrics{ID: "Temperature", MType: "gauge"})
+	require.NoError(t, err)
+	assert.False(t, res.Stale)
+	assert.False(t, c.IsStale("Temperature", nil))
+
+	c.Metrics.UpdatedAt["Temperature"] = time.Now().Add(-2 * time.Minute).UnixMilli()
+	res, err = c.GetMetricJSON(&metrics.JSONMetrics{ID: "Temperature", MType: "gauge"})
+	require.NoError(t, err)
+	assert.True(t, res.Stale)
+	assert.True(t, c.IsStale("Temperature", nil))
+	assert.False(t, c.IsStale("Unknown", nil))
+}
+
+func TestEvictStale(t *testing.T) {
+	c := NewCollector()
+	c.Staleness = Staleness{EvictAfter: time.Hour}
+	now := time.Now()
+	value := 1.0
+	delta := int64(5)
+	_, err := c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Old", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	_, err = c.UpdateMetricFromJSON(&metrics.JSONMetrics{ID: "Fresh", MType: "counter", Delta: &delta})
+	require.NoError(t, err)
+	c.Metrics.UpdatedAt["Old"] = now.Add(-2 * time.Hour).UnixMilli()
+
+	evicted := c.EvictStale(now)
+	assert.Equal(t, []string{"Old"}, evicted)
+	assert.NotContains(t, c.Metrics.GaugeMetrics, "Old")
+	assert.NotContains(t, c.Metrics.UpdatedAt, "Old")
+	assert.Contains(t, c.Metrics.CounterMetrics, "Fresh")
+
+	c.Staleness = Staleness{}
+	assert.Empty(t, c.EvictStale(now.Add(24*time.Hour)))
+}
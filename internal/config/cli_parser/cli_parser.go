@@ -2,9 +2,11 @@ package cliparser
 
 import (
 	"flag"
+	"math"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/nmramorov/gowatcher/internal/errors"
 	"github.com/nmramorov/gowatcher/internal/log"
@@ -21,6 +23,20 @@ type ServerCLIOptions struct {
 	Config        string
 	TrustedSubnet string
 	GRPC          bool
+	OutOfOrder    string
+	OutOfOrderWin string
+	StaleTTL      string
+	EvictTTL      string
+	RollupAfter   string
+	Retention     string
+	Migrate       bool
+	SnapshotGens  int
+	SnapshotCodec string
+	TSDBPath      string
+	TSDBRetention string
+	RestoreFrom   string
+	StatsD        string
+	StatsDFlush   string
 }
 
 type AgentCLIOptions struct {
@@ -32,6 +48,8 @@ type AgentCLIOptions struct {
 	CryptoKey      string
 	Config         string
 	GRPC           bool
+	Buckets        string
+	Labels         string
 }
 
 func (scli *ServerCLIOptions) GetNumericInterval(intervalName string) int64 {
@@ -74,6 +92,20 @@ func NewServerCliOptions() (*ServerCLIOptions, error) {
 	config := serverOptions.String("c", "", "server json config path")
 	subnet := serverOptions.String("t", "", "trusted subnet CIDR")
 	grpc := serverOptions.Bool("grpc", false, "grpc mode")
+	outOfOrder := serverOptions.String("out-of-order", "accept", "late samples policy: accept, drop or window")
+	outOfOrderWindow := serverOptions.String("out-of-order-window", "300s", "max lag of accepted late samples")
+	staleTTL := serverOptions.String("stale-ttl", "", "period without updates after which series is stale")
+	evictTTL := serverOptions.String("evict-ttl", "", "period without updates after which series is evicted")
+	rollupAfter := serverOptions.String("rollup-after", "", "age after which stored history is rolled up, e.g. 48h or 2d")
+	migrate := serverOptions.Bool("migrate", false, "apply database schema migrations at startup")
+	snapshotGens := serverOptions.Int("snapshot-generations", 0, "number of snapshot file generations to keep")
+	snapshotCodec := serverOptions.String("snapshot-codec", "", "snapshot file compression: none or gzip")
+	tsdbPath := serverOptions.String("tsdb", "", "directory of the embedded time-series history without a database")
+	tsdbRetention := serverOptions.String("tsdb-retention", "", "age after which embedded history is removed, e.g. 720h or 30d")
+	restoreFrom := serverOptions.String("restore-from", "", "source of truth restored at startup with a database: db or file")
+	statsd := serverOptions.String("statsd", "", "StatsD listener address, e.g. :8125 or tcp://:8125")
+	statsdFlush := serverOptions.String("statsd-flush", "", "period between StatsD aggregate flushes, e.g. 10s")
+	retention := serverOptions.String("retention", "", "database retention rules, e.g. gauge=7d,counter=30d,gauge:cpu_=1d,gauge@1h=365d")
 	if err := serverOptions.Parse(os.Args[1:]); err != nil {
 		log.ErrorLog.Printf("error parsing server cli options: %e", err)
 		return nil, errors.ErrorWithCli
@@ -90,6 +122,20 @@ func NewServerCliOptions() (*ServerCLIOptions, error) {
 		Config:        *config,
 		TrustedSubnet: *subnet,
 		GRPC:          *grpc,
+		OutOfOrder:    *outOfOrder,
+		OutOfOrderWin: *outOfOrderWindow,
+		StaleTTL:      *staleTTL,
+		EvictTTL:      *evictTTL,
+		RollupAfter:   *rollupAfter,
+		Retention:     *retention,
+		Migrate:       *migrate,
+		SnapshotGens:  *snapshotGens,
+		SnapshotCodec: *snapshotCodec,
+		TSDBPath:      *tsdbPath,
+		TSDBRetention: *tsdbRetention,
+		RestoreFrom:   *restoreFrom,
+		StatsD:        *statsd,
+		StatsDFlush:   *statsdFlush,
 	}, nil
 }
 
@@ -103,6 +149,8 @@ func NewAgentCliOptions() (*AgentCLIOptions, error) {
 	cryptoKey := agentOptions.String("crypto-key", "", "path to public key")
 	config := agentOptions.String("c", "", "path to agent json config")
 	grpc := agentOptions.Bool("grpc", false, "grpc mode")
+	buckets := agentOptions.String("b", "", "comma separated histogram bucket bounds")
+	labels := agentOptions.String("labels", "", "comma separated name:value labels attached to every metric")
 	if err := agentOptions.Parse(os.Args[1:]); err != nil {
 		log.ErrorLog.Printf("error parsing agent cli options: %e", err)
 		return nil, errors.ErrorWithCli
@@ -117,9 +165,72 @@ func NewAgentCliOptions() (*AgentCLIOptions, error) {
 		CryptoKey:      *cryptoKey,
 		Config:         *config,
 		GRPC:           *grpc,
+		Buckets:        *buckets,
+		Labels:         *labels,
 	}, nil
 }
 
+// Функция, разбирающая границы корзин гистограммы, перечисленные через запятую.
+func ParseBuckets(value string) ([]float64, error) {
+	if value == "" {
+		return nil, nil
+	}
+	parts := strings.Split(value, ",")
+	buckets := make([]float64, 0, len(parts))
+	for _, part := range parts {
+		bound, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			log.ErrorLog.Printf("error parsing histogram bucket %s: %e", part, err)
+			return nil, errors.ErrorWithCli
+		}
+		buckets = append(buckets, bound)
+	}
+	return buckets, nil
+}
+
+// Функция, разбирающая метки вида name:value, перечисленные через запятую.
+func ParseLabels(value string) (map[string]string, error) {
+	if value == "" {
+		return nil, nil
+	}
+	labels := map[string]string{}
+	for _, part := range strings.Split(value, ",") {
+		name, labelValue, found := strings.Cut(strings.TrimSpace(part), ":")
+		if !found || name == "" {
+			log.ErrorLog.Printf("error parsing label %s", part)
+			return nil, errors.ErrorWithCli
+		}
+		labels[name] = labelValue
+	}
+	return labels, nil
+}
+
+// Функция, переводящая интервал вида 30s, 5m, 1h30m или 30d в секунды. Пустая строка соответствует нулю.
+// Отрицательный интервал, дробная часть секунды или неизвестная единица — ошибка, чтобы опечатка
+// не превращалась молча в ноль и не отключала зависящую от интервала функцию.
+func ParseInterval(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	var interval time.Duration
+	if strings.HasSuffix(value, "d") {
+		number, err := strconv.ParseInt(strings.TrimSuffix(value, "d"), 10, 64)
+		if err != nil || number < 0 || number > math.MaxInt64/int64(24*time.Hour) {
+			return 0, errors.ErrorWithIntervalConvertion
+		}
+		interval = time.Duration(number) * 24 * time.Hour
+	} else {
+		var err error
+		if interval, err = time.ParseDuration(value); err != nil {
+			return 0, errors.ErrorWithIntervalConvertion
+		}
+	}
+	if interval < 0 || interval%time.Second != 0 {
+		return 0, errors.ErrorWithIntervalConvertion
+	}
+	return int64(interval / time.Second), nil
+}
+
 func GetMultiplier(intervalValue string) int64 {
 	var multiplier int64
 	splitter := intervalValue[len(intervalValue)-1:]
@@ -129,6 +240,8 @@ func GetMultiplier(intervalValue string) int64 {
 		multiplier = 1
 	case `m`:
 		multiplier = 60
+	case `h`:
+		multiplier = 3600
 	}
 	return multiplier
 }
@@ -4,19 +4,39 @@ import (
 	"os"
 	"testing"
 
+	"github.com/nmramorov/gowatcher/internal/errors"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestGetMultiplier(t *testing.T) {
 	assert.Equal(t, int64(60), GetMultiplier("1m"))
 	assert.Equal(t, int64(1), GetMultiplier("6s"))
+	assert.Equal(t, int64(3600), GetMultiplier("2h"))
+}
+
+func TestParseInterval(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"": 0, "0": 0, "30s": 30, "5m": 300, "2h": 7200, "1h30m": 5400, "2d": 2 * 86400, "30d": 30 * 86400,
+	} {
+		seconds, err := ParseInterval(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, expected, seconds, value)
+	}
+	for _, value := range []string{"30", "2w", "d", "1.5d", "-1m", "500ms", "3o0s"} {
+		_, err := ParseInterval(value)
+		assert.ErrorIs(t, err, errors.ErrorWithIntervalConvertion, value)
+	}
 }
 
 func TestPositiveNewServerCLIOptions(t *testing.T) {
 	os.Args = []string{
 		"main.go", "-a", "localhost:38731", "-r=true", "-i=5m",
 		"-f=/tmp/wmSoUM", "-k=aaab", "-d=ddd", "-crypto-key=sfsdfsdfsd", "-c=/path/to/json",
-		"-t=255.255.255.0", "-grpc=true",
+		"-t=255.255.255.0", "-grpc=true", "-out-of-order=window", "-out-of-order-window=2m",
+		"-stale-ttl=1m", "-evict-ttl=10m", "-rollup-after=48h",
+		"-retention=gauge=7d", "-migrate", "-snapshot-generations=5",
+		"-snapshot-codec=gzip", "-tsdb=/tmp/tsdb", "-tsdb-retention=720h",
+		"-restore-from=file", "-statsd=:8125", "-statsd-flush=5s",
 	}
 	config, err := NewServerCliOptions()
 	assert.NoError(t, err)
@@ -30,6 +50,20 @@ func TestPositiveNewServerCLIOptions(t *testing.T) {
 	assert.Equal(t, "/path/to/json", config.Config)
 	assert.Equal(t, "255.255.255.0", config.TrustedSubnet)
 	assert.Equal(t, true, config.GRPC)
+	assert.Equal(t, "window", config.OutOfOrder)
+	assert.Equal(t, int64(120), mustParseInterval(t, config.OutOfOrderWin))
+	assert.Equal(t, int64(60), mustParseInterval(t, config.StaleTTL))
+	assert.Equal(t, int64(600), mustParseInterval(t, config.EvictTTL))
+	assert.Equal(t, int64(48*3600), mustParseInterval(t, config.RollupAfter))
+	assert.Equal(t, "gauge=7d", config.Retention)
+	assert.True(t, config.Migrate)
+	assert.Equal(t, 5, config.SnapshotGens)
+	assert.Equal(t, "gzip", config.SnapshotCodec)
+	assert.Equal(t, "/tmp/tsdb", config.TSDBPath)
+	assert.Equal(t, int64(720*3600), mustParseInterval(t, config.TSDBRetention))
+	assert.Equal(t, "file", config.RestoreFrom)
+	assert.Equal(t, ":8125", config.StatsD)
+	assert.Equal(t, int64(5), mustParseInterval(t, config.StatsDFlush))
 
 	assert.Equal(t, int64(300), config.GetNumericInterval("StoreInterval"))
 	assert.Equal(t, int64(0), config.GetNumericInterval("MyInterval"))
@@ -65,3 +99,10 @@ func TestNegativeNewAgentCLIOptions(t *testing.T) {
 	_, err := NewAgentCliOptions()
 	assert.Error(t, err)
 }
+
+func mustParseInterval(t *testing.T, value string) int64 {
+	t.Helper()
+	seconds, err := ParseInterval(value)
+	assert.NoError(t, err)
+	return seconds
+}
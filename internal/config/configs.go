@@ -22,9 +22,36 @@ type ServerConfig struct {
 	PrivateKeyPath string
 	TrustedSubnet  string
 	GRPC           bool
+	// Политика запоздавших наблюдений и окно в секундах для режима window.
+	OutOfOrder       string
+	OutOfOrderWindow int
+	// Время в секундах без обновлений, после которого серия считается устаревшей
+	// и после которого удаляется. Ноль отключает соответствующую проверку.
+	StaleTTL int
+	EvictTTL int
+	// Возраст в секундах, после которого история в БД сворачивается в агрегаты. Ноль отключает свёртку.
+	RollupAfter int
+	// Правила хранения строк в БД вида gauge=7d,counter=30d,gauge:cpu_=1d.
+	Retention string
+	// Применять миграции схемы БД при запуске.
+	Migrate bool
+	// Число хранимых поколений снимка файлового хранилища. Ноль означает значение по умолчанию.
+	SnapshotGenerations int
+	// Сжатие снимков файлового хранилища: none или gzip.
+	SnapshotCodec string
+	// Каталог встроенной базы временных рядов, хранящей историю без БД. Пустой путь отключает её.
+	TSDBPath string
+	// Возраст в секундах, после которого история во встроенной базе удаляется. Ноль — хранить всегда.
+	TSDBRetention int
+	// Источник восстановления метрик при запуске с БД: db (по умолчанию) или file.
+	RestoreFrom string
+	// Адрес приёма StatsD: :8125 для UDP или tcp://:8125 для TCP. Пустой адрес отключает приём.
+	StatsDAddress string
+	// Период в секундах, с которым агрегаты StatsD записываются в хранилище. Ноль означает значение по умолчанию.
+	StatsDFlushInterval int
 }
 
-func checkServerConfig(envs *env.ServerEnvConfig, clies *cli.ServerCLIOptions) *ServerConfig {
+func checkServerConfig(envs *env.ServerEnvConfig, clies *cli.ServerCLIOptions) (*ServerConfig, error) {
 	addr := clies.Address
 	storeint := clies.StoreInterval
 	storefile := clies.StoreFile
@@ -36,6 +63,20 @@ func checkServerConfig(envs *env.ServerEnvConfig, clies *cli.ServerCLIOptions) *
 	cryptoKey := clies.CryptoKey
 	subnet := clies.TrustedSubnet
 	grpc := clies.GRPC
+	outOfOrder := clies.OutOfOrder
+	outOfOrderWindow := clies.OutOfOrderWin
+	staleTTL := clies.StaleTTL
+	evictTTL := clies.EvictTTL
+	rollupAfter := clies.RollupAfter
+	retention := clies.Retention
+	migrate := clies.Migrate
+	snapshotGens := clies.SnapshotGens
+	snapshotCodec := clies.SnapshotCodec
+	tsdbPath := clies.TSDBPath
+	tsdbRetention := clies.TSDBRetention
+	restoreFrom := clies.RestoreFrom
+	statsd := clies.StatsD
+	statsdFlush := clies.StatsDFlush
 	if envs.Address != env.Address && envs.Address != addr {
 		addr = envs.Address
 	}
@@ -74,17 +115,75 @@ func checkServerConfig(envs *env.ServerEnvConfig, clies *cli.ServerCLIOptions) *
 	if envs.GRPC {
 		grpc = envs.GRPC
 	}
-	return &ServerConfig{
-		Address:        addr,
-		StoreInterval:  storeintNumeric,
-		StoreFile:      storefile,
-		Restore:        rest,
-		Key:            key,
-		Database:       db,
-		PrivateKeyPath: cryptoKey,
-		TrustedSubnet:  subnet,
-		GRPC:           grpc,
+	if envs.OutOfOrder != "" {
+		outOfOrder = envs.OutOfOrder
+	}
+	if envs.OutOfOrderWin != "" {
+		outOfOrderWindow = envs.OutOfOrderWin
+	}
+	if envs.StaleTTL != "" {
+		staleTTL = envs.StaleTTL
+	}
+	if envs.EvictTTL != "" {
+		evictTTL = envs.EvictTTL
+	}
+	if envs.RollupAfter != "" {
+		rollupAfter = envs.RollupAfter
+	}
+	if envs.Retention != "" {
+		retention = envs.Retention
+	}
+	if envs.Migrate {
+		migrate = envs.Migrate
+	}
+	if envs.SnapshotGens != 0 {
+		snapshotGens = envs.SnapshotGens
 	}
+	if envs.SnapshotCodec != "" {
+		snapshotCodec = envs.SnapshotCodec
+	}
+	if envs.TSDBPath != "" {
+		tsdbPath = envs.TSDBPath
+	}
+	if envs.TSDBRetention != "" {
+		tsdbRetention = envs.TSDBRetention
+	}
+	if envs.RestoreFrom != "" {
+		restoreFrom = envs.RestoreFrom
+	}
+	if envs.StatsD != "" {
+		statsd = envs.StatsD
+	}
+	if envs.StatsDFlush != "" {
+		statsdFlush = envs.StatsDFlush
+	}
+	intervals := &intervalParser{}
+	config := &ServerConfig{
+		Address:             addr,
+		StoreInterval:       storeintNumeric,
+		StoreFile:           storefile,
+		Restore:             rest,
+		Key:                 key,
+		Database:            db,
+		PrivateKeyPath:      cryptoKey,
+		TrustedSubnet:       subnet,
+		GRPC:                grpc,
+		OutOfOrder:          outOfOrder,
+		OutOfOrderWindow:    intervals.parse(outOfOrderWindow),
+		StaleTTL:            intervals.parse(staleTTL),
+		EvictTTL:            intervals.parse(evictTTL),
+		RollupAfter:         intervals.parse(rollupAfter),
+		Retention:           retention,
+		Migrate:             migrate,
+		SnapshotGenerations: snapshotGens,
+		SnapshotCodec:       snapshotCodec,
+		TSDBPath:            tsdbPath,
+		TSDBRetention:       intervals.parse(tsdbRetention),
+		RestoreFrom:         restoreFrom,
+		StatsDAddress:       statsd,
+		StatsDFlushInterval: intervals.parse(statsdFlush),
+	}
+	return config, intervals.err
 }
 
 func GetServerConfig() (*ServerConfig, error) {
@@ -110,17 +209,33 @@ func GetServerConfig() (*ServerConfig, error) {
 				log.ErrorLog.Printf("error parsing store interval value: %e", err)
 				return nil, err
 			}
-			return &ServerConfig{
-				Address:        jsonConfig.Address,
-				StoreInterval:  int(cli.GetMultiplier(jsonConfig.StoreInterval) * value),
-				StoreFile:      jsonConfig.StoreFile,
-				Restore:        jsonConfig.Restore,
-				PrivateKeyPath: jsonConfig.PrivateKeyPath,
-				Database:       jsonConfig.Database,
-				TrustedSubnet:  jsonConfig.TrustedSubnet,
-			}, nil
+			intervals := &intervalParser{}
+			config := &ServerConfig{
+				Address:             jsonConfig.Address,
+				StoreInterval:       int(cli.GetMultiplier(jsonConfig.StoreInterval) * value),
+				StoreFile:           jsonConfig.StoreFile,
+				Restore:             jsonConfig.Restore,
+				PrivateKeyPath:      jsonConfig.PrivateKeyPath,
+				Database:            jsonConfig.Database,
+				TrustedSubnet:       jsonConfig.TrustedSubnet,
+				OutOfOrder:          jsonConfig.OutOfOrder,
+				OutOfOrderWindow:    intervals.parse(jsonConfig.OutOfOrderWin),
+				StaleTTL:            intervals.parse(jsonConfig.StaleTTL),
+				EvictTTL:            intervals.parse(jsonConfig.EvictTTL),
+				RollupAfter:         intervals.parse(jsonConfig.RollupAfter),
+				Retention:           jsonConfig.Retention,
+				Migrate:             jsonConfig.Migrate,
+				SnapshotGenerations: jsonConfig.SnapshotGens,
+				SnapshotCodec:       jsonConfig.SnapshotCodec,
+				TSDBPath:            jsonConfig.TSDBPath,
+				TSDBRetention:       intervals.parse(jsonConfig.TSDBRetention),
+				RestoreFrom:         jsonConfig.RestoreFrom,
+				StatsDAddress:       jsonConfig.StatsD,
+				StatsDFlushInterval: intervals.parse(jsonConfig.StatsDFlush),
+			}
+			return config, intervals.err
 		}
-		return checkServerConfig(envConfig, cliConfig), nil
+		return checkServerConfig(envConfig, cliConfig)
 	}
 	var rest bool
 	if envConfig.Restore == "true" {
@@ -128,16 +243,47 @@ func GetServerConfig() (*ServerConfig, error) {
 	} else {
 		rest = false
 	}
-	return &ServerConfig{
-		Restore:        rest,
-		Address:        envConfig.Address,
-		StoreInterval:  int(envConfig.GetNumericInterval("StoreInterval")),
-		StoreFile:      envConfig.StoreFile,
-		Database:       envConfig.Database,
-		PrivateKeyPath: envConfig.CryptoKey,
-		TrustedSubnet:  envConfig.TrustedSubnet,
-		GRPC:           envConfig.GRPC,
-	}, nil
+	intervals := &intervalParser{}
+	config := &ServerConfig{
+		Restore:             rest,
+		Address:             envConfig.Address,
+		StoreInterval:       int(envConfig.GetNumericInterval("StoreInterval")),
+		StoreFile:           envConfig.StoreFile,
+		Database:            envConfig.Database,
+		PrivateKeyPath:      envConfig.CryptoKey,
+		TrustedSubnet:       envConfig.TrustedSubnet,
+		GRPC:                envConfig.GRPC,
+		OutOfOrder:          envConfig.OutOfOrder,
+		OutOfOrderWindow:    intervals.parse(envConfig.OutOfOrderWin),
+		StaleTTL:            intervals.parse(envConfig.StaleTTL),
+		EvictTTL:            intervals.parse(envConfig.EvictTTL),
+		RollupAfter:         intervals.parse(envConfig.RollupAfter),
+		Retention:           envConfig.Retention,
+		Migrate:             envConfig.Migrate,
+		SnapshotGenerations: envConfig.SnapshotGens,
+		SnapshotCodec:       envConfig.SnapshotCodec,
+		TSDBPath:            envConfig.TSDBPath,
+		TSDBRetention:       intervals.parse(envConfig.TSDBRetention),
+		RestoreFrom:         envConfig.RestoreFrom,
+		StatsDAddress:       envConfig.StatsD,
+		StatsDFlushInterval: intervals.parse(envConfig.StatsDFlush),
+	}
+	return config, intervals.err
+}
+
+// Разбор интервалов конфигурации сервера. Первая ошибка сохраняется, чтобы сервер не запускался
+// с нулём вместо значения с опечаткой.
+type intervalParser struct {
+	err error
+}
+
+func (p *intervalParser) parse(value string) int {
+	seconds, err := cli.ParseInterval(value)
+	if err != nil && p.err == nil {
+		log.ErrorLog.Printf("error parsing interval %q: %e", value, err)
+		p.err = err
+	}
+	return int(seconds)
 }
 
 type AgentConfig struct {
@@ -148,6 +294,8 @@ type AgentConfig struct {
 	RateLimit      int
 	PublicKeyPath  string
 	GRPC           bool
+	Buckets        []float64
+	Labels         map[string]string
 }
 
 func checkAgentConfig(envs *env.AgentEnvConfig, clies *cli.AgentCLIOptions) *AgentConfig {
@@ -160,6 +308,8 @@ func checkAgentConfig(envs *env.AgentEnvConfig, clies *cli.AgentCLIOptions) *Age
 	rate := clies.RateLimit
 	cryptoKey := clies.CryptoKey
 	grpc := clies.GRPC
+	bucketsValue := clies.Buckets
+	labelsValue := clies.Labels
 	if envs.Address != env.Address && envs.Address != addr {
 		addr = envs.Address
 	}
@@ -181,6 +331,20 @@ func checkAgentConfig(envs *env.AgentEnvConfig, clies *cli.AgentCLIOptions) *Age
 	if envs.GRPC {
 		grpc = envs.GRPC
 	}
+	if envs.Buckets != "" {
+		bucketsValue = envs.Buckets
+	}
+	buckets, err := cli.ParseBuckets(bucketsValue)
+	if err != nil {
+		log.ErrorLog.Printf("error parsing histogram buckets, using defaults: %e", err)
+	}
+	if envs.Labels != "" {
+		labelsValue = envs.Labels
+	}
+	labels, err := cli.ParseLabels(labelsValue)
+	if err != nil {
+		log.ErrorLog.Printf("error parsing agent labels, sending metrics without labels: %e", err)
+	}
 	return &AgentConfig{
 		Address:        addr,
 		PollInterval:   pollintNumeric,
@@ -189,6 +353,8 @@ func checkAgentConfig(envs *env.AgentEnvConfig, clies *cli.AgentCLIOptions) *Age
 		RateLimit:      rate,
 		PublicKeyPath:  cryptoKey,
 		GRPC:           grpc,
+		Buckets:        buckets,
+		Labels:         labels,
 	}
 }
 
@@ -227,10 +393,20 @@ func GetAgentConfig() (*AgentConfig, error) {
 				ReportInterval: int(cli.GetMultiplier(jsonConfig.ReportInterval) * repValue),
 				PublicKeyPath:  jsonConfig.PublicKeyPath,
 				GRPC:           false,
+				Buckets:        jsonConfig.Buckets,
+				Labels:         jsonConfig.Labels,
 			}, nil
 		}
 		return checkAgentConfig(envConfig, cliConfig), nil
 	}
+	buckets, err := cli.ParseBuckets(envConfig.Buckets)
+	if err != nil {
+		log.ErrorLog.Printf("error parsing histogram buckets, using defaults: %e", err)
+	}
+	labels, err := cli.ParseLabels(envConfig.Labels)
+	if err != nil {
+		log.ErrorLog.Printf("error parsing agent labels, sending metrics without labels: %e", err)
+	}
 	return &AgentConfig{
 		Address:        envConfig.Address,
 		PollInterval:   int(envConfig.GetNumericInterval("PollInterval")),
@@ -238,5 +414,7 @@ func GetAgentConfig() (*AgentConfig, error) {
 		Key:            envConfig.Key,
 		PublicKeyPath:  envConfig.CryptoKey,
 		GRPC:           envConfig.GRPC,
+		Buckets:        buckets,
+		Labels:         labels,
 	}, nil
 }
@@ -30,6 +30,8 @@ type AgentEnvConfig struct {
 	CryptoKey      string `env:"CRYPTO_KEY"`
 	Config         string `env:"CONFIG"`
 	GRPC           bool   `env:"GRPC"`
+	Buckets        string `env:"HISTOGRAM_BUCKETS"`
+	Labels         string `env:"LABELS"`
 }
 
 func checkAgentEnvs(envs *AgentEnvConfig) *AgentEnvConfig {
@@ -62,6 +64,8 @@ func checkAgentEnvs(envs *AgentEnvConfig) *AgentEnvConfig {
 		CryptoKey:      envs.CryptoKey,
 		Config:         envs.Config,
 		GRPC:           envs.GRPC,
+		Buckets:        envs.Buckets,
+		Labels:         envs.Labels,
 	}
 }
 
@@ -85,6 +89,20 @@ type ServerEnvConfig struct {
 	Config        string `env:"CONFIG"`
 	TrustedSubnet string `env:"TRUSTED_SUBNET"`
 	GRPC          bool   `env:"GRPC"`
+	OutOfOrder    string `env:"OUT_OF_ORDER"`
+	OutOfOrderWin string `env:"OUT_OF_ORDER_WINDOW"`
+	StaleTTL      string `env:"STALE_TTL"`
+	EvictTTL      string `env:"EVICT_TTL"`
+	RollupAfter   string `env:"ROLLUP_AFTER"`
+	Retention     string `env:"RETENTION"`
+	Migrate       bool   `env:"MIGRATE"`
+	SnapshotGens  int    `env:"SNAPSHOT_GENERATIONS"`
+	SnapshotCodec string `env:"SNAPSHOT_CODEC"`
+	TSDBPath      string `env:"TSDB_PATH"`
+	TSDBRetention string `env:"TSDB_RETENTION"`
+	RestoreFrom   string `env:"RESTORE_FROM"`
+	StatsD        string `env:"STATSD_ADDRESS"`
+	StatsDFlush   string `env:"STATSD_FLUSH_INTERVAL"`
 }
 
 func checkServerEnvs(envs *ServerEnvConfig) *ServerEnvConfig {
@@ -123,6 +141,20 @@ func checkServerEnvs(envs *ServerEnvConfig) *ServerEnvConfig {
 		Config:        envs.Config,
 		TrustedSubnet: envs.TrustedSubnet,
 		GRPC:          envs.GRPC,
+		OutOfOrder:    envs.OutOfOrder,
+		OutOfOrderWin: envs.OutOfOrderWin,
+		StaleTTL:      envs.StaleTTL,
+		EvictTTL:      envs.EvictTTL,
+		RollupAfter:   envs.RollupAfter,
+		Retention:     envs.Retention,
+		Migrate:       envs.Migrate,
+		SnapshotGens:  envs.SnapshotGens,
+		SnapshotCodec: envs.SnapshotCodec,
+		TSDBPath:      envs.TSDBPath,
+		TSDBRetention: envs.TSDBRetention,
+		RestoreFrom:   envs.RestoreFrom,
+		StatsD:        envs.StatsD,
+		StatsDFlush:   envs.StatsDFlush,
 	}
 }
 
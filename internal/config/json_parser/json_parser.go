@@ -16,15 +16,31 @@ type ServerJSONConfig struct {
 	Database       string `json:"database_dsn"`
 	PrivateKeyPath string `json:"crypto_key"`
 	TrustedSubnet  string `json:"trusted_subnet"`
+	OutOfOrder     string `json:"out_of_order,omitempty"`
+	OutOfOrderWin  string `json:"out_of_order_window,omitempty"`
+	StaleTTL       string `json:"stale_ttl,omitempty"`
+	EvictTTL       string `json:"evict_ttl,omitempty"`
+	RollupAfter    string `json:"rollup_after,omitempty"`
+	Retention      string `json:"retention,omitempty"`
+	Migrate        bool   `json:"migrate,omitempty"`
+	SnapshotGens   int    `json:"snapshot_generations,omitempty"`
+	SnapshotCodec  string `json:"snapshot_codec,omitempty"`
+	TSDBPath       string `json:"tsdb_path,omitempty"`
+	TSDBRetention  string `json:"tsdb_retention,omitempty"`
+	RestoreFrom    string `json:"restore_from,omitempty"`
+	StatsD         string `json:"statsd_address,omitempty"`
+	StatsDFlush    string `json:"statsd_flush_interval,omitempty"`
 }
 
 type AgentJSONConfig struct {
-	Address        string `json:"address"`
-	ReportInterval string `json:"report_interval"`
-	PollInterval   string `json:"poll_interval"`
-	Key            string `json:"key,omitempty"`
-	RateLimit      int    `json:"rate_limit,omitempty"`
-	PublicKeyPath  string `json:"crypto_key"`
+	Address        string            `json:"address"`
+	ReportInterval string            `json:"report_interval"`
+	PollInterval   string            `json:"poll_interval"`
+	Key            string            `json:"key,omitempty"`
+	RateLimit      int               `json:"rate_limit,omitempty"`
+	PublicKeyPath  string            `json:"crypto_key"`
+	Buckets        []float64         `json:"histogram_buckets,omitempty"`
+	Labels         map[string]string `json:"labels,omitempty"`
 }
 
 func ReadJSONConfig[T ServerJSONConfig | AgentJSONConfig](path string) (*T, error) {
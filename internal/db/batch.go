@@ -0,0 +1,226 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	DefaultBatchSize = 100
+	// Предел накопленных наблюдений, пока БД недоступна: новые пачки сверх него отклоняются.
+	MaxBufferedRows = 100000
+	// Период записи неполной пачки, ограничение времени записи и число попыток при закрытии курсора.
+	FlushInterval = time.Second
+	FlushTimeout  = 5 * time.Second
+	FlushRetries  = 3
+	FlushBackoff  = 100 * time.Millisecond
+)
+
+func (c *Cursor) batchSize() int {
+	if c.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return c.BatchSize
+}
+
+// Метод, проверяющий, поместятся ли в буфер ещё n наблюдений.
+func (c *Cursor) CanBuffer(n int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.buffer)+n <= MaxBufferedRows
+}
+
+// Метод, добавляющий наблюдения в буфер. Наблюдениям без времени присваивается время поступления,
+// чтобы порядок строк серии не зависел от момента записи пачки и её повторов. Полная пачка сразу
+// записывается в БД; при ошибке записи наблюдения остаются в буфере и записываются следующей попыткой.
+func (c *Cursor) AddBatchV2(parent context.Context, batch []*metrics.JSONMetrics) error {
+	arrived := time.Now().UnixMilli()
+	stamped := make([]*metrics.JSONMetrics, 0, len(batch))
+	for _, metric := range batch {
+		if metric.Timestamp == nil {
+			row := *metric
+			row.Timestamp = &arrived
+			metric = &row
+		}
+		stamped = append(stamped, metric)
+	}
+
+	c.mu.Lock()
+	if len(c.buffer)+len(stamped) > MaxBufferedRows {
+		c.mu.Unlock()
+		log.ErrorLog.Printf("batch buffer is full, %d rows rejected", len(stamped))
+		return errors.ErrorBatchBufferFull
+	}
+	c.buffer = append(c.buffer, stamped...)
+	full := len(c.buffer) >= c.batchSize()
+	c.mu.Unlock()
+
+	if full {
+		if err := c.Flush(parent); err != nil {
+			log.ErrorLog.Printf("could not flush batch, will retry: %e", err)
+		}
+	}
+	return nil
+}
+
+// Метод, возвращающий число наблюдений, ожидающих записи.
+func (c *Cursor) Buffered() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.buffer)
+}
+
+// Метод, записывающий накопленные наблюдения пачками по BatchSize, каждую в своей транзакции.
+// Незаписанные пачки возвращаются в начало буфера, поэтому повторная попытка не теряет строки, а уникальный
+// ключ (_id, labels, date) не даёт продублировать их, если исход фиксации прошлой попытки неизвестен.
+func (c *Cursor) Flush(parent context.Context) error {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+
+	c.mu.Lock()
+	pending := c.buffer
+	c.buffer = make([]*metrics.JSONMetrics, 0, c.batchSize())
+	c.mu.Unlock()
+
+	written := 0
+	var err error
+	for written < len(pending) {
+		end := written + c.batchSize()
+		if end > len(pending) {
+			end = len(pending)
+		}
+		if err = c.writeBatch(parent, pending[written:end]); err != nil {
+			break
+		}
+		written = end
+	}
+	if written < len(pending) {
+		c.mu.Lock()
+		c.buffer = append(pending[written:len(pending):len(pending)], c.buffer...)
+		c.mu.Unlock()
+	}
+	return err
+}
+
+// Функция, оставляющая из наблюдений серии с одинаковым временем последнее: одна вставка
+// не может обновить одну строку дважды.
+func latestPerSample(batch []*metrics.JSONMetrics) []*metrics.JSONMetrics {
+	last := make(map[string]int, len(batch))
+	for i, metric := range batch {
+		last[fmt.Sprintf("%s\x00%s\x00%d", metric.MType, metric.Key(), *metric.Timestamp)] = i
+	}
+	if len(last) == len(batch) {
+		return batch
+	}
+	unique := make([]*metrics.JSONMetrics, 0, len(last))
+	for i, metric := range batch {
+		if last[fmt.Sprintf("%s\x00%s\x00%d", metric.MType, metric.Key(), *metric.Timestamp)] == i {
+			unique = append(unique, metric)
+		}
+	}
+	return unique
+}
+
+// Метод, записывающий пачку в одной транзакции многострочной вставкой на каждый тип метрики.
+func (c *Cursor) writeBatch(parent context.Context, batch []*metrics.JSONMetrics) error {
+	ctx, cancel := context.WithTimeout(parent, FlushTimeout)
+	defer cancel()
+
+	dialect := c.dialect()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorLog.Printf("could not begin batch transaction: %e", err)
+		return err
+	}
+	byType := make(map[string][]any)
+	rows := make(map[string][]string)
+	types := make([]string, 0)
+	for _, metric := range latestPerSample(batch) {
+		if _, ok := dialect.BatchInsert[metric.MType]; !ok {
+			continue
+		}
+		args, err := rowArgs(metric)
+		if err != nil {
+			log.ErrorLog.Printf("skipping %s in batch: %e", metric.ID, err)
+			continue
+		}
+		if _, ok := rows[metric.MType]; !ok {
+			types = append(types, metric.MType)
+		}
+		n := len(byType[metric.MType])
+		rows[metric.MType] = append(rows[metric.MType], fmt.Sprintf(dialect.BatchValues, n+1, n+2, n+3, n+4, n+5))
+		byType[metric.MType] = append(byType[metric.MType], args...)
+	}
+	for _, mtype := range types {
+		query := dialect.BatchInsert[mtype] + strings.Join(rows[mtype], ", ") + dialect.BatchSuffix
+		if _, err = tx.ExecContext(ctx, query, byType[mtype]...); err != nil {
+			log.ErrorLog.Printf("could not write %s batch: %e", mtype, err)
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.ErrorLog.Printf("could not rollback batch transaction: %e", rollbackErr)
+			}
+			return err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.ErrorLog.Printf("could not commit batch transaction: %e", err)
+		return err
+	}
+	log.InfoLog.Printf("batch of %d rows written to db", len(batch))
+	return nil
+}
+
+// Метод, повторяющий запись буфера с увеличивающейся паузой, пока она не удастся или не кончатся попытки.
+func (c *Cursor) flushWithRetry(parent context.Context) error {
+	var err error
+	backoff := FlushBackoff
+	for attempt := 0; attempt < FlushRetries; attempt++ {
+		if err = c.Flush(parent); err == nil {
+			return nil
+		}
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+	return err
+}
+
+// Метод, запускающий периодическую запись неполной пачки. Останавливается при закрытии соединения.
+func (c *Cursor) StartFlushing(interval time.Duration) {
+	if c.flushDone != nil {
+		return
+	}
+	c.flushDone = make(chan struct{})
+	c.flushWG.Add(1)
+	go func() {
+		defer c.flushWG.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.flushDone:
+				return
+			case <-ticker.C:
+				if c.Buffered() == 0 {
+					continue
+				}
+				if err := c.Flush(context.Background()); err != nil {
+					log.ErrorLog.Printf("could not flush batch, will retry: %e", err)
+				}
+			}
+		}
+	}()
+}
+
+func (c *Cursor) stopFlushing() {
+	if c.flushDone == nil {
+		return
+	}
+	close(c.flushDone)
+	c.flushWG.Wait()
+	c.flushDone = nil
+}
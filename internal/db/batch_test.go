@@ -0,0 +1,89 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func gaugeBatch(n int, at time.Time) []*m.JSONMetrics {
+	batch := make([]*m.JSONMetrics, 0, n)
+	for i := 0; i < n; i++ {
+		value := float64(i)
+		sampleTime := at.Add(time.Duration(i) * time.Second).UnixMilli()
+		batch = append(batch, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value, Timestamp: &sampleTime})
+	}
+	return batch
+}
+
+func countRows(t *testing.T, cursor *Cursor, table string) int {
+	var rows int
+	require.NoError(t, cursor.DB.QueryRowContext(context.Background(), "SELECT COUNT(*) FROM "+table).Scan(&rows))
+	return rows
+}
+
+func TestSQLiteAddBatchV2(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	cursor.BatchSize = 2
+
+	delta := int64(4)
+	batch := append(gaugeBatch(2, time.Now()), &m.JSONMetrics{ID: "Requests", MType: COUNTER, Delta: &delta})
+	require.NoError(t, cursor.AddBatchV2(ctx, batch))
+	assert.Equal(t, 0, cursor.Buffered())
+	assert.Equal(t, 2, countRows(t, cursor, "gaugeMetrics"))
+	assert.Equal(t, 1, countRows(t, cursor, "counterMetrics"))
+
+	// Неполная пачка ждёт таймера или следующих наблюдений.
+	require.NoError(t, cursor.AddBatchV2(ctx, gaugeBatch(1, time.Now().Add(time.Hour))))
+	assert.Equal(t, 1, cursor.Buffered())
+	assert.Equal(t, 2, countRows(t, cursor, "gaugeMetrics"))
+}
+
+func TestSQLiteFlushRetry(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	cursor.BatchSize = 2
+
+	_, err := cursor.DB.ExecContext(ctx, "ALTER TABLE gaugeMetrics RENAME TO gaugeMetricsOffline")
+	require.NoError(t, err)
+	require.NoError(t, cursor.AddBatchV2(ctx, gaugeBatch(3, time.Now())))
+	assert.Equal(t, 3, cursor.Buffered())
+	assert.Error(t, cursor.Flush(ctx))
+	assert.Equal(t, 3, cursor.Buffered())
+
+	_, err = cursor.DB.ExecContext(ctx, "ALTER TABLE gaugeMetricsOffline RENAME TO gaugeMetrics")
+	require.NoError(t, err)
+	require.NoError(t, cursor.Flush(ctx))
+	assert.Equal(t, 0, cursor.Buffered())
+	assert.Equal(t, 3, countRows(t, cursor, "gaugeMetrics"))
+
+	maxRows := MaxBufferedRows
+	MaxBufferedRows = 2
+	defer func() { MaxBufferedRows = maxRows }()
+	assert.Equal(t, errors.ErrorBatchBufferFull, cursor.AddBatchV2(ctx, gaugeBatch(3, time.Now())))
+	assert.Equal(t, 0, cursor.Buffered())
+}
+
+func TestSQLiteFlushOnClose(t *testing.T) {
+	ctx := context.Background()
+	dsn := "file:" + filepath.Join(t.TempDir(), "metrics.db")
+	cursor, err := NewCursor(ctx, dsn, SQLiteAdaptor)
+	require.NoError(t, err)
+	require.NoError(t, cursor.InitDB(ctx))
+	cursor.StartFlushing(time.Hour)
+	require.NoError(t, cursor.AddBatchV2(ctx, gaugeBatch(3, time.Now())))
+	require.NoError(t, cursor.CloseConnection(ctx))
+
+	reopened, err := NewCursor(ctx, dsn, SQLiteAdaptor)
+	require.NoError(t, err)
+	defer reopened.CloseConnection(ctx)
+	assert.Equal(t, 3, countRows(t, reopened, "gaugeMetrics"))
+}
@@ -3,6 +3,8 @@ package db
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"sync"
 	"time"
 
 	_ "github.com/jackc/pgx/v5/stdlib" // required import for pgx
@@ -13,8 +15,11 @@ import (
 )
 
 var (
-	GAUGE   = "gauge"
-	COUNTER = "counter"
+	GAUGE     = "gauge"
+	COUNTER   = "counter"
+	HISTOGRAM = "histogram"
+	SUMMARY   = "summary"
+	SET       = "set"
 
 	DBDefaultTimeout = time.Duration(100) * time.Millisecond
 )
@@ -23,6 +28,7 @@ type DriverMethods interface {
 	Close() error
 	PingContext(ctx context.Context) error
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
 	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
 	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
@@ -40,8 +46,15 @@ type DatabaseAccess interface {
 type Cursor struct {
 	DatabaseAccess
 	DB      DriverMethods
+	Dialect *Dialect
 	IsValid bool
-	buffer  []*metrics.JSONMetrics
+	// Число наблюдений, при накоплении которого пачка записывается в БД; ноль означает DefaultBatchSize.
+	BatchSize int
+	mu        sync.Mutex
+	flushMu   sync.Mutex
+	buffer    []*metrics.JSONMetrics
+	flushDone chan struct{}
+	flushWG   sync.WaitGroup
 }
 
 func NewCursor(parent context.Context, link, adaptor string) (*Cursor, error) {
@@ -54,10 +67,15 @@ func NewCursor(parent context.Context, link, adaptor string) (*Cursor, error) {
 		log.ErrorLog.Printf("Unable to connect to database: %v\n", err)
 		return nil, err
 	}
+	if adaptor == SQLiteAdaptor {
+		// SQLite допускает одного писателя, поэтому запросы выполняются через одно соединение.
+		db.SetMaxOpenConns(1)
+	}
 	cursor := &Cursor{
 		DB:      db,
+		Dialect: DialectFor(adaptor),
 		IsValid: true,
-		buffer:  make([]*metrics.JSONMetrics, 0, 100),
+		buffer:  make([]*metrics.JSONMetrics, 0, DefaultBatchSize),
 	}
 
 	err = cursor.Ping(ctx)
@@ -67,7 +85,14 @@ func NewCursor(parent context.Context, link, adaptor string) (*Cursor, error) {
 	return cursor, nil
 }
 
+// Метод, закрывающий соединение. Накопленные наблюдения предварительно записываются в БД.
 func (c *Cursor) CloseConnection(parent context.Context) error {
+	c.stopFlushing()
+	if c.IsValid {
+		if err := c.flushWithRetry(parent); err != nil {
+			log.ErrorLog.Printf("could not flush buffered rows on close: %e", err)
+		}
+	}
 	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
 	defer cancel()
 
@@ -104,53 +129,111 @@ func (c *Cursor) Ping(parent context.Context) error {
 	return nil
 }
 
-func (c *Cursor) InitDB(parent context.Context) error {
-	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
-	defer cancel()
+// Метод, возвращающий диалект курсора. По умолчанию используется Postgres.
+func (c *Cursor) dialect() *Dialect {
+	if c.Dialect == nil {
+		return PostgresDialect
+	}
+	return c.Dialect
+}
 
-	_, err := c.DB.ExecContext(ctx, CreateGaugeTable)
-	if err != nil {
-		log.ErrorLog.Printf("error creating gaugemetrics table %e", err)
-		return err
+// Метод, создающий недостающие таблицы. Каждый запрос выполняется со своим ограничением
+// MigrationTimeout. Таблицы, которым нужны миграции, не изменяются: InitDB возвращает
+// ErrorSchemaOutdated, и схему нужно обновить командой server migrate.
+func (c *Cursor) InitDB(parent context.Context) error {
+	dialect := c.dialect()
+	if dialect.SchemaCheck != "" {
+		if err := c.execSchema(parent, dialect.SchemaCheck); err != nil {
+			log.ErrorLog.Printf("database schema must be upgraded with `server migrate`: %e", err)
+			return errors.ErrorSchemaOutdated
+		}
 	}
-	log.InfoLog.Println("gaugemetrics table was created")
-	_, err = c.DB.ExecContext(ctx, CreateCounterTable)
-	if err != nil {
-		log.ErrorLog.Printf("error creating countermetrics table %e", err)
-		return err
+	for _, table := range dialect.Tables {
+		if err := c.execSchema(parent, table.Create); err != nil {
+			log.ErrorLog.Printf("error creating %s table %e", table.Name, err)
+			return err
+		}
+		log.InfoLog.Printf("%s table was created", table.Name)
+	}
+	for _, query := range dialect.Upgrades {
+		if err := c.execSchema(parent, query); err != nil {
+			log.ErrorLog.Printf("error upgrading tables: %e", err)
+			return err
+		}
 	}
-	log.InfoLog.Println("countermetrics table was created")
 
 	return nil
 }
 
-func add(parent context.Context, incomingMetrics *metrics.JSONMetrics, db interface {
+func (c *Cursor) execSchema(parent context.Context, query string) error {
+	ctx, cancel := context.WithTimeout(parent, MigrationTimeout)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, query)
+	return err
+}
+
+func add(parent context.Context, incomingMetrics *metrics.JSONMetrics, dialect *Dialect, db interface {
 	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
 },
 ) error {
 	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
 	defer cancel()
 	log.InfoLog.Println(incomingMetrics)
-	switch incomingMetrics.MType {
+	query, ok := dialect.Insert[incomingMetrics.MType]
+	if !ok {
+		return nil
+	}
+	args, err := rowArgs(incomingMetrics)
+	if err != nil {
+		return err
+	}
+	if _, err = db.ExecContext(ctx, query, args...); err != nil {
+		log.ErrorLog.Printf("error adding %s row %s to db: %e", incomingMetrics.MType, incomingMetrics.ID, err)
+		return err
+	}
+	log.InfoLog.Printf("added %s data to db...", incomingMetrics.ID)
+	return nil
+}
+
+// Функция, возвращающая параметры строки метрики в порядке столбцов _id, mtype, _value, labels, date.
+// Значения gauge и counter передаются числом, остальных типов — сериализованным текстом.
+func rowArgs(metric *metrics.JSONMetrics) ([]any, error) {
+	var value any
+	switch metric.MType {
 	case GAUGE:
-		if _, err := db.ExecContext(
-			ctx, InsertIntoGauge, incomingMetrics.ID, incomingMetrics.MType, incomingMetrics.Value); err != nil {
-			log.ErrorLog.Printf("error adding gauge row %s to DB: %e", incomingMetrics.ID, err)
-			return err
-		}
+		value = metric.Value
 	case COUNTER:
-		if _, err := db.ExecContext(
-			ctx, InsertIntoCounter, incomingMetrics.ID, incomingMetrics.MType, incomingMetrics.Delta); err != nil {
-			log.ErrorLog.Printf("error adding counter row %s to db: %e", incomingMetrics.ID, err)
-			return err
+		value = metric.Delta
+	case HISTOGRAM:
+		if metric.Histogram == nil {
+			return nil, errors.ErrorMetricValue
+		}
+		value = metric.Histogram.String()
+	case SUMMARY:
+		if metric.Summary == nil {
+			return nil, errors.ErrorMetricValue
+		}
+		value = metric.Summary.String()
+	case SET:
+		if metric.Set == nil {
+			return nil, errors.ErrorMetricValue
 		}
+		value = metric.Set.String()
 	}
-	log.InfoLog.Printf("added %s data to db...", incomingMetrics.ID)
-	return nil
+	return []any{metric.ID, metric.MType, value, metrics.LabelsJSON(metric.Labels), sampleDate(metric)}, nil
+}
+
+// Функция, возвращающая время наблюдения метрики в UTC или NULL, если клиент его не передал.
+func sampleDate(metric *metrics.JSONMetrics) sql.NullTime {
+	if metric.Timestamp == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: time.UnixMilli(*metric.Timestamp).UTC(), Valid: true}
 }
 
 func (c *Cursor) Add(parent context.Context, incomingMetrics *metrics.JSONMetrics) error {
-	return add(parent, incomingMetrics, c.DB)
+	return add(parent, incomingMetrics, c.dialect(), c.DB)
 }
 
 func (c *Cursor) Get(parent context.Context, metricToFind *metrics.JSONMetrics) (*metrics.JSONMetrics, error) {
@@ -158,52 +241,143 @@ func (c *Cursor) Get(parent context.Context, metricToFind *metrics.JSONMetrics)
 	defer cancel()
 
 	foundMetric := &metrics.JSONMetrics{}
+	matchers := metrics.LabelsJSON(metricToFind.Labels)
+	var labels string
 	var row *sql.Row
 	switch metricToFind.MType {
 	case GAUGE:
-		if row = c.DB.QueryRowContext(ctx, SelectFromGauge, metricToFind.ID); row == nil || row.Err() != nil {
+		if row = c.DB.QueryRowContext(ctx, c.dialect().Select[GAUGE], metricToFind.ID, matchers); row == nil || row.Err() != nil {
 			log.ErrorLog.Printf("error getting gauge row %s to db", metricToFind.ID)
 			if row != nil {
 				return nil, row.Err()
 			}
 			return nil, errors.ErrorDB
 		}
-		err := row.Scan(foundMetric.ID, foundMetric.MType, foundMetric.Value)
+		var value float64
+		err := row.Scan(&foundMetric.ID, &foundMetric.MType, &value, &labels)
 		if err != nil {
 			log.ErrorLog.Printf("error scanning gauge %s: %e", metricToFind.ID, err)
 			return nil, err
 		}
+		foundMetric.Value = &value
 	case COUNTER:
-		if row = c.DB.QueryRowContext(ctx, SelectFromCounter, metricToFind.ID); row == nil || row.Err() != nil {
+		if row = c.DB.QueryRowContext(ctx, c.dialect().Select[COUNTER], metricToFind.ID, matchers); row == nil || row.Err() != nil {
 			log.ErrorLog.Printf("error getting counter row %s to db", metricToFind.ID)
 			if row != nil {
 				return nil, row.Err()
 			}
 			return nil, errors.ErrorDB
 		}
-		err := row.Scan(foundMetric.ID, foundMetric.MType, foundMetric.Delta)
+		var delta int64
+		err := row.Scan(&foundMetric.ID, &foundMetric.MType, &delta, &labels)
 		if err != nil {
 			log.ErrorLog.Printf("error scanning counter %s: %e", metricToFind.ID, err)
 			return nil, err
 		}
+		foundMetric.Delta = &delta
+	case HISTOGRAM:
+		if row = c.DB.QueryRowContext(ctx, c.dialect().Select[HISTOGRAM], metricToFind.ID, matchers); row == nil || row.Err() != nil {
+			log.ErrorLog.Printf("error getting histogram row %s to db", metricToFind.ID)
+			if row != nil {
+				return nil, row.Err()
+			}
+			return nil, errors.ErrorDB
+		}
+		var value string
+		err := row.Scan(&foundMetric.ID, &foundMetric.MType, &value, &labels)
+		if err != nil {
+			log.ErrorLog.Printf("error scanning histogram %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+		foundMetric.Histogram = &metrics.Histogram{}
+		if err = json.Unmarshal([]byte(value), foundMetric.Histogram); err != nil {
+			log.ErrorLog.Printf("error decoding histogram %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+	case SUMMARY:
+		if row = c.DB.QueryRowContext(ctx, c.dialect().Select[SUMMARY], metricToFind.ID, matchers); row == nil || row.Err() != nil {
+			log.ErrorLog.Printf("error getting summary row %s to db", metricToFind.ID)
+			if row != nil {
+				return nil, row.Err()
+			}
+			return nil, errors.ErrorDB
+		}
+		var value string
+		err := row.Scan(&foundMetric.ID, &foundMetric.MType, &value, &labels)
+		if err != nil {
+			log.ErrorLog.Printf("error scanning summary %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+		foundMetric.Summary = &metrics.Summary{}
+		if err = json.Unmarshal([]byte(value), foundMetric.Summary); err != nil {
+			log.ErrorLog.Printf("error decoding summary %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+		levels := make([]float64, 0, len(metricToFind.Quantiles))
+		for _, q := range metricToFind.Quantiles {
+			levels = append(levels, q.Quantile)
+		}
+		foundMetric.Quantiles = foundMetric.Summary.Quantiles(levels)
+	case SET:
+		if row = c.DB.QueryRowContext(ctx, c.dialect().Select[SET], metricToFind.ID, matchers); row == nil || row.Err() != nil {
+			log.ErrorLog.Printf("error getting set row %s to db", metricToFind.ID)
+			if row != nil {
+				return nil, row.Err()
+			}
+			return nil, errors.ErrorDB
+		}
+		var value string
+		err := row.Scan(&foundMetric.ID, &foundMetric.MType, &value, &labels)
+		if err != nil {
+			log.ErrorLog.Printf("error scanning set %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+		foundMetric.Set = &metrics.Set{}
+		if err = json.Unmarshal([]byte(value), foundMetric.Set); err != nil {
+			log.ErrorLog.Printf("error decoding set %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
+		estimate := foundMetric.Set.Estimate()
+		foundMetric.Estimate = &estimate
+	default:
+		return nil, errors.ErrorMetricNotFound
+	}
+	if labels != "" && labels != "{}" {
+		if err := json.Unmarshal([]byte(labels), &foundMetric.Labels); err != nil {
+			log.ErrorLog.Printf("error decoding labels of %s: %e", metricToFind.ID, err)
+			return nil, err
+		}
 	}
 	return foundMetric, nil
 }
 
-func (c *Cursor) AddBatchV2(parent context.Context, metrics []*metrics.JSONMetrics) error {
+// Метод, возвращающий значения серии gauge или counter с точным набором меток за полуинтервал [from, to).
+func (c *Cursor) History(parent context.Context, metric *metrics.JSONMetrics, from, to time.Time) ([]metrics.Sample, error) {
 	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
 	defer cancel()
 
-	c.buffer = append(c.buffer, metrics...)
-	if cap(c.buffer) == len(c.buffer) {
-		for _, item := range c.buffer {
-			err := c.Add(ctx, item)
-			if err != nil {
-				log.ErrorLog.Printf("cannot add record to the database")
-				return err
-			}
+	query, ok := c.dialect().History[metric.MType]
+	if !ok {
+		return nil, errors.ErrorMetricNotFound
+	}
+	rows, err := c.DB.QueryContext(ctx, query, metric.ID, metrics.LabelsJSON(metric.Labels), from.UTC(), to.UTC())
+	if err != nil {
+		log.ErrorLog.Printf("error getting history of %s: %e", metric.ID, err)
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing history rows: %e", err)
 		}
-		c.buffer = c.buffer[:0]
+	}()
+	samples := make([]metrics.Sample, 0)
+	for rows.Next() {
+		var sample metrics.Sample
+		if err = rows.Scan(&sample.Value, &sample.Time); err != nil {
+			log.ErrorLog.Printf("error scanning history of %s: %e", metric.ID, err)
+			return nil, err
+		}
+		samples = append(samples, sample)
 	}
-	return nil
+	return samples, rows.Err()
 }
@@ -140,8 +140,21 @@ func TestInitDBPositive(t *testing.T) {
 	defer ctrl.Finish()
 
 	s := mock_db.NewMockDriverMethods(ctrl)
+	s.EXPECT().ExecContext(gomock.Any(), CheckSchema).Return(nil, nil).MaxTimes(1)
 	s.EXPECT().ExecContext(gomock.Any(), CreateGaugeTable).Return(nil, nil).MaxTimes(1)
 	s.EXPECT().ExecContext(gomock.Any(), CreateCounterTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateHistogramTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateSummaryTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateSetTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateRollupMinuteTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateRollupHourTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), CreateMetadataTable).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), AddGaugeLabels).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), AddCounterLabels).Return(nil, nil).MaxTimes(1)
+	s.EXPECT().ExecContext(gomock.Any(), AddHistogramLabels).Return(nil, nil).MaxTimes(1)
+	for _, query := range uniqueSamples("gaugemetrics", "countermetrics", "histogrammetrics", "summarymetrics", "setmetrics") {
+		s.EXPECT().ExecContext(gomock.Any(), query).Return(nil, nil).MaxTimes(1)
+	}
 	c := Cursor{
 		DB: s,
 	}
@@ -154,6 +167,7 @@ func TestInitDBNegative(t *testing.T) {
 	defer ctrl.Finish()
 
 	s := mock_db.NewMockDriverMethods(ctrl)
+	s.EXPECT().ExecContext(gomock.Any(), CheckSchema).Return(nil, nil).MaxTimes(1)
 	s.EXPECT().ExecContext(gomock.Any(), CreateGaugeTable).Return(nil, errors.ErrorMetricNotFound).MaxTimes(1)
 	s.EXPECT().ExecContext(gomock.Any(), CreateCounterTable).Return(nil, errors.ErrorMetricNotFound).MaxTimes(1)
 	c := Cursor{
@@ -162,12 +176,21 @@ func TestInitDBNegative(t *testing.T) {
 	require.Error(t, c.InitDB(parent))
 
 	ss := mock_db.NewMockDriverMethods(ctrl)
+	ss.EXPECT().ExecContext(gomock.Any(), CheckSchema).Return(nil, nil).MaxTimes(1)
 	ss.EXPECT().ExecContext(gomock.Any(), CreateGaugeTable).Return(nil, nil).MaxTimes(1)
 	ss.EXPECT().ExecContext(gomock.Any(), CreateCounterTable).Return(nil, errors.ErrorMetricNotFound).MaxTimes(1)
 	c = Cursor{
 		DB: ss,
 	}
 	require.Error(t, c.InitDB(parent))
+
+	// таблицы прежних версий не перестраиваются при запуске, их обновляет server migrate
+	outdated := mock_db.NewMockDriverMethods(ctrl)
+	outdated.EXPECT().ExecContext(gomock.Any(), CheckSchema).Return(nil, errors.ErrorDB)
+	c = Cursor{
+		DB: outdated,
+	}
+	require.ErrorIs(t, c.InitDB(parent), errors.ErrorSchemaOutdated)
 }
 
 func TestAddPositive(t *testing.T) {
@@ -190,7 +213,7 @@ func TestAddPositive(t *testing.T) {
 
 	s := mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value).
+		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value, "{}", sql.NullTime{}).
 		MaxTimes(1)
 	c := Cursor{
 		DB: s,
@@ -199,12 +222,66 @@ func TestAddPositive(t *testing.T) {
 
 	s = mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta).
+		ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta, "{}", sql.NullTime{}).
 		MaxTimes(1)
 	c = Cursor{
 		DB: s,
 	}
 	require.NoError(t, c.Add(parent, mockCounterMetric))
+
+	mockHistogram := m.NewHistogram([]float64{1, 5})
+	mockHistogram.Observe(3)
+	mockHistogramMetric := &m.JSONMetrics{
+		ID:        "1",
+		MType:     "histogram",
+		Histogram: mockHistogram,
+		Labels:    map[string]string{"host": "a"},
+	}
+	s = mock_db.NewMockDriverMethods(ctrl)
+	s.EXPECT().
+		ExecContext(gomock.Any(), InsertIntoHistogram, mockHistogramMetric.ID, mockHistogramMetric.MType,
+			`{"bounds":[1,5],"counts":[0,1,0],"count":1,"sum":3}`, `{"host":"a"}`, sql.NullTime{}).
+		Times(1)
+	c = Cursor{
+		DB: s,
+	}
+	require.NoError(t, c.Add(parent, mockHistogramMetric))
+
+	mockSummary := m.NewSummary(m.DefaultRelativeAccuracy)
+	mockSummary.Observe(2)
+	sampleTime := int64(1700000000000)
+	mockSummaryMetric := &m.JSONMetrics{
+		ID:        "1",
+		MType:     "summary",
+		Summary:   mockSummary,
+		Timestamp: &sampleTime,
+	}
+	s = mock_db.NewMockDriverMethods(ctrl)
+	s.EXPECT().
+		ExecContext(gomock.Any(), InsertIntoSummary, mockSummaryMetric.ID, mockSummaryMetric.MType,
+			mockSummary.String(), "{}", sql.NullTime{Time: time.UnixMilli(sampleTime).UTC(), Valid: true}).
+		Times(1)
+	c = Cursor{
+		DB: s,
+	}
+	require.NoError(t, c.Add(parent, mockSummaryMetric))
+
+	mockSet := m.NewSet(m.DefaultSetPrecision)
+	mockSet.Add("user-1")
+	mockSetMetric := &m.JSONMetrics{
+		ID:    "1",
+		MType: "set",
+		Set:   mockSet,
+	}
+	s = mock_db.NewMockDriverMethods(ctrl)
+	s.EXPECT().
+		ExecContext(gomock.Any(), InsertIntoSet, mockSetMetric.ID, mockSetMetric.MType,
+			mockSet.String(), "{}", sql.NullTime{}).
+		Times(1)
+	c = Cursor{
+		DB: s,
+	}
+	require.NoError(t, c.Add(parent, mockSetMetric))
 }
 
 func TestAddNegative(t *testing.T) {
@@ -227,7 +304,7 @@ func TestAddNegative(t *testing.T) {
 
 	s := mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value).
+		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value, "{}", sql.NullTime{}).
 		Return(nil, errors.ErrorWithIntervalConvertion).
 		MaxTimes(1)
 	c := Cursor{
@@ -237,7 +314,7 @@ func TestAddNegative(t *testing.T) {
 
 	s = mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta).
+		ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta, "{}", sql.NullTime{}).
 		Return(nil, errors.ErrorWithIntervalConvertion).
 		MaxTimes(1)
 	c = Cursor{
@@ -268,7 +345,7 @@ func TestAddBatchV2(t *testing.T) {
 
 	s := mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value).
+		ExecContext(gomock.Any(), InsertIntoGauge, mockGaugeMetric.ID, mockGaugeMetric.MType, mockGaugeMetric.Value, "{}", sql.NullTime{}).
 		MaxTimes(1)
 	c := Cursor{
 		DB:     s,
@@ -279,7 +356,7 @@ func TestAddBatchV2(t *testing.T) {
 
 	// s = mock_db.NewMockDriverMethods(ctrl)
 	// s.EXPECT().
-	// 	ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta).
+	// 	ExecContext(gomock.Any(), InsertIntoCounter, mockCounterMetric.ID, mockCounterMetric.MType, mockCounterMetric.Delta, "{}", sql.NullTime{}).
 	// 	MaxTimes(1)
 	// c = Cursor{
 	// 	DB: s,
@@ -307,7 +384,7 @@ func TestGetNegative(t *testing.T) {
 
 	s := mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		QueryRowContext(gomock.Any(), SelectFromGauge, mockGaugeMetric.ID).
+		QueryRowContext(gomock.Any(), SelectFromGauge, mockGaugeMetric.ID, "{}").
 		MaxTimes(1)
 	c := Cursor{
 		DB: s,
@@ -317,7 +394,7 @@ func TestGetNegative(t *testing.T) {
 
 	s = mock_db.NewMockDriverMethods(ctrl)
 	s.EXPECT().
-		QueryRowContext(gomock.Any(), SelectFromCounter, mockCounterMetric.ID).
+		QueryRowContext(gomock.Any(), SelectFromCounter, mockCounterMetric.ID, "{}").
 		MaxTimes(1)
 	c = Cursor{
 		DB: s,
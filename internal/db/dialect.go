@@ -0,0 +1,234 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3" // required import for sqlite3
+)
+
+// Адаптеры database/sql, с которыми работает курсор.
+const (
+	PostgresAdaptor = "pgx"
+	SQLiteAdaptor   = "sqlite3"
+)
+
+// Таблица метрик одного типа и запрос на её создание. У таблиц агрегатов и описаний тип не задан.
+type Table struct {
+	Name   string
+	Create string
+	MType  string
+}
+
+// Таблица агрегатов истории Table с разрешением Step: запросы записи и чтения агрегатов.
+type Rollup struct {
+	Table  string
+	Step   time.Duration
+	Insert string
+	Select string
+}
+
+// Диалект SQL: запросы, которыми курсор работает с конкретной СУБД.
+type Dialect struct {
+	Tables []Table
+	// Запрос, завершающийся ошибкой, если существующие таблицы требуют миграций, которые InitDB
+	// не выполняет; пустой, если проверка не нужна.
+	SchemaCheck string
+	// Запросы, дополняющие таблицы, созданные прошлыми версиями сервера. Должны быть быстрыми:
+	// перестройка данных выполняется только миграциями.
+	Upgrades []string
+	// Запросы вставки и чтения последнего значения по типу метрики.
+	Insert map[string]string
+	Select map[string]string
+	// Запросы истории для типов с числовыми значениями.
+	History map[string]string
+	// Таблицы агрегатов истории от мелкого разрешения к крупному.
+	Rollups []Rollup
+	// Запросы времени самого старого несвёрнутого значения, выборки и удаления сырых значений
+	// старше момента свёртки.
+	RollupOldest map[string]string
+	RollupSource map[string]string
+	RollupDelete map[string]string
+	// Многострочная вставка: начало запроса по типу метрики, шаблон строки значений
+	// с номерами пяти параметров и окончание запроса.
+	BatchInsert map[string]string
+	BatchValues string
+	BatchSuffix string
+	// Шаблоны запросов очистки: имена серий таблицы и удаление ограниченной пачки строк серии,
+	// отдельно для таблиц метрик и таблиц агрегатов. Последняя строка серии метрик удаляется,
+	// только если она старше момента удаления устаревших серий.
+	SeriesIDs       string
+	Prune           string
+	RollupSeriesIDs string
+	RollupPrune     string
+	// Шаблон запроса последнего значения каждой серии таблицы, обновлявшейся не раньше заданного момента.
+	Latest string
+	// Запросы записи и чтения описаний метрик.
+	UpsertMetadata string
+	SelectMetadata string
+	// Каталог встроенных миграций и запросы учёта применённых миграций.
+	MigrationsDir string
+	Migrations    MigrationQueries
+}
+
+var PostgresDialect = &Dialect{
+	Tables: []Table{
+		{Name: "gaugemetrics", Create: CreateGaugeTable, MType: GAUGE},
+		{Name: "countermetrics", Create: CreateCounterTable, MType: COUNTER},
+		{Name: "histogrammetrics", Create: CreateHistogramTable, MType: HISTOGRAM},
+		{Name: "summarymetrics", Create: CreateSummaryTable, MType: SUMMARY},
+		{Name: "setmetrics", Create: CreateSetTable, MType: SET},
+		{Name: "rollup1m", Create: CreateRollupMinuteTable},
+		{Name: "rollup1h", Create: CreateRollupHourTable},
+		{Name: "metricmetadata", Create: CreateMetadataTable},
+	},
+	SchemaCheck: CheckSchema,
+	Upgrades: append(
+		[]string{AddGaugeLabels, AddCounterLabels, AddHistogramLabels},
+		uniqueSamples("gaugemetrics", "countermetrics", "histogrammetrics", "summarymetrics", "setmetrics")...,
+	),
+	Insert: map[string]string{
+		GAUGE:     InsertIntoGauge,
+		COUNTER:   InsertIntoCounter,
+		HISTOGRAM: InsertIntoHistogram,
+		SUMMARY:   InsertIntoSummary,
+		SET:       InsertIntoSet,
+	},
+	Select: map[string]string{
+		GAUGE:     SelectFromGauge,
+		COUNTER:   SelectFromCounter,
+		HISTOGRAM: SelectFromHistogram,
+		SUMMARY:   SelectFromSummary,
+		SET:       SelectFromSet,
+	},
+	History: map[string]string{
+		GAUGE:   SelectGaugeHistory,
+		COUNTER: SelectCounterHistory,
+	},
+	Rollups: []Rollup{
+		{Table: "rollup1m", Step: time.Minute, Insert: InsertIntoRollupMinute, Select: SelectRollupMinute},
+		{Table: "rollup1h", Step: time.Hour, Insert: InsertIntoRollupHour, Select: SelectRollupHour},
+	},
+	RollupOldest: map[string]string{
+		GAUGE:   SelectOldestGaugeBefore,
+		COUNTER: SelectOldestCounterBefore,
+	},
+	RollupSource: map[string]string{
+		GAUGE:   SelectGaugeBefore,
+		COUNTER: SelectCounterBefore,
+	},
+	RollupDelete: map[string]string{
+		GAUGE:   DeleteGaugeBefore,
+		COUNTER: DeleteCounterBefore,
+	},
+	BatchInsert: map[string]string{
+		GAUGE:     BatchInsertIntoGauge,
+		COUNTER:   BatchInsertIntoCounter,
+		HISTOGRAM: BatchInsertIntoHistogram,
+		SUMMARY:   BatchInsertIntoSummary,
+		SET:       BatchInsertIntoSet,
+	},
+	BatchValues:     BatchValues,
+	BatchSuffix:     BatchUpsert,
+	SeriesIDs:       SelectSeriesIDs,
+	Prune:           PruneSeries,
+	RollupSeriesIDs: SelectRollupSeries,
+	RollupPrune:     PruneRollupSeries,
+	Latest:          SelectLatest,
+	UpsertMetadata:  UpsertMetadata,
+	SelectMetadata:  SelectMetadata,
+	MigrationsDir:   "migrations/postgres",
+	Migrations: MigrationQueries{
+		Create:  CreateSchemaMigrations,
+		Applied: SelectSchemaMigrations,
+		Insert:  InsertSchemaMigration,
+		Delete:  DeleteSchemaMigration,
+	},
+}
+
+var SQLiteDialect = &Dialect{
+	Tables: []Table{
+		{Name: "gaugemetrics", Create: CreateSQLiteGaugeTable, MType: GAUGE},
+		{Name: "countermetrics", Create: CreateSQLiteCounterTable, MType: COUNTER},
+		{Name: "histogrammetrics", Create: CreateSQLiteHistogramTable, MType: HISTOGRAM},
+		{Name: "summarymetrics", Create: CreateSQLiteSummaryTable, MType: SUMMARY},
+		{Name: "setmetrics", Create: CreateSQLiteSetTable, MType: SET},
+		{Name: "rollup1m", Create: CreateSQLiteRollupMinuteTable},
+		{Name: "rollup1h", Create: CreateSQLiteRollupHourTable},
+		{Name: "metricmetadata", Create: CreateMetadataTable},
+	},
+	Insert: map[string]string{
+		GAUGE:     InsertIntoSQLiteGauge,
+		COUNTER:   InsertIntoSQLiteCounter,
+		HISTOGRAM: InsertIntoSQLiteHistogram,
+		SUMMARY:   InsertIntoSQLiteSummary,
+		SET:       InsertIntoSQLiteSet,
+	},
+	Select: map[string]string{
+		GAUGE:     SelectFromSQLiteGauge,
+		COUNTER:   SelectFromSQLiteCounter,
+		HISTOGRAM: SelectFromSQLiteHistogram,
+		SUMMARY:   SelectFromSQLiteSummary,
+		SET:       SelectFromSQLiteSet,
+	},
+	History: map[string]string{
+		GAUGE:   SelectSQLiteGaugeHistory,
+		COUNTER: SelectSQLiteCounterHistory,
+	},
+	Rollups: []Rollup{
+		{Table: "rollup1m", Step: time.Minute, Insert: InsertIntoSQLiteRollupMinute, Select: SelectSQLiteRollupMinute},
+		{Table: "rollup1h", Step: time.Hour, Insert: InsertIntoSQLiteRollupHour, Select: SelectSQLiteRollupHour},
+	},
+	RollupOldest: map[string]string{
+		GAUGE:   SelectOldestSQLiteGaugeBefore,
+		COUNTER: SelectOldestSQLiteCounterBefore,
+	},
+	RollupSource: map[string]string{
+		GAUGE:   SelectSQLiteGaugeBefore,
+		COUNTER: SelectSQLiteCounterBefore,
+	},
+	RollupDelete: map[string]string{
+		GAUGE:   DeleteSQLiteGaugeBefore,
+		COUNTER: DeleteSQLiteCounterBefore,
+	},
+	BatchInsert: map[string]string{
+		GAUGE:     BatchInsertIntoSQLiteGauge,
+		COUNTER:   BatchInsertIntoSQLiteCounter,
+		HISTOGRAM: BatchInsertIntoSQLiteHistogram,
+		SUMMARY:   BatchInsertIntoSQLiteSummary,
+		SET:       BatchInsertIntoSQLiteSet,
+	},
+	BatchValues:     BatchSQLiteValues,
+	BatchSuffix:     BatchSQLiteUpsert,
+	SeriesIDs:       SelectSeriesIDs,
+	Prune:           PruneSQLiteSeries,
+	RollupSeriesIDs: SelectRollupSeries,
+	RollupPrune:     PruneSQLiteRollupSeries,
+	Latest:          SelectSQLiteLatest,
+	UpsertMetadata:  UpsertSQLiteMetadata,
+	SelectMetadata:  SelectMetadata,
+	MigrationsDir:   "migrations/sqlite",
+	Migrations: MigrationQueries{
+		Create:  CreateSchemaMigrations,
+		Applied: SelectSchemaMigrations,
+		Insert:  InsertSQLiteSchemaMigration,
+		Delete:  DeleteSQLiteSchemaMigration,
+	},
+}
+
+// Функция, возвращающая запросы, создающие уникальный ключ наблюдения в таблицах tables.
+func uniqueSamples(tables ...string) []string {
+	queries := make([]string, 0, len(tables))
+	for _, table := range tables {
+		queries = append(queries, fmt.Sprintf(AddUniqueSamples, table))
+	}
+	return queries
+}
+
+// Функция, возвращающая диалект для адаптера database/sql.
+func DialectFor(adaptor string) *Dialect {
+	if adaptor == SQLiteAdaptor {
+		return SQLiteDialect
+	}
+	return PostgresDialect
+}
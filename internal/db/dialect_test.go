@@ -0,0 +1,111 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+func openSQLite(t *testing.T) *Cursor {
+	ctx := context.Background()
+	cursor, err := NewCursor(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), SQLiteAdaptor)
+	require.NoError(t, err)
+	require.True(t, cursor.IsValid)
+	require.NoError(t, cursor.InitDB(ctx))
+	t.Cleanup(func() { require.NoError(t, cursor.CloseConnection(ctx)) })
+	return cursor
+}
+
+func TestDialectFor(t *testing.T) {
+	assert.Equal(t, SQLiteDialect, DialectFor(SQLiteAdaptor))
+	assert.Equal(t, PostgresDialect, DialectFor(PostgresAdaptor))
+}
+
+func TestSQLiteAddGet(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	require.NoError(t, cursor.InitDB(ctx))
+
+	first := time.Now().Add(-time.Minute).UnixMilli()
+	second := time.Now().UnixMilli()
+	older, newer := 10.0, 20.0
+	other := 99.0
+	for _, metric := range []*m.JSONMetrics{
+		{ID: "Load", MType: GAUGE, Value: &older, Labels: map[string]string{"host": "a", "dc": "x"}, Timestamp: &first},
+		{ID: "Load", MType: GAUGE, Value: &newer, Labels: map[string]string{"host": "a", "dc": "x"}, Timestamp: &second},
+		{ID: "Load", MType: GAUGE, Value: &other, Labels: map[string]string{"host": "b"}, Timestamp: &first},
+	} {
+		require.NoError(t, cursor.Add(ctx, metric))
+	}
+
+	found, err := cursor.Get(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, 20.0, *found.Value)
+	assert.Equal(t, map[string]string{"host": "a", "dc": "x"}, found.Labels)
+
+	found, err = cursor.Get(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Labels: map[string]string{"host": "b"}})
+	require.NoError(t, err)
+	assert.Equal(t, 99.0, *found.Value)
+
+	_, err = cursor.Get(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Labels: map[string]string{"host": "c"}})
+	assert.Error(t, err)
+}
+
+func TestSQLiteUpsert(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	sampleTime := time.Now().UnixMilli()
+	delta := int64(5)
+	replayed := int64(7)
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Requests", MType: COUNTER, Delta: &delta, Timestamp: &sampleTime}))
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Requests", MType: COUNTER, Delta: &replayed, Timestamp: &sampleTime}))
+
+	var rows int
+	require.NoError(t, cursor.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM counterMetrics").Scan(&rows))
+	assert.Equal(t, 1, rows)
+	found, err := cursor.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: COUNTER})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *found.Delta)
+
+	histogram := m.NewHistogram([]float64{1, 5})
+	histogram.Observe(3)
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Latency", MType: HISTOGRAM, Histogram: histogram}))
+	found, err = cursor.Get(ctx, &m.JSONMetrics{ID: "Latency", MType: HISTOGRAM})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), found.Histogram.Count)
+}
+
+func TestSQLiteHistory(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	now := time.Now()
+	labels := map[string]string{"host": "a"}
+	for i, value := range []float64{1, 2, 3} {
+		value := value
+		sampleTime := now.Add(time.Duration(i-3) * time.Minute).UnixMilli()
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{
+			ID: "Load", MType: GAUGE, Value: &value, Labels: labels, Timestamp: &sampleTime}))
+	}
+	other := 99.0
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{
+		ID: "Load", MType: GAUGE, Value: &other, Labels: map[string]string{"host": "b"}}))
+
+	samples, err := cursor.History(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Labels: labels},
+		now.Add(-150*time.Second), now)
+	require.NoError(t, err)
+	require.Len(t, samples, 2)
+	assert.Equal(t, 2.0, samples[0].Value)
+	assert.Equal(t, 3.0, samples[1].Value)
+	assert.True(t, samples[0].Time.Before(samples[1].Time))
+
+	_, err = cursor.History(ctx, &m.JSONMetrics{ID: "Latency", MType: HISTOGRAM}, now.Add(-time.Hour), now)
+	assert.Error(t, err)
+}
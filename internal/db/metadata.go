@@ -0,0 +1,43 @@
+package db
+
+import (
+	"context"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Метод, сохраняющий описание метрики. Повторное объявление заменяет сохранённое описание целиком,
+// поэтому передаётся итоговое описание из реестра.
+func (c *Cursor) SaveMetadata(parent context.Context, meta *metrics.Metadata) error {
+	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
+	defer cancel()
+
+	_, err := c.DB.ExecContext(ctx, c.dialect().UpsertMetadata, meta.Name, meta.MType, meta.Unit, meta.Help, meta.Owner)
+	return err
+}
+
+// Метод, читающий все сохранённые описания метрик по именам.
+func (c *Cursor) Metadata(parent context.Context) (map[string]*metrics.Metadata, error) {
+	ctx, cancel := context.WithTimeout(parent, LatestTimeout)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, c.dialect().SelectMetadata)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing metadata rows: %e", err)
+		}
+	}()
+	result := make(map[string]*metrics.Metadata)
+	for rows.Next() {
+		meta := &metrics.Metadata{}
+		if err = rows.Scan(&meta.Name, &meta.MType, &meta.Unit, &meta.Help, &meta.Owner); err != nil {
+			return nil, err
+		}
+		result[meta.Name] = meta
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,231 @@
+package db
+
+import (
+	"context"
+	"embed"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Миграции схемы встроены в бинарный файл: каталог на диалект, файлы вида 0001_name.up.sql и 0001_name.down.sql.
+//
+//go:embed migrations
+var migrationsFS embed.FS
+
+// Ограничение времени применения одной миграции.
+var MigrationTimeout = time.Minute
+
+// Миграция схемы: версия, имя и запросы применения и отката.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Состояние миграции в БД.
+type MigrationState struct {
+	Migration
+	Applied bool
+}
+
+// Запросы учёта применённых миграций в таблице schema_migrations.
+type MigrationQueries struct {
+	Create  string
+	Applied string
+	Insert  string
+	Delete  string
+}
+
+// Функция, читающая миграции каталога dir встроенной файловой системы, упорядоченные по версии.
+func LoadMigrations(dir string) ([]Migration, error) {
+	entries, err := migrationsFS.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		name := entry.Name()
+		base, direction, ok := cutMigrationName(name)
+		if !ok {
+			return nil, errors.ErrorMigration
+		}
+		prefix, title, found := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if !found || err != nil || version <= 0 {
+			return nil, errors.ErrorMigration
+		}
+		body, err := migrationsFS.ReadFile(path.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: title}
+			byVersion[version] = migration
+		}
+		if migration.Name != title {
+			return nil, errors.ErrorMigration
+		}
+		if direction == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, errors.ErrorMigration
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// Функция, разбирающая имя файла миграции на основу и направление up или down.
+func cutMigrationName(name string) (string, string, bool) {
+	for _, direction := range []string{"up", "down"} {
+		suffix := "." + direction + ".sql"
+		if strings.HasSuffix(name, suffix) {
+			return strings.TrimSuffix(name, suffix), direction, true
+		}
+	}
+	return "", "", false
+}
+
+// Метод, возвращающий все миграции диалекта с отметкой о применении.
+func (c *Cursor) MigrationStatus(parent context.Context) ([]MigrationState, error) {
+	migrations, err := LoadMigrations(c.dialect().MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	applied, err := c.appliedMigrations(parent)
+	if err != nil {
+		return nil, err
+	}
+	states := make([]MigrationState, 0, len(migrations))
+	for _, migration := range migrations {
+		states = append(states, MigrationState{Migration: migration, Applied: applied[migration.Version]})
+	}
+	return states, nil
+}
+
+func (c *Cursor) appliedMigrations(parent context.Context) (map[int]bool, error) {
+	ctx, cancel := context.WithTimeout(parent, MigrationTimeout)
+	defer cancel()
+
+	queries := c.dialect().Migrations
+	if _, err := c.DB.ExecContext(ctx, queries.Create); err != nil {
+		log.ErrorLog.Printf("could not create schema_migrations: %e", err)
+		return nil, err
+	}
+	rows, err := c.DB.QueryContext(ctx, queries.Applied)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing schema_migrations rows: %e", err)
+		}
+	}()
+	applied := make(map[int]bool)
+	for rows.Next() {
+		var version int
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// Метод, применяющий все неприменённые миграции по возрастанию версии.
+// Каждая миграция выполняется в своей транзакции вместе с записью в schema_migrations.
+func (c *Cursor) Migrate(parent context.Context) ([]int, error) {
+	states, err := c.MigrationStatus(parent)
+	if err != nil {
+		return nil, err
+	}
+	done := make([]int, 0)
+	for _, state := range states {
+		if state.Applied {
+			continue
+		}
+		if err = c.runMigration(parent, state.Up, c.dialect().Migrations.Insert, state.Version, state.Name); err != nil {
+			log.ErrorLog.Printf("could not apply migration %d_%s: %e", state.Version, state.Name, err)
+			return done, err
+		}
+		log.InfoLog.Printf("migration %d_%s applied", state.Version, state.Name)
+		done = append(done, state.Version)
+	}
+	return done, nil
+}
+
+// Метод, откатывающий steps последних применённых миграций по убыванию версии.
+func (c *Cursor) MigrateDown(parent context.Context, steps int) ([]int, error) {
+	states, err := c.MigrationStatus(parent)
+	if err != nil {
+		return nil, err
+	}
+	done := make([]int, 0, steps)
+	for i := len(states) - 1; i >= 0 && len(done) < steps; i-- {
+		state := states[i]
+		if !state.Applied {
+			continue
+		}
+		if err = c.runMigration(parent, state.Down, c.dialect().Migrations.Delete, state.Version); err != nil {
+			log.ErrorLog.Printf("could not roll back migration %d_%s: %e", state.Version, state.Name, err)
+			return done, err
+		}
+		log.InfoLog.Printf("migration %d_%s rolled back", state.Version, state.Name)
+		done = append(done, state.Version)
+	}
+	return done, nil
+}
+
+// Метод, выполняющий запросы миграции и изменение schema_migrations в одной транзакции.
+func (c *Cursor) runMigration(parent context.Context, script, record string, args ...any) error {
+	ctx, cancel := context.WithTimeout(parent, MigrationTimeout)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if !emptySQL(script) {
+		if _, err = tx.ExecContext(ctx, script); err != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				log.ErrorLog.Printf("could not rollback migration transaction: %e", rollbackErr)
+			}
+			return err
+		}
+	}
+	if _, err = tx.ExecContext(ctx, record, args...); err != nil {
+		if rollbackErr := tx.Rollback(); rollbackErr != nil {
+			log.ErrorLog.Printf("could not rollback migration transaction: %e", rollbackErr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+// Функция, проверяющая, что в запросах миграции нет ничего, кроме комментариев.
+func emptySQL(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return true
+}
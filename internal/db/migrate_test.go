@@ -0,0 +1,75 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	for _, dialect := range []*Dialect{PostgresDialect, SQLiteDialect} {
+		migrations, err := LoadMigrations(dialect.MigrationsDir)
+		require.NoError(t, err)
+		require.NotEmpty(t, migrations)
+		for i, migration := range migrations {
+			assert.Equal(t, i+1, migration.Version)
+			assert.NotEmpty(t, migration.Up)
+			assert.NotEmpty(t, migration.Down)
+		}
+	}
+	_, err := LoadMigrations("migrations/unknown")
+	assert.Error(t, err)
+	assert.True(t, emptySQL("-- no changes\n\n"))
+	assert.False(t, emptySQL("-- comment\nDROP TABLE x;"))
+}
+
+func TestSQLiteMigrate(t *testing.T) {
+	ctx := context.Background()
+	cursor, err := NewCursor(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), SQLiteAdaptor)
+	require.NoError(t, err)
+	defer cursor.CloseConnection(ctx)
+	migrations, err := LoadMigrations(SQLiteDialect.MigrationsDir)
+	require.NoError(t, err)
+
+	applied, err := cursor.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	applied, err = cursor.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, applied)
+	value := 1.5
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value}))
+
+	rolledBack, err := cursor.MigrateDown(ctx, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []int{len(migrations), len(migrations) - 1}, rolledBack)
+	states, err := cursor.MigrationStatus(ctx)
+	require.NoError(t, err)
+	for _, state := range states {
+		assert.Equal(t, state.Version <= len(migrations)-2, state.Applied, state.Name)
+	}
+	// Откат не затрагивает данные более ранних миграций.
+	assert.Equal(t, 1, countRows(t, cursor, "gaugeMetrics"))
+
+	_, err = cursor.MigrateDown(ctx, len(migrations))
+	require.NoError(t, err)
+	assert.Error(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value}))
+}
+
+func TestSQLiteMigrateOverInitDB(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	value := 2.5
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value}))
+
+	_, err := cursor.Migrate(ctx)
+	require.NoError(t, err)
+	found, err := cursor.Get(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *found.Value)
+}
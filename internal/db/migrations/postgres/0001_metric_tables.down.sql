@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS setMetrics;
+DROP TABLE IF EXISTS summaryMetrics;
+DROP TABLE IF EXISTS histogramMetrics;
+DROP TABLE IF EXISTS counterMetrics;
+DROP TABLE IF EXISTS gaugeMetrics;
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS gaugeMetrics (
+	_id TEXT,
+	mtype TEXT,
+	_value DOUBLE PRECISION,
+	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	labels TEXT DEFAULT '{}'
+);
+CREATE TABLE IF NOT EXISTS counterMetrics (
+	_id TEXT,
+	mtype TEXT,
+	_value INTEGER,
+	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	labels TEXT DEFAULT '{}'
+);
+CREATE TABLE IF NOT EXISTS histogramMetrics (
+	_id TEXT,
+	mtype TEXT,
+	_value TEXT,
+	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	labels TEXT DEFAULT '{}'
+);
+CREATE TABLE IF NOT EXISTS summaryMetrics (
+	_id TEXT,
+	mtype TEXT,
+	_value TEXT,
+	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	labels TEXT DEFAULT '{}'
+);
+CREATE TABLE IF NOT EXISTS setMetrics (
+	_id TEXT,
+	mtype TEXT,
+	_value TEXT,
+	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	labels TEXT DEFAULT '{}'
+);
@@ -0,0 +1 @@
+-- Метки входят в таблицы с первой версии схемы, поэтому столбец не удаляется.
@@ -0,0 +1,4 @@
+-- Для таблиц, созданных до появления меток.
+ALTER TABLE gaugeMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';
+ALTER TABLE counterMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';
+ALTER TABLE histogramMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';
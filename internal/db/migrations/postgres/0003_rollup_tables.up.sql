@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS rollup1m (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	bucket TIMESTAMP NOT NULL,
+	_min DOUBLE PRECISION,
+	_max DOUBLE PRECISION,
+	_avg DOUBLE PRECISION,
+	_count BIGINT,
+	_last DOUBLE PRECISION,
+	UNIQUE (_id, mtype, labels, bucket)
+);
+CREATE TABLE IF NOT EXISTS rollup1h (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	bucket TIMESTAMP NOT NULL,
+	_min DOUBLE PRECISION,
+	_max DOUBLE PRECISION,
+	_avg DOUBLE PRECISION,
+	_count BIGINT,
+	_last DOUBLE PRECISION,
+	UNIQUE (_id, mtype, labels, bucket)
+);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS countermetrics_date_idx;
+DROP INDEX IF EXISTS gaugemetrics_date_idx;
+DROP INDEX IF EXISTS countermetrics_series_idx;
+DROP INDEX IF EXISTS gaugemetrics_series_idx;
@@ -0,0 +1,5 @@
+-- Индексы для чтения последнего значения и истории серии, свёртки и очистки.
+CREATE INDEX IF NOT EXISTS gaugemetrics_series_idx ON gaugeMetrics (_id, labels, date);
+CREATE INDEX IF NOT EXISTS countermetrics_series_idx ON counterMetrics (_id, labels, date);
+CREATE INDEX IF NOT EXISTS gaugemetrics_date_idx ON gaugeMetrics (date);
+CREATE INDEX IF NOT EXISTS countermetrics_date_idx ON counterMetrics (date);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS setmetrics_sample_idx;
+DROP INDEX IF EXISTS summarymetrics_sample_idx;
+DROP INDEX IF EXISTS histogrammetrics_sample_idx;
+DROP INDEX IF EXISTS countermetrics_sample_idx;
+DROP INDEX IF EXISTS gaugemetrics_sample_idx;
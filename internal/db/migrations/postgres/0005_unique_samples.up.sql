@@ -0,0 +1,17 @@
+-- Уникальный ключ наблюдения: повторная запись пачки после сбоя обновляет строки, а не дублирует их.
+-- Дубликаты, записанные прежними версиями, удаляются заранее.
+DELETE FROM gaugeMetrics a USING gaugeMetrics b
+	WHERE a.ctid < b.ctid AND a._id = b._id AND a.labels = b.labels AND a.date = b.date;
+DELETE FROM counterMetrics a USING counterMetrics b
+	WHERE a.ctid < b.ctid AND a._id = b._id AND a.labels = b.labels AND a.date = b.date;
+DELETE FROM histogramMetrics a USING histogramMetrics b
+	WHERE a.ctid < b.ctid AND a._id = b._id AND a.labels = b.labels AND a.date = b.date;
+DELETE FROM summaryMetrics a USING summaryMetrics b
+	WHERE a.ctid < b.ctid AND a._id = b._id AND a.labels = b.labels AND a.date = b.date;
+DELETE FROM setMetrics a USING setMetrics b
+	WHERE a.ctid < b.ctid AND a._id = b._id AND a.labels = b.labels AND a.date = b.date;
+CREATE UNIQUE INDEX IF NOT EXISTS gaugemetrics_sample_idx ON gaugeMetrics (_id, labels, date);
+CREATE UNIQUE INDEX IF NOT EXISTS countermetrics_sample_idx ON counterMetrics (_id, labels, date);
+CREATE UNIQUE INDEX IF NOT EXISTS histogrammetrics_sample_idx ON histogramMetrics (_id, labels, date);
+CREATE UNIQUE INDEX IF NOT EXISTS summarymetrics_sample_idx ON summaryMetrics (_id, labels, date);
+CREATE UNIQUE INDEX IF NOT EXISTS setmetrics_sample_idx ON setMetrics (_id, labels, date);
@@ -0,0 +1,2 @@
+-- Откат не удастся, если сохранены итоги, не помещающиеся в INTEGER.
+ALTER TABLE counterMetrics ALTER COLUMN _value TYPE INTEGER;
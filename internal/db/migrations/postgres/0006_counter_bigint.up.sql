@@ -0,0 +1,2 @@
+-- Итог counter — int64: столбец INTEGER переполнялся после 2^31.
+ALTER TABLE counterMetrics ALTER COLUMN _value TYPE BIGINT;
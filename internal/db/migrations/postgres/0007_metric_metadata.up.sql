@@ -0,0 +1,8 @@
+-- Описания метрик из реестра сохраняются, чтобы переживать перезапуск сервера.
+CREATE TABLE IF NOT EXISTS metricmetadata (
+	_id TEXT PRIMARY KEY,
+	mtype TEXT NOT NULL,
+	unit TEXT NOT NULL DEFAULT '',
+	help TEXT NOT NULL DEFAULT '',
+	owner TEXT NOT NULL DEFAULT ''
+);
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS gaugeMetrics (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	_value REAL,
+	date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	labels TEXT NOT NULL DEFAULT '{}',
+	UNIQUE (_id, labels, date)
+);
+CREATE TABLE IF NOT EXISTS counterMetrics (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	_value INTEGER,
+	date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	labels TEXT NOT NULL DEFAULT '{}',
+	UNIQUE (_id, labels, date)
+);
+CREATE TABLE IF NOT EXISTS histogramMetrics (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	_value TEXT,
+	date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	labels TEXT NOT NULL DEFAULT '{}',
+	UNIQUE (_id, labels, date)
+);
+CREATE TABLE IF NOT EXISTS summaryMetrics (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	_value TEXT,
+	date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	labels TEXT NOT NULL DEFAULT '{}',
+	UNIQUE (_id, labels, date)
+);
+CREATE TABLE IF NOT EXISTS setMetrics (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	_value TEXT,
+	date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+	labels TEXT NOT NULL DEFAULT '{}',
+	UNIQUE (_id, labels, date)
+);
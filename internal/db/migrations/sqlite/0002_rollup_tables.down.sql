@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS rollup1h;
+DROP TABLE IF EXISTS rollup1m;
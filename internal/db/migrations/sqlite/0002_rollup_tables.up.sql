@@ -0,0 +1,24 @@
+CREATE TABLE IF NOT EXISTS rollup1m (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	bucket TIMESTAMP NOT NULL,
+	_min REAL,
+	_max REAL,
+	_avg REAL,
+	_count INTEGER,
+	_last REAL,
+	UNIQUE (_id, mtype, labels, bucket)
+);
+CREATE TABLE IF NOT EXISTS rollup1h (
+	_id TEXT NOT NULL,
+	mtype TEXT NOT NULL,
+	labels TEXT NOT NULL DEFAULT '{}',
+	bucket TIMESTAMP NOT NULL,
+	_min REAL,
+	_max REAL,
+	_avg REAL,
+	_count INTEGER,
+	_last REAL,
+	UNIQUE (_id, mtype, labels, bucket)
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS countermetrics_date_idx;
+DROP INDEX IF EXISTS gaugemetrics_date_idx;
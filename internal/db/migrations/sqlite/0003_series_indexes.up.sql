@@ -0,0 +1,3 @@
+-- Серии уже проиндексированы ограничениями уникальности, для свёртки и очистки нужен индекс по времени.
+CREATE INDEX IF NOT EXISTS gaugemetrics_date_idx ON gaugeMetrics (date);
+CREATE INDEX IF NOT EXISTS countermetrics_date_idx ON counterMetrics (date);
@@ -6,16 +6,398 @@ const (
 		_id TEXT,
 		mtype TEXT,
 		_value DOUBLE PRECISION,
-	  	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	  	date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		labels TEXT DEFAULT '{}'
 	);`
 	CreateCounterTable string = `CREATE TABLE IF NOT EXISTS counterMetrics (
 		_id TEXT,
 		mtype TEXT,
+		_value BIGINT,
+		date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		labels TEXT DEFAULT '{}'
+	);`
+	CreateHistogramTable string = `CREATE TABLE IF NOT EXISTS histogramMetrics (
+		_id TEXT,
+		mtype TEXT,
+		_value TEXT,
+		date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		labels TEXT DEFAULT '{}'
+	);`
+	CreateSummaryTable string = `CREATE TABLE IF NOT EXISTS summaryMetrics (
+		_id TEXT,
+		mtype TEXT,
+		_value TEXT,
+		date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		labels TEXT DEFAULT '{}'
+	);`
+	CreateSetTable string = `CREATE TABLE IF NOT EXISTS setMetrics (
+		_id TEXT,
+		mtype TEXT,
+		_value TEXT,
+		date TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		labels TEXT DEFAULT '{}'
+	);`
+	// Для таблиц, созданных до появления меток.
+	AddGaugeLabels     = `ALTER TABLE gaugeMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';`
+	AddCounterLabels   = `ALTER TABLE counterMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';`
+	AddHistogramLabels = `ALTER TABLE histogramMetrics ADD COLUMN IF NOT EXISTS labels TEXT DEFAULT '{}';`
+	// Шаблон запроса, создающего уникальный ключ наблюдения: повторная запись наблюдения после сбоя
+	// обновляет строку, а не дублирует её. Выполняется только для новых или уже мигрированных таблиц,
+	// поэтому индекс либо строится по пустой таблице, либо уже существует.
+	AddUniqueSamples = `CREATE UNIQUE INDEX IF NOT EXISTS %[1]s_sample_idx ON %[1]s (_id, labels, date);`
+	// Проверка, что существующие таблицы не старше схемы, которую создаёт InitDB: уникальный ключ
+	// наблюдения и удаление дубликатов прежних версий добавляет только миграция 0005, а столбец
+	// BIGINT для итогов counter — миграция 0006.
+	CheckSchema = `DO $$ BEGIN
+		IF EXISTS (SELECT 1 FROM information_schema.tables
+			WHERE table_schema = current_schema()
+				AND table_name IN ('gaugemetrics', 'countermetrics', 'histogrammetrics', 'summarymetrics', 'setmetrics')
+				AND to_regclass(table_name::text || '_sample_idx') IS NULL)
+			OR EXISTS (SELECT 1 FROM information_schema.columns
+				WHERE table_schema = current_schema() AND table_name = 'countermetrics'
+					AND column_name = '_value' AND data_type = 'integer') THEN
+			RAISE EXCEPTION 'database schema is older than the server, run "server migrate"';
+		END IF;
+	END $$;`
+	// Время наблюдения, переданное клиентом, записывается в date; иначе используется время записи.
+	// Повторная запись того же наблюдения обновляет строку, а не дублирует её.
+	InsertIntoGauge = `INSERT INTO gaugemetrics (_id, mtype, _value, labels, date)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoCounter = `INSERT INTO countermetrics (_id, mtype, _value, labels, date)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoHistogram = `INSERT INTO histogrammetrics (_id, mtype, _value, labels, date)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSummary = `INSERT INTO summarymetrics (_id, mtype, _value, labels, date)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSet = `INSERT INTO setmetrics (_id, mtype, _value, labels, date)
+		VALUES ($1, $2, $3, $4, COALESCE($5::timestamp, CURRENT_TIMESTAMP))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	// Метки запроса являются условиями отбора: серия подходит, если содержит все указанные метки.
+	// Из подходящих серий выбирается так же, как в памяти: точное совпадение, иначе серия с самым
+	// коротким представлением меток, затем первая по байтам.
+	SelectFromGauge = `SELECT _id, mtype, _value, labels FROM gaugemetrics
+		WHERE _id=$1 AND labels::jsonb @> $2::jsonb
+		ORDER BY octet_length(labels), labels COLLATE "C", date DESC LIMIT 1`
+	SelectFromCounter string = `SELECT _id, mtype, _value, labels FROM countermetrics
+		WHERE _id=$1 AND labels::jsonb @> $2::jsonb
+		ORDER BY octet_length(labels), labels COLLATE "C", date DESC LIMIT 1`
+	SelectFromHistogram string = `SELECT _id, mtype, _value, labels FROM histogrammetrics
+		WHERE _id=$1 AND labels::jsonb @> $2::jsonb
+		ORDER BY octet_length(labels), labels COLLATE "C", date DESC LIMIT 1`
+	SelectFromSummary string = `SELECT _id, mtype, _value, labels FROM summarymetrics
+		WHERE _id=$1 AND labels::jsonb @> $2::jsonb
+		ORDER BY octet_length(labels), labels COLLATE "C", date DESC LIMIT 1`
+	SelectFromSet string = `SELECT _id, mtype, _value, labels FROM setmetrics
+		WHERE _id=$1 AND labels::jsonb @> $2::jsonb
+		ORDER BY octet_length(labels), labels COLLATE "C", date DESC LIMIT 1`
+)
+
+// Запросы SQLite. Время хранится текстом в UTC, поэтому строки упорядочиваются так же, как моменты времени.
+// Повторная запись того же наблюдения обновляет строку, а не дублирует её.
+const (
+	CreateSQLiteGaugeTable string = `CREATE TABLE IF NOT EXISTS gaugeMetrics (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		_value REAL,
+		date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+		labels TEXT NOT NULL DEFAULT '{}',
+		UNIQUE (_id, labels, date)
+	);`
+	CreateSQLiteCounterTable string = `CREATE TABLE IF NOT EXISTS counterMetrics (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
 		_value INTEGER,
-		date TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+		labels TEXT NOT NULL DEFAULT '{}',
+		UNIQUE (_id, labels, date)
+	);`
+	CreateSQLiteHistogramTable string = `CREATE TABLE IF NOT EXISTS histogramMetrics (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		_value TEXT,
+		date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+		labels TEXT NOT NULL DEFAULT '{}',
+		UNIQUE (_id, labels, date)
+	);`
+	CreateSQLiteSummaryTable string = `CREATE TABLE IF NOT EXISTS summaryMetrics (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		_value TEXT,
+		date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+		labels TEXT NOT NULL DEFAULT '{}',
+		UNIQUE (_id, labels, date)
+	);`
+	CreateSQLiteSetTable string = `CREATE TABLE IF NOT EXISTS setMetrics (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		_value TEXT,
+		date TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+		labels TEXT NOT NULL DEFAULT '{}',
+		UNIQUE (_id, labels, date)
+	);`
+	InsertIntoSQLiteGauge = `INSERT INTO gaugeMetrics (_id, mtype, _value, labels, date)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(?5, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSQLiteCounter = `INSERT INTO counterMetrics (_id, mtype, _value, labels, date)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(?5, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSQLiteHistogram = `INSERT INTO histogramMetrics (_id, mtype, _value, labels, date)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(?5, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSQLiteSummary = `INSERT INTO summaryMetrics (_id, mtype, _value, labels, date)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(?5, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	InsertIntoSQLiteSet = `INSERT INTO setMetrics (_id, mtype, _value, labels, date)
+		VALUES (?1, ?2, ?3, ?4, COALESCE(?5, strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')))
+		ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value;`
+	// Серия подходит, если для каждой метки условия её значение совпадает. Из подходящих серий
+	// выбирается так же, как в памяти: с самым коротким представлением меток, затем первая по байтам.
+	SelectFromSQLiteGauge = `SELECT _id, mtype, _value, labels FROM gaugeMetrics AS t
+		WHERE _id = ?1 AND NOT EXISTS (SELECT 1 FROM json_each(?2) AS m
+			WHERE json_extract(t.labels, '$."' || m.key || '"') IS NOT m.value)
+		ORDER BY length(CAST(labels AS BLOB)), labels, date DESC LIMIT 1`
+	SelectFromSQLiteCounter = `SELECT _id, mtype, _value, labels FROM counterMetrics AS t
+		WHERE _id = ?1 AND NOT EXISTS (SELECT 1 FROM json_each(?2) AS m
+			WHERE json_extract(t.labels, '$."' || m.key || '"') IS NOT m.value)
+		ORDER BY length(CAST(labels AS BLOB)), labels, date DESC LIMIT 1`
+	SelectFromSQLiteHistogram = `SELECT _id, mtype, _value, labels FROM histogramMetrics AS t
+		WHERE _id = ?1 AND NOT EXISTS (SELECT 1 FROM json_each(?2) AS m
+			WHERE json_extract(t.labels, '$."' || m.key || '"') IS NOT m.value)
+		ORDER BY length(CAST(labels AS BLOB)), labels, date DESC LIMIT 1`
+	SelectFromSQLiteSummary = `SELECT _id, mtype, _value, labels FROM summaryMetrics AS t
+		WHERE _id = ?1 AND NOT EXISTS (SELECT 1 FROM json_each(?2) AS m
+			WHERE json_extract(t.labels, '$."' || m.key || '"') IS NOT m.value)
+		ORDER BY length(CAST(labels AS BLOB)), labels, date DESC LIMIT 1`
+	SelectFromSQLiteSet = `SELECT _id, mtype, _value, labels FROM setMetrics AS t
+		WHERE _id = ?1 AND NOT EXISTS (SELECT 1 FROM json_each(?2) AS m
+			WHERE json_extract(t.labels, '$."' || m.key || '"') IS NOT m.value)
+		ORDER BY length(CAST(labels AS BLOB)), labels, date DESC LIMIT 1`
+)
+
+// Запросы истории серии: значения с точным набором меток за полуинтервал [from, to).
+const (
+	SelectGaugeHistory = `SELECT _value, date FROM gaugemetrics
+		WHERE _id=$1 AND labels=$2 AND date >= $3 AND date < $4 ORDER BY date`
+	SelectCounterHistory = `SELECT _value, date FROM countermetrics
+		WHERE _id=$1 AND labels=$2 AND date >= $3 AND date < $4 ORDER BY date`
+	SelectSQLiteGaugeHistory = `SELECT _value, date FROM gaugeMetrics
+		WHERE _id = ?1 AND labels = ?2 AND date >= ?3 AND date < ?4 ORDER BY date`
+	SelectSQLiteCounterHistory = `SELECT _value, date FROM counterMetrics
+		WHERE _id = ?1 AND labels = ?2 AND date >= ?3 AND date < ?4 ORDER BY date`
+)
+
+// Таблицы агрегатов истории gauge и counter с разрешением в минуту и в час.
+// Агрегат строки bucket описывает значения полуинтервала [bucket, bucket+шаг).
+// Повторная свёртка того же интервала объединяется с уже сохранённым агрегатом.
+const (
+	CreateRollupMinuteTable = `CREATE TABLE IF NOT EXISTS rollup1m (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		labels TEXT NOT NULL DEFAULT '{}',
+		bucket TIMESTAMP NOT NULL,
+		_min DOUBLE PRECISION,
+		_max DOUBLE PRECISION,
+		_avg DOUBLE PRECISION,
+		_count BIGINT,
+		_last DOUBLE PRECISION,
+		UNIQUE (_id, mtype, labels, bucket)
+	);`
+	CreateRollupHourTable = `CREATE TABLE IF NOT EXISTS rollup1h (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		labels TEXT NOT NULL DEFAULT '{}',
+		bucket TIMESTAMP NOT NULL,
+		_min DOUBLE PRECISION,
+		_max DOUBLE PRECISION,
+		_avg DOUBLE PRECISION,
+		_count BIGINT,
+		_last DOUBLE PRECISION,
+		UNIQUE (_id, mtype, labels, bucket)
+	);`
+	InsertIntoRollupMinute = `INSERT INTO rollup1m (_id, mtype, labels, bucket, _min, _max, _avg, _count, _last)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (_id, mtype, labels, bucket) DO UPDATE SET
+			_min = LEAST(rollup1m._min, excluded._min),
+			_max = GREATEST(rollup1m._max, excluded._max),
+			_avg = (rollup1m._avg * rollup1m._count + excluded._avg * excluded._count) /
+				(rollup1m._count + excluded._count),
+			_count = rollup1m._count + excluded._count,
+			_last = excluded._last;`
+	InsertIntoRollupHour = `INSERT INTO rollup1h (_id, mtype, labels, bucket, _min, _max, _avg, _count, _last)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (_id, mtype, labels, bucket) DO UPDATE SET
+			_min = LEAST(rollup1h._min, excluded._min),
+			_max = GREATEST(rollup1h._max, excluded._max),
+			_avg = (rollup1h._avg * rollup1h._count + excluded._avg * excluded._count) /
+				(rollup1h._count + excluded._count),
+			_count = rollup1h._count + excluded._count,
+			_last = excluded._last;`
+	SelectRollupMinute = `SELECT bucket, _min, _max, _avg, _count, _last FROM rollup1m
+		WHERE _id=$1 AND mtype=$2 AND labels=$3 AND bucket >= $4 AND bucket < $5 ORDER BY bucket`
+	SelectRollupHour = `SELECT bucket, _min, _max, _avg, _count, _last FROM rollup1h
+		WHERE _id=$1 AND mtype=$2 AND labels=$3 AND bucket >= $4 AND bucket < $5 ORDER BY bucket`
+	// Сырые значения, подлежащие свёртке, упорядоченные по серии и времени. Последнее значение серии
+	// не сворачивается, чтобы по нему восстанавливалось состояние.
+	SelectOldestGaugeBefore = `SELECT date FROM gaugemetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM gaugemetrics AS n WHERE n._id = gaugemetrics._id AND n.labels = gaugemetrics.labels)
+		ORDER BY date LIMIT 1`
+	SelectOldestCounterBefore = `SELECT date FROM countermetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM countermetrics AS n WHERE n._id = countermetrics._id AND n.labels = countermetrics.labels)
+		ORDER BY date LIMIT 1`
+	SelectGaugeBefore = `SELECT _id, labels, _value, date FROM gaugemetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM gaugemetrics AS n WHERE n._id = gaugemetrics._id AND n.labels = gaugemetrics.labels)
+		ORDER BY _id, labels, date`
+	SelectCounterBefore = `SELECT _id, labels, _value, date FROM countermetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM countermetrics AS n WHERE n._id = countermetrics._id AND n.labels = countermetrics.labels)
+		ORDER BY _id, labels, date`
+	DeleteGaugeBefore = `DELETE FROM gaugemetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM gaugemetrics AS n WHERE n._id = gaugemetrics._id AND n.labels = gaugemetrics.labels)`
+	DeleteCounterBefore = `DELETE FROM countermetrics WHERE date < $1
+		AND date < (SELECT MAX(date) FROM countermetrics AS n WHERE n._id = countermetrics._id AND n.labels = countermetrics.labels)`
+
+	CreateSQLiteRollupMinuteTable = `CREATE TABLE IF NOT EXISTS rollup1m (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		labels TEXT NOT NULL DEFAULT '{}',
+		bucket TIMESTAMP NOT NULL,
+		_min REAL,
+		_max REAL,
+		_avg REAL,
+		_count INTEGER,
+		_last REAL,
+		UNIQUE (_id, mtype, labels, bucket)
+	);`
+	CreateSQLiteRollupHourTable = `CREATE TABLE IF NOT EXISTS rollup1h (
+		_id TEXT NOT NULL,
+		mtype TEXT NOT NULL,
+		labels TEXT NOT NULL DEFAULT '{}',
+		bucket TIMESTAMP NOT NULL,
+		_min REAL,
+		_max REAL,
+		_avg REAL,
+		_count INTEGER,
+		_last REAL,
+		UNIQUE (_id, mtype, labels, bucket)
+	);`
+	InsertIntoSQLiteRollupMinute = `INSERT INTO rollup1m (_id, mtype, labels, bucket, _min, _max, _avg, _count, _last)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		ON CONFLICT (_id, mtype, labels, bucket) DO UPDATE SET
+			_min = MIN(_min, excluded._min),
+			_max = MAX(_max, excluded._max),
+			_avg = (_avg * _count + excluded._avg * excluded._count) / (_count + excluded._count),
+			_count = _count + excluded._count,
+			_last = excluded._last;`
+	InsertIntoSQLiteRollupHour = `INSERT INTO rollup1h (_id, mtype, labels, bucket, _min, _max, _avg, _count, _last)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, ?8, ?9)
+		ON CONFLICT (_id, mtype, labels, bucket) DO UPDATE SET
+			_min = MIN(_min, excluded._min),
+			_max = MAX(_max, excluded._max),
+			_avg = (_avg * _count + excluded._avg * excluded._count) / (_count + excluded._count),
+			_count = _count + excluded._count,
+			_last = excluded._last;`
+	SelectSQLiteRollupMinute = `SELECT bucket, _min, _max, _avg, _count, _last FROM rollup1m
+		WHERE _id = ?1 AND mtype = ?2 AND labels = ?3 AND bucket >= ?4 AND bucket < ?5 ORDER BY bucket`
+	SelectSQLiteRollupHour = `SELECT bucket, _min, _max, _avg, _count, _last FROM rollup1h
+		WHERE _id = ?1 AND mtype = ?2 AND labels = ?3 AND bucket >= ?4 AND bucket < ?5 ORDER BY bucket`
+	SelectOldestSQLiteGaugeBefore = `SELECT date FROM gaugeMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM gaugeMetrics AS n WHERE n._id = gaugeMetrics._id AND n.labels = gaugeMetrics.labels)
+		ORDER BY date LIMIT 1`
+	SelectOldestSQLiteCounterBefore = `SELECT date FROM counterMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM counterMetrics AS n WHERE n._id = counterMetrics._id AND n.labels = counterMetrics.labels)
+		ORDER BY date LIMIT 1`
+	SelectSQLiteGaugeBefore = `SELECT _id, labels, _value, date FROM gaugeMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM gaugeMetrics AS n WHERE n._id = gaugeMetrics._id AND n.labels = gaugeMetrics.labels)
+		ORDER BY _id, labels, date`
+	SelectSQLiteCounterBefore = `SELECT _id, labels, _value, date FROM counterMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM counterMetrics AS n WHERE n._id = counterMetrics._id AND n.labels = counterMetrics.labels)
+		ORDER BY _id, labels, date`
+	DeleteSQLiteGaugeBefore = `DELETE FROM gaugeMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM gaugeMetrics AS n WHERE n._id = gaugeMetrics._id AND n.labels = gaugeMetrics.labels)`
+	DeleteSQLiteCounterBefore = `DELETE FROM counterMetrics WHERE date < ?1
+		AND date < (SELECT MAX(date) FROM counterMetrics AS n WHERE n._id = counterMetrics._id AND n.labels = counterMetrics.labels)`
+)
+
+// Шаблоны запросов очистки, в которые подставляется имя таблицы. Удаление идёт пачками
+// ограниченного размера, чтобы не блокировать таблицу надолго. Последнее значение серии
+// не удаляется, чтобы по нему восстанавливалось состояние, пока оно не старше момента $3,
+// после которого серия считается удалённой как устаревшая.
+const (
+	SelectSeriesIDs = `SELECT DISTINCT _id FROM %s`
+	PruneSeries     = `DELETE FROM %[1]s WHERE ctid IN (
+		SELECT ctid FROM %[1]s WHERE _id=$1 AND date < $2 AND (date < $3
+			OR date < (SELECT MAX(date) FROM %[1]s AS n WHERE n._id = %[1]s._id AND n.labels = %[1]s.labels))
+		LIMIT $4)`
+	PruneSQLiteSeries = `DELETE FROM %[1]s WHERE rowid IN (
+		SELECT rowid FROM %[1]s WHERE _id = ?1 AND date < ?2 AND (date < ?3
+			OR date < (SELECT MAX(date) FROM %[1]s AS n WHERE n._id = %[1]s._id AND n.labels = %[1]s.labels))
+		LIMIT ?4)`
+	// Агрегаты удаляются по типу и имени серии целиком: последнее значение серии хранится в таблице метрик.
+	SelectRollupSeries = `SELECT DISTINCT _id, mtype FROM %s`
+	PruneRollupSeries  = `DELETE FROM %[1]s WHERE ctid IN (
+		SELECT ctid FROM %[1]s WHERE _id=$1 AND mtype=$2 AND bucket < $3 LIMIT $4)`
+	PruneSQLiteRollupSeries = `DELETE FROM %[1]s WHERE rowid IN (
+		SELECT rowid FROM %[1]s WHERE _id = ?1 AND mtype = ?2 AND bucket < ?3 LIMIT ?4)`
+)
+
+// Таблица описаний метрик из реестра: одна строка на имя метрики, повторное объявление её заменяет.
+const (
+	CreateMetadataTable = `CREATE TABLE IF NOT EXISTS metricmetadata (
+		_id TEXT PRIMARY KEY,
+		mtype TEXT NOT NULL,
+		unit TEXT NOT NULL DEFAULT '',
+		help TEXT NOT NULL DEFAULT '',
+		owner TEXT NOT NULL DEFAULT ''
+	);`
+	UpsertMetadata = `INSERT INTO metricmetadata (_id, mtype, unit, help, owner) VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (_id) DO UPDATE SET
+			mtype = excluded.mtype, unit = excluded.unit, help = excluded.help, owner = excluded.owner`
+	UpsertSQLiteMetadata = `INSERT INTO metricmetadata (_id, mtype, unit, help, owner) VALUES (?1, ?2, ?3, ?4, ?5)
+		ON CONFLICT (_id) DO UPDATE SET
+			mtype = excluded.mtype, unit = excluded.unit, help = excluded.help, owner = excluded.owner`
+	SelectMetadata = `SELECT _id, mtype, unit, help, owner FROM metricmetadata`
+)
+
+// Шаблоны запроса последнего значения каждой серии таблицы, обновлявшейся не раньше заданного момента.
+const (
+	SelectLatest = `SELECT _id, _value, labels, date FROM %[1]s AS t
+	WHERE date = (SELECT MAX(date) FROM %[1]s WHERE _id = t._id AND labels = t.labels) AND date >= $1`
+	SelectSQLiteLatest = `SELECT _id, _value, labels, date FROM %[1]s AS t
+	WHERE date = (SELECT MAX(date) FROM %[1]s WHERE _id = t._id AND labels = t.labels) AND date >= ?1`
+)
+
+// Многострочная вставка пачки наблюдений: к началу запроса добавляются строки значений через запятую.
+const (
+	BatchInsertIntoGauge     = `INSERT INTO gaugemetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoCounter   = `INSERT INTO countermetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoHistogram = `INSERT INTO histogrammetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSummary   = `INSERT INTO summarymetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSet       = `INSERT INTO setmetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchValues              = `($%d, $%d, $%d, $%d, COALESCE($%d::timestamp, CURRENT_TIMESTAMP))`
+	BatchUpsert              = ` ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value`
+
+	BatchInsertIntoSQLiteGauge     = `INSERT INTO gaugeMetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSQLiteCounter   = `INSERT INTO counterMetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSQLiteHistogram = `INSERT INTO histogramMetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSQLiteSummary   = `INSERT INTO summaryMetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchInsertIntoSQLiteSet       = `INSERT INTO setMetrics (_id, mtype, _value, labels, date) VALUES `
+	BatchSQLiteValues              = `(?%d, ?%d, ?%d, ?%d, COALESCE(?%d, strftime('%%Y-%%m-%%d %%H:%%M:%%f+00:00', 'now')))`
+	BatchSQLiteUpsert              = ` ON CONFLICT (_id, labels, date) DO UPDATE SET _value = excluded._value`
+)
+
+// Учёт применённых миграций схемы.
+const (
+	CreateSchemaMigrations = `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 	);`
-	InsertIntoGauge          = `INSERT INTO gaugemetrics VALUES ($1, $2, $3);`
-	InsertIntoCounter        = `INSERT INTO countermetrics VALUES ($1, $2, $3);`
-	SelectFromGauge          = `SELECT * FROM gaugemetrics WHERE _id=$1 ORDER BY date DESC LIMIT 1`
-	SelectFromCounter string = `SELECT * FROM countermetrics WHERE _id=$1 ORDER BY date DESC LIMIT 1`
+	SelectSchemaMigrations      = `SELECT version FROM schema_migrations ORDER BY version`
+	InsertSchemaMigration       = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	DeleteSchemaMigration       = `DELETE FROM schema_migrations WHERE version=$1`
+	InsertSQLiteSchemaMigration = `INSERT INTO schema_migrations (version, name) VALUES (?1, ?2)`
+	DeleteSQLiteSchemaMigration = `DELETE FROM schema_migrations WHERE version = ?1`
 )
@@ -0,0 +1,112 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Ограничение времени чтения последних значений всех серий.
+var LatestTimeout = time.Minute
+
+// Метод, читающий последнее по времени значение каждой серии всех таблиц метрик.
+// Для counter это накопленное значение, для histogram, summary и set — сохранённый скетч.
+// Время последнего значения попадает в Timestamps, чтобы политика запоздавших наблюдений
+// продолжала работать после восстановления. Серии, последнее значение которых старше since,
+// пропускаются: при нулевом since читаются все серии.
+func (c *Cursor) Latest(parent context.Context, since time.Time) (*metrics.Metrics, error) {
+	ctx, cancel := context.WithTimeout(parent, LatestTimeout)
+	defer cancel()
+
+	dialect := c.dialect()
+	latest := &metrics.Metrics{}
+	latest.EnsureInitialized()
+	for _, table := range dialect.Tables {
+		if table.MType == "" {
+			continue
+		}
+		query := fmt.Sprintf(dialect.Latest, table.Name)
+		if err := c.latestOf(ctx, query, table.MType, since.UTC(), latest); err != nil {
+			log.ErrorLog.Printf("could not read latest %s values: %e", table.MType, err)
+			return nil, err
+		}
+	}
+	return latest, nil
+}
+
+func (c *Cursor) latestOf(ctx context.Context, query, mtype string, since time.Time, latest *metrics.Metrics) error {
+	rows, err := c.DB.QueryContext(ctx, query, since)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing latest rows: %e", err)
+		}
+	}()
+	for rows.Next() {
+		var id, value, labelsJSON string
+		var date time.Time
+		if err = rows.Scan(&id, &value, &labelsJSON, &date); err != nil {
+			return err
+		}
+		var labels map[string]string
+		if labelsJSON != "" && labelsJSON != "{}" {
+			if err = json.Unmarshal([]byte(labelsJSON), &labels); err != nil {
+				return err
+			}
+		}
+		key := metrics.SeriesKey(id, labels)
+		if err = setLatest(latest, mtype, key, value); err != nil {
+			log.ErrorLog.Printf("error decoding latest %s %s: %e", mtype, key, err)
+			return err
+		}
+		latest.Timestamps[key] = date.UnixMilli()
+	}
+	return rows.Err()
+}
+
+// Функция, записывающая значение серии key, прочитанное из БД как текст, в снимок метрик.
+func setLatest(latest *metrics.Metrics, mtype, key, value string) error {
+	switch mtype {
+	case GAUGE:
+		gauge, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		latest.GaugeMetrics[key] = metrics.Gauge(gauge)
+	case COUNTER:
+		counter, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		latest.CounterMetrics[key] = metrics.Counter(counter)
+	case HISTOGRAM:
+		histogram := &metrics.Histogram{}
+		if err := json.Unmarshal([]byte(value), histogram); err != nil {
+			return err
+		}
+		latest.HistogramMetrics[key] = histogram
+	case SUMMARY:
+		summary := &metrics.Summary{}
+		if err := json.Unmarshal([]byte(value), summary); err != nil {
+			return err
+		}
+		latest.SummaryMetrics[key] = summary
+	case SET:
+		set := &metrics.Set{}
+		if err := json.Unmarshal([]byte(value), set); err != nil {
+			return err
+		}
+		latest.SetMetrics[key] = set
+	default:
+		return errors.ErrorMetricNotFound
+	}
+	return nil
+}
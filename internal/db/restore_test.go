@@ -0,0 +1,68 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+func TestSQLiteLatest(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	now := time.Now()
+	labels := map[string]string{"host": "a"}
+	for i := 0; i < 3; i++ {
+		sampleTime := now.Add(time.Duration(i-3) * time.Minute).UnixMilli()
+		value := float64(i) + 0.5
+		delta := int64(10 * (i + 1))
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value, Timestamp: &sampleTime}))
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{
+			ID: "Requests", MType: COUNTER, Delta: &delta, Labels: labels, Timestamp: &sampleTime,
+		}))
+	}
+	histogram := m.NewHistogram([]float64{1, 5})
+	histogram.Observe(3)
+	require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Latency", MType: HISTOGRAM, Histogram: histogram}))
+
+	latest, err := cursor.Latest(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, m.Gauge(2.5), latest.GaugeMetrics["Load"])
+	key := m.SeriesKey("Requests", labels)
+	assert.Equal(t, m.Counter(30), latest.CounterMetrics[key])
+	assert.Equal(t, now.Add(-time.Minute).UnixMilli(), latest.Timestamps[key])
+	require.Contains(t, latest.HistogramMetrics, "Latency")
+	assert.Equal(t, histogram.Count, latest.HistogramMetrics["Latency"].Count)
+	assert.Empty(t, latest.SetMetrics)
+
+	// серии, не обновлявшиеся с момента since, удалены как устаревшие и не восстанавливаются
+	latest, err = cursor.Latest(ctx, now.Add(-90*time.Second))
+	require.NoError(t, err)
+	assert.Contains(t, latest.GaugeMetrics, "Load")
+	assert.Contains(t, latest.CounterMetrics, key)
+	latest, err = cursor.Latest(ctx, now.Add(-30*time.Second))
+	require.NoError(t, err)
+	assert.Empty(t, latest.GaugeMetrics)
+	assert.Empty(t, latest.CounterMetrics)
+	assert.Contains(t, latest.HistogramMetrics, "Latency")
+}
+
+func TestSQLiteMetadata(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	require.NoError(t, cursor.SaveMetadata(ctx, &m.Metadata{Name: "Load", MType: GAUGE, Unit: "percent"}))
+	require.NoError(t, cursor.SaveMetadata(ctx, &m.Metadata{Name: "Load", MType: GAUGE, Unit: "percent", Help: "CPU load"}))
+	require.NoError(t, cursor.SaveMetadata(ctx, &m.Metadata{Name: "Requests", MType: COUNTER, Owner: "api"}))
+
+	stored, err := cursor.Metadata(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]*m.Metadata{
+		"Load":     {Name: "Load", MType: GAUGE, Unit: "percent", Help: "CPU load"},
+		"Requests": {Name: "Requests", MType: COUNTER, Owner: "api"},
+	}, stored)
+}
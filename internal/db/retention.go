@@ -0,0 +1,319 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	// Период запуска очистки, размер пачки удаляемых строк и ограничение времени одного запроса очистки.
+	PruneInterval  = time.Hour
+	PruneBatchSize = 1000
+	PruneTimeout   = time.Minute
+)
+
+// Правило хранения: строки метрик типа MType с именем, начинающимся с Prefix, хранятся Keep.
+// Правило с ненулевым Step относится к агрегатам свёртки этого разрешения, а не к сырым строкам.
+type RetentionRule struct {
+	MType  string
+	Prefix string
+	Step   time.Duration
+	Keep   time.Duration
+}
+
+// Набор правил хранения. Для серии применяется правило её типа и разрешения с самым длинным
+// совпавшим префиксом. Агрегаты, к которым не относится ни одно правило, хранятся всегда.
+type Retention []RetentionRule
+
+// Функция, разбирающая правила хранения вида gauge=7d,counter=30d,gauge:cpu_=1d,gauge@1h=365d.
+// Суффикс @1m или @1h после типа задаёт срок хранения агрегатов свёртки gauge и counter.
+// Срок задаётся в днях с суффиксом d или в формате time.ParseDuration.
+func ParseRetention(spec string) (Retention, error) {
+	rules := make(Retention, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		target, age, found := strings.Cut(item, "=")
+		if !found {
+			return nil, errors.ErrorRetention
+		}
+		rule := RetentionRule{}
+		rule.MType, rule.Prefix, _ = strings.Cut(target, ":")
+		mtype, step, rolled := strings.Cut(rule.MType, "@")
+		if rolled {
+			var err error
+			if rule.Step, err = time.ParseDuration(step); err != nil || !isRollupStep(rule.Step) ||
+				(mtype != GAUGE && mtype != COUNTER) {
+				return nil, errors.ErrorRetention
+			}
+			rule.MType = mtype
+		}
+		keep, err := parseRetentionAge(age)
+		if err != nil || !isMetricType(rule.MType) {
+			return nil, errors.ErrorRetention
+		}
+		rule.Keep = keep
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func parseRetentionAge(value string) (time.Duration, error) {
+	var keep time.Duration
+	if strings.HasSuffix(value, "d") {
+		number, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil {
+			return 0, err
+		}
+		keep = time.Duration(number) * 24 * time.Hour
+	} else {
+		var err error
+		if keep, err = time.ParseDuration(value); err != nil {
+			return 0, err
+		}
+	}
+	if keep <= 0 {
+		return 0, errors.ErrorRetention
+	}
+	return keep, nil
+}
+
+func isRollupStep(step time.Duration) bool {
+	for _, rollup := range PostgresDialect.Rollups {
+		if rollup.Step == step {
+			return true
+		}
+	}
+	return false
+}
+
+func isMetricType(mtype string) bool {
+	switch mtype {
+	case GAUGE, COUNTER, HISTOGRAM, SUMMARY, SET:
+		return true
+	}
+	return false
+}
+
+// Метод, возвращающий срок хранения сырых строк серии (step равен нулю) или её агрегатов с шагом step;
+// false, если ни одно правило к ним не относится.
+func (r Retention) For(mtype, id string, step time.Duration) (time.Duration, bool) {
+	var chosen *RetentionRule
+	for i := range r {
+		rule := &r[i]
+		if rule.MType != mtype || rule.Step != step || !strings.HasPrefix(id, rule.Prefix) {
+			continue
+		}
+		if chosen == nil || len(rule.Prefix) > len(chosen.Prefix) {
+			chosen = rule
+		}
+	}
+	if chosen == nil {
+		return 0, false
+	}
+	return chosen.Keep, true
+}
+
+// Метод, удаляющий строки старше сроков хранения. Строки каждой серии удаляются пачками
+// по PruneBatchSize, каждый запрос ограничен PruneTimeout, чтобы длинный проход по большой базе
+// не прерывался целиком. Последняя строка серии удаляется, только если она старше и срока хранения,
+// и срока удаления устаревших серий evictAfter; нулевой evictAfter сохраняет последние строки всегда.
+// Возвращает число удалённых строк по типам метрик, а для агрегатов — по именам их таблиц.
+func (c *Cursor) Prune(
+	parent context.Context, retention Retention, evictAfter time.Duration, now time.Time,
+) (map[string]int64, error) {
+	var evictBefore time.Time
+	if evictAfter > 0 {
+		evictBefore = now.Add(-evictAfter).UTC()
+	}
+	dialect := c.dialect()
+	removed := make(map[string]int64)
+	for _, table := range dialect.Tables {
+		if table.MType == "" {
+			continue
+		}
+		ids, err := c.seriesIDs(parent, fmt.Sprintf(dialect.SeriesIDs, table.Name))
+		if err != nil {
+			log.ErrorLog.Printf("could not list series of %s: %e", table.Name, err)
+			return removed, err
+		}
+		query := fmt.Sprintf(dialect.Prune, table.Name)
+		for _, id := range ids {
+			keep, ok := retention.For(table.MType, id, 0)
+			if !ok {
+				continue
+			}
+			rows, err := c.pruneSeries(parent, query, id, now.Add(-keep).UTC(), evictBefore)
+			removed[table.MType] += rows
+			if err != nil {
+				log.ErrorLog.Printf("could not prune %s rows of %s: %e", table.MType, id, err)
+				return removed, err
+			}
+		}
+	}
+	for _, rollup := range dialect.Rollups {
+		series, err := c.rollupSeries(parent, fmt.Sprintf(dialect.RollupSeriesIDs, rollup.Table))
+		if err != nil {
+			log.ErrorLog.Printf("could not list series of %s: %e", rollup.Table, err)
+			return removed, err
+		}
+		query := fmt.Sprintf(dialect.RollupPrune, rollup.Table)
+		for _, item := range series {
+			keep, ok := retention.For(item.mtype, item.id, rollup.Step)
+			if !ok {
+				continue
+			}
+			rows, err := c.pruneSeries(parent, query, item.id, item.mtype, now.Add(-keep).UTC())
+			removed[rollup.Table] += rows
+			if err != nil {
+				log.ErrorLog.Printf("could not prune %s rows of %s: %e", rollup.Table, item.id, err)
+				return removed, err
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Метод, удаляющий строки одной серии пачками по PruneBatchSize, пока пачка заполняется целиком.
+// Последним параметром запроса передаётся размер пачки.
+func (c *Cursor) pruneSeries(parent context.Context, query string, args ...any) (int64, error) {
+	var removed int64
+	args = append(args, PruneBatchSize)
+	for {
+		rows, err := c.pruneBatch(parent, query, args...)
+		if err != nil {
+			return removed, err
+		}
+		removed += rows
+		if rows < int64(PruneBatchSize) {
+			return removed, nil
+		}
+	}
+}
+
+// Метод, удаляющий одну пачку строк с ограничением PruneTimeout и возвращающий число удалённых строк.
+func (c *Cursor) pruneBatch(parent context.Context, query string, args ...any) (int64, error) {
+	ctx, cancel := context.WithTimeout(parent, PruneTimeout)
+	defer cancel()
+	result, err := c.DB.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Имя и тип серии таблицы агрегатов.
+type rolledSeries struct {
+	id    string
+	mtype string
+}
+
+// Метод, возвращающий имена и типы серий таблицы агрегатов.
+func (c *Cursor) rollupSeries(parent context.Context, query string) ([]rolledSeries, error) {
+	ctx, cancel := context.WithTimeout(parent, PruneTimeout)
+	defer cancel()
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing series rows: %e", err)
+		}
+	}()
+	series := make([]rolledSeries, 0)
+	for rows.Next() {
+		var item rolledSeries
+		if err = rows.Scan(&item.id, &item.mtype); err != nil {
+			return nil, err
+		}
+		series = append(series, item)
+	}
+	return series, rows.Err()
+}
+
+// Метод, возвращающий имена серий таблицы метрик.
+func (c *Cursor) seriesIDs(parent context.Context, query string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(parent, PruneTimeout)
+	defer cancel()
+	rows, err := c.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing series rows: %e", err)
+		}
+	}()
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err = rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Фоновая задача, периодически удаляющая строки старше сроков хранения.
+// После каждого прохода число удалённых строк передаётся в report.
+type Pruner struct {
+	cursor     *Cursor
+	retention  Retention
+	evictAfter time.Duration
+	report     func(removed map[string]int64)
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Функция, запускающая очистку по правилам retention с периодом PruneInterval. Последние строки
+// серий, не обновлявшихся дольше evictAfter, удаляются вместе с остальными, см. Cursor.Prune.
+func StartPruning(
+	cursor *Cursor, retention Retention, evictAfter time.Duration, report func(removed map[string]int64),
+) *Pruner {
+	p := &Pruner{
+		cursor: cursor, retention: retention, evictAfter: evictAfter, report: report, done: make(chan struct{}),
+	}
+	p.wg.Add(1)
+	go p.run()
+	return p
+}
+
+func (p *Pruner) run() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		removed, err := p.cursor.Prune(context.Background(), p.retention, p.evictAfter, time.Now())
+		if err != nil {
+			log.ErrorLog.Printf("error pruning history: %e", err)
+		}
+		log.InfoLog.Printf("pruned rows: %v", removed)
+		if p.report != nil {
+			p.report(removed)
+		}
+		select {
+		case <-p.done:
+			log.InfoLog.Println("Stop pruning history")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Метод, останавливающий очистку и дожидающийся завершения текущего прохода.
+func (p *Pruner) Stop() {
+	close(p.done)
+	p.wg.Wait()
+}
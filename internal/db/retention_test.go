@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestParseRetention(t *testing.T) {
+	retention, err := ParseRetention("gauge=7d, counter=30d,gauge:cpu_=90m")
+	require.NoError(t, err)
+	assert.Equal(t, Retention{
+		{MType: GAUGE, Keep: 7 * 24 * time.Hour},
+		{MType: COUNTER, Keep: 30 * 24 * time.Hour},
+		{MType: GAUGE, Prefix: "cpu_", Keep: 90 * time.Minute},
+	}, retention)
+
+	keep, ok := retention.For(GAUGE, "cpu_user", 0)
+	assert.True(t, ok)
+	assert.Equal(t, 90*time.Minute, keep)
+	keep, ok = retention.For(GAUGE, "Load", 0)
+	assert.True(t, ok)
+	assert.Equal(t, 7*24*time.Hour, keep)
+	_, ok = retention.For(HISTOGRAM, "Latency", 0)
+	assert.False(t, ok)
+	_, ok = retention.For(GAUGE, "Load", time.Minute)
+	assert.False(t, ok)
+
+	retention, err = ParseRetention("gauge@1m=2d,counter@1h:req_=365d")
+	require.NoError(t, err)
+	assert.Equal(t, Retention{
+		{MType: GAUGE, Step: time.Minute, Keep: 2 * 24 * time.Hour},
+		{MType: COUNTER, Prefix: "req_", Step: time.Hour, Keep: 365 * 24 * time.Hour},
+	}, retention)
+	keep, ok = retention.For(GAUGE, "Load", time.Minute)
+	assert.True(t, ok)
+	assert.Equal(t, 2*24*time.Hour, keep)
+	_, ok = retention.For(GAUGE, "Load", 0)
+	assert.False(t, ok)
+
+	empty, err := ParseRetention("")
+	require.NoError(t, err)
+	assert.Empty(t, empty)
+	for _, spec := range []string{
+		"gauge", "gauge=forever", "gauge=-1d", "timer=1d", "gauge@5m=1d", "gauge@x=1d", "histogram@1h=1d",
+	} {
+		_, err = ParseRetention(spec)
+		assert.Equal(t, errors.ErrorRetention, err, spec)
+	}
+}
+
+func TestSQLitePrune(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+	batchSize := PruneBatchSize
+	PruneBatchSize = 2
+	defer func() { PruneBatchSize = batchSize }()
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		value := float64(i)
+		sampleTime := now.Add(-time.Duration(i+1) * time.Hour).UnixMilli()
+		for _, id := range []string{"cpu_user", "Load"} {
+			require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: id, MType: GAUGE, Value: &value, Timestamp: &sampleTime}))
+		}
+		delta := int64(i)
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Requests", MType: COUNTER, Delta: &delta, Timestamp: &sampleTime}))
+	}
+
+	retention, err := ParseRetention("gauge=150m,gauge:cpu_=30m")
+	require.NoError(t, err)
+	removed, err := cursor.Prune(ctx, retention, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{GAUGE: 7}, removed)
+
+	count := func(query, id string) int {
+		var rows int
+		require.NoError(t, cursor.DB.QueryRowContext(ctx, query, id).Scan(&rows))
+		return rows
+	}
+	// последнее значение серии остаётся, даже если оно старше срока хранения
+	assert.Equal(t, 1, count("SELECT COUNT(*) FROM gaugeMetrics WHERE _id = ?1", "cpu_user"))
+	assert.Equal(t, 2, count("SELECT COUNT(*) FROM gaugeMetrics WHERE _id = ?1", "Load"))
+	assert.Equal(t, 5, count("SELECT COUNT(*) FROM counterMetrics WHERE _id = ?1", "Requests"))
+
+	latest, err := cursor.Latest(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, m.Gauge(0), latest.GaugeMetrics["cpu_user"])
+	assert.Equal(t, now.Add(-time.Hour).UnixMilli(), latest.Timestamps["cpu_user"])
+
+	// последнее значение старше и срока хранения, и срока удаления устаревших серий удаляется
+	removed, err = cursor.Prune(ctx, retention, 30*time.Minute, now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{GAUGE: 1}, removed)
+	assert.Equal(t, 0, count("SELECT COUNT(*) FROM gaugeMetrics WHERE _id = ?1", "cpu_user"))
+	assert.Equal(t, 2, count("SELECT COUNT(*) FROM gaugeMetrics WHERE _id = ?1", "Load"))
+}
+
+func TestSQLitePruneRollups(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	now := time.Now().UTC().Truncate(time.Hour)
+	for i := 0; i < 4; i++ {
+		value, sampleTime := float64(i), now.Add(-time.Duration(4-i)*24*time.Hour).UnixMilli()
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value, Timestamp: &sampleTime}))
+	}
+	require.NoError(t, cursor.Rollup(ctx, now))
+	count := func(table string) int {
+		var rows int
+		require.NoError(t, cursor.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM "+table).Scan(&rows))
+		return rows
+	}
+	require.Equal(t, 3, count("rollup1m"))
+	require.Equal(t, 3, count("rollup1h"))
+
+	// Правила сырых строк не затрагивают агрегаты, а агрегаты без правила хранятся всегда.
+	retention, err := ParseRetention("gauge=1h,gauge@1m=50h")
+	require.NoError(t, err)
+	removed, err := cursor.Prune(ctx, retention, 0, now)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int64{GAUGE: 0, "rollup1m": 2}, removed)
+	assert.Equal(t, 1, count("rollup1m"))
+	assert.Equal(t, 3, count("rollup1h"))
+	assert.Equal(t, 1, count("gaugeMetrics"))
+}
@@ -0,0 +1,320 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	// Период запуска свёртки и ограничение времени транзакции одного окна свёртки.
+	RollupInterval = 10 * time.Minute
+	RollupTimeout  = time.Minute
+	// Длительность истории, сворачиваемой одной транзакцией. Кратна часу, чтобы часовые агрегаты
+	// строились по полным интервалам.
+	RollupWindow = time.Hour
+)
+
+// Сырые значения одной серии, подлежащие свёртке.
+type rawSeries struct {
+	id      string
+	labels  string
+	samples []metrics.Sample
+}
+
+// Метод, сворачивающий сырые значения gauge и counter старше before в агрегаты всех разрешений
+// диалекта и удаляющий свёрнутые строки. Граница выравнивается по часу. Накопленная история
+// сворачивается окнами RollupWindow от старых значений к новым, каждое окно — в отдельной транзакции
+// со своим ограничением RollupTimeout, поэтому большой долг свёртки не упирается в один таймаут,
+// а прерванный проход продолжается со следующего несвёрнутого окна.
+func (c *Cursor) Rollup(ctx context.Context, before time.Time) error {
+	cutoff := before.UTC().Truncate(time.Hour)
+	windows := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rolled, err := c.rollupWindow(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		if !rolled {
+			break
+		}
+		windows++
+	}
+	log.InfoLog.Printf("history before %s rolled up in %d windows", cutoff.Format(time.RFC3339), windows)
+	return nil
+}
+
+// Метод, сворачивающий в одной транзакции самое старое окно несвёрнутых значений до cutoff.
+// Возвращает false, если сворачивать нечего.
+func (c *Cursor) rollupWindow(parent context.Context, cutoff time.Time) (bool, error) {
+	ctx, cancel := context.WithTimeout(parent, RollupTimeout)
+	defer cancel()
+
+	dialect := c.dialect()
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorLog.Printf("could not begin rollup transaction: %e", err)
+		return false, err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.ErrorLog.Printf("could not rollback rollup transaction: %e", err)
+		}
+	}()
+	var oldest time.Time
+	for _, mtype := range []string{GAUGE, COUNTER} {
+		var date time.Time
+		err = tx.QueryRowContext(ctx, dialect.RollupOldest[mtype], cutoff).Scan(&date)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			log.ErrorLog.Printf("could not find %s rows to roll up: %e", mtype, err)
+			return false, err
+		}
+		if oldest.IsZero() || date.Before(oldest) {
+			oldest = date
+		}
+	}
+	if oldest.IsZero() {
+		return false, nil
+	}
+	end := oldest.UTC().Truncate(RollupWindow).Add(RollupWindow)
+	if end.After(cutoff) {
+		end = cutoff
+	}
+	for _, mtype := range []string{GAUGE, COUNTER} {
+		series, err := rawBefore(ctx, tx, dialect.RollupSource[mtype], end)
+		if err != nil {
+			log.ErrorLog.Printf("could not read %s rows to roll up: %e", mtype, err)
+			return false, err
+		}
+		for _, raw := range series {
+			for _, rollup := range dialect.Rollups {
+				for _, point := range metrics.Downsample(raw.samples, rollup.Step) {
+					if _, err = tx.ExecContext(ctx, rollup.Insert, raw.id, mtype, raw.labels,
+						time.UnixMilli(point.Timestamp).UTC(), point.Min, point.Max, point.Avg, point.Count, point.Last,
+					); err != nil {
+						log.ErrorLog.Printf("could not write %s rollup of %s: %e", rollup.Step, raw.id, err)
+						return false, err
+					}
+				}
+			}
+		}
+		if _, err = tx.ExecContext(ctx, dialect.RollupDelete[mtype], end); err != nil {
+			log.ErrorLog.Printf("could not delete rolled up %s rows: %e", mtype, err)
+			return false, err
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		log.ErrorLog.Printf("could not commit rollup transaction: %e", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// Функция, читающая сырые значения, упорядоченные по серии и времени, и группирующая их по сериям.
+func rawBefore(ctx context.Context, tx *sql.Tx, query string, cutoff time.Time) ([]*rawSeries, error) {
+	rows, err := tx.QueryContext(ctx, query, cutoff)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing rollup rows: %e", err)
+		}
+	}()
+	series := make([]*rawSeries, 0)
+	for rows.Next() {
+		var id, labels string
+		var sample metrics.Sample
+		if err = rows.Scan(&id, &labels, &sample.Value, &sample.Time); err != nil {
+			return nil, err
+		}
+		if len(series) == 0 || series[len(series)-1].id != id || series[len(series)-1].labels != labels {
+			series = append(series, &rawSeries{id: id, labels: labels})
+		}
+		last := series[len(series)-1]
+		last.samples = append(last.samples, sample)
+	}
+	return series, rows.Err()
+}
+
+// Метод, выбирающий таблицу агрегатов для шага step: самое крупное разрешение, на которое шаг делится
+// без остатка, а для шага мельче всех разрешений — самое мелкое.
+func (c *Cursor) rollupFor(step time.Duration) *Rollup {
+	rollups := c.dialect().Rollups
+	if len(rollups) == 0 {
+		return nil
+	}
+	chosen := &rollups[0]
+	for i := range rollups {
+		if step >= rollups[i].Step && step%rollups[i].Step == 0 {
+			chosen = &rollups[i]
+		}
+	}
+	return chosen
+}
+
+// Метод, возвращающий точки истории серии с шагом step за полуинтервал [from, to).
+// Несвёрнутые значения читаются из таблиц метрик, свёрнутые — из агрегатов подходящего разрешения:
+// свёртка удаляет сырые строки, поэтому два источника не пересекаются.
+func (c *Cursor) Points(
+	parent context.Context, metric *metrics.JSONMetrics, from, to time.Time, step time.Duration,
+) ([]metrics.Point, error) {
+	samples, err := c.History(parent, metric, from, to)
+	if err != nil {
+		return nil, err
+	}
+	points := metrics.Downsample(samples, step)
+	rollup := c.rollupFor(step)
+	if rollup == nil {
+		return points, nil
+	}
+	rolled, err := c.rollupPoints(parent, rollup, metric, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return metrics.Resample(append(rolled, points...), step), nil
+}
+
+func (c *Cursor) rollupPoints(
+	parent context.Context, rollup *Rollup, metric *metrics.JSONMetrics, from, to time.Time,
+) ([]metrics.Point, error) {
+	ctx, cancel := context.WithTimeout(parent, DBDefaultTimeout)
+	defer cancel()
+
+	rows, err := c.DB.QueryContext(ctx, rollup.Select, metric.ID, metric.MType, metrics.LabelsJSON(metric.Labels),
+		from.UTC(), to.UTC())
+	if err != nil {
+		log.ErrorLog.Printf("error getting %s rollup of %s: %e", rollup.Step, metric.ID, err)
+		return nil, err
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			log.ErrorLog.Printf("error closing rollup rows: %e", err)
+		}
+	}()
+	points := make([]metrics.Point, 0)
+	for rows.Next() {
+		var bucket time.Time
+		var point metrics.Point
+		if err = rows.Scan(&bucket, &point.Min, &point.Max, &point.Avg, &point.Count, &point.Last); err != nil {
+			log.ErrorLog.Printf("error scanning rollup of %s: %e", metric.ID, err)
+			return nil, err
+		}
+		point.Timestamp = bucket.UnixMilli()
+		points = append(points, point)
+	}
+	return points, rows.Err()
+}
+
+// Метод, возвращающий сохранённые агрегаты серии всех разрешений с началом интервала в [from, to),
+// например для выгрузки истории.
+func (c *Cursor) Rollups(
+	parent context.Context, metric *metrics.JSONMetrics, from, to time.Time,
+) ([]metrics.Rollup, error) {
+	rollups := make([]metrics.Rollup, 0)
+	for i := range c.dialect().Rollups {
+		rollup := &c.dialect().Rollups[i]
+		points, err := c.rollupPoints(parent, rollup, metric, from, to)
+		if err != nil {
+			return nil, err
+		}
+		for _, point := range points {
+			rollups = append(rollups, metrics.Rollup{Step: rollup.Step.Milliseconds(), Point: point})
+		}
+	}
+	return rollups, nil
+}
+
+// Метод, записывающий агрегаты в таблицы их разрешений одной транзакцией, например при загрузке
+// выгрузки. Агрегат уже сохранённого интервала объединяется с ним, как при повторной свёртке.
+// Для агрегата с разрешением, которого нет в диалекте, возвращается ErrorRollupStep.
+func (c *Cursor) AddRollups(parent context.Context, rollups []metrics.SeriesRollup) error {
+	ctx, cancel := context.WithTimeout(parent, RollupTimeout)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		log.ErrorLog.Printf("could not begin rollup import transaction: %e", err)
+		return err
+	}
+	defer func() {
+		if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
+			log.ErrorLog.Printf("could not rollback rollup import transaction: %e", err)
+		}
+	}()
+	for _, item := range rollups {
+		var table *Rollup
+		for i := range c.dialect().Rollups {
+			if c.dialect().Rollups[i].Step.Milliseconds() == item.Step {
+				table = &c.dialect().Rollups[i]
+			}
+		}
+		if table == nil {
+			log.ErrorLog.Printf("no rollup table with step %dms for %s", item.Step, item.Series.ID)
+			return errors.ErrorRollupStep
+		}
+		if _, err = tx.ExecContext(ctx, table.Insert, item.Series.ID, item.Series.MType,
+			metrics.LabelsJSON(item.Series.Labels), time.UnixMilli(item.Timestamp).UTC(),
+			item.Min, item.Max, item.Avg, item.Count, item.Last,
+		); err != nil {
+			log.ErrorLog.Printf("could not write %s rollup of %s: %e", table.Step, item.Series.ID, err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Фоновая задача, периодически сворачивающая историю старше заданного возраста.
+type Roller struct {
+	cursor *Cursor
+	after  time.Duration
+	done   chan struct{}
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// Функция, запускающая свёртку истории старше after с периодом RollupInterval.
+func StartRollups(cursor *Cursor, after time.Duration) *Roller {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Roller{cursor: cursor, after: after, done: make(chan struct{}), cancel: cancel}
+	r.wg.Add(1)
+	go r.run(ctx)
+	return r
+}
+
+func (r *Roller) run(ctx context.Context) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(RollupInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.cursor.Rollup(ctx, time.Now().Add(-r.after)); err != nil {
+			log.ErrorLog.Printf("error rolling up history: %e", err)
+		}
+		select {
+		case <-r.done:
+			log.InfoLog.Println("Stop rolling up history")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Метод, останавливающий свёртку и дожидающийся завершения текущего прохода. Проход прерывается
+// после текущего окна, его транзакция откатывается.
+func (r *Roller) Stop() {
+	r.cancel()
+	close(r.done)
+	r.wg.Wait()
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+func TestSQLiteRollup(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	hour := time.Now().UTC().Truncate(time.Hour).Add(-3 * time.Hour)
+	labels := map[string]string{"host": "a"}
+	add := func(value float64, at time.Time) {
+		sampleTime := at.UnixMilli()
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{
+			ID: "Load", MType: GAUGE, Value: &value, Labels: labels, Timestamp: &sampleTime}))
+	}
+	add(1, hour.Add(10*time.Second))
+	add(3, hour.Add(20*time.Second))
+	add(8, hour.Add(30*time.Minute))
+	add(5, hour.Add(2*time.Hour+time.Minute))
+
+	require.NoError(t, cursor.Rollup(ctx, hour.Add(90*time.Minute)))
+
+	// Свёрнуты только значения до границы, выровненной по часу.
+	var raw int
+	require.NoError(t, cursor.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM gaugeMetrics").Scan(&raw))
+	assert.Equal(t, 1, raw)
+
+	metric := &m.JSONMetrics{ID: "Load", MType: GAUGE, Labels: labels}
+	points, err := cursor.Points(ctx, metric, hour, hour.Add(3*time.Hour), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Point{
+		{Timestamp: hour.UnixMilli(), Avg: 2, Min: 1, Max: 3, Last: 3, Count: 2},
+		{Timestamp: hour.Add(30 * time.Minute).UnixMilli(), Avg: 8, Min: 8, Max: 8, Last: 8, Count: 1},
+		{Timestamp: hour.Add(2*time.Hour + time.Minute).UnixMilli(), Avg: 5, Min: 5, Max: 5, Last: 5, Count: 1},
+	}, points)
+
+	points, err = cursor.Points(ctx, metric, hour, hour.Add(3*time.Hour), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Point{
+		{Timestamp: hour.UnixMilli(), Avg: 4, Min: 1, Max: 8, Last: 8, Count: 3},
+		{Timestamp: hour.Add(2 * time.Hour).UnixMilli(), Avg: 5, Min: 5, Max: 5, Last: 5, Count: 1},
+	}, points)
+
+	// Запоздавшее значение объединяется с уже свёрнутым часом.
+	add(2, hour.Add(40*time.Minute))
+	require.NoError(t, cursor.Rollup(ctx, hour.Add(90*time.Minute)))
+	points, err = cursor.Points(ctx, metric, hour, hour.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Point{{Timestamp: hour.UnixMilli(), Avg: 3.5, Min: 1, Max: 8, Last: 2, Count: 4}}, points)
+
+	// У простаивающей серии последнее значение остаётся сырым, чтобы по нему восстановился counter.
+	for i, delta := range []int64{4, 9} {
+		delta, sampleTime := delta, hour.Add(time.Duration(i+1)*time.Minute).UnixMilli()
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Idle", MType: COUNTER, Delta: &delta, Timestamp: &sampleTime}))
+	}
+	require.NoError(t, cursor.Rollup(ctx, hour.Add(90*time.Minute)))
+	latest, err := cursor.Latest(ctx, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, m.Counter(9), latest.CounterMetrics["Idle"])
+	points, err = cursor.Points(ctx, &m.JSONMetrics{ID: "Idle", MType: COUNTER}, hour, hour.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, []m.Point{{Timestamp: hour.UnixMilli(), Avg: 6.5, Min: 4, Max: 9, Last: 9, Count: 2}}, points)
+}
+
+func TestSQLiteRollupWindows(t *testing.T) {
+	ctx := context.Background()
+	cursor := openSQLite(t)
+
+	start := time.Now().UTC().Truncate(time.Hour).Add(-6 * time.Hour)
+	for i := 0; i < 5; i++ {
+		value, sampleTime := float64(i), start.Add(time.Duration(i)*time.Hour+time.Minute).UnixMilli()
+		require.NoError(t, cursor.Add(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE, Value: &value, Timestamp: &sampleTime}))
+	}
+
+	// Прерванный проход ничего не сворачивает и не теряет.
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	assert.ErrorIs(t, cursor.Rollup(cancelled, start.Add(4*time.Hour)), context.Canceled)
+	var raw int
+	require.NoError(t, cursor.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM gaugeMetrics").Scan(&raw))
+	assert.Equal(t, 5, raw)
+
+	// Каждый час долга сворачивается своей транзакцией, значения после границы остаются сырыми.
+	windows := 0
+	for {
+		rolled, err := cursor.rollupWindow(ctx, start.Add(4*time.Hour))
+		require.NoError(t, err)
+		if !rolled {
+			break
+		}
+		windows++
+	}
+	assert.Equal(t, 4, windows)
+	require.NoError(t, cursor.DB.QueryRowContext(ctx, "SELECT COUNT(*) FROM gaugeMetrics").Scan(&raw))
+	assert.Equal(t, 1, raw)
+
+	require.NoError(t, cursor.Rollup(ctx, start.Add(6*time.Hour)))
+	points, err := cursor.Points(ctx, &m.JSONMetrics{ID: "Load", MType: GAUGE}, start, start.Add(6*time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, points, 5)
+	for i, point := range points {
+		assert.Equal(t, start.Add(time.Duration(i)*time.Hour).UnixMilli(), point.Timestamp)
+		assert.Equal(t, float64(i), point.Last)
+	}
+}
+
+func TestRollupFor(t *testing.T) {
+	cursor := &Cursor{Dialect: SQLiteDialect}
+	assert.Equal(t, time.Minute, cursor.rollupFor(time.Second).Step)
+	assert.Equal(t, time.Minute, cursor.rollupFor(5*time.Minute).Step)
+	assert.Equal(t, time.Minute, cursor.rollupFor(90*time.Minute).Step)
+	assert.Equal(t, time.Hour, cursor.rollupFor(24*time.Hour).Step)
+}
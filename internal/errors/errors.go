@@ -10,4 +10,33 @@ var (
 	ErrorWithIntervalConvertion = errors.New("error converting Intervals to int64")
 	ErrorHash                   = errors.New("wrong hash")
 	ErrorDB                     = errors.New("DB error")
+	ErrorHistogramBounds        = errors.New("histogram bounds mismatch")
+	ErrorMetricValue            = errors.New("metric value is missing")
+	ErrorSummaryAccuracy        = errors.New("summary relative accuracy mismatch")
+	ErrorLabelMatcher           = errors.New("wrong label matcher, expected name:value")
+	ErrorQuantile               = errors.New("quantile must be a number in [0, 1]")
+	ErrorTypeConflict           = errors.New("metric type conflicts with registered type")
+	ErrorMetadata               = errors.New("metadata requires metric name and known type")
+	ErrorLateSample             = errors.New("sample is older than the stored one")
+	ErrorOutOfOrderPolicy       = errors.New("unknown out-of-order policy, expected accept, drop or window")
+	ErrorSetPrecision           = errors.New("set sketch precision mismatch")
+	ErrorRateWindow             = errors.New("rate window must be a positive duration not exceeding retained history")
+	ErrorHistoryRange           = errors.New("history range requires from < to, positive step and a bounded number of points")
+	ErrorHistoryUnavailable     = errors.New("history is available only with database storage")
+	ErrorRollupStep             = errors.New("no rollup table with this step")
+	ErrorBatchBufferFull        = errors.New("database batch buffer is full")
+	ErrorMigration              = errors.New("wrong migration, expected 0001_name.up.sql with optional down")
+	ErrorSchemaOutdated         = errors.New("database schema is older than the server, run server migrate")
+	ErrorMigrateUsage           = errors.New("usage: server migrate [up | down [N] | status] -d DSN")
+	ErrorRetention              = errors.New("wrong retention rule, expected type[:prefix]=age, e.g. gauge=7d")
+	ErrorSnapshot               = errors.New("no valid snapshot generation: wrong format, version or checksum")
+	ErrorSnapshotCodec          = errors.New("unsupported snapshot codec, expected none or gzip")
+	ErrorTSDBBlock              = errors.New("corrupt TSDB block: wrong magic, layout or checksum")
+	ErrorRestoreSource          = errors.New("unknown restore source, expected db or file")
+	ErrorTransferFormat         = errors.New("unknown transfer format, expected ndjson or csv")
+	ErrorTransferRecord         = errors.New("wrong transfer record, expected kind, type, id, labels, value, timestamp")
+	ErrorStatsDLine             = errors.New("wrong statsd line, expected name:value|type[|@rate][|#tags]")
+	ErrorInfluxLine             = errors.New("wrong line protocol, expected measurement[,tag=value] field=value[,...] [timestamp]")
+	ErrorInfluxPrecision        = errors.New("wrong precision, expected ns, us, ms or s")
+	ErrorTransferUsage          = errors.New("usage: server export|import [ndjson|csv] [-history] [-from T] [-to T] [-file PATH]")
 )
@@ -0,0 +1,68 @@
+package file
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Кодеки сжатия снимков.
+const (
+	CodecNone = "none" // JSON без сжатия
+	CodecGzip = "gzip" // JSON, сжатый gzip
+	CodecZstd = "zstd" // распознаётся при чтении, но не поддерживается этой сборкой
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// Функция, проверяющая имя кодека. Пустое имя соответствует CodecNone.
+func ParseCodec(name string) (string, error) {
+	switch name {
+	case "":
+		return CodecNone, nil
+	case CodecNone, CodecGzip:
+		return name, nil
+	}
+	return CodecNone, errors.ErrorSnapshotCodec
+}
+
+// Функция, сжимающая содержимое снимка кодеком codec.
+func compress(codec string, data []byte) ([]byte, error) {
+	switch codec {
+	case "", CodecNone:
+		return data, nil
+	case CodecGzip:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+	return nil, errors.ErrorSnapshotCodec
+}
+
+// Функция, распаковывающая содержимое снимка. Кодек определяется по первым байтам,
+// данные без известной сигнатуры считаются несжатым JSON.
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, gzipMagic):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	case bytes.HasPrefix(data, zstdMagic):
+		return nil, errors.ErrorSnapshotCodec
+	}
+	return data, nil
+}
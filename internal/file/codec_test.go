@@ -0,0 +1,49 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCodec(t *testing.T) {
+	for name, want := range map[string]string{"": CodecNone, "none": CodecNone, "gzip": CodecGzip} {
+		codec, err := ParseCodec(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, codec)
+	}
+	for _, name := range []string{"zstd", "lz4"} {
+		_, err := ParseCodec(name)
+		assert.ErrorIs(t, err, errors.ErrorSnapshotCodec)
+	}
+}
+
+func TestCompressedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	snapshot := &metrics.Metrics{GaugeMetrics: map[string]metrics.Gauge{"Alloc": 2.5}}
+	require.NoError(t, WriteSnapshot(path, snapshot, 3, 2, CodecNone))
+	require.NoError(t, WriteSnapshot(path, snapshot, 4, 2, CodecGzip))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, gzipMagic, data[:2])
+	restored, seq, err := ReadSnapshot(path, 2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), seq)
+	assert.Equal(t, metrics.Gauge(2.5), restored.GaugeMetrics["Alloc"])
+
+	// предыдущее поколение без сжатия читается тем же вызовом
+	require.NoError(t, os.WriteFile(path, append(append([]byte{}, gzipMagic...), "broken"...), 0o666))
+	restored, seq, err = ReadSnapshot(path, 2)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.Equal(t, metrics.Gauge(2.5), restored.GaugeMetrics["Alloc"])
+
+	_, _, err = DecodeSnapshot(append(append([]byte{}, zstdMagic...), 0, 0))
+	assert.ErrorIs(t, err, errors.ErrorSnapshotCodec)
+}
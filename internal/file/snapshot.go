@@ -0,0 +1,169 @@
+package file
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+const (
+	// Версия формата снимка, записываемая в заголовок.
+	SnapshotVersion = 1
+	// Число хранимых поколений снимка по умолчанию.
+	DefaultSnapshotGenerations = 3
+)
+
+// Заголовок снимка: первая строка файла. За ним следует тело — метрики в JSON,
+// контрольная сумма SHA-256 которого записана в Checksum.
+type SnapshotHeader struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Checksum  string    `json:"checksum"`
+	Seq       uint64    `json:"wal_seq"`
+}
+
+// Снимок прежнего формата без заголовка: метрики и номер записи журнала на верхнем уровне.
+type legacySnapshot struct {
+	*metrics.Metrics
+	Seq uint64 `json:"wal_seq,omitempty"`
+}
+
+// Функция, возвращающая путь поколения снимка: 0 — актуальный файл, далее path.1, path.2 и т.д.
+func SnapshotGeneration(path string, generation int) string {
+	if generation == 0 {
+		return path
+	}
+	return fmt.Sprintf("%s.%d", path, generation)
+}
+
+// Функция, атомарно записывающая снимок с номером последней вошедшей в него записи журнала seq,
+// сжатый кодеком codec. Снимок пишется во временный файл, сбрасывается на диск и переименовывается
+// поверх актуального; предыдущие снимки сдвигаются на поколение назад, хранится не больше generations поколений.
+func WriteSnapshot(path string, snapshot *metrics.Metrics, seq uint64, generations int, codec string) error {
+	body, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+	checksum := sha256.Sum256(body)
+	header, err := json.Marshal(&SnapshotHeader{
+		Version:   SnapshotVersion,
+		CreatedAt: time.Now().UTC(),
+		Checksum:  hex.EncodeToString(checksum[:]),
+		Seq:       seq,
+	})
+	if err != nil {
+		return err
+	}
+	data, err := compress(codec, append(append(header, '\n'), body...))
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = WriteSynced(tmp, data); err != nil {
+		return err
+	}
+	for generation := generations - 1; generation > 0; generation-- {
+		err = os.Rename(SnapshotGeneration(path, generation-1), SnapshotGeneration(path, generation))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return SyncDir(filepath.Dir(path))
+}
+
+// Функция, читающая самое новое целое поколение снимка из generations. Повреждённые поколения
+// пропускаются. Если файлов снимка нет, возвращается пустой снимок; если все они повреждены — ErrorSnapshot.
+func ReadSnapshot(path string, generations int) (*metrics.Metrics, uint64, error) {
+	if generations <= 0 {
+		generations = DefaultSnapshotGenerations
+	}
+	found := false
+	for generation := 0; generation < generations; generation++ {
+		name := SnapshotGeneration(path, generation)
+		data, err := os.ReadFile(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		found = true
+		if err != nil {
+			log.ErrorLog.Printf("Error reading snapshot %s: %e", name, err)
+			continue
+		}
+		snapshot, seq, err := DecodeSnapshot(data)
+		if err != nil {
+			log.ErrorLog.Printf("Snapshot %s is corrupt, falling back to the previous generation: %e", name, err)
+			continue
+		}
+		log.InfoLog.Printf("Snapshot restored from %s", name)
+		return snapshot, seq, nil
+	}
+	if found {
+		return nil, 0, errors.ErrorSnapshot
+	}
+	return &metrics.Metrics{}, 0, nil
+}
+
+// Функция, разбирающая содержимое файла снимка и проверяющая контрольную сумму. Сжатие определяется
+// по сигнатуре. Файлы прежнего формата без заголовка читаются без проверки; пустой файл соответствует пустому снимку.
+func DecodeSnapshot(data []byte) (*metrics.Metrics, uint64, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &metrics.Metrics{}, 0, nil
+	}
+	line, body, _ := bytes.Cut(data, []byte("\n"))
+	header := &SnapshotHeader{}
+	if err := json.Unmarshal(line, header); err != nil {
+		return nil, 0, err
+	}
+	if header.Version == 0 {
+		return decodeLegacySnapshot(data)
+	}
+	if header.Version != SnapshotVersion {
+		return nil, 0, errors.ErrorSnapshot
+	}
+	checksum := sha256.Sum256(body)
+	if hex.EncodeToString(checksum[:]) != header.Checksum {
+		return nil, 0, errors.ErrorSnapshot
+	}
+	snapshot := &metrics.Metrics{}
+	if err := json.Unmarshal(body, snapshot); err != nil {
+		return nil, 0, err
+	}
+	return snapshot, header.Seq, nil
+}
+
+// Функция, разбирающая файл прежнего формата. Прежний Writer дописывал снимки в конец файла,
+// поэтому актуален последний целый объект; оборванный хвост после него пропускается.
+func decodeLegacySnapshot(data []byte) (*metrics.Metrics, uint64, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	var latest *legacySnapshot
+	for {
+		legacy := &legacySnapshot{Metrics: &metrics.Metrics{}}
+		if err := decoder.Decode(legacy); err != nil {
+			if latest == nil {
+				return nil, 0, err
+			}
+			if err != io.EOF {
+				log.ErrorLog.Printf("Skipping incomplete legacy snapshot at the end of file: %e", err)
+			}
+			return latest.Metrics, latest.Seq, nil
+		}
+		latest = legacy
+	}
+}
@@ -0,0 +1,91 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotGenerations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	for i := 1; i <= 4; i++ {
+		snapshot := &metrics.Metrics{CounterMetrics: map[string]metrics.Counter{"PollCount": metrics.Counter(i)}}
+		require.NoError(t, WriteSnapshot(path, snapshot, uint64(i), 3, CodecNone))
+	}
+	for generation := 0; generation < 3; generation++ {
+		assert.FileExists(t, SnapshotGeneration(path, generation))
+	}
+	assert.NoFileExists(t, SnapshotGeneration(path, 3))
+	assert.NoFileExists(t, path+".tmp")
+
+	restored, seq, err := ReadSnapshot(path, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), seq)
+	assert.Equal(t, metrics.Counter(4), restored.CounterMetrics["PollCount"])
+
+	// повреждённое тело не совпадает с контрольной суммой заголовка
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(data)-3] = '9'
+	require.NoError(t, os.WriteFile(path, data, 0o666))
+	restored, seq, err = ReadSnapshot(path, 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), seq)
+	assert.Equal(t, metrics.Counter(3), restored.CounterMetrics["PollCount"])
+
+	for generation := 1; generation < 3; generation++ {
+		require.NoError(t, os.WriteFile(SnapshotGeneration(path, generation), []byte("{\"version\":1"), 0o666))
+	}
+	_, _, err = ReadSnapshot(path, 3)
+	assert.ErrorIs(t, err, errors.ErrorSnapshot)
+
+	restored, seq, err = ReadSnapshot(filepath.Join(t.TempDir(), "missing.json"), 3)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+	assert.Empty(t, restored.CounterMetrics)
+}
+
+func TestDecodeLegacySnapshot(t *testing.T) {
+	snapshot, seq, err := DecodeSnapshot([]byte(`{"GaugeMetrics":{"Alloc":1.5},"wal_seq":7}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), seq)
+	assert.Equal(t, metrics.Gauge(1.5), snapshot.GaugeMetrics["Alloc"])
+
+	snapshot, seq, err = DecodeSnapshot([]byte(`{"CounterMetrics":{"PollCount":2}}`))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+	assert.Equal(t, metrics.Counter(2), snapshot.CounterMetrics["PollCount"])
+
+	// прежний Writer дописывал каждое сохранение в конец файла
+	snapshot, seq, err = DecodeSnapshot([]byte(`{"CounterMetrics":{"PollCount":1},"wal_seq":3}` + "\n" +
+		`{"CounterMetrics":{"PollCount":5},"wal_seq":4}` + "\n" +
+		`{"CounterMetrics":{"PollCount":7}}` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), seq)
+	assert.Equal(t, metrics.Counter(7), snapshot.CounterMetrics["PollCount"])
+
+	_, _, err = DecodeSnapshot([]byte(`{"version":2,"checksum":""}` + "\n{}"))
+	assert.ErrorIs(t, err, errors.ErrorSnapshot)
+}
+
+func TestReadLegacySnapshotWithSeveralSaves(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	// так писал прежний Writer: файл открывался без O_TRUNC, и каждое сохранение дописывалось в конец
+	for i := 1; i <= 3; i++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+		require.NoError(t, err)
+		snapshot := &metrics.Metrics{CounterMetrics: map[string]metrics.Counter{"PollCount": metrics.Counter(i)}}
+		require.NoError(t, json.NewEncoder(file).Encode(snapshot))
+		require.NoError(t, file.Close())
+	}
+
+	restored, _, err := ReadSnapshot(path, 3)
+	require.NoError(t, err)
+	assert.Equal(t, metrics.Counter(3), restored.CounterMetrics["PollCount"])
+}
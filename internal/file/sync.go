@@ -0,0 +1,38 @@
+package file
+
+import (
+	"os"
+
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Функция, записывающая data в файл fileName и сбрасывающая его на диск до закрытия.
+func WriteSynced(fileName string, data []byte) error {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o666)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Функция, сбрасывающая на диск каталог, чтобы создание, переименование и удаление файлов пережили сбой.
+func SyncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.ErrorLog.Printf("Error closing directory %s: %e", dir, err)
+		}
+	}()
+	return file.Sync()
+}
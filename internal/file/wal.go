@@ -0,0 +1,126 @@
+package file
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Запись журнала: порядковый номер и пакет обновлений в том виде, в котором он был применён,
+// либо объявленное описание метрики в итоговом виде.
+type Record struct {
+	Seq      uint64                 `json:"seq"`
+	Metrics  []*metrics.JSONMetrics `json:"metrics,omitempty"`
+	Metadata *metrics.Metadata      `json:"metadata,omitempty"`
+}
+
+// Журнал предзаписи: обновления дописываются в конец файла по одной JSON-записи на строку.
+// Записи попадают в файл сразу, на диск они сбрасываются вызовом Sync.
+type WAL struct {
+	file    *os.File
+	encoder *json.Encoder
+	seq     uint64
+	records int
+}
+
+// Функция, открывающая журнал на дозапись. Номера новых записей продолжают seq.
+func OpenWAL(fileName string, seq uint64) (*WAL, error) {
+	file, err := os.OpenFile(fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	return &WAL{
+		file:    file,
+		encoder: json.NewEncoder(file),
+		seq:     seq,
+	}, nil
+}
+
+// Метод, дописывающий пакет обновлений в журнал. Возвращает номер записи.
+func (w *WAL) Append(batch []*metrics.JSONMetrics) (uint64, error) {
+	return w.append(&Record{Metrics: batch})
+}
+
+// Метод, дописывающий в журнал описание метрики. Возвращает номер записи.
+func (w *WAL) AppendMetadata(meta *metrics.Metadata) (uint64, error) {
+	return w.append(&Record{Metadata: meta})
+}
+
+func (w *WAL) append(record *Record) (uint64, error) {
+	record.Seq = w.seq + 1
+	if err := w.encoder.Encode(record); err != nil {
+		return 0, err
+	}
+	w.seq = record.Seq
+	w.records++
+	return record.Seq, nil
+}
+
+// Метод, сбрасывающий дописанные записи на диск.
+func (w *WAL) Sync() error {
+	return w.file.Sync()
+}
+
+// Метод, очищающий журнал после того, как его записи вошли в снимок. Нумерация записей продолжается.
+func (w *WAL) Reset() error {
+	if err := w.file.Truncate(0); err != nil {
+		return err
+	}
+	w.records = 0
+	return w.file.Sync()
+}
+
+// Номер последней записи журнала.
+func (w *WAL) Seq() uint64 {
+	return w.seq
+}
+
+// Число записей, дописанных с момента открытия или очистки журнала.
+func (w *WAL) Records() int {
+	return w.records
+}
+
+func (w *WAL) Close() error {
+	if err := w.file.Sync(); err != nil {
+		return err
+	}
+	return w.file.Close()
+}
+
+// Функция, передающая в apply записи журнала с номером больше after в порядке записи.
+// Отсутствующий журнал считается пустым. Недописанная при сбое последняя запись и всё после неё
+// пропускаются. Возвращает номер последней прочитанной записи.
+func ReplayWAL(fileName string, after uint64, apply func(record *Record)) (uint64, error) {
+	file, err := os.Open(fileName)
+	if os.IsNotExist(err) {
+		return after, nil
+	}
+	if err != nil {
+		return after, err
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			log.ErrorLog.Printf("Error closing WAL after replay: %e", err)
+		}
+	}()
+	last := after
+	decoder := json.NewDecoder(file)
+	for {
+		record := &Record{}
+		if err = decoder.Decode(record); err == io.EOF {
+			return last, nil
+		}
+		if err != nil {
+			log.ErrorLog.Printf("WAL is truncated after record %d: %e", last, err)
+			return last, nil
+		}
+		if record.Seq <= last {
+			continue
+		}
+		apply(record)
+		last = record.Seq
+	}
+}
@@ -0,0 +1,68 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWALReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	delta := int64(1)
+	wal, err := OpenWAL(path, 0)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		seq, err := wal.Append([]*metrics.JSONMetrics{{ID: "PollCount", MType: "counter", Delta: &delta}})
+		require.NoError(t, err)
+		assert.Equal(t, uint64(i+1), seq)
+	}
+	require.NoError(t, wal.Close())
+
+	// запись, оборванная сбоем посреди строки
+	broken, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o666)
+	require.NoError(t, err)
+	_, err = broken.WriteString(`{"seq":4,"metrics":[{"id":"Poll`)
+	require.NoError(t, err)
+	require.NoError(t, broken.Close())
+
+	replayed := make([]uint64, 0)
+	last, err := ReplayWAL(path, 1, func(record *Record) {
+		replayed = append(replayed, record.Seq)
+		assert.Equal(t, "PollCount", record.Metrics[0].ID)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), last)
+	assert.Equal(t, []uint64{2, 3}, replayed)
+
+	last, err = ReplayWAL(filepath.Join(t.TempDir(), "missing.wal"), 7, func(record *Record) {
+		t.Fatal("missing WAL has no records")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(7), last)
+}
+
+func TestWALReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "metrics.json.wal")
+	value := 1.0
+	wal, err := OpenWAL(path, 10)
+	require.NoError(t, err)
+	_, err = wal.Append([]*metrics.JSONMetrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	require.NoError(t, err)
+	assert.Equal(t, 1, wal.Records())
+	require.NoError(t, wal.Reset())
+	assert.Equal(t, 0, wal.Records())
+
+	seq, err := wal.Append([]*metrics.JSONMetrics{{ID: "Alloc", MType: "gauge", Value: &value}})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(12), seq)
+	require.NoError(t, wal.Close())
+
+	replayed := 0
+	_, err = ReplayWAL(path, 0, func(record *Record) { replayed++ })
+	require.NoError(t, err)
+	assert.Equal(t, 1, replayed)
+}
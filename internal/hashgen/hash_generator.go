@@ -20,6 +20,12 @@ func (gen *HashGenerator) GenerateHash(metricType, id string, value interface{})
 		hashString = fmt.Sprintf("%s:gauge:%f", id, value)
 	case "counter":
 		hashString = fmt.Sprintf("%s:counter:%d", id, value)
+	case "histogram":
+		hashString = fmt.Sprintf("%s:histogram:%s", id, value)
+	case "summary":
+		hashString = fmt.Sprintf("%s:summary:%s", id, value)
+	case "set":
+		hashString = fmt.Sprintf("%s:set:%s", id, value)
 	}
 	h := hmac.New(sha256.New, []byte(gen.secretkey))
 	h.Write([]byte(hashString))
@@ -0,0 +1,184 @@
+// Пакет influx разбирает строки протокола InfluxDB line protocol в метрики gowatcher.
+package influx
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Имя поля, значение которого записывается в метрику с именем измерения без суффикса.
+const ValueField = "value"
+
+// Функция, возвращающая делитель, приводящий время с точностью precision к миллисекундам,
+// или множитель для точности грубее миллисекунды. По умолчанию время задано в наносекундах.
+func precisionScale(precision string) (div, mul int64, err error) {
+	switch precision {
+	case "", "n", "ns":
+		return 1000000, 1, nil
+	case "u", "us":
+		return 1000, 1, nil
+	case "ms":
+		return 1, 1, nil
+	case "s":
+		return 1, 1000, nil
+	}
+	return 0, 0, errors.ErrorInfluxPrecision
+}
+
+// Функция, разбирающая строки line protocol вида measurement[,tag=value...] field=value[,...] [timestamp].
+// Поля с плавающей точкой становятся gauge, целые с суффиксом i или u — counter, в Delta которого
+// записан итог, а не приращение: Telegraf передаёт в целых полях накопленные значения. Строковые
+// и логические поля пропускаются. Метрика называется measurement_field,
+// а для поля value — именем измерения; теги становятся метками. При ошибке в любой строке
+// возвращается ошибка с её номером, чтобы пакет не записывался частично.
+func ParseLines(data []byte, precision string) ([]*metrics.JSONMetrics, error) {
+	div, mul, err := precisionScale(precision)
+	if err != nil {
+		return nil, err
+	}
+	batch := make([]*metrics.JSONMetrics, 0)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 4096), len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		points, err := parseLine(line, div, mul)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d", err, n)
+		}
+		batch = append(batch, points...)
+	}
+	return batch, scanner.Err()
+}
+
+func parseLine(line string, div, mul int64) ([]*metrics.JSONMetrics, error) {
+	sections := split(line, ' ', true)
+	if len(sections) < 2 || len(sections) > 3 {
+		return nil, errors.ErrorInfluxLine
+	}
+	keys := split(sections[0], ',', false)
+	measurement := unescape(keys[0])
+	if measurement == "" {
+		return nil, errors.ErrorInfluxLine
+	}
+	var labels map[string]string
+	for _, tag := range keys[1:] {
+		name, value, ok := cutUnescaped(tag, '=')
+		if !ok || name == "" || value == "" {
+			return nil, errors.ErrorInfluxLine
+		}
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		labels[unescape(name)] = unescape(value)
+	}
+	var timestamp *int64
+	if len(sections) == 3 {
+		ts, err := strconv.ParseInt(sections[2], 10, 64)
+		if err != nil {
+			return nil, errors.ErrorInfluxLine
+		}
+		ms := ts / div * mul
+		timestamp = &ms
+	}
+	points := make([]*metrics.JSONMetrics, 0)
+	for _, field := range split(sections[1], ',', true) {
+		name, value, ok := cutUnescaped(field, '=')
+		if !ok || name == "" || value == "" {
+			return nil, errors.ErrorInfluxLine
+		}
+		metric, err := parseField(value)
+		if err != nil {
+			return nil, err
+		}
+		if metric == nil {
+			continue
+		}
+		metric.ID = measurement + "_" + unescape(name)
+		if unescape(name) == ValueField {
+			metric.ID = measurement
+		}
+		metric.Labels, metric.Timestamp = labels, timestamp
+		points = append(points, metric)
+	}
+	return points, nil
+}
+
+// Функция, разбирающая значение поля. Для строковых и логических значений возвращается nil.
+func parseField(value string) (*metrics.JSONMetrics, error) {
+	switch {
+	case strings.HasPrefix(value, `"`):
+		if len(value) < 2 || !strings.HasSuffix(value, `"`) {
+			return nil, errors.ErrorInfluxLine
+		}
+		return nil, nil
+	case strings.HasSuffix(value, "i"):
+		total, err := strconv.ParseInt(strings.TrimSuffix(value, "i"), 10, 64)
+		if err != nil {
+			return nil, errors.ErrorInfluxLine
+		}
+		return &metrics.JSONMetrics{MType: "counter", Delta: &total}, nil
+	case strings.HasSuffix(value, "u"):
+		unsigned, err := strconv.ParseUint(strings.TrimSuffix(value, "u"), 10, 63)
+		if err != nil {
+			return nil, errors.ErrorInfluxLine
+		}
+		total := int64(unsigned)
+		return &metrics.JSONMetrics{MType: "counter", Delta: &total}, nil
+	}
+	switch value {
+	case "t", "T", "true", "True", "TRUE", "f", "F", "false", "False", "FALSE":
+		return nil, nil
+	}
+	gauge, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.ErrorInfluxLine
+	}
+	return &metrics.JSONMetrics{MType: "gauge", Value: &gauge}, nil
+}
+
+// Функция, разбивающая строку по sep, не учитывая экранированные обратной косой чертой
+// разделители и, если quoted, разделители внутри строк в двойных кавычках.
+func split(s string, sep byte, quoted bool) []string {
+	parts := make([]string, 0)
+	start, inQuotes := 0, false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quoted && s[i] == '"':
+			inQuotes = !inQuotes
+		case s[i] == sep && !inQuotes:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// Функция, разделяющая строку по первому неэкранированному sep.
+func cutUnescaped(s string, sep byte) (string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case sep:
+			return s[:i], s[i+1:], true
+		}
+	}
+	return s, "", false
+}
+
+var unescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=", `\\`, `\`)
+
+func unescape(s string) string {
+	return unescaper.Replace(s)
+}
@@ -0,0 +1,43 @@
+package influx
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestParseLines(t *testing.T) {
+	data := []byte(`# comment
+cpu,host=server\ 1,region=eu usage_idle=92.5,usage_user=3i,state="running, ok",up=true 1700000000000000000
+
+disk\,fs value=0.5,reads=7u
+`)
+	batch, err := ParseLines(data, "")
+	require.NoError(t, err)
+	idle, user, disk, reads := 92.5, int64(3), 0.5, int64(7)
+	ts := int64(1700000000000)
+	labels := map[string]string{"host": "server 1", "region": "eu"}
+	assert.Equal(t, []*metrics.JSONMetrics{
+		{ID: "cpu_usage_idle", MType: "gauge", Value: &idle, Labels: labels, Timestamp: &ts},
+		{ID: "cpu_usage_user", MType: "counter", Delta: &user, Labels: labels, Timestamp: &ts},
+		{ID: "disk,fs", MType: "gauge", Value: &disk},
+		{ID: "disk,fs_reads", MType: "counter", Delta: &reads},
+	}, batch)
+
+	batch, err = ParseLines([]byte("mem free=1 1700000000"), "s")
+	require.NoError(t, err)
+	assert.Equal(t, ts, *batch[0].Timestamp)
+}
+
+func TestParseLinesErrors(t *testing.T) {
+	for _, line := range []string{"cpu", "cpu usage=", "cpu,host usage=1", "cpu usage=abc", "cpu usage=1 now", "cpu s=\"x"} {
+		_, err := ParseLines([]byte(line), "")
+		assert.ErrorIs(t, err, errors.ErrorInfluxLine, line)
+	}
+	_, err := ParseLines([]byte("cpu usage=1"), "h")
+	assert.ErrorIs(t, err, errors.ErrorInfluxPrecision)
+}
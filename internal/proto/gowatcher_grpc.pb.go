@@ -19,8 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	Metrics_AddMetric_FullMethodName = "/gowatcher.Metrics/AddMetric"
-	Metrics_GetMetric_FullMethodName = "/gowatcher.Metrics/GetMetric"
+	Metrics_AddMetric_FullMethodName       = "/gowatcher.Metrics/AddMetric"
+	Metrics_GetMetric_FullMethodName       = "/gowatcher.Metrics/GetMetric"
+	Metrics_DeclareMetadata_FullMethodName = "/gowatcher.Metrics/DeclareMetadata"
+	Metrics_History_FullMethodName         = "/gowatcher.Metrics/History"
 )
 
 // MetricsClient is the client API for Metrics service.
@@ -29,6 +31,8 @@ const (
 type MetricsClient interface {
 	AddMetric(ctx context.Context, in *AddMetricRequest, opts ...grpc.CallOption) (*AddMetricResponse, error)
 	GetMetric(ctx context.Context, in *GetMetricRequest, opts ...grpc.CallOption) (*GetMetricResponse, error)
+	DeclareMetadata(ctx context.Context, in *DeclareMetadataRequest, opts ...grpc.CallOption) (*DeclareMetadataResponse, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error)
 }
 
 type metricsClient struct {
@@ -57,12 +61,32 @@ func (c *metricsClient) GetMetric(ctx context.Context, in *GetMetricRequest, opt
 	return out, nil
 }
 
+func (c *metricsClient) DeclareMetadata(ctx context.Context, in *DeclareMetadataRequest, opts ...grpc.CallOption) (*DeclareMetadataResponse, error) {
+	out := new(DeclareMetadataResponse)
+	err := c.cc.Invoke(ctx, Metrics_DeclareMetadata_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsClient) History(ctx context.Context, in *HistoryRequest, opts ...grpc.CallOption) (*HistoryResponse, error) {
+	out := new(HistoryResponse)
+	err := c.cc.Invoke(ctx, Metrics_History_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // MetricsServer is the server API for Metrics service.
 // All implementations must embed UnimplementedMetricsServer
 // for forward compatibility
 type MetricsServer interface {
 	AddMetric(context.Context, *AddMetricRequest) (*AddMetricResponse, error)
 	GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error)
+	DeclareMetadata(context.Context, *DeclareMetadataRequest) (*DeclareMetadataResponse, error)
+	History(context.Context, *HistoryRequest) (*HistoryResponse, error)
 	mustEmbedUnimplementedMetricsServer()
 }
 
@@ -76,6 +100,12 @@ func (UnimplementedMetricsServer) AddMetric(context.Context, *AddMetricRequest)
 func (UnimplementedMetricsServer) GetMetric(context.Context, *GetMetricRequest) (*GetMetricResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetMetric not implemented")
 }
+func (UnimplementedMetricsServer) DeclareMetadata(context.Context, *DeclareMetadataRequest) (*DeclareMetadataResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeclareMetadata not implemented")
+}
+func (UnimplementedMetricsServer) History(context.Context, *HistoryRequest) (*HistoryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method History not implemented")
+}
 func (UnimplementedMetricsServer) mustEmbedUnimplementedMetricsServer() {}
 
 // UnsafeMetricsServer may be embedded to opt out of forward compatibility for this service.
@@ -125,6 +155,42 @@ func _Metrics_GetMetric_Handler(srv interface{}, ctx context.Context, dec func(i
 	return interceptor(ctx, in, info, handler)
 }
 
+func _Metrics_DeclareMetadata_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeclareMetadataRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).DeclareMetadata(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_DeclareMetadata_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).DeclareMetadata(ctx, req.(*DeclareMetadataRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Metrics_History_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(HistoryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServer).History(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Metrics_History_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServer).History(ctx, req.(*HistoryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // Metrics_ServiceDesc is the grpc.ServiceDesc for Metrics service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -140,6 +206,14 @@ var Metrics_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetMetric",
 			Handler:    _Metrics_GetMetric_Handler,
 		},
+		{
+			MethodName: "DeclareMetadata",
+			Handler:    _Metrics_DeclareMetadata_Handler,
+		},
+		{
+			MethodName: "History",
+			Handler:    _Metrics_History_Handler,
+		},
 	},
 	Streams:  []grpc.StreamDesc{},
 	Metadata: "internal/proto/gowatcher.proto",
@@ -3,12 +3,16 @@ package server
 import (
 	"context"
 	"fmt"
+	"time"
 
 	// импортируем пакет со сгенерированными protobuf-файлами
 	"github.com/nmramorov/gowatcher/internal/api/handlers"
+	col "github.com/nmramorov/gowatcher/internal/collector"
 	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
 	"github.com/nmramorov/gowatcher/internal/log"
 	pb "github.com/nmramorov/gowatcher/internal/proto"
+	"github.com/nmramorov/gowatcher/internal/storage"
 )
 
 // MetricsServer поддерживает все необходимые методы сервера.
@@ -17,64 +21,223 @@ type MetricsServer struct {
 	// для совместимости с будущими версиями
 	pb.UnimplementedMetricsServer
 
-	h handlers.Handler
+	storage   storage.Storage
+	collector *col.Collector
+}
+
+// Конструктор gRPC-сервера, работающего с тем же хранилищем и реестром описаний, что и HTTP-обработчик.
+func NewMetricsServer(store storage.Storage, collector *col.Collector) *MetricsServer {
+	return &MetricsServer{storage: store, collector: collector}
+}
+
+// Функция, преобразующая метрику из protobuf в JSONMetrics.
+func metricFromProto(in *pb.Metric) *m.JSONMetrics {
+	metric := &m.JSONMetrics{
+		ID:     in.GetId(),
+		MType:  in.GetMtype(),
+		Hash:   in.GetHash(),
+		Labels: in.GetLabels(),
+		Window: in.GetWindow(),
+	}
+	if ts := in.GetTimestamp(); ts != 0 {
+		metric.Timestamp = &ts
+	}
+	switch metric.MType {
+	case handlers.GAUGE:
+		value := in.GetValue()
+		metric.Value = &value
+	case handlers.COUNTER:
+		delta := in.GetDelta()
+		metric.Delta = &delta
+	case handlers.HISTOGRAM:
+		if h := in.GetHistogram(); h != nil {
+			metric.Histogram = &m.Histogram{
+				Bounds: h.GetBounds(),
+				Counts: h.GetCounts(),
+				Count:  h.GetCount(),
+				Sum:    h.GetSum(),
+			}
+		}
+	case handlers.SUMMARY:
+		metric.Samples = in.GetSamples()
+		if sm := in.GetSummary(); sm != nil {
+			metric.Summary = &m.Summary{
+				RelativeAccuracy: sm.GetRelativeAccuracy(),
+				Positive:         sm.GetPositive(),
+				Negative:         sm.GetNegative(),
+				Zero:             sm.GetZero(),
+				Count:            sm.GetCount(),
+				Sum:              sm.GetSum(),
+				Min:              sm.GetMin(),
+				Max:              sm.GetMax(),
+			}
+		}
+	case handlers.SET:
+		metric.Members = in.GetMembers()
+		if set := in.GetSet(); set != nil {
+			metric.Set = &m.Set{
+				Precision: uint8(set.GetPrecision()),
+				Registers: set.GetRegisters(),
+			}
+		}
+	}
+	for _, q := range in.GetQuantiles() {
+		metric.Quantiles = append(metric.Quantiles, m.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+	}
+	return metric
+}
+
+// Функция, преобразующая JSONMetrics в метрику protobuf.
+func metricToProto(metric *m.JSONMetrics) *pb.Metric {
+	out := &pb.Metric{
+		Id:     metric.ID,
+		Mtype:  metric.MType,
+		Hash:   metric.Hash,
+		Labels: metric.Labels,
+		Window: metric.Window,
+	}
+	if metric.Delta != nil {
+		out.Delta = *metric.Delta
+	}
+	if metric.Value != nil {
+		out.Value = *metric.Value
+	}
+	if metric.Histogram != nil {
+		out.Histogram = &pb.Histogram{
+			Bounds: metric.Histogram.Bounds,
+			Counts: metric.Histogram.Counts,
+			Count:  metric.Histogram.Count,
+			Sum:    metric.Histogram.Sum,
+		}
+	}
+	if metric.Summary != nil {
+		out.Summary = &pb.Summary{
+			RelativeAccuracy: metric.Summary.RelativeAccuracy,
+			Positive:         metric.Summary.Positive,
+			Negative:         metric.Summary.Negative,
+			Zero:             metric.Summary.Zero,
+			Count:            metric.Summary.Count,
+			Sum:              metric.Summary.Sum,
+			Min:              metric.Summary.Min,
+			Max:              metric.Summary.Max,
+		}
+	}
+	if metric.Set != nil {
+		out.Set = &pb.Set{
+			Precision: uint32(metric.Set.Precision),
+			Registers: metric.Set.Registers,
+		}
+	}
+	if metric.Estimate != nil {
+		out.Estimate = *metric.Estimate
+	}
+	if metric.Rate != nil {
+		out.Rate = *metric.Rate
+	}
+	if metric.Increase != nil {
+		out.Increase = *metric.Increase
+	}
+	for _, q := range metric.Quantiles {
+		out.Quantiles = append(out.Quantiles, &pb.Quantile{Quantile: q.Quantile, Value: q.Value})
+	}
+	if metric.Timestamp != nil {
+		out.Timestamp = *metric.Timestamp
+	}
+	return out
 }
 
 // AddMetric реализует интерфейс добавления метрики.
 func (s *MetricsServer) AddMetric(ctx context.Context, in *pb.AddMetricRequest) (*pb.AddMetricResponse, error) {
 	var response pb.AddMetricResponse
-	metricToAdd := m.JSONMetrics{
-		ID:    in.Metric.Id,
-		MType: in.Metric.Mtype,
-		Delta: &in.Metric.Delta,
-		Value: &in.Metric.Value,
-		Hash:  in.Metric.Hash,
-	}
-	updatedData, err := s.h.Collector.UpdateMetricFromJSON(&metricToAdd)
+	metricToAdd := metricFromProto(in.GetMetric())
+	_, err := s.storage.Update(ctx, metricToAdd)
 	if err != nil {
 		log.ErrorLog.Printf("Error occurred during metric update from json: %e", err)
 		response.Error = fmt.Sprintf("Error occurred during metric update from json: %e", err)
 	}
-	if s.h.Cursor.IsValid {
-		err = s.h.Cursor.Add(ctx, updatedData)
-		if err != nil {
-			log.ErrorLog.Printf("could not add data to db for metric %s: %e", metricToAdd.ID, err)
-			response.Error = fmt.Sprintf("could not add data to db for metric %s: %e", metricToAdd.ID, err)
-		}
-	}
 	return &response, nil
 }
 
 // GetMetric реализует интерфейс получения метрики.
 func (s *MetricsServer) GetMetric(ctx context.Context, in *pb.GetMetricRequest) (*pb.GetMetricResponse, error) {
 	var response pb.GetMetricResponse
+	requested := metricFromProto(in.GetMetric())
 	metricToAdd := m.JSONMetrics{
-		ID:    in.Metric.Id,
-		MType: in.Metric.Mtype,
-	}
-	var metric *m.JSONMetrics
-	var err error
-	if s.h.Cursor.IsValid {
-		metric, err = s.h.Cursor.Get(ctx, &metricToAdd)
-		if err != nil {
-			log.ErrorLog.Printf("could not get data from db for metric %s: %e", metricToAdd.ID, err)
-			response.Error = fmt.Sprintf("could not get data from db for metric %s: %e", metricToAdd.ID, err)
-		}
+		ID:        requested.ID,
+		MType:     requested.MType,
+		Labels:    requested.Labels,
+		Quantiles: requested.Quantiles,
+		Window:    requested.Window,
 	}
-	if metric == nil {
-		metric, err = s.h.Collector.GetMetricJSON(&metricToAdd)
-		if err != nil {
-			log.ErrorLog.Printf("Error occurred during metric getting from json: %e", err)
-			response.Error = fmt.Sprintf("Error occurred during metric getting from json: %e", err)
-		}
+	metric, err := s.storage.Get(ctx, &metricToAdd)
+	if err != nil {
+		log.ErrorLog.Printf("Error occurred during metric getting from json: %e", err)
+		response.Error = fmt.Sprintf("Error occurred during metric getting from json: %e", err)
 	}
-	response.Metric = &pb.Metric{
-		Id:    metric.ID,
-		Mtype: metric.MType,
-		Delta: *metric.Delta,
-		Value: *metric.Value,
-		Hash:  metric.Hash,
+	response.Metric = metricToProto(metric)
+
+	return &response, nil
+}
+
+// DeclareMetadata реализует интерфейс регистрации описания метрики.
+func (s *MetricsServer) DeclareMetadata(
+	ctx context.Context, in *pb.DeclareMetadataRequest,
+) (*pb.DeclareMetadataResponse, error) {
+	var response pb.DeclareMetadataResponse
+	meta := in.GetMetadata()
+	stored, err := s.storage.DeclareMetadata(ctx, &m.Metadata{
+		Name:  meta.GetId(),
+		MType: meta.GetMtype(),
+		Unit:  meta.GetUnit(),
+		Help:  meta.GetHelp(),
+		Owner: meta.GetOwner(),
+	})
+	if err != nil {
+		log.ErrorLog.Printf("could not declare metadata for %s: %e", meta.GetId(), err)
+		response.Error = fmt.Sprintf("could not declare metadata for %s: %v", meta.GetId(), err)
+		return &response, nil
 	}
+	response.Metadata = &pb.Metadata{
+		Id:    stored.Name,
+		Mtype: stored.MType,
+		Unit:  stored.Unit,
+		Help:  stored.Help,
+		Owner: stored.Owner,
+	}
+	return &response, nil
+}
 
+// History реализует интерфейс получения истории серии gauge или counter.
+func (s *MetricsServer) History(ctx context.Context, in *pb.HistoryRequest) (*pb.HistoryResponse, error) {
+	var response pb.HistoryResponse
+	requested := metricFromProto(in.GetMetric())
+	metric := &m.JSONMetrics{ID: requested.ID, MType: requested.MType, Labels: requested.Labels}
+	from, to := time.UnixMilli(in.GetFrom()), time.UnixMilli(in.GetTo())
+	step := time.Duration(in.GetStep()) * time.Millisecond
+	if err := m.ValidateHistoryRange(from, to, step); err != nil {
+		response.Error = err.Error()
+		return &response, nil
+	}
+	reader, ok := s.storage.(storage.HistoryReader)
+	if !ok {
+		response.Error = errors.ErrorHistoryUnavailable.Error()
+		return &response, nil
+	}
+	points, err := reader.History(ctx, metric, from, to, step)
+	if err != nil {
+		log.ErrorLog.Printf("could not read history of %s: %e", metric.ID, err)
+		response.Error = fmt.Sprintf("could not read history of %s: %v", metric.ID, err)
+		return &response, nil
+	}
+	for _, point := range points {
+		response.Points = append(response.Points, &pb.Point{
+			Timestamp: point.Timestamp,
+			Avg:       point.Avg,
+			Min:       point.Min,
+			Max:       point.Max,
+			Last:      point.Last,
+			Count:     point.Count,
+		})
+	}
 	return &response, nil
 }
@@ -0,0 +1,92 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/db"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+	"github.com/nmramorov/gowatcher/internal/storage"
+)
+
+// Функция, разбирающая аргументы команды migrate: действие up, down или status, число откатываемых
+// миграций для down (по умолчанию одна) и оставшиеся флаги конфигурации сервера.
+func ParseMigrateArgs(args []string) (string, int, []string, error) {
+	action, steps := "up", 1
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		action, args = args[0], args[1:]
+	}
+	switch action {
+	case "up", "status":
+	case "down":
+		if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n <= 0 {
+				return "", 0, nil, errors.ErrorMigrateUsage
+			}
+			steps, args = n, args[1:]
+		}
+	default:
+		return "", 0, nil, errors.ErrorMigrateUsage
+	}
+	return action, steps, args, nil
+}
+
+// Migrate выполняет команду migrate над БД из конфигурации сервера и печатает результат в out.
+func Migrate(ctx context.Context, action string, steps int, out io.Writer) error {
+	serverConfig, err := config.GetServerConfig()
+	if err != nil {
+		log.ErrorLog.Printf("could not get server config: %e", err)
+		return err
+	}
+	if serverConfig.Database == "" {
+		return errors.ErrorMigrateUsage
+	}
+	cursor, err := db.NewCursor(ctx, serverConfig.Database, storage.Adaptor(serverConfig.Database))
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := cursor.CloseConnection(ctx); err != nil {
+			log.ErrorLog.Printf("error closing db: %e", err)
+		}
+	}()
+	if !cursor.IsValid {
+		return errors.ErrorDB
+	}
+	switch action {
+	case "status":
+		states, err := cursor.MigrationStatus(ctx)
+		if err != nil {
+			return err
+		}
+		for _, state := range states {
+			mark := "pending"
+			if state.Applied {
+				mark = "applied"
+			}
+			fmt.Fprintf(out, "%04d_%s\t%s\n", state.Version, state.Name, mark)
+		}
+		return nil
+	case "down":
+		done, err := cursor.MigrateDown(ctx, steps)
+		for _, version := range done {
+			fmt.Fprintf(out, "rolled back %04d\n", version)
+		}
+		return err
+	default:
+		done, err := cursor.Migrate(ctx)
+		for _, version := range done {
+			fmt.Fprintf(out, "applied %04d\n", version)
+		}
+		if err == nil && len(done) == 0 {
+			fmt.Fprintln(out, "schema is up to date")
+		}
+		return err
+	}
+}
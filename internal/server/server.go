@@ -6,7 +6,6 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
-	"path/filepath"
 	"strings"
 	"sync"
 	"syscall"
@@ -15,83 +14,52 @@ import (
 	"google.golang.org/grpc"
 
 	"github.com/nmramorov/gowatcher/internal/api/handlers"
+	col "github.com/nmramorov/gowatcher/internal/collector"
 	"github.com/nmramorov/gowatcher/internal/config"
-	"github.com/nmramorov/gowatcher/internal/db"
-	"github.com/nmramorov/gowatcher/internal/file"
 	"github.com/nmramorov/gowatcher/internal/log"
 	pb "github.com/nmramorov/gowatcher/internal/proto"
+	"github.com/nmramorov/gowatcher/internal/statsd"
+	"github.com/nmramorov/gowatcher/internal/storage"
 )
 
+// Функция, создающая коллектор с настроенными политиками, выбранное хранилище и обработчик поверх них.
 func GetMetricsHandler(parent context.Context, options *config.ServerConfig) (*handlers.Handler, error) {
-	ctx, cancel := context.WithCancel(parent)
-	defer cancel()
-
-	cursor, err := db.NewCursor(ctx, options.Database, "pgx")
+	collector := col.NewCollector()
+	policy, err := col.NewOutOfOrderPolicy(options.OutOfOrder,
+		time.Duration(options.OutOfOrderWindow)*time.Second)
 	if err != nil {
-		cursor.IsValid = false
+		log.ErrorLog.Printf("could not apply out-of-order policy %s: %e", options.OutOfOrder, err)
+		return nil, err
 	}
-	path, err := filepath.Abs(".")
+	collector.OutOfOrder = policy
+	collector.Staleness = col.Staleness{
+		StaleAfter: time.Duration(options.StaleTTL) * time.Second,
+		EvictAfter: time.Duration(options.EvictTTL) * time.Second,
+	}
+	store, err := storage.New(parent, options, collector)
 	if err != nil {
-		log.ErrorLog.Printf("no file to save exist: %e", err)
+		log.ErrorLog.Printf("could not open storage: %e", err)
 		return nil, err
 	}
-	if options.Restore {
-		log.InfoLog.Println("Restoring configuration from file...")
-		reader, err := file.NewReader(path + options.StoreFile)
-		defer func() {
-			err = reader.Close()
-			if err != nil {
-				log.ErrorLog.Printf("Error closing file during read operation: %e", err)
-			}
-		}()
-		if err != nil {
-			log.ErrorLog.Printf("Error happened creating File Reader: %e", err)
-			return nil, err
-		}
-		storedMetrics, err := reader.ReadJSON()
-		if err != nil {
-			log.ErrorLog.Printf("Error happened during JSON reading: %e", err)
-			return handlers.NewHandler(options.Key, options.PrivateKeyPath,
-				options.TrustedSubnet, cursor), nil
-		}
-		metricsHandler := handlers.NewHandlerFromSavedData(storedMetrics, options.Key,
-			options.PrivateKeyPath, options.TrustedSubnet, cursor)
-		log.InfoLog.Println("Configuration restored.")
-		return metricsHandler, nil
-	}
-	return handlers.NewHandler(options.Key, options.PrivateKeyPath, options.TrustedSubnet, cursor), nil
+	return handlers.NewHandler(options.Key, options.PrivateKeyPath, options.TrustedSubnet, collector, store), nil
 }
 
-func StartSavingToDisk(killSig chan struct{}, options *config.ServerConfig, handler *handlers.Handler) error {
-	path, err := filepath.Abs(".")
-	if err != nil {
-		log.ErrorLog.Printf("no file to save exist: %e", err)
-		return err
+// StartEvicting периодически удаляет серии, не обновлявшиеся дольше EvictTTL.
+func StartEvicting(killSig chan struct{}, options *config.ServerConfig, handler *handlers.Handler) {
+	period := time.Duration(options.EvictTTL) * time.Second
+	if period > time.Minute {
+		period = time.Minute
 	}
-	writer, err := file.NewWriter(path + options.StoreFile)
-	defer func() {
-		err = writer.Close()
-		if err != nil {
-			log.ErrorLog.Printf("Error closing file during write operation: %e", err)
-		}
-	}()
-	if err != nil {
-		log.ErrorLog.Printf("Error with file writer: %e", err)
-		return err
-	}
-	ticker := time.NewTicker(time.Duration(options.StoreInterval) * time.Second)
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
 
 	for {
 		select {
 		case <-killSig:
-			log.InfoLog.Println("Stop saving file")
-			return nil
+			log.InfoLog.Println("Stop evicting stale series")
+			return
 		case <-ticker.C:
-			err := writer.WriteJSON(handler.GetCurrentMetrics())
-			if err != nil {
-				log.ErrorLog.Printf("Error happened during saving metrics to JSON: %e", err)
-			}
-			log.InfoLog.Println("Metrics successfully saved to file")
+			handler.EvictStale(time.Now())
 		}
 	}
 }
@@ -109,7 +77,7 @@ func (s *Server) Run(parent context.Context) error {
 	// поскольку нужно отловить всего одно прерывание,
 	// ёмкости 1 для канала будет достаточно
 	sigint := make(chan os.Signal, 1)
-	killFileSave := make(chan struct{}, 1)
+	killWorkers := make(chan struct{}, 1)
 	// регистрируем перенаправление прерываний
 	signal.Notify(sigint, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
 
@@ -125,24 +93,34 @@ func (s *Server) Run(parent context.Context) error {
 		log.ErrorLog.Printf("could not get metrics handler: %e", err)
 		return err
 	}
+	defer func() {
+		if err := metricsHandler.Storage.Close(ctx); err != nil {
+			log.ErrorLog.Printf("error closing storage: %e", err)
+		}
+	}()
 
-	if serverConfig.Database != "" {
-		err = metricsHandler.InitDB(ctx)
+	if serverConfig.StatsDAddress != "" {
+		listener, err := statsd.Listen(serverConfig.StatsDAddress, metricsHandler.Storage,
+			time.Duration(serverConfig.StatsDFlushInterval)*time.Second)
 		if err != nil {
-			log.ErrorLog.Printf("error initializing db: %e", err)
+			log.ErrorLog.Printf("could not start statsd listener: %e", err)
 			return err
 		}
+		// приём останавливается и агрегаты сбрасываются до закрытия хранилища
+		defer func() {
+			if err := listener.Close(ctx); err != nil {
+				log.ErrorLog.Printf("error closing statsd listener: %e", err)
+			}
+		}()
 	}
-	if serverConfig.StoreFile != "" {
+
+	if serverConfig.EvictTTL > 0 {
 		wg.Add(1)
 		go func() {
-			err = StartSavingToDisk(killFileSave, serverConfig, metricsHandler)
-			if err != nil {
-				log.ErrorLog.Printf("error starting saving file to disk: %e", err)
-			}
+			StartEvicting(killWorkers, serverConfig, metricsHandler)
 			wg.Done()
 		}()
-		log.InfoLog.Println("Initialized file saving")
+		log.InfoLog.Println("Initialized stale series eviction")
 	}
 
 	server := &http.Server{
@@ -162,8 +140,8 @@ func (s *Server) Run(parent context.Context) error {
 			// ошибки закрытия Listener
 			log.ErrorLog.Printf("HTTP server Shutdown: %v", err)
 		}
-		// Kill file save
-		close(killFileSave)
+		// Kill background workers
+		close(killWorkers)
 		// сообщаем основному потоку,
 		// что все сетевые соединения обработаны и закрыты
 		log.InfoLog.Println("closing channels, shutting down server")
@@ -186,7 +164,7 @@ func (s *Server) Run(parent context.Context) error {
 		// создаём gRPC-сервер без зарегистрированной службы
 		s := grpc.NewServer()
 		// регистрируем сервис
-		pb.RegisterMetricsServer(s, &MetricsServer{})
+		pb.RegisterMetricsServer(s, NewMetricsServer(metricsHandler.Storage, metricsHandler.Collector))
 
 		log.InfoLog.Println("Сервер gRPC начал работу")
 		// получаем запрос gRPC
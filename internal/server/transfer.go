@@ -0,0 +1,272 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/api/handlers"
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+	"github.com/nmramorov/gowatcher/internal/storage"
+	"github.com/nmramorov/gowatcher/internal/transfer"
+)
+
+// Число значений истории, загружаемых в хранилище одним пакетом.
+var ImportBatchSize = 1000
+
+// Параметры команд export и import.
+type TransferOptions struct {
+	Format  string // ndjson или csv
+	History bool   // выгружать историю gauge и counter вместе с текущими значениями
+	From    string // начало интервала истории: unix ms или RFC3339
+	To      string // конец интервала истории: unix ms или RFC3339
+	File    string // файл выгрузки вместо stdout или stdin
+}
+
+// Функция, разбирающая аргументы команд export и import: необязательный формат ndjson или csv,
+// флаги -history, -from, -to и -file и оставшиеся флаги конфигурации сервера.
+func ParseTransferArgs(args []string) (*TransferOptions, []string, error) {
+	opts := &TransferOptions{Format: transfer.FormatNDJSON}
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		format, err := transfer.ParseFormat(args[0])
+		if err != nil {
+			return nil, nil, errors.ErrorTransferUsage
+		}
+		opts.Format, args = format, args[1:]
+	}
+	rest := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(args[i], "-"), "=")
+		var target *string
+		switch name {
+		case "history":
+			opts.History = !hasValue || value == "true"
+			continue
+		case "from":
+			target = &opts.From
+		case "to":
+			target = &opts.To
+		case "file":
+			target = &opts.File
+		default:
+			rest = append(rest, args[i])
+			continue
+		}
+		if !hasValue {
+			if i+1 >= len(args) {
+				return nil, nil, errors.ErrorTransferUsage
+			}
+			i++
+			value = args[i]
+		}
+		*target = value
+	}
+	return opts, rest, nil
+}
+
+// Функция, открывающая хранилище из конфигурации сервера для команд export и import.
+func openTransferStorage(ctx context.Context) (storage.Storage, error) {
+	serverConfig, err := config.GetServerConfig()
+	if err != nil {
+		log.ErrorLog.Printf("could not get server config: %e", err)
+		return nil, err
+	}
+	return storage.OpenForTransfer(ctx, serverConfig, col.NewCollector())
+}
+
+func closeTransferStorage(ctx context.Context, store storage.Storage) {
+	if err := store.Close(ctx); err != nil {
+		log.ErrorLog.Printf("could not close storage: %e", err)
+	}
+}
+
+// Export выгружает текущие значения всех серий хранилища из конфигурации сервера в out,
+// а с -history — и сохранённые значения gauge и counter за интервал [from, to) вместе с агрегатами
+// свёрнутой истории. По умолчанию выгружается вся история. Если хранилище не ведёт историю,
+// выгружаются только текущие значения, как и при загрузке в такое хранилище.
+func Export(ctx context.Context, opts *TransferOptions, out io.Writer) error {
+	from, err := handlers.ParseHistoryTime(opts.From, time.UnixMilli(0))
+	if err != nil {
+		return err
+	}
+	to, err := handlers.ParseHistoryTime(opts.To, time.Now())
+	if err != nil {
+		return err
+	}
+	store, err := openTransferStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeTransferStorage(ctx, store)
+
+	list, err := store.List(ctx)
+	if err != nil {
+		return err
+	}
+	writer, err := transfer.NewWriter(out, opts.Format)
+	if err != nil {
+		return err
+	}
+	for _, metric := range list {
+		if err = writer.Write(&transfer.Record{Kind: transfer.KindState, JSONMetrics: metric}); err != nil {
+			return err
+		}
+	}
+	if opts.History {
+		if err = exportHistory(ctx, store, list, from, to, writer); err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+func exportHistory(
+	ctx context.Context, store storage.Storage, list []*metrics.JSONMetrics, from, to time.Time, writer *transfer.Writer,
+) error {
+	reader, ok := store.(storage.SampleReader)
+	if !ok {
+		log.InfoLog.Println("storage keeps no history, only current values are exported")
+		return nil
+	}
+	for _, metric := range list {
+		if metric.MType != "gauge" && metric.MType != "counter" {
+			continue
+		}
+		samples, err := reader.Samples(ctx, metric, from, to)
+		if err == errors.ErrorHistoryUnavailable {
+			log.InfoLog.Println("storage keeps no history, only current values are exported")
+			return nil
+		}
+		if err != nil {
+			log.ErrorLog.Printf("could not read history of %s: %e", metric.Key(), err)
+			return err
+		}
+		for _, sample := range samples {
+			record := &transfer.Record{Kind: transfer.KindHistory, JSONMetrics: &metrics.JSONMetrics{
+				ID: metric.ID, MType: metric.MType, Labels: metric.Labels,
+			}}
+			timestamp := sample.Time.UnixMilli()
+			record.Timestamp = &timestamp
+			if metric.MType == "gauge" {
+				value := sample.Value
+				record.Value = &value
+			} else {
+				delta := int64(sample.Value)
+				record.Delta = &delta
+			}
+			if err = writer.Write(record); err != nil {
+				return err
+			}
+		}
+		if err = exportRollups(ctx, store, metric, from, to, writer); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Функция, выгружающая агрегаты свёрнутой истории серии, если хранилище их ведёт: свёртка удаляет
+// сырые значения, и без агрегатов выгрузка теряла бы старую историю.
+func exportRollups(
+	ctx context.Context, store storage.Storage, metric *metrics.JSONMetrics, from, to time.Time, writer *transfer.Writer,
+) error {
+	reader, ok := store.(storage.RollupReader)
+	if !ok {
+		return nil
+	}
+	rollups, err := reader.Rollups(ctx, metric, from, to)
+	if err != nil {
+		log.ErrorLog.Printf("could not read rollups of %s: %e", metric.Key(), err)
+		return err
+	}
+	for i := range rollups {
+		timestamp := rollups[i].Timestamp
+		record := &transfer.Record{Kind: transfer.KindRollup, JSONMetrics: &metrics.JSONMetrics{
+			ID: metric.ID, MType: metric.MType, Labels: metric.Labels, Timestamp: &timestamp,
+		}, Rollup: &rollups[i]}
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Import загружает выгрузку из in в хранилище из конфигурации сервера и печатает итог в out.
+// Текущие значения заменяют значения тех же серий, история и агрегаты свёрнутой истории дописываются
+// пакетами по ImportBatchSize. Если хранилище не ведёт историю, её записи пропускаются.
+func Import(ctx context.Context, opts *TransferOptions, in io.Reader, out io.Writer) error {
+	store, err := openTransferStorage(ctx)
+	if err != nil {
+		return err
+	}
+	defer closeTransferStorage(ctx, store)
+
+	importer, ok := store.(storage.Importer)
+	if !ok {
+		return errors.ErrorHistoryUnavailable
+	}
+	state := make([]*metrics.JSONMetrics, 0)
+	batch := make([]*metrics.JSONMetrics, 0, ImportBatchSize)
+	rollups := make([]metrics.SeriesRollup, 0, ImportBatchSize)
+	imported, skipped := 0, 0
+	counted := func(n int, err error) error {
+		if err == errors.ErrorHistoryUnavailable {
+			skipped += n
+			return nil
+		}
+		imported += n
+		return err
+	}
+	flush := func() error {
+		if len(batch) > 0 {
+			if err := counted(len(batch), importer.ImportHistory(ctx, batch)); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+		if len(rollups) > 0 {
+			if err := counted(len(rollups), importer.ImportRollups(ctx, rollups)); err != nil {
+				return err
+			}
+			rollups = rollups[:0]
+		}
+		return nil
+	}
+	err = transfer.Read(in, opts.Format, func(record *transfer.Record) error {
+		switch record.Kind {
+		case transfer.KindState:
+			state = append(state, record.JSONMetrics)
+			return nil
+		case transfer.KindRollup:
+			rollups = append(rollups, metrics.SeriesRollup{Series: record.JSONMetrics, Rollup: *record.Rollup})
+		default:
+			batch = append(batch, record.JSONMetrics)
+		}
+		if len(batch) < ImportBatchSize && len(rollups) < ImportBatchSize {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		log.ErrorLog.Printf("could not import history: %e", err)
+		return err
+	}
+	if skipped > 0 {
+		log.InfoLog.Printf("storage keeps no history, %d history records skipped", skipped)
+	}
+	if err = importer.ImportState(ctx, state); err != nil {
+		log.ErrorLog.Printf("could not import state: %e", err)
+		return err
+	}
+	fmt.Fprintf(out, "imported %d series and %d history records\n", len(state), imported)
+	return nil
+}
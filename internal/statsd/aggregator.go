@@ -0,0 +1,239 @@
+package statsd
+
+import (
+	"context"
+	"math"
+	"sync"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Наибольшее число повторов значения таймера при частоте выборки меньше единицы.
+var MaxSampleWeight = 1000
+
+// Получатель агрегатов, которым служит хранилище сервера.
+type Sink interface {
+	GetSeries(ctx context.Context, metric *metrics.JSONMetrics) (*metrics.JSONMetrics, error)
+	UpdateBatch(ctx context.Context, batch []*metrics.JSONMetrics) ([]*metrics.JSONMetrics, error)
+}
+
+// Агрегат одной серии за период между сбросами.
+type series struct {
+	mtype    string
+	name     string
+	labels   map[string]string
+	count    float64 // сумма counter с поправкой на частоту выборки
+	gauge    float64
+	absolute bool // gauge получил значение без знака, изменения применяются к нему
+	samples  []float64
+	members  map[string]struct{}
+}
+
+// Агрегатор наблюдений StatsD. Counter суммируются с учётом частоты выборки, для gauge остаётся
+// последнее значение с применёнными изменениями, таймеры копятся в summary, элементы множеств — в set.
+type Aggregator struct {
+	mu     sync.Mutex
+	series map[string]*series
+	// Ненулевые дробные остатки counter, переносимые на следующий сброс.
+	remainders map[string]*remainder
+}
+
+// Дробный остаток counter серии.
+type remainder struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// Конструктор пустого агрегатора.
+func NewAggregator() *Aggregator {
+	return &Aggregator{series: make(map[string]*series), remainders: make(map[string]*remainder)}
+}
+
+// Метод, возвращающий остаток counter серии key. Вызывается под мьютексом агрегатора.
+func (a *Aggregator) remainder(key string) float64 {
+	if r, ok := a.remainders[key]; ok {
+		return r.value
+	}
+	return 0
+}
+
+// Метод, запоминающий остаток counter серии key; нулевой остаток удаляется.
+// Вызывается под мьютексом агрегатора.
+func (a *Aggregator) keepRemainder(key, name string, labels map[string]string, value float64) {
+	if value == 0 {
+		delete(a.remainders, key)
+		return
+	}
+	a.remainders[key] = &remainder{name: name, labels: labels, value: value}
+}
+
+// Функция, возвращающая тип метрики gowatcher для типа StatsD: таймеры, гистограммы
+// и распределения StatsD попадают в summary.
+func metricType(statsdType string) string {
+	switch statsdType {
+	case TypeCounter:
+		return "counter"
+	case TypeGauge:
+		return "gauge"
+	case TypeSet:
+		return "set"
+	}
+	return "summary"
+}
+
+// Метод, добавляющий наблюдение в агрегат его серии.
+func (a *Aggregator) Add(sample *Sample) {
+	mtype := metricType(sample.Type)
+	key := mtype + "\x00" + metrics.SeriesKey(sample.Name, sample.Labels)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.series[key]
+	if !ok {
+		s = &series{mtype: mtype, name: sample.Name, labels: sample.Labels}
+		a.series[key] = s
+	}
+	switch mtype {
+	case "counter":
+		s.count += sample.Value / sample.Rate
+	case "gauge":
+		if sample.Relative {
+			s.gauge += sample.Value
+		} else {
+			s.gauge, s.absolute = sample.Value, true
+		}
+	case "set":
+		if s.members == nil {
+			s.members = make(map[string]struct{})
+		}
+		s.members[sample.Member] = struct{}{}
+	default:
+		weight := int(math.Round(1 / sample.Rate))
+		if weight > MaxSampleWeight {
+			weight = MaxSampleWeight
+		}
+		for i := 0; i < weight; i++ {
+			s.samples = append(s.samples, sample.Value)
+		}
+	}
+}
+
+// Метод, записывающий накопленные агрегаты в sink одним пакетом и очищающий их.
+// Изменения gauge без абсолютного значения применяются к текущему значению серии в sink.
+// Дробная часть counter, возникшая из-за частоты выборки, переносится на следующий сброс.
+// Серии, которые sink не принял, возвращаются в агрегатор и записываются следующим сбросом,
+// их остатки counter не меняются. Остатки серий без наблюдений, которых уже нет в sink,
+// например удалённых как устаревшие, забываются.
+func (a *Aggregator) Flush(ctx context.Context, sink Sink) error {
+	a.mu.Lock()
+	pending := a.series
+	a.series = make(map[string]*series)
+	idle := make(map[string]*remainder)
+	for key, r := range a.remainders {
+		if _, ok := pending[key]; !ok {
+			idle[key] = r
+		}
+	}
+	batch := make([]*metrics.JSONMetrics, 0, len(pending))
+	remainders := make(map[string]float64)
+	relative := make([]*series, 0)
+	for key, s := range pending {
+		metric := &metrics.JSONMetrics{ID: s.name, MType: s.mtype, Labels: s.labels}
+		switch s.mtype {
+		case "counter":
+			total := s.count + a.remainder(key)
+			delta := int64(math.Trunc(total))
+			if delta == 0 {
+				a.keepRemainder(key, s.name, s.labels, total)
+				delete(pending, key)
+				continue
+			}
+			remainders[key] = total - float64(delta)
+			metric.Delta = &delta
+		case "gauge":
+			if !s.absolute {
+				relative = append(relative, s)
+				continue
+			}
+			value := s.gauge
+			metric.Value = &value
+		case "set":
+			for member := range s.members {
+				metric.Members = append(metric.Members, member)
+			}
+		default:
+			metric.Samples = s.samples
+		}
+		batch = append(batch, metric)
+	}
+	a.mu.Unlock()
+
+	for key, r := range idle {
+		if _, err := sink.GetSeries(ctx, &metrics.JSONMetrics{ID: r.name, MType: "counter", Labels: r.labels}); err == nil {
+			delete(idle, key)
+		}
+	}
+	for _, s := range relative {
+		value := s.gauge
+		current, err := sink.GetSeries(ctx, &metrics.JSONMetrics{ID: s.name, MType: "gauge", Labels: s.labels})
+		if err == nil && current.Value != nil {
+			value += *current.Value
+		}
+		batch = append(batch, &metrics.JSONMetrics{ID: s.name, MType: "gauge", Labels: s.labels, Value: &value})
+	}
+	var accepted []*metrics.JSONMetrics
+	var err error
+	if len(batch) > 0 {
+		accepted, err = sink.UpdateBatch(ctx, batch)
+	}
+	if err != nil {
+		log.ErrorLog.Printf("could not flush %d statsd series: %e", len(batch)-len(accepted), err)
+	} else {
+		accepted = batch
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for key := range idle {
+		if _, ok := a.series[key]; !ok {
+			delete(a.remainders, key)
+		}
+	}
+	for _, metric := range accepted {
+		key := metric.MType + "\x00" + metrics.SeriesKey(metric.ID, metric.Labels)
+		if remainder, ok := remainders[key]; ok {
+			a.keepRemainder(key, metric.ID, metric.Labels, remainder)
+		}
+		delete(pending, key)
+	}
+	a.restore(pending)
+	return err
+}
+
+// Метод, возвращающий в агрегатор серии несостоявшегося сброса. Наблюдения, поступившие
+// после начала сброса, новее возвращённых: абсолютное значение gauge заменяет прежнее.
+func (a *Aggregator) restore(pending map[string]*series) {
+	for key, old := range pending {
+		s, ok := a.series[key]
+		if !ok {
+			a.series[key] = old
+			continue
+		}
+		switch s.mtype {
+		case "counter":
+			s.count += old.count
+		case "gauge":
+			if !s.absolute {
+				s.gauge += old.gauge
+				s.absolute = old.absolute
+			}
+		case "set":
+			for member := range old.members {
+				s.members[member] = struct{}{}
+			}
+		default:
+			s.samples = append(old.samples, s.samples...)
+		}
+	}
+}
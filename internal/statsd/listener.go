@@ -0,0 +1,187 @@
+package statsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	stdErrors "errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	// Период сброса агрегатов по умолчанию.
+	DefaultFlushInterval = 10 * time.Second
+	// Наибольший размер датаграммы UDP.
+	MaxPacketSize = 65535
+)
+
+// Приёмник StatsD: слушает UDP или TCP и периодически сбрасывает агрегаты в хранилище.
+type Listener struct {
+	aggregator *Aggregator
+	sink       Sink
+	interval   time.Duration
+	packet     net.PacketConn
+	stream     net.Listener
+	conns      map[net.Conn]struct{}
+	mu         sync.Mutex
+	done       chan struct{}
+	wg         sync.WaitGroup
+}
+
+// Функция, запускающая приём StatsD по адресу вида :8125 или udp://:8125 для UDP и tcp://:8125 для TCP.
+// Агрегаты записываются в sink каждые interval, при нулевом интервале — каждые DefaultFlushInterval.
+func Listen(address string, sink Sink, interval time.Duration) (*Listener, error) {
+	if interval <= 0 {
+		interval = DefaultFlushInterval
+	}
+	l := &Listener{
+		aggregator: NewAggregator(),
+		sink:       sink,
+		interval:   interval,
+		conns:      make(map[net.Conn]struct{}),
+		done:       make(chan struct{}),
+	}
+	var err error
+	if strings.HasPrefix(address, "tcp://") {
+		l.stream, err = net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+	} else {
+		l.packet, err = net.ListenPacket("udp", strings.TrimPrefix(address, "udp://"))
+	}
+	if err != nil {
+		log.ErrorLog.Printf("could not listen for statsd on %s: %e", address, err)
+		return nil, err
+	}
+	l.wg.Add(2)
+	if l.stream != nil {
+		go l.acceptStream()
+	} else {
+		go l.readPackets()
+	}
+	go l.run()
+	log.InfoLog.Printf("Accepting statsd on %s", l.Addr())
+	return l, nil
+}
+
+// Метод, возвращающий адрес, на котором принимаются метрики.
+func (l *Listener) Addr() net.Addr {
+	if l.stream != nil {
+		return l.stream.Addr()
+	}
+	return l.packet.LocalAddr()
+}
+
+// Метод, разбирающий строки пакета и добавляющий наблюдения в агрегатор.
+func (l *Listener) handle(data []byte) {
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		sample, err := Parse(string(line))
+		if err != nil {
+			log.ErrorLog.Printf("skipping statsd line %q: %e", line, err)
+			continue
+		}
+		l.aggregator.Add(sample)
+	}
+}
+
+func (l *Listener) readPackets() {
+	defer l.wg.Done()
+	buffer := make([]byte, MaxPacketSize)
+	for {
+		n, _, err := l.packet.ReadFrom(buffer)
+		if err != nil {
+			if !stdErrors.Is(err, net.ErrClosed) {
+				log.ErrorLog.Printf("error reading statsd packet: %e", err)
+			}
+			return
+		}
+		l.handle(buffer[:n])
+	}
+}
+
+func (l *Listener) acceptStream() {
+	defer l.wg.Done()
+	for {
+		conn, err := l.stream.Accept()
+		if err != nil {
+			if !stdErrors.Is(err, net.ErrClosed) {
+				log.ErrorLog.Printf("error accepting statsd connection: %e", err)
+			}
+			return
+		}
+		l.mu.Lock()
+		l.conns[conn] = struct{}{}
+		l.mu.Unlock()
+		l.wg.Add(1)
+		go l.readStream(conn)
+	}
+}
+
+func (l *Listener) readStream(conn net.Conn) {
+	defer l.wg.Done()
+	defer func() {
+		l.mu.Lock()
+		delete(l.conns, conn)
+		l.mu.Unlock()
+		if err := conn.Close(); err != nil && !stdErrors.Is(err, net.ErrClosed) {
+			log.ErrorLog.Printf("error closing statsd connection: %e", err)
+		}
+	}()
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 0, 4096), MaxPacketSize)
+	for scanner.Scan() {
+		l.handle(scanner.Bytes())
+	}
+}
+
+func (l *Listener) run() {
+	defer l.wg.Done()
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			log.InfoLog.Println("Stop flushing statsd")
+			return
+		case <-ticker.C:
+			if err := l.aggregator.Flush(context.Background(), l.sink); err != nil {
+				log.ErrorLog.Printf("error flushing statsd: %e", err)
+			}
+		}
+	}
+}
+
+// Метод, сбрасывающий накопленные агрегаты в хранилище немедленно.
+func (l *Listener) Flush(ctx context.Context) error {
+	return l.aggregator.Flush(ctx, l.sink)
+}
+
+// Метод, прекращающий приём, дожидающийся обработчиков и сбрасывающий оставшиеся агрегаты.
+func (l *Listener) Close(ctx context.Context) error {
+	close(l.done)
+	var err error
+	if l.stream != nil {
+		err = l.stream.Close()
+		l.mu.Lock()
+		for conn := range l.conns {
+			if closeErr := conn.Close(); closeErr != nil {
+				log.ErrorLog.Printf("error closing statsd connection: %e", closeErr)
+			}
+		}
+		l.mu.Unlock()
+	} else {
+		err = l.packet.Close()
+	}
+	l.wg.Wait()
+	if flushErr := l.Flush(ctx); err == nil {
+		err = flushErr
+	}
+	return err
+}
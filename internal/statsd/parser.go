@@ -0,0 +1,85 @@
+// Пакет statsd принимает метрики по протоколу StatsD через UDP или TCP,
+// агрегирует их и периодически записывает в хранилище сервера.
+package statsd
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Типы строк StatsD.
+const (
+	TypeCounter      = "c"
+	TypeGauge        = "g"
+	TypeTimer        = "ms"
+	TypeHistogram    = "h"
+	TypeDistribution = "d"
+	TypeSet          = "s"
+)
+
+// Наблюдение из одной строки StatsD вида name:value|type[|@rate][|#tag:value,...].
+type Sample struct {
+	Name     string
+	Type     string
+	Value    float64           // значение counter, gauge или таймера
+	Member   string            // элемент множества для типа s
+	Relative bool              // значение gauge со знаком изменяет текущее, а не заменяет его
+	Rate     float64           // доля отправленных наблюдений, от 0 до 1
+	Labels   map[string]string // теги DogStatsD
+}
+
+// Функция, разбирающая строку StatsD.
+func Parse(line string) (*Sample, error) {
+	name, rest, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found || name == "" {
+		return nil, errors.ErrorStatsDLine
+	}
+	fields := strings.Split(rest, "|")
+	if len(fields) < 2 {
+		return nil, errors.ErrorStatsDLine
+	}
+	sample := &Sample{Name: name, Type: fields[1], Rate: 1}
+	switch sample.Type {
+	case TypeSet:
+		sample.Member = fields[0]
+	case TypeCounter, TypeGauge, TypeTimer, TypeHistogram, TypeDistribution:
+		value, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			return nil, errors.ErrorStatsDLine
+		}
+		sample.Value = value
+		sample.Relative = sample.Type == TypeGauge && (fields[0][0] == '+' || fields[0][0] == '-')
+	default:
+		return nil, errors.ErrorStatsDLine
+	}
+	for _, field := range fields[2:] {
+		switch {
+		case strings.HasPrefix(field, "@"):
+			rate, err := strconv.ParseFloat(field[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return nil, errors.ErrorStatsDLine
+			}
+			sample.Rate = rate
+		case strings.HasPrefix(field, "#"):
+			sample.Labels = parseTags(field[1:])
+		}
+	}
+	return sample, nil
+}
+
+// Функция, превращающая теги вида env:prod,region:eu в метки. Теги без значения пропускаются.
+func parseTags(tags string) map[string]string {
+	labels := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		name, value, found := strings.Cut(tag, ":")
+		if found && name != "" {
+			labels[name] = value
+		}
+	}
+	if len(labels) == 0 {
+		return nil
+	}
+	return labels
+}
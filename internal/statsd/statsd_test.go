@@ -0,0 +1,186 @@
+package statsd
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/storage"
+)
+
+func TestParse(t *testing.T) {
+	sample, err := Parse("api.requests:2|c|@0.1|#env:prod,region")
+	require.NoError(t, err)
+	assert.Equal(t, &Sample{
+		Name: "api.requests", Type: TypeCounter, Value: 2, Rate: 0.1, Labels: map[string]string{"env": "prod"},
+	}, sample)
+
+	sample, err = Parse("queue.depth:-3|g")
+	require.NoError(t, err)
+	assert.True(t, sample.Relative)
+	assert.Equal(t, -3.0, sample.Value)
+
+	sample, err = Parse("users:alice|s")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", sample.Member)
+
+	for _, line := range []string{"noseparator", "a:1", "a:x|c", "a:1|q", "a:1|ms|@0", "a:1|ms|@2"} {
+		_, err = Parse(line)
+		assert.ErrorIs(t, err, errors.ErrorStatsDLine, line)
+	}
+}
+
+func TestAggregatorFlush(t *testing.T) {
+	ctx := context.Background()
+	c := col.NewCollector()
+	store := storage.NewMemory(c)
+	aggregator := NewAggregator()
+	// изменение gauge без меток применяется к серии без меток, а не к серии с метками
+	queue := 10.0
+	_, err := store.Update(ctx, &metrics.JSONMetrics{
+		ID: "queue", MType: "gauge", Labels: map[string]string{"host": "a"}, Value: &queue,
+	})
+	require.NoError(t, err)
+	for _, line := range []string{
+		"hits:1|c|@0.3", "hits:1|c|@0.3", "load:5|g", "load:+2|g", "depth:4|g", "queue:+2|g",
+		"latency:300|ms|@0.5", "latency:100|ms", "users:alice|s", "users:bob|s", "users:alice|s",
+	} {
+		sample, err := Parse(line)
+		require.NoError(t, err)
+		aggregator.Add(sample)
+	}
+	require.NoError(t, aggregator.Flush(ctx, store))
+
+	// 2/0.3 = 6.67: целая часть записывается, остаток переносится на следующий сброс
+	found, err := store.Get(ctx, &metrics.JSONMetrics{ID: "hits", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *found.Delta)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "load", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 7.0, *found.Value)
+	found, err = store.GetSeries(ctx, &metrics.JSONMetrics{ID: "queue", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, *found.Value)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "latency", MType: "summary"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), found.Summary.Count)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "users", MType: "set"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), *found.Estimate)
+
+	for _, line := range []string{"hits:1|c|@0.3", "depth:-1|g"} {
+		sample, err := Parse(line)
+		require.NoError(t, err)
+		aggregator.Add(sample)
+	}
+	require.NoError(t, aggregator.Flush(ctx, store))
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "hits", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *found.Delta)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "depth", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, *found.Value)
+	// остаток, дошедший до нуля, не хранится
+	assert.Empty(t, aggregator.remainders)
+
+	// остаток серии, удалённой как устаревшая, забывается при следующем сбросе
+	sample, err := Parse("jobs:1|c|@0.3")
+	require.NoError(t, err)
+	aggregator.Add(sample)
+	require.NoError(t, aggregator.Flush(ctx, store))
+	assert.Len(t, aggregator.remainders, 1)
+	require.NoError(t, aggregator.Flush(ctx, store))
+	assert.Len(t, aggregator.remainders, 1)
+	c.Staleness.EvictAfter = time.Minute
+	c.EvictStale(time.Now().Add(time.Hour))
+	require.NoError(t, aggregator.Flush(ctx, store))
+	assert.Empty(t, aggregator.remainders)
+}
+
+// Хранилище, отклоняющее пакеты, пока full установлен, как переполненный буфер БД.
+type fullSink struct {
+	*storage.Memory
+	full bool
+}
+
+func (s *fullSink) UpdateBatch(ctx context.Context, batch []*metrics.JSONMetrics) ([]*metrics.JSONMetrics, error) {
+	if s.full {
+		return nil, errors.ErrorBatchBufferFull
+	}
+	return s.Memory.UpdateBatch(ctx, batch)
+}
+
+func TestAggregatorFlushFailure(t *testing.T) {
+	ctx := context.Background()
+	store := &fullSink{Memory: storage.NewMemory(col.NewCollector()), full: true}
+	aggregator := NewAggregator()
+	add := func(lines ...string) {
+		for _, line := range lines {
+			sample, err := Parse(line)
+			require.NoError(t, err)
+			aggregator.Add(sample)
+		}
+	}
+	add("hits:1|c|@0.3", "load:5|g", "depth:+4|g", "latency:100|ms", "users:alice|s")
+	assert.ErrorIs(t, aggregator.Flush(ctx, store), errors.ErrorBatchBufferFull)
+
+	// наблюдения несостоявшегося сброса объединяются с новыми и записываются следующим сбросом
+	add("hits:1|c|@0.3", "load:+1|g", "depth:+1|g", "latency:300|ms", "users:bob|s")
+	store.full = false
+	require.NoError(t, aggregator.Flush(ctx, store))
+
+	found, err := store.Get(ctx, &metrics.JSONMetrics{ID: "hits", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(6), *found.Delta)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "load", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 6.0, *found.Value)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "depth", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 5.0, *found.Value)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "latency", MType: "summary"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), found.Summary.Count)
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "users", MType: "set"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), *found.Estimate)
+
+	// остаток 0.67 не потерян и не учтён дважды: 6.67 + 3.33 = 10
+	add("hits:1|c|@0.3")
+	require.NoError(t, aggregator.Flush(ctx, store))
+	found, err = store.Get(ctx, &metrics.JSONMetrics{ID: "hits", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *found.Delta)
+}
+
+func TestListener(t *testing.T) {
+	ctx := context.Background()
+	for _, scheme := range []string{"udp", "tcp"} {
+		c := col.NewCollector()
+		store := storage.NewMemory(c)
+		listener, err := Listen(scheme+"://127.0.0.1:0", store, time.Hour)
+		require.NoError(t, err)
+
+		conn, err := net.Dial(scheme, listener.Addr().String())
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("jobs:3|c|#queue:mail\njobs:2|c|#queue:mail\nbroken\n"))
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+
+		assert.Eventually(t, func() bool {
+			if err := listener.Flush(ctx); err != nil {
+				return false
+			}
+			value, err := c.GetMetricWithLabels("jobs", map[string]string{"queue": "mail"})
+			return err == nil && value == metrics.Counter(5)
+		}, time.Second, 10*time.Millisecond, scheme)
+		require.NoError(t, listener.Close(ctx))
+	}
+}
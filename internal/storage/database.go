@@ -0,0 +1,222 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/db"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+// Хранилище, записывающее каждое наблюдение в БД (Postgres или SQLite). Агрегаты ведутся в памяти,
+// чтение сначала обращается к БД, а при её недоступности или незаписанных наблюдениях — к памяти.
+// Одиночные наблюдения и пачки проходят через общий буфер курсора, поэтому строки серии
+// записываются в порядке поступления.
+type Database struct {
+	*Memory
+	Cursor *db.Cursor
+	roller *db.Roller
+	pruner *db.Pruner
+	mu     sync.Mutex
+	// Порядок записи описаний в БД совпадает с порядком их применения в памяти.
+	metaMu sync.Mutex
+}
+
+// Имя собственной метрики сервера с числом строк, удалённых очисткой, с меткой type: типом метрики
+// для сырых строк или именем таблицы для агрегатов свёртки.
+const PrunedRowsMetric = "RetentionPrunedRows"
+
+// Конструктор хранилища поверх открытого курсора.
+func NewDatabase(collector *col.Collector, cursor *db.Cursor) *Database {
+	return &Database{Memory: NewMemory(collector), Cursor: cursor}
+}
+
+// Функция, подключающаяся к Postgres по DSN и создающая таблицы метрик.
+func OpenPostgres(ctx context.Context, dsn string, collector *col.Collector) (*Database, error) {
+	return open(ctx, dsn, db.PostgresAdaptor, collector, false)
+}
+
+// Функция, открывающая файл SQLite по DSN вида file:metrics.db и создающая таблицы метрик.
+func OpenSQLite(ctx context.Context, dsn string, collector *col.Collector) (*Database, error) {
+	return open(ctx, dsn, db.SQLiteAdaptor, collector, false)
+}
+
+// Функция, подключающаяся к БД. Схема приводится к последней версии миграциями, если они включены,
+// иначе создаются недостающие таблицы.
+func open(ctx context.Context, dsn, adaptor string, collector *col.Collector, migrate bool) (*Database, error) {
+	cursor, err := db.NewCursor(ctx, dsn, adaptor)
+	if err != nil {
+		return nil, err
+	}
+	if migrate {
+		_, err = cursor.Migrate(ctx)
+	} else {
+		err = cursor.InitDB(ctx)
+	}
+	if err != nil {
+		log.ErrorLog.Printf("error initializing db: %e", err)
+		return nil, err
+	}
+	cursor.StartFlushing(db.FlushInterval)
+	return NewDatabase(collector, cursor), nil
+}
+
+// Метод, применяющий наблюдение и сразу записывающий его в БД вместе с ожидающими в буфере.
+// При ошибке записи наблюдение остаётся в буфере до следующей попытки.
+func (s *Database) Update(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	if !s.Cursor.IsValid {
+		return s.Memory.Update(ctx, metric)
+	}
+	if err := s.lockBuffer(1); err != nil {
+		return &m.JSONMetrics{}, err
+	}
+	updated, err := s.Memory.Update(ctx, metric)
+	if err == nil {
+		err = s.Cursor.AddBatchV2(ctx, []*m.JSONMetrics{updated})
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return updated, err
+	}
+	if err = s.Cursor.Flush(ctx); err != nil {
+		log.ErrorLog.Printf("could not add data to db, will retry: %e", err)
+	}
+	return updated, nil
+}
+
+func (s *Database) UpdateBatch(ctx context.Context, batch []*m.JSONMetrics) ([]*m.JSONMetrics, error) {
+	if !s.Cursor.IsValid {
+		return s.Memory.UpdateBatch(ctx, batch)
+	}
+	if err := s.lockBuffer(len(batch)); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	accepted, err := s.Memory.UpdateBatch(ctx, batch)
+	if err != nil {
+		return accepted, err
+	}
+	return accepted, s.Cursor.AddBatchV2(ctx, accepted)
+}
+
+// Метод, захватывающий очередь записи, если в буфере курсора есть место для n наблюдений.
+// Место проверяется до изменения памяти: отклонённый запрос не должен менять её, иначе
+// повтор клиента учтёт приращения counter дважды.
+func (s *Database) lockBuffer(n int) error {
+	s.mu.Lock()
+	if !s.Cursor.CanBuffer(n) {
+		s.mu.Unlock()
+		log.ErrorLog.Printf("batch buffer is full, %d rows rejected", n)
+		return errors.ErrorBatchBufferFull
+	}
+	return nil
+}
+
+// Метод, регистрирующий описание метрики и сохраняющий итоговое описание в БД.
+// При недоступной БД описание хранится только в памяти.
+func (s *Database) DeclareMetadata(ctx context.Context, meta *m.Metadata) (*m.Metadata, error) {
+	s.metaMu.Lock()
+	defer s.metaMu.Unlock()
+	stored, err := s.Memory.DeclareMetadata(ctx, meta)
+	if err != nil || !s.Cursor.IsValid {
+		return stored, err
+	}
+	if err = s.Cursor.SaveMetadata(ctx, stored); err != nil {
+		log.ErrorLog.Printf("could not save metadata of %s to db: %e", stored.Name, err)
+		return stored, err
+	}
+	return stored, nil
+}
+
+// Метод, читающий серию из БД. Пока в буфере есть незаписанные наблюдения, актуальное значение
+// есть только в памяти. rate и increase рассчитываются по истории значений в памяти.
+func (s *Database) Get(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	if s.Cursor.IsValid && metric.Window == "" && s.Cursor.Buffered() == 0 {
+		found, err := s.Cursor.Get(ctx, metric)
+		if err == nil {
+			found.Stale = s.Collector.IsStale(found.ID, found.Labels)
+			return found, nil
+		}
+		log.ErrorLog.Println("could not get data from db...")
+	}
+	return s.Memory.Get(ctx, metric)
+}
+
+// Метод, читающий историю серии из БД с шагом step. Разрешение агрегатов выбирается по шагу.
+func (s *Database) History(
+	ctx context.Context, metric *m.JSONMetrics, from, to time.Time, step time.Duration,
+) ([]m.Point, error) {
+	if !s.Cursor.IsValid {
+		return nil, errors.ErrorHistoryUnavailable
+	}
+	return s.Cursor.Points(ctx, metric, from, to, step)
+}
+
+// Метод, заполняющий коллектор последними значениями всех серий и описаниями метрик из БД,
+// чтобы накопленные значения counter продолжились с сохранённых итогов. Серии, которые
+// не обновлялись дольше срока удаления устаревших серий, не восстанавливаются.
+func (s *Database) Restore(ctx context.Context) error {
+	if !s.Cursor.IsValid {
+		return errors.ErrorDB
+	}
+	var since time.Time
+	if evictAfter := s.Collector.Staleness.EvictAfter; evictAfter > 0 {
+		since = time.Now().Add(-evictAfter)
+	}
+	latest, err := s.Cursor.Latest(ctx, since)
+	if err != nil {
+		return err
+	}
+	if latest.Metadata, err = s.Cursor.Metadata(ctx); err != nil {
+		log.ErrorLog.Printf("could not read metadata from db: %e", err)
+		return err
+	}
+	s.Collector.Restore(latest)
+	log.InfoLog.Printf("Restored %d counters and %d gauges from db", len(latest.CounterMetrics), len(latest.GaugeMetrics))
+	return nil
+}
+
+// Метод, запускающий фоновую свёртку истории старше after. Останавливается при закрытии хранилища.
+func (s *Database) StartRollups(after time.Duration) {
+	if s.Cursor.IsValid && s.roller == nil {
+		s.roller = db.StartRollups(s.Cursor, after)
+	}
+}
+
+// Метод, запускающий фоновую очистку строк старше сроков хранения. Число удалённых строк
+// каждого прохода добавляется к счётчику PrunedRowsMetric. Последние строки удалённых устаревших
+// серий очищаются по сроку удаления коллектора. Останавливается при закрытии хранилища.
+func (s *Database) StartPruning(retention db.Retention) {
+	if s.Cursor.IsValid && s.pruner == nil && len(retention) > 0 {
+		s.pruner = db.StartPruning(s.Cursor, retention, s.Collector.Staleness.EvictAfter, s.reportPruned)
+	}
+}
+
+func (s *Database) reportPruned(removed map[string]int64) {
+	for mtype, rows := range removed {
+		rows := rows
+		if _, err := s.Collector.UpdateMetricFromJSON(&m.JSONMetrics{
+			ID: PrunedRowsMetric, MType: "counter", Delta: &rows, Labels: map[string]string{"type": mtype},
+		}); err != nil {
+			log.ErrorLog.Printf("could not report pruned rows: %e", err)
+		}
+	}
+}
+
+func (s *Database) Ping(ctx context.Context) error {
+	return s.Cursor.Ping(ctx)
+}
+
+func (s *Database) Close(ctx context.Context) error {
+	if s.roller != nil {
+		s.roller.Stop()
+	}
+	if s.pruner != nil {
+		s.pruner.Stop()
+	}
+	return s.Cursor.CloseConnection(ctx)
+}
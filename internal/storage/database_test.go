@@ -0,0 +1,283 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/db"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestDatabaseStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+	delta := int64(3)
+
+	updated, err := s.Update(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *updated.Delta)
+	// одиночное наблюдение записывается сразу, вместе с ожидавшими в буфере
+	assert.Equal(t, 0, s.Cursor.Buffered())
+	stored, err := s.Cursor.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), *stored.Delta)
+}
+
+func TestDatabaseStorageLateCounter(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+	now := time.Now()
+	for _, sample := range []struct {
+		delta int64
+		at    time.Time
+	}{{5, now}, {2, now.Add(-time.Minute)}} {
+		delta, ms := sample.delta, sample.at.UnixMilli()
+		_, err = s.Update(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &ms})
+		require.NoError(t, err)
+	}
+
+	stored, err := s.Cursor.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *stored.Delta)
+}
+
+func TestDatabaseStorageLabelMatchers(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+
+	// память и БД выбирают из подходящих серий одну и ту же: точное совпадение, затем самые
+	// короткие метки, а не последнюю записанную серию и не первую по ключу
+	for i, labels := range []map[string]string{
+		{"host": "a", "z": "1"}, {"dc": "x", "host": "a"}, {"host": "a", "zone": "b"},
+	} {
+		value := float64(i)
+		_, err = s.Update(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Value: &value, Labels: labels})
+		require.NoError(t, err)
+	}
+	require.Zero(t, s.Cursor.Buffered())
+	for _, get := range []func(context.Context, *m.JSONMetrics) (*m.JSONMetrics, error){s.Get, s.Memory.Get} {
+		found, err := get(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Labels: map[string]string{"host": "a"}})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"host": "a", "z": "1"}, found.Labels)
+		assert.Equal(t, 0.0, *found.Value)
+	}
+	value := 5.0
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Value: &value, Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	for _, get := range []func(context.Context, *m.JSONMetrics) (*m.JSONMetrics, error){s.Get, s.Memory.Get} {
+		found, err := get(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Labels: map[string]string{"host": "a"}})
+		require.NoError(t, err)
+		assert.Equal(t, 5.0, *found.Value)
+	}
+}
+
+func TestDatabaseStorageBuffered(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+	s.Cursor.BatchSize = 100
+	first, second := int64(3), int64(4)
+
+	// наблюдения без времени клиента получают время поступления, а не время записи пачки
+	_, err = s.UpdateBatch(ctx, []*m.JSONMetrics{{ID: "Requests", MType: "counter", Delta: &first}})
+	require.NoError(t, err)
+	time.Sleep(5 * time.Millisecond)
+	_, err = s.UpdateBatch(ctx, []*m.JSONMetrics{{ID: "Requests", MType: "counter", Delta: &second}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, s.Cursor.Buffered())
+	found, err := s.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *found.Delta)
+
+	require.NoError(t, s.Cursor.Flush(ctx))
+	samples, err := s.Cursor.History(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"},
+		time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Len(t, samples, 2)
+	found, err = s.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *found.Delta)
+
+	// полный буфер отклоняет пачку до изменения памяти, поэтому повтор клиента не удваивает counter
+	maxRows := db.MaxBufferedRows
+	db.MaxBufferedRows = 0
+	defer func() { db.MaxBufferedRows = maxRows }()
+	_, err = s.UpdateBatch(ctx, []*m.JSONMetrics{{ID: "Requests", MType: "counter", Delta: &first}})
+	assert.ErrorIs(t, err, errors.ErrorBatchBufferFull)
+	found, err = s.Memory.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), *found.Delta)
+}
+
+func TestDatabaseStorageUnavailable(t *testing.T) {
+	ctx := context.Background()
+	cursor, err := db.NewCursor(ctx, "", "pgx")
+	require.NoError(t, err)
+	s := NewDatabase(col.NewCollector(), cursor)
+	value := 1.5
+
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	found, err := s.Get(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *found.Value)
+	assert.Error(t, s.Ping(ctx))
+
+	_, err = OpenPostgres(ctx, "", col.NewCollector())
+	assert.Error(t, err)
+}
+
+func TestSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	options := &config.ServerConfig{Database: "file:" + filepath.Join(t.TempDir(), "metrics.db")}
+	s, err := New(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	require.IsType(t, &Database{}, s)
+	value := 2.5
+
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, s.Ping(ctx))
+
+	// Новое хранилище над тем же файлом читает значение из БД, а не из памяти.
+	require.NoError(t, s.Close(ctx))
+	reopened, err := OpenSQLite(ctx, options.Database, col.NewCollector())
+	require.NoError(t, err)
+	found, err := reopened.Get(ctx, &m.JSONMetrics{ID: "Load", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 2.5, *found.Value)
+	require.NoError(t, reopened.Close(ctx))
+}
+
+func TestSQLiteHistory(t *testing.T) {
+	ctx := context.Background()
+	s, err := OpenSQLite(ctx, "file:"+filepath.Join(t.TempDir(), "metrics.db"), col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+
+	start := time.Now().Truncate(time.Minute).Add(-time.Minute)
+	delta := int64(5)
+	for _, offset := range []time.Duration{10 * time.Second, 40 * time.Second, 70 * time.Second} {
+		sampleTime := start.Add(offset).UnixMilli()
+		_, err = s.Update(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &sampleTime})
+		require.NoError(t, err)
+	}
+
+	var reader HistoryReader = s
+	points, err := reader.History(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"},
+		start, start.Add(2*time.Minute), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, m.Point{Timestamp: start.UnixMilli(), Avg: 7.5, Min: 5, Max: 10, Last: 10, Count: 2}, points[0])
+	assert.Equal(t, 15.0, points[1].Last)
+
+	unavailable := NewDatabase(col.NewCollector(), &db.Cursor{})
+	_, err = unavailable.History(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"},
+		start, start.Add(time.Minute), time.Minute)
+	assert.Equal(t, errors.ErrorHistoryUnavailable, err)
+}
+
+func TestDatabasePruningReport(t *testing.T) {
+	ctx := context.Background()
+	options := &config.ServerConfig{
+		Database:  "file:" + filepath.Join(t.TempDir(), "metrics.db"),
+		Retention: "counter=1h",
+	}
+	c := col.NewCollector()
+	store, err := New(ctx, options, c)
+	require.NoError(t, err)
+	require.NoError(t, store.Close(ctx))
+
+	s, err := OpenSQLite(ctx, options.Database, c)
+	require.NoError(t, err)
+	for i := int64(1); i <= 2; i++ {
+		delta := i
+		sampleTime := time.Now().Add(-time.Duration(4-i) * time.Hour).UnixMilli()
+		require.NoError(t, s.Cursor.Add(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &sampleTime}))
+	}
+	s.StartPruning(db.Retention{{MType: "counter", Keep: time.Hour}})
+	require.NoError(t, s.Close(ctx))
+
+	found, err := c.GetMetricJSON(&m.JSONMetrics{ID: PrunedRowsMetric, MType: "counter",
+		Labels: map[string]string{"type": "counter"}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), *found.Delta)
+
+	_, err = New(ctx, &config.ServerConfig{Database: options.Database, Retention: "gauge"}, c)
+	assert.Equal(t, errors.ErrorRetention, err)
+}
+
+func TestDatabaseMigrateOnStartup(t *testing.T) {
+	ctx := context.Background()
+	options := &config.ServerConfig{Database: "file:" + filepath.Join(t.TempDir(), "metrics.db"), Migrate: true}
+	s, err := New(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	defer s.Close(ctx)
+
+	states, err := s.(*Database).Cursor.MigrationStatus(ctx)
+	require.NoError(t, err)
+	for _, state := range states {
+		assert.True(t, state.Applied, state.Name)
+	}
+}
+
+func TestDatabaseRestoreOnStartup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	options := &config.ServerConfig{Database: "file:" + filepath.Join(dir, "metrics.db"), Restore: true}
+	delta := int64(4)
+
+	s, err := New(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		_, err = s.Update(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter", Delta: &delta})
+		require.NoError(t, err)
+	}
+	_, err = s.DeclareMetadata(ctx, &m.Metadata{Name: "Latency", MType: "histogram", Unit: "ms"})
+	require.NoError(t, err)
+	_, err = s.DeclareMetadata(ctx, &m.Metadata{Name: "Latency", MType: "histogram", Help: "request latency"})
+	require.NoError(t, err)
+	require.NoError(t, s.Close(ctx))
+
+	// счётчик продолжается с итога из БД, а не с нуля; описания метрик восстанавливаются
+	c := col.NewCollector()
+	restored, err := New(ctx, options, c)
+	require.NoError(t, err)
+	meta, ok := c.GetMetadata("Latency")
+	require.True(t, ok)
+	assert.Equal(t, m.Metadata{Name: "Latency", MType: "histogram", Unit: "ms", Help: "request latency"}, *meta)
+	updated, err := restored.Update(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter", Delta: &delta})
+	require.NoError(t, err)
+	assert.Equal(t, int64(16), *updated.Delta)
+	require.NoError(t, restored.Close(ctx))
+
+	// источником может быть выбран файл: в нём счётчика нет
+	fileOptions := *options
+	fileOptions.RestoreFrom = RestoreFromFile
+	fileOptions.StoreFile = "/missing-metrics.json"
+	c = col.NewCollector()
+	fromFile, err := New(ctx, &fileOptions, c)
+	require.NoError(t, err)
+	_, err = c.GetMetric("PollCount")
+	assert.Error(t, err)
+	require.NoError(t, fromFile.Close(ctx))
+
+	fileOptions.RestoreFrom = "cache"
+	_, err = New(ctx, &fileOptions, col.NewCollector())
+	assert.ErrorIs(t, err, errors.ErrorRestoreSource)
+}
@@ -0,0 +1,265 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/file"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	// Период сброса журнала на диск: при сбое теряется не больше этого интервала обновлений.
+	WALSyncInterval = time.Second
+	// Число записей журнала, после которого снимок записывается, не дожидаясь периода сохранения.
+	WALCompactRecords = 10000
+)
+
+// Хранилище в памяти с журналом предзаписи. Каждое обновление дописывается в журнал path.wal,
+// снимок метрик периодически атомарно записывается в файл path, после чего журнал очищается.
+// При восстановлении к снимку применяются записи журнала, не вошедшие в него.
+// При нулевом интервале журнал сбрасывается на диск после каждого обновления.
+type File struct {
+	*Memory
+	path        string
+	interval    time.Duration
+	generations int
+	codec       string
+	wal         *file.WAL
+	mu          sync.Mutex
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// Конструктор файлового хранилища. При restore коллектор заполняется сохранёнными данными.
+// Снимок записывается сразу, чтобы журнал начинался с чистого файла. Хранится generations поколений снимка,
+// сжатых кодеком codec; при чтении кодек определяется автоматически.
+func NewFile(
+	collector *col.Collector, path string, restore bool, interval time.Duration, generations int, codec string,
+) (*File, error) {
+	if generations <= 0 {
+		generations = file.DefaultSnapshotGenerations
+	}
+	parsed, err := file.ParseCodec(codec)
+	if err != nil {
+		log.ErrorLog.Printf("Error with snapshot codec %s: %e", codec, err)
+		return nil, err
+	}
+	s := &File{
+		Memory:      NewMemory(collector),
+		path:        path,
+		interval:    interval,
+		generations: generations,
+		codec:       parsed,
+		done:        make(chan struct{}),
+	}
+	var seq uint64
+	if restore {
+		if seq, err = restoreFile(s.Collector, s.path, s.generations); err != nil {
+			return nil, err
+		}
+	}
+	wal, err := file.OpenWAL(s.walPath(), seq)
+	if err != nil {
+		log.ErrorLog.Printf("Error opening WAL: %e", err)
+		return nil, err
+	}
+	s.wal = wal
+	if !restore {
+		if err = s.wal.Reset(); err != nil {
+			log.ErrorLog.Printf("Error resetting WAL: %e", err)
+			return nil, err
+		}
+	}
+	if err = s.Save(); err != nil {
+		return nil, err
+	}
+	s.wg.Add(1)
+	go s.run()
+	return s, nil
+}
+
+func (s *File) walPath() string {
+	return walPath(s.path)
+}
+
+// Функция, возвращающая путь журнала предзаписи для файла снимка path.
+func walPath(path string) string {
+	return path + ".wal"
+}
+
+// Функция, восстанавливающая метрики коллектора из самого нового целого поколения снимка path
+// и журнала. Возвращает номер последней применённой записи. Если все поколения повреждены,
+// возвращается ошибка, чтобы сервер не запустился молча с пустым хранилищем.
+func restoreFile(collector *col.Collector, path string, generations int) (uint64, error) {
+	log.InfoLog.Println("Restoring configuration from file...")
+	storedMetrics, seq, err := file.ReadSnapshot(path, generations)
+	if err != nil {
+		log.ErrorLog.Printf("Error happened during snapshot reading: %e", err)
+		return 0, err
+	}
+	collector.Restore(storedMetrics)
+	seq, err = file.ReplayWAL(walPath(path), seq, func(record *file.Record) {
+		if record.Metadata != nil {
+			if _, err := collector.DeclareMetadata(record.Metadata); err != nil {
+				log.ErrorLog.Printf("Error replaying WAL record %d: %e", record.Seq, err)
+			}
+			return
+		}
+		if _, err := collector.UpdateBatch(record.Metrics); err != nil {
+			log.ErrorLog.Printf("Error replaying WAL record %d: %e", record.Seq, err)
+		}
+	})
+	if err != nil {
+		log.ErrorLog.Printf("Error happened during WAL replay: %e", err)
+	}
+	log.InfoLog.Println("Configuration restored.")
+	return seq, nil
+}
+
+func (s *File) run() {
+	defer s.wg.Done()
+	syncTicker := time.NewTicker(WALSyncInterval)
+	defer syncTicker.Stop()
+	// без периода сохранения снимок записывается только по размеру журнала и при остановке
+	var save <-chan time.Time
+	if s.interval > 0 {
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+		save = ticker.C
+	}
+
+	for {
+		select {
+		case <-s.done:
+			log.InfoLog.Println("Stop saving file")
+			return
+		case <-syncTicker.C:
+			if err := s.Sync(); err != nil {
+				log.ErrorLog.Printf("Error happened during WAL sync: %e", err)
+			}
+		case <-save:
+			if err := s.Save(); err != nil {
+				log.ErrorLog.Printf("Error happened during saving metrics to JSON: %e", err)
+			}
+		}
+	}
+}
+
+// Метод, сбрасывающий журнал на диск.
+func (s *File) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.wal.Sync()
+}
+
+// Метод, записывающий снимок метрик в файл и очищающий журнал. Устаревшие серии удаляются до записи,
+// чтобы не восстанавливаться после рестарта.
+func (s *File) Save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save()
+}
+
+// Метод записи снимка, вызываемый под мьютексом хранилища. Снимок хранит номер последней записи журнала,
+// поэтому сбой между записью снимка и очисткой журнала не приводит к повторному применению записей.
+func (s *File) save() error {
+	s.Collector.EvictStale(time.Now())
+	if err := file.WriteSnapshot(s.path, s.Collector.Snapshot(), s.wal.Seq(), s.generations, s.codec); err != nil {
+		log.ErrorLog.Printf("Error writing snapshot: %e", err)
+		return err
+	}
+	if err := s.wal.Reset(); err != nil {
+		log.ErrorLog.Printf("Error resetting WAL: %e", err)
+		return err
+	}
+	log.InfoLog.Println("Metrics successfully saved to file")
+	return nil
+}
+
+// Метод, дописывающий пакет в журнал до его применения, вызываемый под мьютексом хранилища.
+// Наблюдениям без времени проставляется время получения, чтобы повтор журнала принимал
+// те же решения о запоздавших значениях.
+func (s *File) logBatch(batch []*m.JSONMetrics) error {
+	now := time.Now().UnixMilli()
+	record := make([]*m.JSONMetrics, len(batch))
+	for i, metric := range batch {
+		if metric.Timestamp == nil {
+			stamped := *metric
+			stamped.Timestamp = &now
+			metric = &stamped
+		}
+		record[i] = metric
+	}
+	if _, err := s.wal.Append(record); err != nil {
+		log.ErrorLog.Printf("Error appending to WAL: %e", err)
+		return err
+	}
+	if s.interval == 0 {
+		return s.wal.Sync()
+	}
+	return nil
+}
+
+// Метод, записывающий снимок, если журнал вырос до WALCompactRecords записей.
+func (s *File) compact() {
+	if s.wal.Records() < WALCompactRecords {
+		return
+	}
+	if err := s.save(); err != nil {
+		log.ErrorLog.Printf("Error happened during WAL compaction: %e", err)
+	}
+}
+
+func (s *File) Update(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.logBatch([]*m.JSONMetrics{metric}); err != nil {
+		return &m.JSONMetrics{}, err
+	}
+	defer s.compact()
+	return s.Memory.Update(ctx, metric)
+}
+
+func (s *File) UpdateBatch(ctx context.Context, batch []*m.JSONMetrics) ([]*m.JSONMetrics, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.logBatch(batch); err != nil {
+		return nil, err
+	}
+	defer s.compact()
+	return s.Memory.UpdateBatch(ctx, batch)
+}
+
+// Метод, регистрирующий описание метрики и дописывающий итоговое описание в журнал,
+// чтобы объявления между снимками переживали сбой.
+func (s *File) DeclareMetadata(ctx context.Context, meta *m.Metadata) (*m.Metadata, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := s.Memory.DeclareMetadata(ctx, meta)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.wal.AppendMetadata(stored); err != nil {
+		log.ErrorLog.Printf("Error appending to WAL: %e", err)
+		return stored, err
+	}
+	defer s.compact()
+	if s.interval == 0 {
+		return stored, s.wal.Sync()
+	}
+	return stored, nil
+}
+
+// Метод, останавливающий фоновые задачи, записывающий итоговый снимок и закрывающий журнал.
+func (s *File) Close(ctx context.Context) error {
+	close(s.done)
+	s.wg.Wait()
+	if err := s.Save(); err != nil {
+		return err
+	}
+	return s.wal.Close()
+}
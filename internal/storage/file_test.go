@@ -0,0 +1,113 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestFileStorageRestore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	value := 36.6
+
+	s, err := NewFile(col.NewCollector(), path, false, 0, 0, "")
+	require.NoError(t, err)
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "Temperature", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, s.Close(ctx))
+
+	restored, err := NewFile(col.NewCollector(), path, true, time.Hour, 0, "")
+	require.NoError(t, err)
+	found, err := restored.Get(ctx, &m.JSONMetrics{ID: "Temperature", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 36.6, *found.Value)
+	require.NoError(t, restored.Close(ctx))
+
+	empty, err := NewFile(col.NewCollector(), filepath.Join(t.TempDir(), "missing.json"), true, 0, 0, "")
+	require.NoError(t, err)
+	_, err = empty.Get(ctx, &m.JSONMetrics{ID: "Temperature", MType: "gauge"})
+	assert.Error(t, err)
+	require.NoError(t, empty.Close(ctx))
+}
+
+func TestFileStorageReplayWAL(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	delta := int64(5)
+	value := 1.5
+
+	s, err := NewFile(col.NewCollector(), path, false, time.Hour, 0, "")
+	require.NoError(t, err)
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter", Delta: &delta})
+	require.NoError(t, err)
+	require.NoError(t, s.Save())
+	_, err = s.UpdateBatch(ctx, []*m.JSONMetrics{
+		{ID: "PollCount", MType: "counter", Delta: &delta},
+		{ID: "Alloc", MType: "gauge", Value: &value},
+	})
+	require.NoError(t, err)
+	_, err = s.DeclareMetadata(ctx, &m.Metadata{Name: "Alloc", MType: "gauge", Unit: "bytes"})
+	require.NoError(t, err)
+
+	// хранилище не закрывается: восстановление видит снимок и записи журнала после него
+	c := col.NewCollector()
+	restored, err := NewFile(c, path, true, time.Hour, 0, "")
+	require.NoError(t, err)
+	meta, ok := c.GetMetadata("Alloc")
+	require.True(t, ok)
+	assert.Equal(t, "bytes", meta.Unit)
+	counter, err := restored.Get(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *counter.Delta)
+	gauge, err := restored.Get(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.5, *gauge.Value)
+	require.NoError(t, restored.Close(ctx))
+
+	again, err := NewFile(col.NewCollector(), path, true, time.Hour, 0, "")
+	require.NoError(t, err)
+	counter, err = again.Get(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(10), *counter.Delta)
+	require.NoError(t, again.Close(ctx))
+
+	close(s.done)
+	s.wg.Wait()
+	require.NoError(t, s.wal.Close())
+}
+
+func TestFileStorageSnapshotFallback(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.json")
+	value := 1.0
+
+	s, err := NewFile(col.NewCollector(), path, false, time.Hour, 2, "")
+	require.NoError(t, err)
+	_, err = s.Update(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge", Value: &value})
+	require.NoError(t, err)
+	require.NoError(t, s.Save())
+	require.NoError(t, s.Close(ctx))
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o666))
+
+	restored, err := NewFile(col.NewCollector(), path, true, time.Hour, 2, "")
+	require.NoError(t, err)
+	gauge, err := restored.Get(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge"})
+	require.NoError(t, err)
+	assert.Equal(t, 1.0, *gauge.Value)
+	require.NoError(t, restored.Close(ctx))
+
+	require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o666))
+	require.NoError(t, os.WriteFile(path+".1", []byte("garbage"), 0o666))
+	_, err = NewFile(col.NewCollector(), path, true, time.Hour, 2, "")
+	assert.ErrorIs(t, err, errors.ErrorSnapshot)
+}
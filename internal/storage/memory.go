@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"sort"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+)
+
+// Хранилище в памяти: все серии живут в коллекторе и теряются при остановке сервера.
+type Memory struct {
+	Collector *col.Collector
+}
+
+// Конструктор хранилища в памяти поверх коллектора.
+func NewMemory(collector *col.Collector) *Memory {
+	return &Memory{Collector: collector}
+}
+
+func (s *Memory) Update(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	return s.Collector.UpdateMetricFromJSON(metric)
+}
+
+func (s *Memory) UpdateBatch(ctx context.Context, batch []*m.JSONMetrics) ([]*m.JSONMetrics, error) {
+	return s.Collector.UpdateBatch(batch)
+}
+
+func (s *Memory) Get(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	return s.Collector.GetMetricJSON(metric)
+}
+
+// Метод, возвращающий серию с точным набором меток. Память актуальна и для хранилищ поверх неё:
+// все наблюдения применяются к коллектору до записи в БД или файл.
+func (s *Memory) GetSeries(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	return s.Collector.GetSeries(metric)
+}
+
+func (s *Memory) DeclareMetadata(ctx context.Context, meta *m.Metadata) (*m.Metadata, error) {
+	return s.Collector.DeclareMetadata(meta)
+}
+
+func (s *Memory) List(ctx context.Context) ([]*m.JSONMetrics, error) {
+	return ListSnapshot(s.Collector.Snapshot()), nil
+}
+
+func (s *Memory) Snapshot(ctx context.Context) (*m.Metrics, error) {
+	return s.Collector.Snapshot(), nil
+}
+
+func (s *Memory) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Memory) Close(ctx context.Context) error {
+	return nil
+}
+
+// Функция, раскладывающая снимок метрик в список серий, упорядоченный по ключу.
+func ListSnapshot(snapshot *m.Metrics) []*m.JSONMetrics {
+	list := make([]*m.JSONMetrics, 0, len(snapshot.GaugeMetrics)+len(snapshot.CounterMetrics))
+	series := func(key, mtype string) *m.JSONMetrics {
+		metric := &m.JSONMetrics{MType: mtype}
+		metric.ID, metric.Labels = m.ParseSeriesKey(key)
+		if ts, ok := snapshot.Timestamps[key]; ok {
+			metric.Timestamp = &ts
+		}
+		list = append(list, metric)
+		return metric
+	}
+	for key, value := range snapshot.GaugeMetrics {
+		gauge := float64(value)
+		series(key, "gauge").Value = &gauge
+	}
+	for key, value := range snapshot.CounterMetrics {
+		counter := int64(value)
+		series(key, "counter").Delta = &counter
+	}
+	for key, value := range snapshot.HistogramMetrics {
+		series(key, "histogram").Histogram = value
+	}
+	for key, value := range snapshot.SummaryMetrics {
+		series(key, "summary").Summary = value
+	}
+	for key, value := range snapshot.SetMetrics {
+		metric := series(key, "set")
+		estimate := value.Estimate()
+		metric.Set, metric.Estimate = value, &estimate
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key() < list[j].Key()
+	})
+	return list
+}
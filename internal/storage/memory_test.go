@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestMemoryStorage(t *testing.T) {
+	ctx := context.Background()
+	s := NewMemory(col.NewCollector())
+	value := 36.6
+	delta := int64(2)
+
+	updated, err := s.Update(ctx, &m.JSONMetrics{ID: "Temperature", MType: "gauge", Value: &value,
+		Labels: map[string]string{"host": "a"}})
+	require.NoError(t, err)
+	assert.Equal(t, 36.6, *updated.Value)
+	accepted, err := s.UpdateBatch(ctx, []*m.JSONMetrics{
+		{ID: "Requests", MType: "counter", Delta: &delta},
+		{ID: "Requests", MType: "counter", Delta: &delta},
+	})
+	require.NoError(t, err)
+	assert.Len(t, accepted, 2)
+
+	found, err := s.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *found.Delta)
+	_, err = s.Get(ctx, &m.JSONMetrics{ID: "Unknown", MType: "gauge"})
+	assert.Equal(t, errors.ErrorMetricNotFound, err)
+
+	list, err := s.List(ctx)
+	require.NoError(t, err)
+	var temperature *m.JSONMetrics
+	for i := 1; i < len(list); i++ {
+		assert.Less(t, list[i-1].Key(), list[i].Key())
+	}
+	for _, metric := range list {
+		if metric.ID == "Temperature" {
+			temperature = metric
+		}
+	}
+	require.NotNil(t, temperature)
+	assert.Equal(t, map[string]string{"host": "a"}, temperature.Labels)
+
+	snapshot, err := s.Snapshot(ctx)
+	require.NoError(t, err)
+	snapshot.CounterMetrics["Requests"] = 100
+	found, err = s.Get(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), *found.Delta)
+
+	assert.NoError(t, s.Ping(ctx))
+	assert.NoError(t, s.Close(ctx))
+}
@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"time"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/db"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/log"
+	"github.com/nmramorov/gowatcher/internal/tsdb"
+)
+
+// Префикс DSN, по которому выбирается SQLite.
+const SQLitePrefix = "file:"
+
+// Источники восстановления метрик при запуске с БД.
+const (
+	RestoreFromDB   = "db"   // последние значения серий в БД
+	RestoreFromFile = "file" // снимок и журнал файлового хранилища
+)
+
+// Интерфейс хранилища метрик, через который работают HTTP- и gRPC-обработчики.
+type Storage interface {
+	// Update применяет наблюдение и возвращает итоговое значение серии.
+	Update(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error)
+	// UpdateBatch применяет пакет наблюдений и возвращает принятые.
+	UpdateBatch(ctx context.Context, batch []*m.JSONMetrics) ([]*m.JSONMetrics, error)
+	// Get возвращает серию по имени, типу и условиям на метки.
+	Get(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error)
+	// GetSeries возвращает серию по имени, типу и точному набору меток.
+	GetSeries(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error)
+	// List возвращает все серии, упорядоченные по ключу.
+	List(ctx context.Context) ([]*m.JSONMetrics, error)
+	// DeclareMetadata регистрирует описание метрики и возвращает итоговое описание.
+	DeclareMetadata(ctx context.Context, meta *m.Metadata) (*m.Metadata, error)
+	// Snapshot возвращает копию всех серий вместе с описаниями.
+	Snapshot(ctx context.Context) (*m.Metrics, error)
+	Ping(ctx context.Context) error
+	Close(ctx context.Context) error
+}
+
+// Необязательный интерфейс хранилища, умеющего отдавать историю серии.
+// Обработчики проверяют его наличие приведением типа.
+type HistoryReader interface {
+	// History возвращает точки истории серии за полуинтервал [from, to) с шагом step.
+	History(ctx context.Context, metric *m.JSONMetrics, from, to time.Time, step time.Duration) ([]m.Point, error)
+}
+
+// Функция, возвращающая адаптер database/sql для DSN: SQLite для DSN вида file:metrics.db, иначе Postgres.
+func Adaptor(dsn string) string {
+	if strings.HasPrefix(dsn, SQLitePrefix) {
+		return db.SQLiteAdaptor
+	}
+	return db.PostgresAdaptor
+}
+
+// Функция, выбирающая хранилище по конфигурации сервера: SQLite для DSN вида file:metrics.db,
+// Postgres для остальных DSN, файл, если задан путь к нему, иначе только память.
+// Для БД запускаются свёртка истории, если задан её возраст, и очистка по правилам хранения;
+// при восстановлении метрики загружаются из источника, выбранного RestoreFrom.
+// Без БД история хранится во встроенной базе временных рядов, если задан её каталог.
+func New(ctx context.Context, options *config.ServerConfig, collector *col.Collector) (Storage, error) {
+	if options.Database != "" {
+		retention, err := db.ParseRetention(options.Retention)
+		if err != nil {
+			log.ErrorLog.Printf("wrong retention rules %q: %e", options.Retention, err)
+			return nil, err
+		}
+		adaptor := Adaptor(options.Database)
+		log.InfoLog.Printf("Using %s storage", adaptor)
+		database, err := open(ctx, options.Database, adaptor, collector, options.Migrate)
+		if err != nil {
+			return nil, err
+		}
+		if options.Restore {
+			if err = restoreDatabase(ctx, database, options); err != nil {
+				if closeErr := database.Close(ctx); closeErr != nil {
+					log.ErrorLog.Printf("could not close storage: %e", closeErr)
+				}
+				return nil, err
+			}
+		}
+		if options.RollupAfter > 0 {
+			database.StartRollups(time.Duration(options.RollupAfter) * time.Second)
+		}
+		database.StartPruning(retention)
+		return database, nil
+	}
+	store, err := newLocal(options, collector)
+	if err != nil || options.TSDBPath == "" {
+		return store, err
+	}
+	history, err := tsdb.Open(options.TSDBPath, time.Duration(options.TSDBRetention)*time.Second)
+	if err != nil {
+		log.ErrorLog.Printf("could not open TSDB at %s: %e", options.TSDBPath, err)
+		if closeErr := store.Close(ctx); closeErr != nil {
+			log.ErrorLog.Printf("could not close storage: %e", closeErr)
+		}
+		return nil, err
+	}
+	history.Start()
+	log.InfoLog.Printf("Keeping history in TSDB at %s", options.TSDBPath)
+	return NewTSDB(store, history), nil
+}
+
+// Функция, восстанавливающая метрики при запуске с БД из источника options.RestoreFrom:
+// последних значений серий в БД или снимка файлового хранилища.
+func restoreDatabase(ctx context.Context, database *Database, options *config.ServerConfig) error {
+	switch options.RestoreFrom {
+	case "", RestoreFromDB:
+		return database.Restore(ctx)
+	case RestoreFromFile:
+		if options.StoreFile == "" {
+			log.InfoLog.Println("No store file to restore from")
+			return nil
+		}
+		path, err := storeFilePath(options)
+		if err != nil {
+			return err
+		}
+		_, err = restoreFile(database.Collector, path, options.SnapshotGenerations)
+		return err
+	}
+	log.ErrorLog.Printf("wrong restore source %q", options.RestoreFrom)
+	return errors.ErrorRestoreSource
+}
+
+// Функция, возвращающая путь файла снимка относительно рабочего каталога.
+func storeFilePath(options *config.ServerConfig) (string, error) {
+	path, err := filepath.Abs(".")
+	if err != nil {
+		log.ErrorLog.Printf("no file to save exist: %e", err)
+		return "", err
+	}
+	return path + options.StoreFile, nil
+}
+
+// Функция, выбирающая хранилище без БД: файл, если задан путь к нему, иначе только память.
+func newLocal(options *config.ServerConfig, collector *col.Collector) (Storage, error) {
+	if options.StoreFile != "" {
+		path, err := storeFilePath(options)
+		if err != nil {
+			return nil, err
+		}
+		log.InfoLog.Println("Using file storage")
+		store, err := NewFile(collector, path, options.Restore,
+			time.Duration(options.StoreInterval)*time.Second, options.SnapshotGenerations, options.SnapshotCodec)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	}
+	log.InfoLog.Println("Using memory storage")
+	return NewMemory(collector), nil
+}
@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Необязательный интерфейс хранилища, умеющего отдавать сырые значения серии для выгрузки.
+type SampleReader interface {
+	// Samples возвращает сохранённые значения gauge или counter за полуинтервал [from, to).
+	Samples(ctx context.Context, metric *m.JSONMetrics, from, to time.Time) ([]m.Sample, error)
+}
+
+// Необязательный интерфейс хранилища, сворачивающего историю: агрегаты серии для выгрузки.
+type RollupReader interface {
+	// Rollups возвращает агрегаты gauge или counter всех разрешений с началом интервала в [from, to).
+	Rollups(ctx context.Context, metric *m.JSONMetrics, from, to time.Time) ([]m.Rollup, error)
+}
+
+// Интерфейс хранилища, принимающего выгрузку. Реализуется всеми хранилищами;
+// хранилища без истории возвращают ErrorHistoryUnavailable из ImportHistory и ImportRollups.
+type Importer interface {
+	// ImportState заменяет текущие значения перечисленных серий и сохраняет их.
+	ImportState(ctx context.Context, list []*m.JSONMetrics) error
+	// ImportHistory дописывает значения серий с временем наблюдения в историю.
+	ImportHistory(ctx context.Context, samples []*m.JSONMetrics) error
+	// ImportRollups дописывает агрегаты свёрнутой истории серий.
+	ImportRollups(ctx context.Context, rollups []m.SeriesRollup) error
+}
+
+// Функция, открывающая хранилище из конфигурации сервера для выгрузки или загрузки:
+// сохранённые метрики всегда восстанавливаются, фоновые свёртка и очистка истории не запускаются.
+func OpenForTransfer(ctx context.Context, options *config.ServerConfig, collector *col.Collector) (Storage, error) {
+	transfer := *options
+	transfer.Restore = true
+	transfer.RollupAfter = 0
+	transfer.Retention = ""
+	return New(ctx, &transfer, collector)
+}
+
+// Функция, собирающая снимок метрик из списка серий; обратная к ListSnapshot.
+func SnapshotFromList(list []*m.JSONMetrics) *m.Metrics {
+	snapshot := &m.Metrics{}
+	snapshot.EnsureInitialized()
+	for _, metric := range list {
+		key := metric.Key()
+		switch {
+		case metric.MType == "gauge" && metric.Value != nil:
+			snapshot.GaugeMetrics[key] = m.Gauge(*metric.Value)
+		case metric.MType == "counter" && metric.Delta != nil:
+			snapshot.CounterMetrics[key] = m.Counter(*metric.Delta)
+		case metric.MType == "histogram" && metric.Histogram != nil:
+			snapshot.HistogramMetrics[key] = metric.Histogram
+		case metric.MType == "summary" && metric.Summary != nil:
+			snapshot.SummaryMetrics[key] = metric.Summary
+		case metric.MType == "set" && metric.Set != nil:
+			snapshot.SetMetrics[key] = metric.Set
+		default:
+			continue
+		}
+		if metric.Timestamp != nil {
+			snapshot.Timestamps[key] = *metric.Timestamp
+		}
+	}
+	return snapshot
+}
+
+// Метод, заменяющий значения перечисленных серий в коллекторе; остальные серии сохраняются.
+func (s *Memory) ImportState(ctx context.Context, list []*m.JSONMetrics) error {
+	snapshot := s.Collector.Snapshot()
+	imported := SnapshotFromList(list)
+	for key, value := range imported.GaugeMetrics {
+		snapshot.GaugeMetrics[key] = value
+	}
+	for key, value := range imported.CounterMetrics {
+		snapshot.CounterMetrics[key] = value
+	}
+	for key, value := range imported.HistogramMetrics {
+		snapshot.HistogramMetrics[key] = value
+	}
+	for key, value := range imported.SummaryMetrics {
+		snapshot.SummaryMetrics[key] = value
+	}
+	for key, value := range imported.SetMetrics {
+		snapshot.SetMetrics[key] = value
+	}
+	for key, value := range imported.Timestamps {
+		snapshot.Timestamps[key] = value
+	}
+	s.Collector.Restore(snapshot)
+	return nil
+}
+
+func (s *Memory) ImportHistory(ctx context.Context, samples []*m.JSONMetrics) error {
+	return errors.ErrorHistoryUnavailable
+}
+
+func (s *Memory) ImportRollups(ctx context.Context, rollups []m.SeriesRollup) error {
+	return errors.ErrorHistoryUnavailable
+}
+
+// Метод, заменяющий значения серий и сразу записывающий снимок, чтобы загрузка пережила рестарт.
+func (s *File) ImportState(ctx context.Context, list []*m.JSONMetrics) error {
+	if err := s.Memory.ImportState(ctx, list); err != nil {
+		return err
+	}
+	return s.Save()
+}
+
+// Метод, заменяющий значения серий и записывающий их строками в БД,
+// чтобы восстановление последних значений вернуло загруженные итоги.
+func (s *Database) ImportState(ctx context.Context, list []*m.JSONMetrics) error {
+	if err := s.Memory.ImportState(ctx, list); err != nil {
+		return err
+	}
+	return s.ImportHistory(ctx, list)
+}
+
+// Метод, записывающий значения серий строками в БД с переданным временем наблюдения.
+func (s *Database) ImportHistory(ctx context.Context, samples []*m.JSONMetrics) error {
+	if !s.Cursor.IsValid {
+		return errors.ErrorHistoryUnavailable
+	}
+	if err := s.Cursor.AddBatchV2(ctx, samples); err != nil {
+		return err
+	}
+	return s.Cursor.Flush(ctx)
+}
+
+// Метод, записывающий агрегаты свёрнутой истории в таблицы агрегатов БД.
+func (s *Database) ImportRollups(ctx context.Context, rollups []m.SeriesRollup) error {
+	if !s.Cursor.IsValid {
+		return errors.ErrorHistoryUnavailable
+	}
+	return s.Cursor.AddRollups(ctx, rollups)
+}
+
+// Метод, возвращающий агрегаты свёрнутой истории серии из БД.
+func (s *Database) Rollups(ctx context.Context, metric *m.JSONMetrics, from, to time.Time) ([]m.Rollup, error) {
+	if !s.Cursor.IsValid {
+		return nil, errors.ErrorHistoryUnavailable
+	}
+	return s.Cursor.Rollups(ctx, metric, from, to)
+}
+
+// Метод, возвращающий несвёрнутые значения серии из БД.
+func (s *Database) Samples(ctx context.Context, metric *m.JSONMetrics, from, to time.Time) ([]m.Sample, error) {
+	if !s.Cursor.IsValid {
+		return nil, errors.ErrorHistoryUnavailable
+	}
+	return s.Cursor.History(ctx, metric, from, to)
+}
+
+func (s *TSDB) ImportState(ctx context.Context, list []*m.JSONMetrics) error {
+	importer, ok := s.Storage.(Importer)
+	if !ok {
+		return errors.ErrorHistoryUnavailable
+	}
+	return importer.ImportState(ctx, list)
+}
+
+// Метод, дописывающий значения gauge и counter во встроенную базу временных рядов.
+func (s *TSDB) ImportHistory(ctx context.Context, samples []*m.JSONMetrics) error {
+	for _, metric := range samples {
+		if err := s.record(metric); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Встроенная база временных рядов не сворачивает историю: агрегаты не загружаются.
+func (s *TSDB) ImportRollups(ctx context.Context, rollups []m.SeriesRollup) error {
+	return errors.ErrorHistoryUnavailable
+}
+
+// Метод, возвращающий значения серии из встроенной базы временных рядов.
+func (s *TSDB) Samples(ctx context.Context, metric *m.JSONMetrics, from, to time.Time) ([]m.Sample, error) {
+	return s.DB.Samples(metric.MType, metric.ID, metric.Labels, from, to)
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+func TestTransferBetweenStorages(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source, err := OpenSQLite(ctx, "file:"+filepath.Join(dir, "source.db"), col.NewCollector())
+	require.NoError(t, err)
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	delta := int64(5)
+	for i := 0; i < 3; i++ {
+		sampleTime := start.Add(time.Duration(i) * time.Minute).UnixMilli()
+		_, err = source.Update(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta, Timestamp: &sampleTime})
+		require.NoError(t, err)
+	}
+	list, err := source.List(ctx)
+	require.NoError(t, err)
+	var reader SampleReader = source
+	samples, err := reader.Samples(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"}, start, time.Now())
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	history := make([]*m.JSONMetrics, 0, len(samples))
+	for _, sample := range samples {
+		total, timestamp := int64(sample.Value), sample.Time.UnixMilli()
+		history = append(history, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &total, Timestamp: &timestamp})
+	}
+	require.NoError(t, source.Close(ctx))
+
+	// в БД загружаются и история, и итоги, с которых продолжается счётчик после восстановления
+	options := &config.ServerConfig{Database: "file:" + filepath.Join(dir, "target.db")}
+	target, err := OpenForTransfer(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	importer := target.(Importer)
+	require.NoError(t, importer.ImportHistory(ctx, history))
+	require.NoError(t, importer.ImportState(ctx, list))
+	// итог совпадает с последним значением истории и не добавляет строку
+	samples, err = target.(SampleReader).Samples(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter"}, start, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, samples, 3)
+	require.NoError(t, target.Close(ctx))
+
+	restored, err := OpenForTransfer(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	updated, err := restored.Update(ctx, &m.JSONMetrics{ID: "Requests", MType: "counter", Delta: &delta})
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), *updated.Delta)
+	require.NoError(t, restored.Close(ctx))
+
+	// файловое хранилище принимает только итоги и сразу сохраняет их в снимок
+	path := filepath.Join(dir, "metrics.json")
+	file, err := NewFile(col.NewCollector(), path, false, time.Minute, 0, "")
+	require.NoError(t, err)
+	assert.ErrorIs(t, file.ImportHistory(ctx, history), errors.ErrorHistoryUnavailable)
+	require.NoError(t, file.ImportState(ctx, list))
+	require.NoError(t, restoreFileInto(t, path))
+}
+
+func restoreFileInto(t *testing.T, path string) error {
+	c := col.NewCollector()
+	if _, err := restoreFile(c, path, 0); err != nil {
+		return err
+	}
+	value, err := c.GetMetric("Requests")
+	require.NoError(t, err)
+	assert.Equal(t, m.Counter(15), value)
+	return nil
+}
+
+func TestTransferRollups(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source, err := OpenSQLite(ctx, "file:"+filepath.Join(dir, "source.db"), col.NewCollector())
+	require.NoError(t, err)
+	start := time.Now().Add(-3 * time.Hour).Truncate(time.Hour)
+	for i := 0; i < 3; i++ {
+		value, sampleTime := float64(i+1), start.Add(time.Duration(i)*time.Minute).UnixMilli()
+		_, err = source.Update(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge", Value: &value, Timestamp: &sampleTime})
+		require.NoError(t, err)
+	}
+	// свёрнутая история, кроме последнего значения серии, остаётся только в агрегатах и выгружается из них
+	require.NoError(t, source.Cursor.Rollup(ctx, time.Now()))
+	series := &m.JSONMetrics{ID: "Alloc", MType: "gauge"}
+	samples, err := source.Samples(ctx, series, start, time.Now())
+	require.NoError(t, err)
+	assert.Len(t, samples, 1)
+	var reader RollupReader = source
+	rollups, err := reader.Rollups(ctx, series, start, time.Now())
+	require.NoError(t, err)
+	require.NotEmpty(t, rollups)
+	require.NoError(t, source.Close(ctx))
+
+	batch := make([]m.SeriesRollup, 0, len(rollups))
+	for _, rollup := range rollups {
+		batch = append(batch, m.SeriesRollup{Series: series, Rollup: rollup})
+	}
+	target, err := OpenSQLite(ctx, "file:"+filepath.Join(dir, "target.db"), col.NewCollector())
+	require.NoError(t, err)
+	require.NoError(t, target.ImportRollups(ctx, batch))
+	imported, err := target.Rollups(ctx, series, start, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, rollups, imported)
+	require.NoError(t, target.Close(ctx))
+
+	// агрегат с разрешением, которого нет в БД, не загружается
+	target, err = OpenSQLite(ctx, "file:"+filepath.Join(dir, "target.db"), col.NewCollector())
+	require.NoError(t, err)
+	wrong := m.SeriesRollup{Series: series, Rollup: m.Rollup{Step: 7, Point: rollups[0].Point}}
+	assert.ErrorIs(t, target.ImportRollups(ctx, []m.SeriesRollup{wrong}), errors.ErrorRollupStep)
+	require.NoError(t, target.Close(ctx))
+
+	// хранилища без истории пропускают агрегаты
+	assert.ErrorIs(t, NewMemory(col.NewCollector()).ImportRollups(ctx, batch), errors.ErrorHistoryUnavailable)
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/log"
+	"github.com/nmramorov/gowatcher/internal/tsdb"
+)
+
+// Хранилище без БД, дополненное историей gauge и counter во встроенной базе временных рядов.
+// Текущие значения обслуживает вложенное хранилище, историю — база.
+type TSDB struct {
+	Storage
+	DB *tsdb.DB
+}
+
+// Конструктор хранилища с историей поверх вложенного хранилища и открытой базы.
+func NewTSDB(inner Storage, db *tsdb.DB) *TSDB {
+	return &TSDB{Storage: inner, DB: db}
+}
+
+func (s *TSDB) Update(ctx context.Context, metric *m.JSONMetrics) (*m.JSONMetrics, error) {
+	updated, err := s.Storage.Update(ctx, metric)
+	if err != nil {
+		return updated, err
+	}
+	if err = s.record(updated); err != nil {
+		log.ErrorLog.Printf("could not write %s to TSDB: %e", updated.ID, err)
+	}
+	return updated, nil
+}
+
+func (s *TSDB) UpdateBatch(ctx context.Context, batch []*m.JSONMetrics) ([]*m.JSONMetrics, error) {
+	accepted, err := s.Storage.UpdateBatch(ctx, batch)
+	for _, metric := range accepted {
+		if recordErr := s.record(metric); recordErr != nil {
+			log.ErrorLog.Printf("could not write %s to TSDB: %e", metric.ID, recordErr)
+		}
+	}
+	return accepted, err
+}
+
+// Метод, дописывающий в историю итоговое значение gauge или накопленное значение counter.
+func (s *TSDB) record(metric *m.JSONMetrics) error {
+	sampleTime := metric.SampleTime(time.Now())
+	switch {
+	case metric.MType == "gauge" && metric.Value != nil:
+		return s.DB.Append(metric.MType, metric.ID, metric.Labels, sampleTime, *metric.Value)
+	case metric.MType == "counter" && metric.Delta != nil:
+		return s.DB.Append(metric.MType, metric.ID, metric.Labels, sampleTime, float64(*metric.Delta))
+	}
+	return nil
+}
+
+// Метод, читающий историю серии из встроенной базы с шагом step.
+func (s *TSDB) History(
+	ctx context.Context, metric *m.JSONMetrics, from, to time.Time, step time.Duration,
+) ([]m.Point, error) {
+	samples, err := s.DB.Samples(metric.MType, metric.ID, metric.Labels, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return m.Downsample(samples, step), nil
+}
+
+// Метод, сбрасывающий историю на диск и закрывающий вложенное хранилище.
+func (s *TSDB) Close(ctx context.Context) error {
+	if err := s.DB.Close(); err != nil {
+		log.ErrorLog.Printf("could not close TSDB: %e", err)
+		return err
+	}
+	return s.Storage.Close(ctx)
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	col "github.com/nmramorov/gowatcher/internal/collector"
+	m "github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/config"
+)
+
+func TestTSDBHistory(t *testing.T) {
+	ctx := context.Background()
+	options := &config.ServerConfig{TSDBPath: filepath.Join(t.TempDir(), "tsdb")}
+	start := time.Now().Add(-2 * time.Hour).Truncate(time.Hour)
+	delta := int64(2)
+
+	store, err := New(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	reader, ok := store.(HistoryReader)
+	require.True(t, ok)
+	for i := 0; i < 4; i++ {
+		ts := start.Add(time.Duration(i) * 30 * time.Second).UnixMilli()
+		value := float64(i)
+		_, err = store.Update(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge", Value: &value, Timestamp: &ts})
+		require.NoError(t, err)
+		_, err = store.UpdateBatch(ctx, []*m.JSONMetrics{{ID: "PollCount", MType: "counter", Delta: &delta, Timestamp: &ts}})
+		require.NoError(t, err)
+	}
+
+	points, err := reader.History(ctx, &m.JSONMetrics{ID: "Alloc", MType: "gauge"}, start, start.Add(time.Hour), time.Minute)
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, 0.5, points[0].Avg)
+	assert.Equal(t, 3.0, points[1].Last)
+	require.NoError(t, store.Close(ctx))
+
+	reopened, err := New(ctx, options, col.NewCollector())
+	require.NoError(t, err)
+	points, err = reopened.(HistoryReader).History(ctx, &m.JSONMetrics{ID: "PollCount", MType: "counter"},
+		start, start.Add(time.Hour), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, 8.0, points[0].Last)
+	assert.Equal(t, uint64(4), points[0].Count)
+	require.NoError(t, reopened.Close(ctx))
+}
@@ -0,0 +1,262 @@
+// Пакет transfer кодирует выгрузку метрик: текущие значения серий и их историю
+// в формате NDJSON или CSV.
+package transfer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+)
+
+// Форматы выгрузки.
+const (
+	FormatNDJSON = "ndjson" // одна JSON-запись на строку
+	FormatCSV    = "csv"    // строка заголовка и по строке на запись
+)
+
+// Виды записей выгрузки.
+const (
+	KindState   = "state"   // текущее значение серии
+	KindHistory = "history" // сохранённое значение серии в момент Timestamp
+	KindRollup  = "rollup"  // агрегат свёрнутой истории gauge или counter с началом интервала Timestamp
+)
+
+// Колонки CSV. Метки записываются JSON-объектом, значения histogram, summary и set — JSON скетча,
+// значение агрегата свёртки — JSON агрегата.
+var csvHeader = []string{"kind", "type", "id", "labels", "value", "timestamp"}
+
+// Запись выгрузки: серия в формате JSONMetrics и вид записи. У записей KindRollup значение
+// серии не задано, агрегат хранится в Rollup.
+type Record struct {
+	Kind string `json:"kind"`
+	*metrics.JSONMetrics
+	Rollup *metrics.Rollup `json:"rollup,omitempty"`
+}
+
+// Функция, проверяющая формат. Пустой формат соответствует FormatNDJSON.
+func ParseFormat(format string) (string, error) {
+	switch format {
+	case "":
+		return FormatNDJSON, nil
+	case FormatNDJSON, FormatCSV:
+		return format, nil
+	}
+	return "", errors.ErrorTransferFormat
+}
+
+// Кодировщик записей выгрузки в выбранном формате.
+type Writer struct {
+	format  string
+	buffer  *bufio.Writer
+	encoder *json.Encoder
+	csv     *csv.Writer
+	header  bool
+}
+
+// Конструктор кодировщика записей в out.
+func NewWriter(out io.Writer, format string) (*Writer, error) {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	w := &Writer{format: format, buffer: bufio.NewWriter(out)}
+	if format == FormatCSV {
+		w.csv = csv.NewWriter(w.buffer)
+	} else {
+		w.encoder = json.NewEncoder(w.buffer)
+	}
+	return w, nil
+}
+
+// Метод, записывающий запись выгрузки.
+func (w *Writer) Write(record *Record) error {
+	if w.format == FormatNDJSON {
+		return w.encoder.Encode(record)
+	}
+	if !w.header {
+		if err := w.csv.Write(csvHeader); err != nil {
+			return err
+		}
+		w.header = true
+	}
+	value, err := recordValue(record)
+	if err != nil {
+		return err
+	}
+	timestamp := ""
+	if record.Timestamp != nil {
+		timestamp = strconv.FormatInt(*record.Timestamp, 10)
+	}
+	return w.csv.Write([]string{
+		record.Kind, record.MType, record.ID, metrics.LabelsJSON(record.Labels), value, timestamp,
+	})
+}
+
+// Метод, дописывающий буферизованные записи.
+func (w *Writer) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			return err
+		}
+	}
+	return w.buffer.Flush()
+}
+
+// Функция, возвращающая значение записи для колонки value.
+func recordValue(record *Record) (string, error) {
+	if record.Kind != KindRollup {
+		return formatValue(record.JSONMetrics)
+	}
+	if record.Rollup == nil {
+		return "", errors.ErrorMetricValue
+	}
+	data, err := json.Marshal(record.Rollup)
+	return string(data), err
+}
+
+func formatValue(metric *metrics.JSONMetrics) (string, error) {
+	var sketch any
+	switch {
+	case metric.MType == "gauge" && metric.Value != nil:
+		return strconv.FormatFloat(*metric.Value, 'g', -1, 64), nil
+	case metric.MType == "counter" && metric.Delta != nil:
+		return strconv.FormatInt(*metric.Delta, 10), nil
+	case metric.MType == "histogram" && metric.Histogram != nil:
+		sketch = metric.Histogram
+	case metric.MType == "summary" && metric.Summary != nil:
+		sketch = metric.Summary
+	case metric.MType == "set" && metric.Set != nil:
+		sketch = metric.Set
+	default:
+		return "", errors.ErrorMetricValue
+	}
+	data, err := json.Marshal(sketch)
+	return string(data), err
+}
+
+// Функция, читающая записи выгрузки из in и передающая их в fn по одной.
+func Read(in io.Reader, format string, fn func(record *Record) error) error {
+	format, err := ParseFormat(format)
+	if err != nil {
+		return err
+	}
+	if format == FormatCSV {
+		return readCSV(in, fn)
+	}
+	decoder := json.NewDecoder(bufio.NewReader(in))
+	for {
+		record := &Record{}
+		if err = decoder.Decode(record); err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err = checkRecord(record); err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func readCSV(in io.Reader, fn func(record *Record) error) error {
+	reader := csv.NewReader(bufio.NewReader(in))
+	reader.FieldsPerRecord = len(csvHeader)
+	header := true
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header {
+			header = false
+			if row[0] == csvHeader[0] {
+				continue
+			}
+		}
+		record, err := parseRow(row)
+		if err != nil {
+			return err
+		}
+		if err = fn(record); err != nil {
+			return err
+		}
+	}
+}
+
+func parseRow(row []string) (*Record, error) {
+	record := &Record{Kind: row[0], JSONMetrics: &metrics.JSONMetrics{MType: row[1], ID: row[2]}}
+	if row[3] != "" && row[3] != "{}" {
+		if err := json.Unmarshal([]byte(row[3]), &record.Labels); err != nil {
+			return nil, errors.ErrorTransferRecord
+		}
+	}
+	if row[5] != "" {
+		timestamp, err := strconv.ParseInt(row[5], 10, 64)
+		if err != nil {
+			return nil, errors.ErrorTransferRecord
+		}
+		record.Timestamp = &timestamp
+	}
+	var err error
+	switch {
+	case record.Kind == KindRollup:
+		record.Rollup = &metrics.Rollup{}
+		err = json.Unmarshal([]byte(row[4]), record.Rollup)
+	case record.MType == "gauge":
+		var value float64
+		value, err = strconv.ParseFloat(row[4], 64)
+		record.Value = &value
+	case record.MType == "counter":
+		var delta int64
+		delta, err = strconv.ParseInt(row[4], 10, 64)
+		record.Delta = &delta
+	case record.MType == "histogram":
+		record.Histogram = &metrics.Histogram{}
+		err = json.Unmarshal([]byte(row[4]), record.Histogram)
+	case record.MType == "summary":
+		record.Summary = &metrics.Summary{}
+		err = json.Unmarshal([]byte(row[4]), record.Summary)
+	case record.MType == "set":
+		record.Set = &metrics.Set{}
+		err = json.Unmarshal([]byte(row[4]), record.Set)
+	}
+	if err != nil {
+		return nil, errors.ErrorTransferRecord
+	}
+	return record, checkRecord(record)
+}
+
+// Функция, проверяющая вид записи и наличие значения её типа. Агрегат свёртки должен относиться
+// к gauge или counter и иметь положительное разрешение.
+func checkRecord(record *Record) error {
+	if record.JSONMetrics == nil {
+		return errors.ErrorTransferRecord
+	}
+	switch record.Kind {
+	case KindState, KindHistory:
+	case KindRollup:
+		if record.Rollup == nil || record.Rollup.Step <= 0 || record.Timestamp == nil ||
+			(record.MType != "gauge" && record.MType != "counter") {
+			return errors.ErrorTransferRecord
+		}
+		return nil
+	default:
+		return errors.ErrorTransferRecord
+	}
+	if _, err := formatValue(record.JSONMetrics); err != nil {
+		return errors.ErrorTransferRecord
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package transfer
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testRecords() []*Record {
+	value, delta, timestamp := 2.5, int64(42), int64(1700000000000)
+	histogram := metrics.NewHistogram([]float64{1, 10})
+	histogram.Observe(3)
+	return []*Record{
+		{Kind: KindState, JSONMetrics: &metrics.JSONMetrics{ID: "Alloc", MType: "gauge", Value: &value}},
+		{Kind: KindState, JSONMetrics: &metrics.JSONMetrics{
+			ID: "Requests", MType: "counter", Delta: &delta, Labels: map[string]string{"path": "/a,b"},
+		}},
+		{Kind: KindState, JSONMetrics: &metrics.JSONMetrics{ID: "Latency", MType: "histogram", Histogram: histogram}},
+		{Kind: KindHistory, JSONMetrics: &metrics.JSONMetrics{
+			ID: "Requests", MType: "counter", Delta: &delta, Labels: map[string]string{"path": "/a,b"}, Timestamp: &timestamp,
+		}},
+		{
+			Kind:        KindRollup,
+			JSONMetrics: &metrics.JSONMetrics{ID: "Alloc", MType: "gauge", Timestamp: &timestamp},
+			Rollup: &metrics.Rollup{Step: 60000, Point: metrics.Point{
+				Timestamp: timestamp, Avg: 2, Min: 1, Max: 3, Last: 2.5, Count: 4,
+			}},
+		},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, format := range []string{FormatNDJSON, FormatCSV} {
+		var buffer bytes.Buffer
+		writer, err := NewWriter(&buffer, format)
+		require.NoError(t, err)
+		for _, record := range testRecords() {
+			require.NoError(t, writer.Write(record))
+		}
+		require.NoError(t, writer.Flush())
+
+		read := make([]*Record, 0)
+		require.NoError(t, Read(&buffer, format, func(record *Record) error {
+			read = append(read, record)
+			return nil
+		}), format)
+		assert.Equal(t, testRecords(), read, format)
+	}
+}
+
+func TestReadWrongRecords(t *testing.T) {
+	_, err := NewWriter(&bytes.Buffer{}, "xml")
+	assert.ErrorIs(t, err, errors.ErrorTransferFormat)
+
+	noop := func(*Record) error { return nil }
+	err = Read(strings.NewReader(`{"kind":"state","id":"Alloc","type":"gauge"}`+"\n"), FormatNDJSON, noop)
+	assert.ErrorIs(t, err, errors.ErrorTransferRecord)
+	err = Read(strings.NewReader("kind,type,id,labels,value,timestamp\nstate,counter,Requests,{},1.5,\n"), FormatCSV, noop)
+	assert.ErrorIs(t, err, errors.ErrorTransferRecord)
+	err = Read(strings.NewReader(`{"kind":"rollup","id":"Alloc","type":"gauge","timestamp":1,"rollup":{"step":0}}`+"\n"),
+		FormatNDJSON, noop)
+	assert.ErrorIs(t, err, errors.ErrorTransferRecord)
+}
@@ -0,0 +1,154 @@
+package tsdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/nmramorov/gowatcher/internal/file"
+)
+
+// Сигнатура файла блока.
+var blockMagic = []byte("GWTSDB1\n")
+
+// Описание блока на диске: неизменяемого файла с чанками серий за интервал [MinT, MaxT].
+type blockMeta struct {
+	id         uint64
+	path       string
+	minT, maxT int64
+}
+
+// Функция, возвращающая имя файла блока: границы интервала и порядковый номер.
+func blockName(id uint64, minT, maxT int64) string {
+	return fmt.Sprintf("%d-%d-%d.block", minT, maxT, id)
+}
+
+// Функция, разбирающая имя файла блока.
+func parseBlockName(dir, name string) (blockMeta, bool) {
+	meta := blockMeta{path: filepath.Join(dir, name)}
+	if _, err := fmt.Sscanf(name, "%d-%d-%d.block", &meta.minT, &meta.maxT, &meta.id); err != nil {
+		return meta, false
+	}
+	return meta, name == blockName(meta.id, meta.minT, meta.maxT)
+}
+
+// Функция, атомарно записывающая блок с чанками серий в каталог dir.
+// Формат: сигнатура, число серий, для каждой серии ключ и её чанки
+// (границы, число значений и байты), в конце CRC32 всего предшествующего содержимого.
+func writeBlock(dir string, id uint64, series map[string][]*Chunk) (blockMeta, error) {
+	keys := make([]string, 0, len(series))
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	meta := blockMeta{id: id}
+	first := true
+	var buffer bytes.Buffer
+	buffer.Write(blockMagic)
+	scratch := make([]byte, binary.MaxVarintLen64)
+	putUvarint := func(x uint64) { buffer.Write(scratch[:binary.PutUvarint(scratch, x)]) }
+	putVarint := func(x int64) { buffer.Write(scratch[:binary.PutVarint(scratch, x)]) }
+	putUvarint(uint64(len(keys)))
+	for _, key := range keys {
+		putUvarint(uint64(len(key)))
+		buffer.WriteString(key)
+		putUvarint(uint64(len(series[key])))
+		for _, chunk := range series[key] {
+			putVarint(chunk.MinTime())
+			putVarint(chunk.MaxTime())
+			putUvarint(uint64(chunk.Len()))
+			putUvarint(uint64(len(chunk.Bytes())))
+			buffer.Write(chunk.Bytes())
+			if first || chunk.MinTime() < meta.minT {
+				meta.minT = chunk.MinTime()
+			}
+			if first || chunk.MaxTime() > meta.maxT {
+				meta.maxT = chunk.MaxTime()
+			}
+			first = false
+		}
+	}
+	checksum := make([]byte, 4)
+	binary.BigEndian.PutUint32(checksum, crc32.ChecksumIEEE(buffer.Bytes()))
+	buffer.Write(checksum)
+
+	meta.path = filepath.Join(dir, blockName(id, meta.minT, meta.maxT))
+	tmp := meta.path + ".tmp"
+	if err := file.WriteSynced(tmp, buffer.Bytes()); err != nil {
+		return meta, err
+	}
+	if err := os.Rename(tmp, meta.path); err != nil {
+		return meta, err
+	}
+	return meta, file.SyncDir(dir)
+}
+
+// Функция, читающая чанки серий блока. Содержимое проверяется по контрольной сумме.
+func readBlock(path string) (map[string][]*Chunk, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < len(blockMagic)+4 || !bytes.HasPrefix(data, blockMagic) {
+		return nil, errors.ErrorTSDBBlock
+	}
+	body := data[:len(data)-4]
+	if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(data[len(data)-4:]) {
+		return nil, errors.ErrorTSDBBlock
+	}
+	reader := bytes.NewReader(body[len(blockMagic):])
+	count, err := binary.ReadUvarint(reader)
+	if err != nil {
+		return nil, errors.ErrorTSDBBlock
+	}
+	series := make(map[string][]*Chunk, count)
+	for i := uint64(0); i < count; i++ {
+		key, err := readBytes(reader)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, errors.ErrorTSDBBlock
+		}
+		for j := uint64(0); j < chunks; j++ {
+			minT, err := binary.ReadVarint(reader)
+			if err != nil {
+				return nil, errors.ErrorTSDBBlock
+			}
+			maxT, err := binary.ReadVarint(reader)
+			if err != nil {
+				return nil, errors.ErrorTSDBBlock
+			}
+			n, err := binary.ReadUvarint(reader)
+			if err != nil {
+				return nil, errors.ErrorTSDBBlock
+			}
+			data, err := readBytes(reader)
+			if err != nil {
+				return nil, err
+			}
+			series[string(key)] = append(series[string(key)], decodeChunk(data, int(n), minT, maxT))
+		}
+	}
+	return series, nil
+}
+
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	size, err := binary.ReadUvarint(reader)
+	if err != nil || size > uint64(reader.Len()) {
+		return nil, errors.ErrorTSDBBlock
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return nil, errors.ErrorTSDBBlock
+	}
+	return data, nil
+}
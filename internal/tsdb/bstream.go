@@ -0,0 +1,57 @@
+package tsdb
+
+import "io"
+
+// Поток битов для записи чанка. Биты заполняют байты от старшего к младшему.
+type bstream struct {
+	stream []byte
+	free   uint8 // число свободных битов в последнем байте
+}
+
+func (b *bstream) writeBit(bit bool) {
+	if b.free == 0 {
+		b.stream = append(b.stream, 0)
+		b.free = 8
+	}
+	if bit {
+		b.stream[len(b.stream)-1] |= 1 << (b.free - 1)
+	}
+	b.free--
+}
+
+// Метод, записывающий nbits младших битов u, начиная со старшего из них.
+func (b *bstream) writeBits(u uint64, nbits int) {
+	for i := nbits - 1; i >= 0; i-- {
+		b.writeBit(u>>uint(i)&1 == 1)
+	}
+}
+
+// Поток битов для чтения чанка.
+type bitReader struct {
+	stream []byte
+	pos    int // номер следующего бита
+}
+
+func (r *bitReader) readBit() (bool, error) {
+	if r.pos >= len(r.stream)*8 {
+		return false, io.ErrUnexpectedEOF
+	}
+	bit := r.stream[r.pos/8]>>(7-uint(r.pos%8))&1 == 1
+	r.pos++
+	return bit, nil
+}
+
+func (r *bitReader) readBits(nbits int) (uint64, error) {
+	var u uint64
+	for i := 0; i < nbits; i++ {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		u <<= 1
+		if bit {
+			u |= 1
+		}
+	}
+	return u, nil
+}
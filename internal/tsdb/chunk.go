@@ -0,0 +1,221 @@
+package tsdb
+
+import (
+	"math"
+	"math/bits"
+)
+
+// Диапазоны разности разностей меток времени и число битов, которым она кодируется
+// после соответствующего префикса: 0, 10, 110, 1110 и 1111 для остальных значений.
+var dodBuckets = []struct {
+	prefix, prefixBits uint64
+	bits               int
+}{
+	{prefix: 0b10, prefixBits: 2, bits: 7},
+	{prefix: 0b110, prefixBits: 3, bits: 9},
+	{prefix: 0b1110, prefixBits: 4, bits: 12},
+}
+
+// Чанк значений одной серии, сжатый по схеме Gorilla: метки времени в миллисекундах кодируются
+// разностью разностей, значения — XOR с предыдущим значением.
+type Chunk struct {
+	b          bstream
+	n          int
+	minT, maxT int64
+
+	// состояние кодера
+	t        int64
+	tDelta   int64
+	v        uint64
+	leading  uint8
+	trailing uint8
+}
+
+// Конструктор пустого чанка.
+func NewChunk() *Chunk {
+	return &Chunk{leading: math.MaxUint8}
+}
+
+// Функция, восстанавливающая чанк из закодированных байтов для чтения.
+func decodeChunk(data []byte, n int, minT, maxT int64) *Chunk {
+	return &Chunk{b: bstream{stream: data}, n: n, minT: minT, maxT: maxT}
+}
+
+// Число значений в чанке.
+func (c *Chunk) Len() int {
+	return c.n
+}
+
+// Наименьшая и наибольшая метки времени чанка в миллисекундах.
+func (c *Chunk) MinTime() int64 { return c.minT }
+func (c *Chunk) MaxTime() int64 { return c.maxT }
+
+// Закодированное содержимое чанка.
+func (c *Chunk) Bytes() []byte {
+	return c.b.stream
+}
+
+// Метод, дописывающий значение v в момент t (миллисекунды Unix).
+func (c *Chunk) Append(t int64, v float64) {
+	vbits := math.Float64bits(v)
+	if c.n == 0 {
+		c.b.writeBits(uint64(t), 64)
+		c.b.writeBits(vbits, 64)
+		c.minT, c.maxT = t, t
+	} else {
+		delta := t - c.t
+		c.writeDod(delta - c.tDelta)
+		c.tDelta = delta
+		c.writeXOR(vbits)
+	}
+	if t < c.minT {
+		c.minT = t
+	}
+	if t > c.maxT {
+		c.maxT = t
+	}
+	c.t, c.v = t, vbits
+	c.n++
+}
+
+func (c *Chunk) writeDod(dod int64) {
+	if dod == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	for _, bucket := range dodBuckets {
+		if fitsBits(dod, bucket.bits) {
+			c.b.writeBits(bucket.prefix, int(bucket.prefixBits))
+			c.b.writeBits(uint64(dod), bucket.bits)
+			return
+		}
+	}
+	c.b.writeBits(0b1111, 4)
+	c.b.writeBits(uint64(dod), 64)
+}
+
+// Функция, проверяющая, что x представимо nbits битами в кодировке чанка.
+func fitsBits(x int64, nbits int) bool {
+	return -((1<<(nbits-1))-1) <= x && x <= 1<<(nbits-1)
+}
+
+func (c *Chunk) writeXOR(vbits uint64) {
+	xor := vbits ^ c.v
+	if xor == 0 {
+		c.b.writeBit(false)
+		return
+	}
+	c.b.writeBit(true)
+	leading := uint8(bits.LeadingZeros64(xor))
+	trailing := uint8(bits.TrailingZeros64(xor))
+	// число ведущих нулей кодируется пятью битами
+	if leading > 31 {
+		leading = 31
+	}
+	if c.leading != math.MaxUint8 && leading >= c.leading && trailing >= c.trailing {
+		c.b.writeBit(false)
+		c.b.writeBits(xor>>c.trailing, 64-int(c.leading)-int(c.trailing))
+		return
+	}
+	c.leading, c.trailing = leading, trailing
+	c.b.writeBit(true)
+	c.b.writeBits(uint64(leading), 5)
+	// 64 значащих бита не помещаются в шесть битов и записываются как 0
+	sigbits := 64 - leading - trailing
+	c.b.writeBits(uint64(sigbits), 6)
+	c.b.writeBits(xor>>trailing, int(sigbits))
+}
+
+// Метод, передающий значения чанка в fn в порядке записи.
+func (c *Chunk) Iterate(fn func(t int64, v float64)) error {
+	r := &bitReader{stream: c.b.stream}
+	var t, tDelta int64
+	var v uint64
+	var leading, trailing uint8
+	for i := 0; i < c.n; i++ {
+		switch i {
+		case 0:
+			first, err := r.readBits(64)
+			if err != nil {
+				return err
+			}
+			if v, err = r.readBits(64); err != nil {
+				return err
+			}
+			t = int64(first)
+		default:
+			dod, err := readDod(r)
+			if err != nil {
+				return err
+			}
+			tDelta += dod
+			t += tDelta
+			if v, leading, trailing, err = readXOR(r, v, leading, trailing); err != nil {
+				return err
+			}
+		}
+		fn(t, math.Float64frombits(v))
+	}
+	return nil
+}
+
+func readDod(r *bitReader) (int64, error) {
+	// число единиц префикса: 0 — нулевая разность, 1–3 — корзины dodBuckets, 4 — полные 64 бита
+	ones := 0
+	for ones < 4 {
+		bit, err := r.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if !bit {
+			break
+		}
+		ones++
+	}
+	switch ones {
+	case 0:
+		return 0, nil
+	case 4:
+		u, err := r.readBits(64)
+		return int64(u), err
+	}
+	nbits := dodBuckets[ones-1].bits
+	u, err := r.readBits(nbits)
+	if err != nil {
+		return 0, err
+	}
+	dod := int64(u)
+	if u > 1<<(nbits-1) {
+		dod -= 1 << nbits
+	}
+	return dod, nil
+}
+
+func readXOR(r *bitReader, v uint64, leading, trailing uint8) (uint64, uint8, uint8, error) {
+	bit, err := r.readBit()
+	if err != nil || !bit {
+		return v, leading, trailing, err
+	}
+	if bit, err = r.readBit(); err != nil {
+		return v, leading, trailing, err
+	}
+	if bit {
+		l, err := r.readBits(5)
+		if err != nil {
+			return v, leading, trailing, err
+		}
+		sigbits, err := r.readBits(6)
+		if err != nil {
+			return v, leading, trailing, err
+		}
+		if sigbits == 0 {
+			sigbits = 64
+		}
+		leading, trailing = uint8(l), uint8(64-l-sigbits)
+	}
+	xor, err := r.readBits(64 - int(leading) - int(trailing))
+	if err != nil {
+		return v, leading, trailing, err
+	}
+	return v ^ xor<<trailing, leading, trailing, nil
+}
@@ -0,0 +1,53 @@
+package tsdb
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkRoundTrip(t *testing.T) {
+	type sample struct {
+		t int64
+		v float64
+	}
+	samples := []sample{
+		{t: 1700000000000, v: 12.5},
+		{t: 1700000010000, v: 12.5},
+		{t: 1700000020000, v: 12.75},
+		{t: 1700000030001, v: -3},
+		{t: 1700000029000, v: 1e300},
+		{t: 1700000329000, v: math.Inf(1)},
+		{t: 1700100329000, v: 0},
+		{t: 1700100339000, v: 42},
+		{t: 1700100349000, v: 42.000001},
+	}
+	chunk := NewChunk()
+	for _, s := range samples {
+		chunk.Append(s.t, s.v)
+	}
+	assert.Equal(t, len(samples), chunk.Len())
+	assert.Equal(t, int64(1700000000000), chunk.MinTime())
+	assert.Equal(t, int64(1700100349000), chunk.MaxTime())
+
+	decoded := make([]sample, 0)
+	restored := decodeChunk(chunk.Bytes(), chunk.Len(), chunk.MinTime(), chunk.MaxTime())
+	require.NoError(t, restored.Iterate(func(t int64, v float64) {
+		decoded = append(decoded, sample{t: t, v: v})
+	}))
+	assert.Equal(t, samples, decoded)
+}
+
+func TestChunkCompression(t *testing.T) {
+	chunk := NewChunk()
+	for i := 0; i < ChunkSamples; i++ {
+		chunk.Append(1700000000000+int64(i)*10000, 100+float64(i%4))
+	}
+	// регулярные метки времени и близкие значения занимают в разы меньше 16 байт на значение
+	assert.Less(t, len(chunk.Bytes()), ChunkSamples*4)
+
+	truncated := decodeChunk(chunk.Bytes()[:20], chunk.Len(), chunk.MinTime(), chunk.MaxTime())
+	assert.Error(t, truncated.Iterate(func(t int64, v float64) {}))
+}
@@ -0,0 +1,385 @@
+package tsdb
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/collector/metrics"
+	"github.com/nmramorov/gowatcher/internal/file"
+	"github.com/nmramorov/gowatcher/internal/log"
+)
+
+var (
+	// Число значений, после которого открытый чанк серии закрывается и начинается новый.
+	ChunkSamples = 120
+	// Период сброса чанков из памяти в блок на диске, уплотнения и очистки.
+	// Значения в памяти до сброса восстанавливаются из журнала головы при следующем открытии.
+	FlushInterval = 5 * time.Minute
+	// Интервал, блоки которого после его окончания уплотняются в один.
+	CompactWindow = 24 * time.Hour
+)
+
+// Имя журнала головы: значений, ещё не сброшенных из памяти в блок.
+const headWAL = "head.wal"
+
+// Встроенная база временных рядов. Новые значения копятся в сжатых чанках в памяти
+// и периодически сбрасываются в неизменяемые блоки на диске. До сброса каждое значение
+// дописывается в журнал головы, поэтому сбой процесса их не теряет; на диск журнал сбрасывается
+// вместе с блоком, и при отказе питания теряются значения не более чем за FlushInterval.
+// Блоки закончившегося интервала CompactWindow уплотняются в один, значения старше срока хранения удаляются.
+type DB struct {
+	dir       string
+	retention time.Duration
+	// mu защищает серии в памяти, журнал головы, список блоков и удаление их файлов
+	mu     sync.RWMutex
+	series map[string][]*Chunk
+	wal    *file.WAL
+	blocks []blockMeta
+	nextID uint64
+	// compactMu не даёт двум уплотнениям выполняться одновременно
+	compactMu sync.Mutex
+	done      chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Функция, открывающая базу в каталоге dir. Значения старше retention удаляются; ноль — хранить всегда.
+// Недописанные при сбое временные файлы удаляются, значения из журнала головы сбрасываются в блок.
+func Open(dir string, retention time.Duration) (*DB, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	db := &DB{dir: dir, retention: retention, series: make(map[string][]*Chunk), nextID: 1}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasSuffix(name, ".tmp") {
+			if err = os.Remove(filepath.Join(dir, name)); err != nil {
+				log.ErrorLog.Printf("could not remove unfinished TSDB block %s: %e", name, err)
+			}
+			continue
+		}
+		meta, ok := parseBlockName(dir, name)
+		if !ok {
+			continue
+		}
+		db.blocks = append(db.blocks, meta)
+		if meta.id >= db.nextID {
+			db.nextID = meta.id + 1
+		}
+	}
+	db.sortBlocks()
+	if err = db.openHead(); err != nil {
+		log.ErrorLog.Printf("could not restore TSDB head: %e", err)
+		return nil, err
+	}
+	return db, nil
+}
+
+// Метод, восстанавливающий значения из журнала головы и сразу сбрасывающий их в блок: так журнал
+// очищается, и недописанная при сбое последняя запись не мешает дописывать новые.
+func (db *DB) openHead() error {
+	path := filepath.Join(db.dir, headWAL)
+	seq, err := file.ReplayWAL(path, 0, func(record *file.Record) {
+		for _, sample := range record.Metrics {
+			if sample.Value != nil && sample.Timestamp != nil {
+				db.appendHead(seriesKey(sample.MType, sample.ID, sample.Labels), *sample.Timestamp, *sample.Value)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if db.wal, err = file.OpenWAL(path, seq); err != nil {
+		return err
+	}
+	return db.Flush(time.Now())
+}
+
+func (db *DB) sortBlocks() {
+	sort.Slice(db.blocks, func(i, j int) bool {
+		return db.blocks[i].minT < db.blocks[j].minT
+	})
+}
+
+// Функция, возвращающая ключ серии: тип, имя и метки в каноническом JSON.
+func seriesKey(mtype, id string, labels map[string]string) string {
+	return mtype + "\x00" + id + "\x00" + metrics.LabelsJSON(labels)
+}
+
+// Метод, дописывающий значение серии в журнал головы и в открытый чанк в памяти.
+func (db *DB) Append(mtype, id string, labels map[string]string, t time.Time, value float64) error {
+	timestamp := t.UnixMilli()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if _, err := db.wal.Append([]*metrics.JSONMetrics{
+		{ID: id, MType: mtype, Labels: labels, Value: &value, Timestamp: &timestamp},
+	}); err != nil {
+		return err
+	}
+	db.appendHead(seriesKey(mtype, id, labels), timestamp, value)
+	return nil
+}
+
+func (db *DB) appendHead(key string, t int64, value float64) {
+	chunks := db.series[key]
+	if len(chunks) == 0 || chunks[len(chunks)-1].Len() >= ChunkSamples {
+		chunks = append(chunks, NewChunk())
+		db.series[key] = chunks
+	}
+	chunks[len(chunks)-1].Append(t, value)
+}
+
+// Метод, возвращающий упорядоченные по времени значения серии за полуинтервал [from, to)
+// из памяти и блоков на диске. Метки серии должны совпадать точно.
+func (db *DB) Samples(mtype, id string, labels map[string]string, from, to time.Time) ([]metrics.Sample, error) {
+	key := seriesKey(mtype, id, labels)
+	minT, maxT := from.UnixMilli(), to.UnixMilli()
+	samples := make([]metrics.Sample, 0)
+	collect := func(chunks []*Chunk) error {
+		for _, chunk := range chunks {
+			if chunk.MaxTime() < minT || chunk.MinTime() >= maxT {
+				continue
+			}
+			if err := chunk.Iterate(func(t int64, v float64) {
+				if t >= minT && t < maxT {
+					samples = append(samples, metrics.Sample{Time: time.UnixMilli(t).UTC(), Value: v})
+				}
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	for _, block := range db.blocks {
+		if block.maxT < minT || block.minT >= maxT {
+			continue
+		}
+		series, err := readBlock(block.path)
+		if err != nil {
+			log.ErrorLog.Printf("could not read TSDB block %s: %e", block.path, err)
+			return nil, err
+		}
+		if err = collect(series[key]); err != nil {
+			return nil, err
+		}
+	}
+	if err := collect(db.series[key]); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Time.Before(samples[j].Time)
+	})
+	return samples, nil
+}
+
+// Метод, сбрасывающий все чанки из памяти в новый блок на диске и очищающий журнал головы.
+// Чанки значений старше срока хранения отбрасываются.
+func (db *DB) Flush(now time.Time) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	cutoff := db.cutoff(now)
+	series := make(map[string][]*Chunk, len(db.series))
+	for key, chunks := range db.series {
+		for _, chunk := range chunks {
+			if chunk.Len() > 0 && chunk.MaxTime() >= cutoff {
+				series[key] = append(series[key], chunk)
+			}
+		}
+	}
+	if len(series) > 0 {
+		meta, err := writeBlock(db.dir, db.nextID, series)
+		if err != nil {
+			log.ErrorLog.Printf("could not write TSDB block: %e", err)
+			return err
+		}
+		db.nextID++
+		db.blocks = append(db.blocks, meta)
+		db.sortBlocks()
+	}
+	db.series = make(map[string][]*Chunk)
+	if err := db.wal.Reset(); err != nil {
+		log.ErrorLog.Printf("could not reset TSDB head WAL: %e", err)
+		return err
+	}
+	return nil
+}
+
+// Метод, возвращающий наименьшую хранимую метку времени в миллисекундах.
+func (db *DB) cutoff(now time.Time) int64 {
+	if db.retention <= 0 {
+		return 0
+	}
+	return now.Add(-db.retention).UnixMilli()
+}
+
+// Метод, удаляющий блоки старше срока хранения и уплотняющий блоки каждого закончившегося
+// интервала CompactWindow в один блок. При уплотнении значения серии перекодируются
+// в полные чанки, значения старше срока хранения отбрасываются.
+func (db *DB) Compact(now time.Time) error {
+	db.compactMu.Lock()
+	defer db.compactMu.Unlock()
+
+	db.mu.RLock()
+	cutoff := db.cutoff(now)
+	windows := make(map[int64][]blockMeta)
+	expired := make([]blockMeta, 0)
+	for _, block := range db.blocks {
+		if block.maxT < cutoff {
+			expired = append(expired, block)
+			continue
+		}
+		window := block.minT / CompactWindow.Milliseconds()
+		if (window+1)*CompactWindow.Milliseconds() <= now.UnixMilli() {
+			windows[window] = append(windows[window], block)
+		}
+	}
+	db.mu.RUnlock()
+
+	if err := db.replace(expired, nil); err != nil {
+		return err
+	}
+	for _, blocks := range windows {
+		if len(blocks) < 2 && blocks[0].minT >= cutoff {
+			continue
+		}
+		merged, err := db.merge(blocks, cutoff)
+		if err != nil {
+			log.ErrorLog.Printf("could not compact TSDB blocks: %e", err)
+			return err
+		}
+		if err = db.replace(blocks, merged); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Метод, объединяющий значения серий блоков в новый блок. Возвращает nil, если значений не осталось.
+func (db *DB) merge(blocks []blockMeta, cutoff int64) (*blockMeta, error) {
+	type sample struct {
+		t int64
+		v float64
+	}
+	values := make(map[string][]sample)
+	for _, block := range blocks {
+		series, err := readBlock(block.path)
+		if err != nil {
+			return nil, err
+		}
+		for key, chunks := range series {
+			for _, chunk := range chunks {
+				if err = chunk.Iterate(func(t int64, v float64) {
+					if t >= cutoff {
+						values[key] = append(values[key], sample{t: t, v: v})
+					}
+				}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	series := make(map[string][]*Chunk, len(values))
+	for key, samples := range values {
+		sort.SliceStable(samples, func(i, j int) bool { return samples[i].t < samples[j].t })
+		for i, s := range samples {
+			if i%ChunkSamples == 0 {
+				series[key] = append(series[key], NewChunk())
+			}
+			series[key][len(series[key])-1].Append(s.t, s.v)
+		}
+	}
+	if len(series) == 0 {
+		return nil, nil
+	}
+	db.mu.Lock()
+	id := db.nextID
+	db.nextID++
+	db.mu.Unlock()
+	meta, err := writeBlock(db.dir, id, series)
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+// Метод, заменяющий блоки old блоком merged и удаляющий их файлы.
+func (db *DB) replace(old []blockMeta, merged *blockMeta) error {
+	if len(old) == 0 && merged == nil {
+		return nil
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	removed := make(map[uint64]bool, len(old))
+	for _, block := range old {
+		removed[block.id] = true
+	}
+	blocks := make([]blockMeta, 0, len(db.blocks))
+	for _, block := range db.blocks {
+		if !removed[block.id] {
+			blocks = append(blocks, block)
+		}
+	}
+	if merged != nil {
+		blocks = append(blocks, *merged)
+	}
+	db.blocks = blocks
+	db.sortBlocks()
+	for _, block := range old {
+		if err := os.Remove(block.path); err != nil && !os.IsNotExist(err) {
+			log.ErrorLog.Printf("could not remove TSDB block %s: %e", block.path, err)
+			return err
+		}
+	}
+	return file.SyncDir(db.dir)
+}
+
+// Метод, запускающий фоновые сброс, уплотнение и очистку с периодом FlushInterval.
+func (db *DB) Start() {
+	db.done = make(chan struct{})
+	db.wg.Add(1)
+	go db.run()
+}
+
+func (db *DB) run() {
+	defer db.wg.Done()
+	ticker := time.NewTicker(FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-db.done:
+			log.InfoLog.Println("Stop TSDB maintenance")
+			return
+		case <-ticker.C:
+			now := time.Now()
+			if err := db.Flush(now); err != nil {
+				log.ErrorLog.Printf("error flushing TSDB: %e", err)
+			}
+			if err := db.Compact(now); err != nil {
+				log.ErrorLog.Printf("error compacting TSDB: %e", err)
+			}
+		}
+	}
+}
+
+// Метод, останавливающий фоновые задачи, сбрасывающий значения из памяти на диск и закрывающий журнал головы.
+func (db *DB) Close() error {
+	if db.done != nil {
+		close(db.done)
+		db.wg.Wait()
+	}
+	if err := db.Flush(time.Now()); err != nil {
+		return err
+	}
+	return db.wal.Close()
+}
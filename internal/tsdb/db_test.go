@@ -0,0 +1,140 @@
+package tsdb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/nmramorov/gowatcher/internal/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDBFlushAndReopen(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	labels := map[string]string{"host": "a"}
+
+	db, err := Open(dir, 0)
+	require.NoError(t, err)
+	for i := 0; i < 300; i++ {
+		db.Append("gauge", "Alloc", labels, start.Add(time.Duration(i)*time.Second), float64(i))
+	}
+	db.Append("gauge", "Alloc", nil, start, -1)
+
+	samples, err := db.Samples("gauge", "Alloc", labels, start.Add(10*time.Second), start.Add(20*time.Second))
+	require.NoError(t, err)
+	require.Len(t, samples, 10)
+	assert.Equal(t, 10.0, samples[0].Value)
+	assert.Equal(t, start.Add(19*time.Second), samples[9].Time)
+
+	require.NoError(t, db.Flush(start))
+	db.Append("gauge", "Alloc", labels, start.Add(300*time.Second), 300)
+	require.NoError(t, db.Close())
+
+	reopened, err := Open(dir, 0)
+	require.NoError(t, err)
+	assert.Len(t, reopened.blocks, 2)
+	samples, err = reopened.Samples("gauge", "Alloc", labels, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 301)
+	assert.Equal(t, 300.0, samples[300].Value)
+	samples, err = reopened.Samples("gauge", "Alloc", nil, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+	assert.Equal(t, -1.0, samples[0].Value)
+}
+
+func TestDBCompactAndRetention(t *testing.T) {
+	dir := t.TempDir()
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	db, err := Open(dir, 48*time.Hour)
+	require.NoError(t, err)
+	for d := 0; d < 3; d++ {
+		for h := 0; h < 4; h++ {
+			db.Append("counter", "PollCount", nil, day.AddDate(0, 0, d).Add(time.Duration(h)*time.Hour), float64(d*10+h))
+			require.NoError(t, db.Flush(day))
+		}
+	}
+	require.Len(t, db.blocks, 12)
+
+	// первый день старше срока хранения, второй закончился и уплотняется, третий ещё идёт
+	now := day.AddDate(0, 0, 2).Add(12 * time.Hour)
+	require.NoError(t, db.Compact(now))
+	assert.Len(t, db.blocks, 5)
+	samples, err := db.Samples("counter", "PollCount", nil, day, now)
+	require.NoError(t, err)
+	require.Len(t, samples, 8)
+	assert.Equal(t, 10.0, samples[0].Value)
+	assert.Equal(t, 23.0, samples[7].Value)
+
+	// пять блоков и журнал головы
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Len(t, entries, 6)
+}
+
+func TestDBHeadWAL(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	labels := map[string]string{"host": "a"}
+	db, err := Open(dir, 0)
+	require.NoError(t, err)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Append("gauge", "Alloc", labels, start.Add(time.Duration(i)*time.Second), float64(i)))
+	}
+	require.NoError(t, db.Append("counter", "PollCount", nil, start, 5))
+
+	// сбой процесса до сброса: значения головы есть только в журнале, последняя запись недописана
+	require.NoError(t, db.wal.Close())
+	head, err := os.OpenFile(filepath.Join(dir, headWAL), os.O_WRONLY|os.O_APPEND, 0o666)
+	require.NoError(t, err)
+	_, err = head.WriteString(`{"seq":5,"metrics":[{"id":"Al`)
+	require.NoError(t, err)
+	require.NoError(t, head.Close())
+
+	reopened, err := Open(dir, 0)
+	require.NoError(t, err)
+	assert.Len(t, reopened.blocks, 1)
+	samples, err := reopened.Samples("gauge", "Alloc", labels, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, samples, 3)
+	assert.Equal(t, 2.0, samples[2].Value)
+	samples, err = reopened.Samples("counter", "PollCount", nil, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, samples, 1)
+
+	// журнал очищен при открытии: новые значения не теряются и старые не повторяются
+	require.NoError(t, reopened.Append("gauge", "Alloc", labels, start.Add(3*time.Second), 3))
+	require.NoError(t, reopened.wal.Close())
+	reopened, err = Open(dir, 0)
+	require.NoError(t, err)
+	samples, err = reopened.Samples("gauge", "Alloc", labels, start, start.Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, samples, 4)
+	assert.Equal(t, 3.0, samples[3].Value)
+	require.NoError(t, reopened.Close())
+}
+
+func TestDBCorruptBlock(t *testing.T) {
+	dir := t.TempDir()
+	start := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	db, err := Open(dir, 0)
+	require.NoError(t, err)
+	db.Append("gauge", "Alloc", nil, start, 1)
+	require.NoError(t, db.Flush(start))
+
+	path := db.blocks[0].path
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	data[len(blockMagic)+2] ^= 0xff
+	require.NoError(t, os.WriteFile(path, data, 0o666))
+	_, err = db.Samples("gauge", "Alloc", nil, start, start.Add(time.Minute))
+	assert.ErrorIs(t, err, errors.ErrorTSDBBlock)
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "1-2-3.block.tmp"), data, 0o666))
+	_, err = Open(dir, 0)
+	require.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, "1-2-3.block.tmp"))
+}